@@ -0,0 +1,240 @@
+// bulk imports users and ratings into, and exports them from, the usersms
+// database in CSV or JSON Lines format.
+//
+// Usage:
+//
+//	bulk [-conf file] import -kind users|ratings [flags] file
+//	bulk [-conf file] export -kind users|ratings [flags] file
+//
+// Use - as the file to read from stdin or write to stdout. Run a command with
+// -help for its flags.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/bootstrap"
+	"github.com/tomogoma/usersms/pkg/bulk"
+	"github.com/tomogoma/usersms/pkg/config"
+	"github.com/tomogoma/usersms/pkg/logging"
+	"github.com/tomogoma/usersms/pkg/logging/logrus"
+	_ "github.com/tomogoma/usersms/pkg/logging/standard"
+)
+
+const (
+	cmdImport = "import"
+	cmdExport = "export"
+)
+
+func main() {
+
+	confFile := flag.String("conf", config.DefaultConfPath(), "location of config file")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-conf file] %s|%s -kind %s|%s [flags] file\n",
+			os.Args[0], cmdImport, cmdExport, bulk.KindUsers, bulk.KindRatings)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	log := &logrus.Wrapper{}
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+
+	var err error
+	switch cmd {
+	case cmdImport:
+		err = runImport(*confFile, log, args)
+	case cmdExport:
+		err = runExport(*confFile, log, args)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	logging.LogFatalOnError(log, err, "Run "+cmd)
+}
+
+func runImport(confFile string, log logging.Logger, args []string) error {
+
+	fs := flag.NewFlagSet(cmdImport, flag.ExitOnError)
+	kind := fs.String("kind", "", "kind of records in the file: "+bulk.KindUsers+" or "+bulk.KindRatings)
+	format := fs.String("format", "", "format of the file: "+bulk.FormatCSV+" or "+
+		bulk.FormatJSONL+" (default: from the file extension)")
+	batch := fs.Int("batch", bulk.DefaultBatchSize, "number of records saved per transaction")
+	dryRun := fs.Bool("dry-run", false, "validate the records without saving them")
+	checkpoint := fs.String("checkpoint", "", "file recording how many records"+
+		" have been processed. An interrupted import resumes from it when run again")
+	rejectsFile := fs.String("rejects", "", "file to write rejected records to as JSON lines (default: stderr)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.Newf("expected exactly one file to import, got %d", fs.NArg())
+	}
+	inFile := fs.Arg(0)
+
+	if *format == "" {
+		*format = formatFromExt(inFile)
+	}
+	in := io.Reader(os.Stdin)
+	if inFile != "-" {
+		f, err := os.Open(inFile)
+		if err != nil {
+			return errors.Newf("open input file: %v", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	rejects := io.Writer(os.Stderr)
+	if *rejectsFile != "" {
+		f, err := os.OpenFile(*rejectsFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return errors.Newf("open rejects file: %v", err)
+		}
+		defer f.Close()
+		rejects = f
+	}
+
+	var skip int64
+	if *checkpoint != "" {
+		var err error
+		if skip, err = readCheckpoint(*checkpoint); err != nil {
+			return err
+		}
+		if skip > 0 {
+			log.Infof("Resuming from checkpoint, skipping %d records", skip)
+		}
+	}
+
+	opts := []bulk.Option{
+		bulk.WithBatchSize(int32(*batch)),
+		bulk.WithRejects(rejects),
+		bulk.WithProgress(func(p bulk.Progress) {
+			logProgress(log, p)
+			if *checkpoint == "" || *dryRun {
+				return
+			}
+			err := writeCheckpoint(*checkpoint, p.Records)
+			logging.LogWarnOnError(log, err, "Write checkpoint")
+		}),
+	}
+	if *dryRun {
+		opts = append(opts, bulk.WithDryRun())
+	}
+	bm := instantiateBulkManager(confFile, log, opts...)
+
+	p, err := bm.Import(*kind, *format, in, skip)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		log.Infof("Dry run complete: %d %s valid, %d rejected", p.Imported, p.Kind, p.Rejected)
+		return nil
+	}
+	log.Infof("Import complete: %d %s imported, %d rejected", p.Imported, p.Kind, p.Rejected)
+	return nil
+}
+
+func runExport(confFile string, log logging.Logger, args []string) error {
+
+	fs := flag.NewFlagSet(cmdExport, flag.ExitOnError)
+	kind := fs.String("kind", "", "kind of records to export: "+bulk.KindUsers+" or "+bulk.KindRatings)
+	format := fs.String("format", "", "format of the file: "+bulk.FormatCSV+" or "+
+		bulk.FormatJSONL+" (default: from the file extension)")
+	batch := fs.Int("batch", bulk.DefaultBatchSize, "number of records fetched per query")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.Newf("expected exactly one file to export to, got %d", fs.NArg())
+	}
+	outFile := fs.Arg(0)
+
+	if *format == "" {
+		*format = formatFromExt(outFile)
+	}
+	out := io.Writer(os.Stdout)
+	if outFile != "-" {
+		f, err := os.Create(outFile)
+		if err != nil {
+			return errors.Newf("create output file: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	bm := instantiateBulkManager(confFile, log,
+		bulk.WithBatchSize(int32(*batch)),
+		bulk.WithProgress(func(p bulk.Progress) { logProgress(log, p) }),
+	)
+
+	p, err := bm.Export(*kind, *format, out)
+	if err != nil {
+		return err
+	}
+	log.Infof("Export complete: %d %s exported", p.Records, p.Kind)
+	return nil
+}
+
+func instantiateBulkManager(confFile string, log logging.Logger, opts ...bulk.Option) *bulk.Manager {
+	deps := bootstrap.Instantiate(confFile, log)
+	bm, err := bulk.NewManager(deps.Roach, deps.UserMan, deps.IDGen, opts...)
+	logging.LogFatalOnError(log, err, "New bulk manager")
+	return bm
+}
+
+func logProgress(log logging.Logger, p bulk.Progress) {
+	log.WithFields(map[string]interface{}{
+		"kind":     p.Kind,
+		"records":  p.Records,
+		"imported": p.Imported,
+		"rejected": p.Rejected,
+	}).Info("Progress")
+}
+
+// formatFromExt guesses the format of file from its extension.
+func formatFromExt(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		return bulk.FormatCSV
+	case ".jsonl", ".ndjson":
+		return bulk.FormatJSONL
+	default:
+		return ""
+	}
+}
+
+// readCheckpoint reads the number of records processed from file, returning
+// 0 if file does not exist yet.
+func readCheckpoint(file string) (int64, error) {
+	cpB, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errors.Newf("read checkpoint: %v", err)
+	}
+	records, err := strconv.ParseInt(strings.TrimSpace(string(cpB)), 10, 64)
+	if err != nil {
+		return 0, errors.Newf("invalid checkpoint in %s: %v", file, err)
+	}
+	return records, nil
+}
+
+// writeCheckpoint records the number of records processed in file. It writes
+// to a temporary file first so that an interruption cannot corrupt file.
+func writeCheckpoint(file string, records int64) error {
+	tmpFile := file + ".tmp"
+	err := ioutil.WriteFile(tmpFile, []byte(strconv.FormatInt(records, 10)+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
@@ -16,6 +16,8 @@ func main() {
 	config.DefaultConfDir("conf")
 	log := &logrus.Wrapper{}
 	deps := bootstrap.Instantiate(config.DefaultConfPath(), log)
+	// Domain events are not dispatched here, they wait in the outbox until
+	// the micro service publishes them.
 
 	httpHandler, err := httpInternal.NewHandler(httpInternal.Config{
 		Guard:          deps.Guard,
@@ -23,6 +25,9 @@ func main() {
 		BaseURL:        config.WebRootPath(),
 		Rater:          deps.RatingMan,
 		UserProfiler:   deps.UserMan,
+		Avatars:        deps.AvatarMan,
+		Streams:        deps.FeedMan,
+		StreamInterval: deps.Config.Events.StreamInterval,
 		AllowedOrigins: deps.Config.Service.AllowedOrigins,
 	})
 	logging.LogFatalOnError(log, err, "Instantiate http Handler")
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/micro/go-micro"
+	"github.com/micro/go-micro/broker"
 	"github.com/micro/go-web"
 	"github.com/tomogoma/usersms/pkg/api"
 	"github.com/tomogoma/usersms/pkg/bootstrap"
@@ -23,6 +24,10 @@ func main() {
 	log := &logrus.Wrapper{}
 	deps := bootstrap.Instantiate(*confFile, log)
 
+	err := broker.Connect()
+	logging.LogFatalOnError(log, err, "Connect event broker")
+	bootstrap.DispatchEvents(log, deps.Config.Events, deps.Roach, broker.DefaultBroker)
+
 	serverRPCQuitCh := make(chan error)
 	rpcSrv, err := rpc.NewStatusHandler(deps.Guard, log)
 	logging.LogFatalOnError(log, err, "Instantiate RPC handler")
@@ -35,6 +40,9 @@ func main() {
 		BaseURL:        config.WebRootPath(),
 		Rater:          deps.RatingMan,
 		UserProfiler:   deps.UserMan,
+		Avatars:        deps.AvatarMan,
+		Streams:        deps.FeedMan,
+		StreamInterval: deps.Config.Events.StreamInterval,
 		AllowedOrigins: deps.Config.Service.AllowedOrigins,
 	})
 	logging.LogFatalOnError(log, err, "Instantiate HTTP handler")
@@ -0,0 +1,146 @@
+package avatar
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+)
+
+var rgxVersion = regexp.MustCompile("^[0-9a-z]+$")
+
+// Files keeps the thumbnails of uploaded avatars in a Store, grouped by user
+// and upload version, and maps them to and from the URLs at which this
+// service serves them. Each upload gets a new version and URL so that
+// thumbnails are never overwritten in place. Files implements
+// user.AvatarStore.
+type Files struct {
+	store     Store
+	urlPrefix string
+}
+
+// NewFiles creates Files that keeps thumbnails in store. urlPrefix is the
+// prefix of the avatar URLs e.g. "https://example.com/v0/usersms". An empty
+// prefix gives URLs relative to the service root.
+func NewFiles(store Store, urlPrefix string) (*Files, error) {
+	if store == nil {
+		return nil, errors.Newf("nil Store")
+	}
+	return &Files{store: store, urlPrefix: strings.TrimSuffix(urlPrefix, "/")}, nil
+}
+
+// URL returns the URL of version of the avatar of the user with userID.
+func (f *Files) URL(userID, version string) string {
+	return fmt.Sprintf("%s/users/%s/avatar?v=%s", f.urlPrefix, userID, version)
+}
+
+// IsAvatarURL returns true if avatarURL is a URL returned by URL for the user
+// with userID.
+func (f *Files) IsAvatarURL(userID, avatarURL string) bool {
+	ownerID, _, ok := f.parseURL(avatarURL)
+	return ok && ownerID == userID
+}
+
+// CopyAvatar copies the thumbnails of the avatar at avatarURL to a new version
+// of the avatar of the user with toUserID and returns its URL. avatarURL is
+// returned as is if it is not a URL returned by URL.
+func (f *Files) CopyAvatar(avatarURL, toUserID string) (string, error) {
+
+	ownerID, version, ok := f.parseURL(avatarURL)
+	if !ok {
+		return avatarURL, nil
+	}
+
+	keys, err := f.store.Keys(versionKey(ownerID, version))
+	if err != nil && !f.store.IsNotFoundError(err) {
+		return "", errors.Newf("list thumbnails: %v", err)
+	}
+
+	newVersion := newVersion()
+	for _, k := range keys {
+		data, err := f.store.Get(k)
+		if err != nil {
+			return "", errors.Newf("get thumbnail: %v", err)
+		}
+		newKey := path.Join(versionKey(toUserID, newVersion), path.Base(k))
+		if err := f.store.Put(newKey, data); err != nil {
+			f.deleteVersion(toUserID, newVersion)
+			return "", errors.Newf("put thumbnail copy: %v", err)
+		}
+	}
+
+	return f.URL(toUserID, newVersion), nil
+}
+
+// DeleteAvatar deletes the thumbnails of the avatar at avatarURL. It does
+// nothing if avatarURL is not a URL returned by URL.
+func (f *Files) DeleteAvatar(avatarURL string) error {
+	ownerID, version, ok := f.parseURL(avatarURL)
+	if !ok {
+		return nil
+	}
+	return f.deleteVersion(ownerID, version)
+}
+
+// DeleteAvatars deletes the thumbnails of all versions of the avatar of the
+// user with userID.
+func (f *Files) DeleteAvatars(userID string) error {
+	if userID == "" {
+		return errors.Newf("empty userID")
+	}
+	if err := f.store.Delete(userKey(userID)); err != nil {
+		return errors.Newf("delete thumbnails: %v", err)
+	}
+	return nil
+}
+
+func (f *Files) put(userID, version string, size int, data []byte) error {
+	return f.store.Put(key(userID, version, size), data)
+}
+
+func (f *Files) get(userID, version string, size int) ([]byte, error) {
+	return f.store.Get(key(userID, version, size))
+}
+
+func (f *Files) deleteVersion(userID, version string) error {
+	if err := f.store.Delete(versionKey(userID, version)); err != nil {
+		return errors.Newf("delete thumbnails: %v", err)
+	}
+	return nil
+}
+
+// parseURL extracts the user ID and version from an avatar URL returned by
+// URL. ok is false if avatarURL was not returned by URL.
+func (f *Files) parseURL(avatarURL string) (userID, version string, ok bool) {
+	rest := strings.TrimPrefix(avatarURL, f.urlPrefix+"/users/")
+	if rest == avatarURL {
+		return "", "", false
+	}
+	parts := strings.SplitN(rest, "/avatar?v=", 2)
+	if len(parts) != 2 || parts[0] == "" || strings.ContainsAny(parts[0], "/?#.") ||
+		!rgxVersion.MatchString(parts[1]) {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// newVersion returns a version for a new upload. Versions increase over time.
+func newVersion() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+func userKey(userID string) string {
+	return "avatars/" + userID
+}
+
+func versionKey(userID, version string) string {
+	return userKey(userID) + "/" + version
+}
+
+func key(userID, version string, size int) string {
+	return fmt.Sprintf("%s/%d.jpg", versionKey(userID, version), size)
+}
@@ -0,0 +1,87 @@
+package avatar
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"net/http"
+
+	"github.com/tomogoma/go-typed-errors"
+	"golang.org/x/image/draw"
+
+	// Register decoders for the supported upload formats.
+	_ "golang.org/x/image/webp"
+	_ "image/png"
+)
+
+const thumbnailQuality = 85
+
+var supportedContentTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+// thumbnails decodes data and returns a square JPEG thumbnail of it for each
+// of sizes, in the same order as sizes. The image is cropped to its centre
+// square before being scaled. A client error is returned if data is not a
+// supported image or if its dimensions are outside minDim and maxDim.
+func thumbnails(data []byte, minDim, maxDim int, sizes []int) ([][]byte, error) {
+
+	contentType := http.DetectContentType(data)
+	if !isSupported(contentType) {
+		return nil, errors.NewClientf("unsupported image type '%s', expected"+
+			" one of %v", contentType, supportedContentTypes)
+	}
+
+	// Check dimensions before decoding the whole image to avoid allocating
+	// huge images.
+	conf, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.NewClientf("invalid image: %v", err)
+	}
+	if conf.Width < minDim || conf.Height < minDim {
+		return nil, errors.NewClientf("image must be at least %dx%d pixels",
+			minDim, minDim)
+	}
+	if conf.Width > maxDim || conf.Height > maxDim {
+		return nil, errors.NewClientf("image must be at most %dx%d pixels",
+			maxDim, maxDim)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.NewClientf("invalid image: %v", err)
+	}
+
+	src := centreSquare(img.Bounds())
+	thumbs := make([][]byte, len(sizes))
+	for i, size := range sizes {
+		dst := image.NewRGBA(image.Rect(0, 0, size, size))
+		// JPEG has no alpha channel, fill transparent areas with white.
+		draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Over, nil)
+
+		buf := &bytes.Buffer{}
+		if err := jpeg.Encode(buf, dst, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+			return nil, errors.Newf("encode %dpx thumbnail: %v", size, err)
+		}
+		thumbs[i] = buf.Bytes()
+	}
+
+	return thumbs, nil
+}
+
+func centreSquare(r image.Rectangle) image.Rectangle {
+	side := r.Dx()
+	if r.Dy() < side {
+		side = r.Dy()
+	}
+	min := image.Pt(r.Min.X+(r.Dx()-side)/2, r.Min.Y+(r.Dy()-side)/2)
+	return image.Rectangle{Min: min, Max: min.Add(image.Pt(side, side))}
+}
+
+func isSupported(contentType string) bool {
+	for _, supported := range supportedContentTypes {
+		if contentType == supported {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package avatar
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestThumbnails(t *testing.T) {
+	tt := []struct {
+		name     string
+		img      []byte
+		sizes    []int
+		expErr   bool
+		expClErr bool
+	}{
+		{
+			name:  "landscape png",
+			img:   newPNG(t, 300, 200),
+			sizes: []int{64, 128, 256},
+		},
+		{
+			name:  "portrait png",
+			img:   newPNG(t, 100, 250),
+			sizes: []int{64},
+		},
+		{
+			name:     "too small",
+			img:      newPNG(t, 63, 200),
+			sizes:    []int{64},
+			expErr:   true,
+			expClErr: true,
+		},
+		{
+			name:     "too large",
+			img:      newPNG(t, 200, 1001),
+			sizes:    []int{64},
+			expErr:   true,
+			expClErr: true,
+		},
+		{
+			name:     "unsupported type",
+			img:      []byte("GIF89a not really a gif"),
+			sizes:    []int{64},
+			expErr:   true,
+			expClErr: true,
+		},
+		{
+			name:     "corrupt image",
+			img:      newPNG(t, 200, 200)[:50],
+			sizes:    []int{64},
+			expErr:   true,
+			expClErr: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			thumbs, err := thumbnails(tc.img, 64, 1000, tc.sizes)
+			if tc.expErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got nil")
+				}
+				if tc.expClErr != (&Manager{}).IsClientError(err) {
+					t.Errorf("Expected client error %t, got %v", tc.expClErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if len(thumbs) != len(tc.sizes) {
+				t.Fatalf("Expected %d thumbnails, got %d", len(tc.sizes), len(thumbs))
+			}
+			for i, size := range tc.sizes {
+				img, err := jpeg.Decode(bytes.NewReader(thumbs[i]))
+				if err != nil {
+					t.Fatalf("Thumbnail %d is not a JPEG: %v", i, err)
+				}
+				expBounds := image.Rect(0, 0, size, size)
+				if img.Bounds() != expBounds {
+					t.Errorf("Expected thumbnail %d bounds %v, got %v",
+						i, expBounds, img.Bounds())
+				}
+			}
+		})
+	}
+}
+
+func newPNG(t *testing.T, width, height int) []byte {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewNRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("Error setting up: encode png: %v", err)
+	}
+	return buf.Bytes()
+}
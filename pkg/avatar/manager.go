@@ -0,0 +1,257 @@
+package avatar
+
+import (
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/jwt"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+const (
+	DefaultMaxBytes     = int64(5 << 20)
+	DefaultMinDimension = 64
+	DefaultMaxDimension = 4096
+)
+
+// DefaultSizes are the widths (and heights) in pixels of the square
+// thumbnails generated for each uploaded avatar.
+var DefaultSizes = []int{64, 128, 256, 512}
+
+type JWTEr interface {
+	errors.IsAuthErrChecker
+	IsOwnerOrJWTHasAccess(JWT string, owner string, acl float32) (*jwt.AuthMSClaim, error)
+}
+
+// Store persists blobs by key. Keys are slash separated paths.
+// blob.FileSystem is an implementation that stores blobs on the local file
+// system.
+type Store interface {
+	errors.IsNotFoundErrChecker
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	// Delete deletes the blob at key, or all blobs whose keys are prefixed
+	// by key and a slash.
+	Delete(key string) error
+	// Keys lists the keys prefixed by prefix and a slash.
+	Keys(prefix string) ([]string, error)
+}
+
+// Users updates and fetches users. user.Manager is an implementation.
+type Users interface {
+	Update(JWT string, update user.UserUpdate) (*user.User, error)
+	User(JWT, ID string, offsetUpdateDate time.Time) (*user.User, error)
+}
+
+type Manager struct {
+	errors.ClErrCheck
+	errors.ErrToHTTP
+
+	jwter    JWTEr
+	files    *Files
+	usrs     Users
+	maxBytes int64
+	minDim   int
+	maxDim   int
+	sizes    []int
+}
+
+// Option allows extra configuration for instantiating Manager. Use the With...
+// functions (e.g. WithSizes) to set options.
+type Option func(*Manager) error
+
+// WithMaxBytes sets the maximum size of an uploaded image. Defaults to
+// DefaultMaxBytes.
+func WithMaxBytes(n int64) Option {
+	return func(m *Manager) error {
+		if n <= 0 {
+			return errors.Newf("max bytes must be greater than 0")
+		}
+		m.maxBytes = n
+		return nil
+	}
+}
+
+// WithDimensionLimits sets the minimum and maximum width and height of an
+// uploaded image. Defaults to DefaultMinDimension and DefaultMaxDimension.
+func WithDimensionLimits(min, max int) Option {
+	return func(m *Manager) error {
+		if min <= 0 || max < min {
+			return errors.Newf("invalid dimension limits min %d max %d", min, max)
+		}
+		m.minDim = min
+		m.maxDim = max
+		return nil
+	}
+}
+
+// WithSizes sets the sizes of the thumbnails generated for each uploaded
+// image. Defaults to DefaultSizes.
+func WithSizes(sizes ...int) Option {
+	return func(m *Manager) error {
+		if len(sizes) == 0 {
+			return errors.Newf("at least one size is required")
+		}
+		for _, size := range sizes {
+			if size <= 0 {
+				return errors.Newf("invalid size %d", size)
+			}
+		}
+		m.sizes = append([]int{}, sizes...)
+		sort.Ints(m.sizes)
+		return nil
+	}
+}
+
+func NewManager(jwter JWTEr, files *Files, usrs Users, opts ...Option) (*Manager, error) {
+	if jwter == nil {
+		return nil, errors.Newf("nil JWTEr")
+	}
+	if files == nil {
+		return nil, errors.Newf("nil Files")
+	}
+	if usrs == nil {
+		return nil, errors.Newf("nil Users")
+	}
+	m := &Manager{
+		jwter:    jwter,
+		files:    files,
+		usrs:     usrs,
+		maxBytes: DefaultMaxBytes,
+		minDim:   DefaultMinDimension,
+		maxDim:   DefaultMaxDimension,
+		sizes:    DefaultSizes,
+	}
+	for i, opt := range opts {
+		if opt == nil {
+			return nil, errors.Newf("received nil Option at index %d", i)
+		}
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Upload generates thumbnails of the JPEG, PNG or WebP image read from img,
+// stores them as a new version of the user's avatar and points the user's
+// AvatarURL at them. The previous version is deleted once the user is
+// updated. The new version is discarded if the update fails, and kept without
+// changing the AvatarURL if moderation holds it for review. Only the user or
+// staff can upload a user's avatar.
+func (m *Manager) Upload(JWT, userID string, img io.Reader) (*user.User, error) {
+
+	if _, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff); err != nil {
+		return nil, m.parseJWTErError(err, "validate JWT belongs to"+
+			" subject or has access")
+	}
+
+	if img == nil {
+		return nil, errors.NewClient("an image is required")
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(img, m.maxBytes+1))
+	if err != nil {
+		return nil, errors.NewClientf("unable to read image: %v", err)
+	}
+	if int64(len(data)) > m.maxBytes {
+		return nil, errors.NewClientf("image must not be larger than %d bytes", m.maxBytes)
+	}
+
+	thumbs, err := thumbnails(data, m.minDim, m.maxDim, m.sizes)
+	if err != nil {
+		return nil, err
+	}
+
+	var prevURL string
+	prev, err := m.usrs.User(JWT, userID, time.Time{})
+	if err == nil {
+		prevURL = prev.AvatarURL
+	}
+
+	version := newVersion()
+	for i, size := range m.sizes {
+		if err := m.files.put(userID, version, size, thumbs[i]); err != nil {
+			m.files.deleteVersion(userID, version)
+			return nil, errors.Newf("store %dpx thumbnail: %v", size, err)
+		}
+	}
+
+	avatarURL := m.files.URL(userID, version)
+	usr, err := m.usrs.Update(JWT, user.UserUpdate{
+		UserID:    userID,
+		AvatarURL: user.StringUpdate{IsUpdating: true, NewValue: avatarURL},
+	})
+	if err != nil {
+		m.files.deleteVersion(userID, version)
+		return nil, err
+	}
+
+	// A failure to delete the previous version is not reported since the
+	// upload succeeded. Leftover versions are deleted when the user is
+	// erased.
+	if usr.AvatarURL == avatarURL && prevURL != avatarURL && m.files.IsAvatarURL(userID, prevURL) {
+		m.files.DeleteAvatar(prevURL)
+	}
+
+	return usr, nil
+}
+
+// Avatar returns the stored thumbnail of the user's avatar closest to size
+// without being smaller. The largest thumbnail is returned if size is 0 or
+// larger than all stored thumbnails. The avatar is only returned if the
+// bearer of JWT (who may be anonymous if JWT is empty) can see the user and
+// their AvatarURL (see user.Manager.User), and the AvatarURL points at an
+// avatar uploaded to this service.
+func (m *Manager) Avatar(JWT, userID string, size int) ([]byte, error) {
+
+	if userID == "" {
+		return nil, errors.NewClient("userID was empty")
+	}
+	if size < 0 {
+		return nil, errors.NewClient("size must not be negative")
+	}
+
+	usr, err := m.usrs.User(JWT, userID, time.Time{})
+	if err != nil {
+		if user.IsMergedError(err) {
+			return nil, errors.NewNotFound("avatar not found")
+		}
+		return nil, err
+	}
+	ownerID, version, ok := m.files.parseURL(usr.AvatarURL)
+	if !ok || ownerID != userID {
+		return nil, errors.NewNotFound("avatar not found")
+	}
+
+	closest := m.sizes[len(m.sizes)-1]
+	if size > 0 {
+		for _, s := range m.sizes {
+			if s >= size {
+				closest = s
+				break
+			}
+		}
+	}
+
+	data, err := m.files.get(userID, version, closest)
+	if err != nil {
+		if m.files.store.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("avatar not found")
+		}
+		return nil, errors.Newf("get %dpx thumbnail: %v", closest, err)
+	}
+	return data, nil
+}
+
+func (m *Manager) parseJWTErError(err error, errCtx string) error {
+	if m.jwter.IsAuthError(err) || m.jwter.IsUnauthorizedError(err) {
+		return errors.NewUnauthorized(err)
+	}
+	if m.jwter.IsForbiddenError(err) {
+		return errors.NewForbidden(err)
+	}
+	return errors.Newf("%s: %v", errCtx, err)
+}
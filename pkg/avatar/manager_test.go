@@ -0,0 +1,259 @@
+package avatar
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/blob"
+	"github.com/tomogoma/usersms/pkg/jwt"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+type ownerJWTEr struct {
+	errors.AuthErrCheck
+}
+
+func (ownerJWTEr) IsOwnerOrJWTHasAccess(JWT, owner string, acl float32) (*jwt.AuthMSClaim, error) {
+	if JWT != owner {
+		return nil, errors.NewForbidden("not owner")
+	}
+	return &jwt.AuthMSClaim{UsrID: JWT}, nil
+}
+
+// users holds a single user. holdAvatar simulates moderation holding new
+// avatar URLs.
+type users struct {
+	usr        user.User
+	updateErr  error
+	userErr    error
+	holdAvatar bool
+}
+
+func (u *users) Update(JWT string, update user.UserUpdate) (*user.User, error) {
+	if u.updateErr != nil {
+		return nil, u.updateErr
+	}
+	if !u.holdAvatar {
+		u.usr.AvatarURL = update.AvatarURL.NewValue
+	}
+	usr := u.usr
+	return &usr, nil
+}
+
+func (u *users) User(JWT, ID string, offsetUpdateDate time.Time) (*user.User, error) {
+	if u.userErr != nil {
+		return nil, u.userErr
+	}
+	usr := u.usr
+	return &usr, nil
+}
+
+func newTestFiles(t *testing.T) (*Files, func()) {
+	dir, err := ioutil.TempDir("", "avatars")
+	if err != nil {
+		t.Fatalf("Error setting up: create temp dir: %v", err)
+	}
+	store, err := blob.NewFileSystem(dir)
+	if err != nil {
+		t.Fatalf("Error setting up: new file system: %v", err)
+	}
+	files, err := NewFiles(store, "https://example.com/v0/usersms/")
+	if err != nil {
+		t.Fatalf("Error setting up: new files: %v", err)
+	}
+	return files, func() { os.RemoveAll(dir) }
+}
+
+func TestFiles(t *testing.T) {
+	files, cleanup := newTestFiles(t)
+	defer cleanup()
+
+	if err := files.put("123", "v1", 64, []byte("64px")); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	URL := files.URL("123", "v1")
+	if URL != "https://example.com/v0/usersms/users/123/avatar?v=v1" {
+		t.Errorf("Unexpected URL %s", URL)
+	}
+	if !files.IsAvatarURL("123", URL) {
+		t.Errorf("Expected %s to be an avatar URL of user 123", URL)
+	}
+	for _, notURL := range []string{
+		files.URL("456", "v1"),
+		"https://example.com/v0/usersms/users/123/avatar?v=v1&x=y",
+		"https://example.com/v0/usersms/users/../123/avatar?v=v1",
+		"https://evil.example.com/users/123/avatar?v=v1",
+		"",
+	} {
+		if files.IsAvatarURL("123", notURL) {
+			t.Errorf("Expected %s not to be an avatar URL of user 123", notURL)
+		}
+	}
+
+	copyURL, err := files.CopyAvatar(URL, "456")
+	if err != nil {
+		t.Fatalf("CopyAvatar: %v", err)
+	}
+	if !files.IsAvatarURL("456", copyURL) {
+		t.Fatalf("Expected copy URL %s to be an avatar URL of user 456", copyURL)
+	}
+	_, copyVersion, _ := files.parseURL(copyURL)
+	if data, err := files.get("456", copyVersion, 64); err != nil || string(data) != "64px" {
+		t.Errorf("Expected copied thumbnail, got %s, %v", data, err)
+	}
+
+	if err := files.DeleteAvatars("123"); err != nil {
+		t.Fatalf("DeleteAvatars: %v", err)
+	}
+	if _, err := files.get("123", "v1", 64); !files.store.IsNotFoundError(err) {
+		t.Errorf("Expected a not found error after DeleteAvatars, got %v", err)
+	}
+	if err := files.DeleteAvatar(copyURL); err != nil {
+		t.Fatalf("DeleteAvatar: %v", err)
+	}
+	if _, err := files.get("456", copyVersion, 64); !files.store.IsNotFoundError(err) {
+		t.Errorf("Expected a not found error after DeleteAvatar, got %v", err)
+	}
+}
+
+func TestManager_Upload(t *testing.T) {
+	tt := []struct {
+		name        string
+		usrs        *users
+		expErr      bool
+		expReplaced bool
+	}{
+		{
+			name:        "replaces previous version",
+			usrs:        &users{},
+			expReplaced: true,
+		},
+		{
+			name:   "update fails",
+			usrs:   &users{updateErr: errors.NewClient("erased")},
+			expErr: true,
+		},
+		{
+			name: "held for moderation",
+			usrs: &users{holdAvatar: true},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			files, cleanup := newTestFiles(t)
+			defer cleanup()
+			m, err := NewManager(&ownerJWTEr{}, files, tc.usrs, WithSizes(64),
+				WithDimensionLimits(64, 1000))
+			if err != nil {
+				t.Fatalf("NewManager: %v", err)
+			}
+			if err := files.put("123", "v1", 64, []byte("old")); err != nil {
+				t.Fatalf("Error setting up: put: %v", err)
+			}
+			prevURL := files.URL("123", "v1")
+			tc.usrs.usr = user.User{ID: "123", AvatarURL: prevURL}
+
+			usr, err := m.Upload("123", "123", bytes.NewReader(newPNG(t, 200, 200)))
+			if tc.expErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got nil")
+				}
+			} else if err != nil {
+				t.Fatalf("Upload: %v", err)
+			}
+
+			keys, err := files.store.Keys(userKey("123"))
+			if err != nil {
+				t.Fatalf("Keys: %v", err)
+			}
+			_, err = files.get("123", "v1", 64)
+			oldExists := err == nil
+			switch {
+			case tc.expReplaced:
+				if oldExists || len(keys) != 1 || usr.AvatarURL == prevURL {
+					t.Errorf("Expected only the new version, got %v", keys)
+				}
+			case tc.expErr:
+				if !oldExists || len(keys) != 1 {
+					t.Errorf("Expected only the previous version, got %v", keys)
+				}
+			default:
+				if !oldExists || len(keys) != 2 || usr.AvatarURL != prevURL {
+					t.Errorf("Expected the previous version to be kept"+
+						" along with the held version, got %v", keys)
+				}
+			}
+		})
+	}
+}
+
+func TestManager_Avatar(t *testing.T) {
+	files, cleanup := newTestFiles(t)
+	defer cleanup()
+	if err := files.put("123", "v1", 64, []byte("64px")); err != nil {
+		t.Fatalf("Error setting up: put: %v", err)
+	}
+	tt := []struct {
+		name     string
+		usrs     *users
+		expErr   bool
+		expNtFnd bool
+	}{
+		{
+			name: "visible",
+			usrs: &users{usr: user.User{ID: "123", AvatarURL: files.URL("123", "v1")}},
+		},
+		{
+			name:     "not visible",
+			usrs:     &users{userErr: errors.NewNotFound("user not found")},
+			expErr:   true,
+			expNtFnd: true,
+		},
+		{
+			name:     "merged",
+			usrs:     &users{userErr: user.MergedError{UserID: "123", MergedInto: "456"}},
+			expErr:   true,
+			expNtFnd: true,
+		},
+		{
+			name:     "avatar URL hidden",
+			usrs:     &users{usr: user.User{ID: "123"}},
+			expErr:   true,
+			expNtFnd: true,
+		},
+		{
+			name:     "another user's avatar URL",
+			usrs:     &users{usr: user.User{ID: "123", AvatarURL: files.URL("456", "v1")}},
+			expErr:   true,
+			expNtFnd: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := NewManager(&ownerJWTEr{}, files, tc.usrs, WithSizes(64))
+			if err != nil {
+				t.Fatalf("NewManager: %v", err)
+			}
+			img, err := m.Avatar("", "123", 0)
+			if tc.expErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got nil")
+				}
+				if tc.expNtFnd != (&errors.NotFoundErrCheck{}).IsNotFoundError(err) {
+					t.Errorf("Expected not found %t, got %v", tc.expNtFnd, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Avatar: %v", err)
+			}
+			if string(img) != "64px" {
+				t.Errorf("Expected image 64px, got %s", img)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package blob
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tomogoma/go-typed-errors"
+)
+
+// FileSystem stores blobs as files under a root directory on the local
+// file system. Keys are slash separated paths relative to the root
+// directory.
+type FileSystem struct {
+	errors.NotFoundErrCheck
+
+	rootDir string
+}
+
+func NewFileSystem(rootDir string) (*FileSystem, error) {
+	if rootDir == "" {
+		return nil, errors.Newf("empty root directory")
+	}
+	if err := os.MkdirAll(rootDir, 0755); err != nil {
+		return nil, errors.Newf("create root directory: %v", err)
+	}
+	return &FileSystem{rootDir: rootDir}, nil
+}
+
+// Put writes data to the file at key, replacing any existing content.
+func (fs *FileSystem) Put(key string, data []byte) error {
+	fName, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fName), 0755); err != nil {
+		return errors.Newf("create parent directory: %v", err)
+	}
+	// Write to a temporary file first so that readers never see a
+	// partially written blob.
+	tmpFName := fName + ".tmp"
+	if err := ioutil.WriteFile(tmpFName, data, 0644); err != nil {
+		return errors.Newf("write temp file: %v", err)
+	}
+	if err := os.Rename(tmpFName, fName); err != nil {
+		return errors.Newf("move temp file into place: %v", err)
+	}
+	return nil
+}
+
+// Get returns the contents of the file at key. A not found error is returned
+// if no blob exists at key.
+func (fs *FileSystem) Get(key string) ([]byte, error) {
+	fName, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(fName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.NewNotFoundf("blob '%s' not found", key)
+		}
+		return nil, errors.Newf("read file: %v", err)
+	}
+	return data, nil
+}
+
+// Delete removes the file at key, or the directory at key and all the blobs
+// within it. It is not an error if nothing exists at key.
+func (fs *FileSystem) Delete(key string) error {
+	fName, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(fName); err != nil {
+		return errors.Newf("remove file: %v", err)
+	}
+	return nil
+}
+
+// Keys returns the keys of the blobs within the directory at prefix. A not
+// found error is returned if there are none.
+func (fs *FileSystem) Keys(prefix string) ([]string, error) {
+	dir, err := fs.path(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	err = filepath.Walk(dir, func(fName string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(fName, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(fs.rootDir, fName)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Newf("walk directory: %v", err)
+	}
+	if len(keys) == 0 {
+		return nil, errors.NewNotFoundf("no blobs found in '%s'", prefix)
+	}
+	return keys, nil
+}
+
+func (fs *FileSystem) path(key string) (string, error) {
+	cleanKey := filepath.Clean("/" + filepath.FromSlash(key))
+	if key == "" || strings.Contains(key, "..") || cleanKey == string(filepath.Separator) {
+		return "", errors.Newf("invalid blob key '%s'", key)
+	}
+	return filepath.Join(fs.rootDir, cleanKey), nil
+}
@@ -3,15 +3,23 @@ package bootstrap
 import (
 	"io/ioutil"
 
+	"github.com/micro/go-micro/broker"
 	"github.com/sony/sonyflake"
 	"github.com/tomogoma/crdb"
 	"github.com/tomogoma/go-api-guard"
+	"github.com/tomogoma/usersms/pkg/avatar"
+	"github.com/tomogoma/usersms/pkg/blob"
 	"github.com/tomogoma/usersms/pkg/config"
 	"github.com/tomogoma/usersms/pkg/db/roach"
+	"github.com/tomogoma/usersms/pkg/events"
+	"github.com/tomogoma/usersms/pkg/feed"
 	"github.com/tomogoma/usersms/pkg/jwt"
 	"github.com/tomogoma/usersms/pkg/logging"
+	"github.com/tomogoma/usersms/pkg/mail"
+	"github.com/tomogoma/usersms/pkg/moderation"
 	"github.com/tomogoma/usersms/pkg/phone"
 	"github.com/tomogoma/usersms/pkg/rating"
+	"github.com/tomogoma/usersms/pkg/sms"
 	"github.com/tomogoma/usersms/pkg/uid"
 	"github.com/tomogoma/usersms/pkg/user"
 	"time"
@@ -22,8 +30,11 @@ type Deps struct {
 	Guard     *api.Guard
 	Roach     *roach.Roach
 	JWTEr     *jwt.Manager
+	IDGen     *uid.SonyFlakeWrapper
 	UserMan   *user.Manager
 	RatingMan *rating.Manager
+	AvatarMan *avatar.Manager
+	FeedMan   *feed.Manager
 }
 
 func InstantiateRoach(lg logging.Logger, conf crdb.Config) *roach.Roach {
@@ -71,8 +82,176 @@ func Instantiate(confFile string, lg logging.Logger) Deps {
 		}
 	}()
 
-	userMan, err := user.NewManager(rdb, tg, phone.Formatter{})
+	userOpts := []user.Option{
+		user.WithAttributes(conf.Users.Attributes...),
+		user.WithReservedHandles(conf.Users.ReservedHandles...),
+		user.WithLogger(lg),
+	}
+	if conf.Users.HandleCooldown > 0 {
+		userOpts = append(userOpts, user.WithHandleCooldown(conf.Users.HandleCooldown))
+	}
+	if len(conf.Users.CompletenessWeights) > 0 {
+		userOpts = append(userOpts, user.WithCompletenessWeights(conf.Users.CompletenessWeights))
+	}
+	if len(conf.Users.Genders) > 0 {
+		userOpts = append(userOpts, user.WithGenders(conf.Users.Genders...))
+	}
+	pf := phone.Formatter{
+		RegionCode:  conf.Phones.DefaultRegion,
+		NumberTypes: conf.Phones.NumberTypes,
+		E164:        conf.Phones.E164,
+	}
+	logging.LogFatalOnError(lg, pf.Validate(), "Validate phones config")
+
+	codeValidity := conf.Phones.CodeValidity
+	if codeValidity <= 0 {
+		codeValidity = user.DefaultPhoneCodeValidity
+	}
+	maxCodeAttempts := conf.Phones.MaxCodeAttempts
+	if maxCodeAttempts <= 0 {
+		maxCodeAttempts = user.DefaultPhoneCodeMaxAttempts
+	}
+	// No SMS gateway is integrated yet; codes are logged by the stub.
+	userOpts = append(userOpts, user.WithSMSSender(sms.NewStub(lg)),
+		user.WithPhoneVerification(codeValidity, maxCodeAttempts))
+
+	if mailer := InstantiateMailer(lg, conf.Emails.SMTP); mailer != nil {
+		userOpts = append(userOpts, user.WithMailer(mailer))
+	}
+	tokenValidity := conf.Emails.TokenValidity
+	if tokenValidity <= 0 {
+		tokenValidity = user.DefaultEmailTokenValidity
+	}
+	userOpts = append(userOpts, user.WithEmailVerification(tokenValidity, conf.Emails.VerifyURL))
+
+	if len(conf.Moderation.Words) > 0 {
+		wordList, err := moderation.NewWordList(conf.Moderation.Words...)
+		logging.LogFatalOnError(lg, err, "New moderation word list")
+		mode := conf.Moderation.Mode
+		if mode == "" {
+			mode = user.ModerationModeHold
+		}
+		userOpts = append(userOpts, user.WithContentChecker(wordList, mode))
+	}
+
+	avatarFiles := InstantiateAvatarFiles(lg, conf.Avatars)
+	userOpts = append(userOpts, user.WithAvatarStore(avatarFiles))
+	if len(conf.Avatars.AllowedHosts) > 0 {
+		userOpts = append(userOpts, user.WithAvatarHosts(conf.Avatars.AllowedHosts...))
+	}
+
+	userMan, err := user.NewManager(rdb, tg, pf, userOpts...)
 	logging.LogFatalOnError(lg, err, "New user manager")
 
-	return Deps{Config: conf, Guard: g, Roach: rdb, JWTEr: tg, RatingMan: rater, UserMan: userMan}
+	avatarMan := InstantiateAvatarManager(lg, conf.Avatars, tg, avatarFiles, userMan)
+
+	feedMan, err := feed.NewManager(tg, rdb, userMan)
+	logging.LogFatalOnError(lg, err, "New feed manager")
+	retention := conf.Events.FeedRetention
+	if retention <= 0 {
+		retention = feed.DefaultRetention
+	}
+	go func() {
+		for {
+			err := feedMan.PruneEvery(retention, time.Hour)
+			logging.LogWarnOnError(lg, err, "Prune change feed periodically")
+			time.Sleep(time.Hour)
+		}
+	}()
+
+	return Deps{Config: conf, Guard: g, Roach: rdb, JWTEr: tg, IDGen: idGen,
+		RatingMan: rater, UserMan: userMan, AvatarMan: avatarMan, FeedMan: feedMan}
+}
+
+// DispatchEvents publishes the events written to db's outbox to b in the
+// background, as configured by conf. b must be connected.
+func DispatchEvents(lg logging.Logger, conf config.Events, db events.DB, b broker.Broker) {
+
+	var opts []events.Option
+	if conf.BatchSize > 0 {
+		opts = append(opts, events.WithBatchSize(conf.BatchSize))
+	}
+	if conf.Lease > 0 {
+		opts = append(opts, events.WithLease(conf.Lease))
+	}
+	if conf.MinBackoff > 0 || conf.MaxBackoff > 0 {
+		minBackoff, maxBackoff := events.DefaultMinBackoff, events.DefaultMaxBackoff
+		if conf.MinBackoff > 0 {
+			minBackoff = conf.MinBackoff
+		}
+		if conf.MaxBackoff > 0 {
+			maxBackoff = conf.MaxBackoff
+		}
+		opts = append(opts, events.WithBackoff(minBackoff, maxBackoff))
+	}
+	dispatcher, err := events.NewDispatcher(db, b, opts...)
+	logging.LogFatalOnError(lg, err, "New event dispatcher")
+
+	interval := conf.DispatchInterval
+	if interval <= 0 {
+		interval = events.DefaultInterval
+	}
+	go func() {
+		for {
+			err := dispatcher.DispatchEvery(interval)
+			logging.LogWarnOnError(lg, err, "Dispatch events periodically")
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// InstantiateMailer creates an SMTP mailer from conf or returns nil if no
+// SMTP host is configured, in which case users cannot set their email.
+func InstantiateMailer(lg logging.Logger, conf config.SMTP) *mail.SMTP {
+	if conf.Host == "" {
+		lg.Warnf("No SMTP host configured, email verification is disabled")
+		return nil
+	}
+	mailer, err := mail.NewSMTP(conf.Host, conf.Port, conf.Username,
+		conf.Password, conf.From)
+	logging.LogFatalOnError(lg, err, "Instantiate SMTP mailer")
+	return mailer
+}
+
+func InstantiateAvatarFiles(lg logging.Logger, conf config.Avatars) *avatar.Files {
+
+	storeDir := conf.StoreDir
+	if storeDir == "" {
+		storeDir = config.DefaultAvatarsDir()
+	}
+	store, err := blob.NewFileSystem(storeDir)
+	logging.LogFatalOnError(lg, err, "New avatar file system store")
+
+	URLPrefix := conf.URLPrefix
+	if URLPrefix == "" {
+		URLPrefix = config.WebRootPath()
+	}
+	files, err := avatar.NewFiles(store, URLPrefix)
+	logging.LogFatalOnError(lg, err, "New avatar files")
+	return files
+}
+
+func InstantiateAvatarManager(lg logging.Logger, conf config.Avatars, jwter avatar.JWTEr, files *avatar.Files, usrs avatar.Users) *avatar.Manager {
+
+	var opts []avatar.Option
+	if conf.MaxBytes > 0 {
+		opts = append(opts, avatar.WithMaxBytes(conf.MaxBytes))
+	}
+	if conf.MinDimension > 0 || conf.MaxDimension > 0 {
+		minDim, maxDim := avatar.DefaultMinDimension, avatar.DefaultMaxDimension
+		if conf.MinDimension > 0 {
+			minDim = conf.MinDimension
+		}
+		if conf.MaxDimension > 0 {
+			maxDim = conf.MaxDimension
+		}
+		opts = append(opts, avatar.WithDimensionLimits(minDim, maxDim))
+	}
+	if len(conf.Sizes) > 0 {
+		opts = append(opts, avatar.WithSizes(conf.Sizes...))
+	}
+
+	avatarMan, err := avatar.NewManager(jwter, files, usrs, opts...)
+	logging.LogFatalOnError(lg, err, "New avatar manager")
+	return avatarMan
 }
@@ -0,0 +1,211 @@
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+
+	"github.com/tomogoma/go-typed-errors"
+)
+
+// recordReader reads records one at a time from a file. Read returns io.EOF
+// once all records have been read and a client error for a malformed record,
+// after which reading can continue with the next record.
+type recordReader interface {
+	Read() (record, error)
+}
+
+// recordWriter writes records to a file. Flush must be called once all
+// records have been written.
+type recordWriter interface {
+	Write(record) error
+	Flush() error
+}
+
+// newRecordReader creates a recordReader of format for r. columns are the
+// columns a record may contain.
+func newRecordReader(format string, r io.Reader, columns []string) (recordReader, error) {
+	switch format {
+	case FormatCSV:
+		return &csvReader{r: csv.NewReader(r), columns: columns}, nil
+	case FormatJSONL:
+		return &jsonlReader{r: bufio.NewReader(r)}, nil
+	default:
+		return nil, errors.NewClientf("format must be one of %s or %s", FormatCSV, FormatJSONL)
+	}
+}
+
+// newRecordWriter creates a recordWriter of format for w. columns are the
+// columns of each record in the order they are written.
+func newRecordWriter(format string, w io.Writer, columns []string) (recordWriter, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w), columns: columns}, nil
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		enc := json.NewEncoder(bw)
+		enc.SetEscapeHTML(false)
+		return &jsonlWriter{w: bw, enc: enc}, nil
+	default:
+		return nil, errors.NewClientf("format must be one of %s or %s", FormatCSV, FormatJSONL)
+	}
+}
+
+// csvReader reads records from CSV whose first row names the column of each
+// field.
+type csvReader struct {
+	r       *csv.Reader
+	columns []string
+	header  []string
+}
+
+func (cr *csvReader) Read() (record, error) {
+	if cr.header == nil {
+		if err := cr.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+	row, err := cr.r.Read()
+	if err != nil {
+		if pErr, ok := err.(*csv.ParseError); ok {
+			return nil, errors.NewClient(pErr)
+		}
+		return nil, err
+	}
+	rec := make(record, len(cr.header))
+	for i, col := range cr.header {
+		rec[col] = row[i]
+	}
+	return rec, nil
+}
+
+// readHeader reads the first row and checks that it only contains known
+// columns. Unlike errors in records, errors in the header are fatal.
+func (cr *csvReader) readHeader() error {
+	row, err := cr.r.Read()
+	if err != nil {
+		if err == io.EOF {
+			return err
+		}
+		return errors.Newf("read header: %v", err)
+	}
+	header := make([]string, len(row))
+	seen := make(map[string]bool, len(row))
+	for i, col := range row {
+		if !in(col, cr.columns) {
+			return errors.Newf("unknown column '%s' in header, columns must be"+
+				" among %v", col, cr.columns)
+		}
+		if seen[col] {
+			return errors.Newf("column '%s' repeated in header", col)
+		}
+		seen[col] = true
+		header[i] = col
+	}
+	cr.header = header
+	return nil
+}
+
+// jsonlReader reads records from JSON Lines (http://jsonlines.org), each
+// line containing a JSON object. Blank lines are skipped.
+type jsonlReader struct {
+	r *bufio.Reader
+}
+
+func (jr *jsonlReader) Read() (record, error) {
+	for {
+		line, err := jr.r.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return nil, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		var rec record
+		if err := dec.Decode(&rec); err != nil {
+			return nil, errors.NewClientf("invalid JSON object: %v", err)
+		}
+		if rec == nil {
+			return nil, errors.NewClient("invalid JSON object: null")
+		}
+		return rec, nil
+	}
+}
+
+// csvWriter writes records as CSV preceded by a header row. Non-string values
+// are JSON encoded.
+type csvWriter struct {
+	w             *csv.Writer
+	columns       []string
+	headerWritten bool
+}
+
+func (cw *csvWriter) Write(rec record) error {
+	if err := cw.writeHeaderIfNot(); err != nil {
+		return err
+	}
+	row := make([]string, len(cw.columns))
+	for i, col := range cw.columns {
+		switch val := rec[col].(type) {
+		case nil:
+		case string:
+			row[i] = val
+		default:
+			valB, err := json.Marshal(val)
+			if err != nil {
+				return errors.Newf("marshal %s: %v", col, err)
+			}
+			row[i] = string(valB)
+		}
+	}
+	return cw.w.Write(row)
+}
+
+// Flush writes the header if no records were written so that the file
+// always names the columns.
+func (cw *csvWriter) Flush() error {
+	if err := cw.writeHeaderIfNot(); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) writeHeaderIfNot() error {
+	if cw.headerWritten {
+		return nil
+	}
+	if err := cw.w.Write(cw.columns); err != nil {
+		return err
+	}
+	cw.headerWritten = true
+	return nil
+}
+
+// jsonlWriter writes records as JSON Lines.
+type jsonlWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (jw *jsonlWriter) Write(rec record) error {
+	return jw.enc.Encode(rec)
+}
+
+func (jw *jsonlWriter) Flush() error {
+	return jw.w.Flush()
+}
+
+func in(needle string, haystack []string) bool {
+	for _, v := range haystack {
+		if v == needle {
+			return true
+		}
+	}
+	return false
+}
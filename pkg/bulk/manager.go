@@ -0,0 +1,486 @@
+package bulk
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/jwt"
+	"github.com/tomogoma/usersms/pkg/rating"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+// Formats of the files that can be imported and exported.
+const (
+	// FormatCSV files have a header row naming the column of each field.
+	// Attributes and privacy values are JSON encoded objects.
+	FormatCSV = "csv"
+	// FormatJSONL files have a JSON object per line (http://jsonlines.org).
+	FormatJSONL = "jsonl"
+)
+
+// Kinds of records that can be imported and exported.
+const (
+	KindUsers   = "users"
+	KindRatings = "ratings"
+)
+
+// DefaultBatchSize is the number of records saved per transaction unless
+// set using WithBatchSize.
+const DefaultBatchSize = 500
+
+// ImportActorID is recorded as the actor in the history of imported users.
+const ImportActorID = "bulk-import"
+
+type DB interface {
+	errors.IsNotFoundErrChecker
+	Users(IDs []string) ([]user.User, error)
+	ImportUsers([]user.UserUpdate) error
+	ImportRatings([]rating.Rating) error
+	UsersAfter(afterID string, count int32) ([]user.User, error)
+	RatingsAfter(afterID string, count int32) ([]rating.Rating, error)
+}
+
+type UserValidator interface {
+	// ValidateUpdate validates and normalizes update returning a client
+	// or conflict error if update is invalid.
+	ValidateUpdate(update *user.UserUpdate) error
+}
+
+type IDEr interface {
+	NextID() (string, error)
+}
+
+// Progress reports how far an Import or Export has gone.
+type Progress struct {
+	Kind string
+	// Records is the number of records read so far by an Import,
+	// including skipped and rejected records, or written so far by an
+	// Export. The records counted by an Import have all been saved so
+	// an interrupted Import can be resumed by skipping Records records.
+	Records  int64
+	Imported int64
+	Rejected int64
+}
+
+// rejection is written to the rejects writer (see WithRejects) for each
+// record rejected by Import.
+type rejection struct {
+	// Record is the record's position in the file starting from 1 and
+	// excluding the CSV header.
+	Record int64  `json:"record"`
+	ID     string `json:"ID,omitempty"`
+	Error  string `json:"error"`
+}
+
+// pending is a valid record waiting to be saved in a batch. val is either a
+// user.UserUpdate or a rating.Rating.
+type pending struct {
+	record int64
+	ID     string
+	val    interface{}
+}
+
+type Manager struct {
+	errors.ClErrCheck
+	errors.ConflictErrCheck
+
+	db        DB
+	users     UserValidator
+	idGen     IDEr
+	batchSize int32
+	dryRun    bool
+	rejects   io.Writer
+	progress  func(Progress)
+}
+
+// Option allows extra configuration for instantiating Manager. Use the With...
+// functions (e.g. WithBatchSize) to set options.
+type Option func(*Manager) error
+
+// WithBatchSize sets the number of records saved per transaction during
+// Import and fetched per query during Export.
+func WithBatchSize(n int32) Option {
+	return func(m *Manager) error {
+		if n < 1 {
+			return errors.Newf("batch size must be > 0")
+		}
+		m.batchSize = n
+		return nil
+	}
+}
+
+// WithDryRun makes Import validate records without saving them. Ratings of
+// users that would have been imported in the same run are rejected since the
+// users do not exist.
+func WithDryRun() Option {
+	return func(m *Manager) error {
+		m.dryRun = true
+		return nil
+	}
+}
+
+// WithRejects sets w as the writer of the records rejected by Import, each
+// as a line of JSON with the record's position, ID and the reason it was
+// rejected. Rejected records are only counted if w is not set.
+func WithRejects(w io.Writer) Option {
+	return func(m *Manager) error {
+		if w == nil {
+			return errors.Newf("nil rejects writer")
+		}
+		m.rejects = w
+		return nil
+	}
+}
+
+// WithProgress sets f to be called with the Progress of Import and Export
+// after each batch.
+func WithProgress(f func(Progress)) Option {
+	return func(m *Manager) error {
+		if f == nil {
+			return errors.Newf("nil progress func")
+		}
+		m.progress = f
+		return nil
+	}
+}
+
+func NewManager(db DB, users UserValidator, idGen IDEr, opts ...Option) (*Manager, error) {
+	if db == nil {
+		return nil, errors.Newf("nil DB")
+	}
+	if users == nil {
+		return nil, errors.Newf("nil UserValidator")
+	}
+	if idGen == nil {
+		return nil, errors.Newf("nil IDEr")
+	}
+	m := &Manager{db: db, users: users, idGen: idGen, batchSize: DefaultBatchSize}
+	for i, opt := range opts {
+		if opt == nil {
+			return nil, errors.Newf("received nil Option at index %d", i)
+		}
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Import reads records of kind (one of the Kind... values) in format (one of
+// the Format... values) from r and saves them in batches, each within a
+// single transaction. The first skip records are skipped, which resumes an
+// Import that was interrupted after reporting Progress.Records as skip.
+//
+// Users are validated as user.Manager.Update validates them and ratings as
+// rating.Manager.RateUser validates them, except that ratings between users
+// that have blocked each other are not rejected. Invalid records are
+// rejected (see WithRejects) without stopping the Import. Empty values are
+// ignored so that existing values are never cleared. Ratings replace any
+// existing rating by the same user in the same section for the same user,
+// so importing the same records again is harmless.
+func (m *Manager) Import(kind, format string, r io.Reader, skip int64) (Progress, error) {
+
+	p := Progress{Kind: kind}
+	columns, err := columnsOf(kind)
+	if err != nil {
+		return p, err
+	}
+	rr, err := newRecordReader(format, r, columns)
+	if err != nil {
+		return p, err
+	}
+
+	batch := make([]pending, 0, m.batchSize)
+	for {
+		rec, err := rr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !m.IsClientError(err) {
+			return p, errors.Newf("read record %d: %v", p.Records+1, err)
+		}
+		p.Records++
+		if p.Records <= skip {
+			continue
+		}
+		if err != nil {
+			m.reject(&p, p.Records, "", err)
+			continue
+		}
+
+		pd, err := m.parse(kind, rec, p.Records)
+		if err != nil {
+			if !m.IsClientError(err) && !m.IsConflictError(err) {
+				return p, errors.Newf("record %d: %v", p.Records, err)
+			}
+			m.reject(&p, pd.record, pd.ID, err)
+			continue
+		}
+		batch = append(batch, pd)
+
+		if int32(len(batch)) < m.batchSize {
+			continue
+		}
+		if err := m.saveBatch(kind, batch, &p); err != nil {
+			return p, err
+		}
+		batch = batch[:0]
+		m.reportProgress(p)
+	}
+
+	if err := m.saveBatch(kind, batch, &p); err != nil {
+		return p, err
+	}
+	m.reportProgress(p)
+
+	return p, nil
+}
+
+// Export writes all records of kind (one of the Kind... values) to w in
+// format (one of the Format... values) in order of ID. Erased users and users
+// merged into other users are left out. The records written can be imported
+// using Import.
+func (m *Manager) Export(kind, format string, w io.Writer) (Progress, error) {
+
+	p := Progress{Kind: kind}
+	columns, err := columnsOf(kind)
+	if err != nil {
+		return p, err
+	}
+	rw, err := newRecordWriter(format, w, columns)
+	if err != nil {
+		return p, err
+	}
+
+	for afterID := ""; ; {
+		recs, lastID, err := m.exportPage(kind, afterID)
+		if err != nil {
+			if m.db.IsNotFoundError(err) {
+				break
+			}
+			return p, errors.Newf("fetch %s after '%s': %v", kind, afterID, err)
+		}
+		for _, rec := range recs {
+			if err := rw.Write(rec); err != nil {
+				return p, errors.Newf("write record: %v", err)
+			}
+			p.Records++
+		}
+		afterID = lastID
+		m.reportProgress(p)
+	}
+
+	if err := rw.Flush(); err != nil {
+		return p, errors.Newf("flush records: %v", err)
+	}
+
+	return p, nil
+}
+
+// parse converts and validates rec, the record at position recNum, for
+// saving.
+func (m *Manager) parse(kind string, rec record, recNum int64) (pending, error) {
+
+	pd := pending{record: recNum}
+	if ID, ok := rec[colID].(string); ok {
+		pd.ID = ID
+	}
+
+	switch kind {
+	case KindUsers:
+		uu, err := userUpdate(rec)
+		if err != nil {
+			return pd, err
+		}
+		uu.ActorUserID = ImportActorID
+		uu.ActorAccessLevel = jwt.AccessLevelStaff
+		if err := m.users.ValidateUpdate(&uu); err != nil {
+			return pd, err
+		}
+		uu.Time = time.Now()
+		pd.val = uu
+
+	case KindRatings:
+		rt, err := ratingValue(rec, time.Now())
+		if err != nil {
+			return pd, err
+		}
+		if err := rt.Validate(); err != nil {
+			return pd, err
+		}
+		if rt.ID == "" {
+			if rt.ID, err = m.idGen.NextID(); err != nil {
+				return pd, errors.Newf("generate ID: %v", err)
+			}
+		}
+		pd.ID = rt.ID
+		pd.val = rt
+	}
+
+	return pd, nil
+}
+
+// saveBatch saves the records in batch in a single transaction, updating p.
+// If the transaction fails, e.g. because two records claim the same handle,
+// the records are saved one at a time and those that fail are rejected.
+// The error is returned instead if all of them fail since it is then
+// unlikely to be caused by the records.
+func (m *Manager) saveBatch(kind string, batch []pending, p *Progress) error {
+
+	batch, err := m.checkBatch(kind, batch, p)
+	if err != nil {
+		return err
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if m.dryRun {
+		p.Imported += int64(len(batch))
+		return nil
+	}
+
+	if err := m.save(kind, batch); err == nil {
+		p.Imported += int64(len(batch))
+		return nil
+	}
+
+	errs := make([]error, len(batch))
+	var saved int
+	for i, pd := range batch {
+		if errs[i] = m.save(kind, []pending{pd}); errs[i] == nil {
+			saved++
+		}
+	}
+	if saved == 0 && len(batch) > 1 {
+		return errors.Newf("save %s: %v", kind, errs[len(errs)-1])
+	}
+	for i, pd := range batch {
+		if errs[i] != nil {
+			m.reject(p, pd.record, pd.ID, errs[i])
+		}
+	}
+	p.Imported += int64(saved)
+
+	return nil
+}
+
+// checkBatch rejects the ratings in batch whose rater or rated user does not
+// exist, returning the rest.
+func (m *Manager) checkBatch(kind string, batch []pending, p *Progress) ([]pending, error) {
+
+	if kind != KindRatings || len(batch) == 0 {
+		return batch, nil
+	}
+
+	var IDs []string
+	for _, pd := range batch {
+		rt := pd.val.(rating.Rating)
+		IDs = append(IDs, rt.ForUserID, rt.ByUserID)
+	}
+	usrs, err := m.db.Users(IDs)
+	if err != nil && !m.db.IsNotFoundError(err) {
+		return nil, errors.Newf("fetch rated and rating users: %v", err)
+	}
+	// Deactivated users can still rate but cannot be rated, as with
+	// rating.Manager.RateUser.
+	canRate := make(map[string]bool)
+	canBeRated := make(map[string]bool)
+	for _, usr := range usrs {
+		if !usr.Erased.IsZero() || usr.MergedInto != "" {
+			continue
+		}
+		canRate[usr.ID] = true
+		canBeRated[usr.ID] = usr.Deactivated.IsZero()
+	}
+
+	valid := batch[:0]
+	for _, pd := range batch {
+		rt := pd.val.(rating.Rating)
+		switch {
+		case !canBeRated[rt.ForUserID]:
+			m.reject(p, pd.record, pd.ID, errors.NewNotFoundf("user to rate (%s) not found", rt.ForUserID))
+		case !canRate[rt.ByUserID]:
+			m.reject(p, pd.record, pd.ID, errors.NewNotFoundf("rating user (%s) not found", rt.ByUserID))
+		default:
+			valid = append(valid, pd)
+		}
+	}
+	return valid, nil
+}
+
+func (m *Manager) save(kind string, batch []pending) error {
+	switch kind {
+	case KindUsers:
+		uus := make([]user.UserUpdate, len(batch))
+		for i, pd := range batch {
+			uus[i] = pd.val.(user.UserUpdate)
+		}
+		return m.db.ImportUsers(uus)
+	default:
+		rts := make([]rating.Rating, len(batch))
+		for i, pd := range batch {
+			rts[i] = pd.val.(rating.Rating)
+		}
+		return m.db.ImportRatings(rts)
+	}
+}
+
+// exportPage fetches the page of records of kind after the record with
+// afterID returning them and the ID of the last record fetched.
+func (m *Manager) exportPage(kind, afterID string) ([]record, string, error) {
+	var recs []record
+	switch kind {
+	case KindUsers:
+		usrs, err := m.db.UsersAfter(afterID, m.batchSize)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, usr := range usrs {
+			if usr.Erased.IsZero() && usr.MergedInto == "" {
+				recs = append(recs, userRecord(usr))
+			}
+		}
+		return recs, usrs[len(usrs)-1].ID, nil
+	default:
+		rts, err := m.db.RatingsAfter(afterID, m.batchSize)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, rt := range rts {
+			recs = append(recs, ratingRecord(rt))
+		}
+		return recs, rts[len(rts)-1].ID, nil
+	}
+}
+
+// reject records that the record at position recNum with ID was rejected
+// because of err.
+func (m *Manager) reject(p *Progress, recNum int64, ID string, err error) {
+	p.Rejected++
+	if m.rejects == nil {
+		return
+	}
+	rjB, _ := json.Marshal(rejection{Record: recNum, ID: ID, Error: err.Error()})
+	m.rejects.Write(append(rjB, '\n'))
+}
+
+func (m *Manager) reportProgress(p Progress) {
+	if m.progress != nil {
+		m.progress(p)
+	}
+}
+
+// columnsOf returns the columns of records of kind.
+func columnsOf(kind string) ([]string, error) {
+	switch kind {
+	case KindUsers:
+		return userColumns, nil
+	case KindRatings:
+		return ratingColumns, nil
+	default:
+		return nil, errors.NewClientf("kind must be one of %s or %s", KindUsers, KindRatings)
+	}
+}
@@ -0,0 +1,359 @@
+package bulk
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/rating"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+// bulkDB saves batches in memory. A batch containing a user or rating with
+// ID "fail" fails.
+type bulkDB struct {
+	errors.NotFoundErrCheck
+	existing []user.User
+	users    [][]user.UserUpdate
+	ratings  [][]rating.Rating
+	allRts   []rating.Rating
+}
+
+func (db *bulkDB) IsNotFoundError(err error) bool {
+	return db.NotFoundErrCheck.IsNotFoundError(err)
+}
+
+func (db *bulkDB) Users(IDs []string) ([]user.User, error) {
+	var usrs []user.User
+	for _, usr := range db.existing {
+		if in(usr.ID, IDs) {
+			usrs = append(usrs, usr)
+		}
+	}
+	if len(usrs) == 0 {
+		return nil, errors.NewNotFound("no user found for provided IDs")
+	}
+	return usrs, nil
+}
+
+func (db *bulkDB) ImportUsers(uus []user.UserUpdate) error {
+	for _, uu := range uus {
+		if uu.UserID == "fail" {
+			return errors.New("some error")
+		}
+	}
+	db.users = append(db.users, uus)
+	return nil
+}
+
+func (db *bulkDB) ImportRatings(rts []rating.Rating) error {
+	for _, rt := range rts {
+		if rt.ID == "fail" {
+			return errors.New("some error")
+		}
+	}
+	db.ratings = append(db.ratings, rts)
+	return nil
+}
+
+func (db *bulkDB) UsersAfter(afterID string, count int32) ([]user.User, error) {
+	var usrs []user.User
+	for _, usr := range db.existing {
+		if usr.ID > afterID && int32(len(usrs)) < count {
+			usrs = append(usrs, usr)
+		}
+	}
+	if len(usrs) == 0 {
+		return nil, errors.NewNotFound("no user found after ID")
+	}
+	return usrs, nil
+}
+
+func (db *bulkDB) RatingsAfter(afterID string, count int32) ([]rating.Rating, error) {
+	var rts []rating.Rating
+	for _, rt := range db.allRts {
+		if rt.ID > afterID && int32(len(rts)) < count {
+			rts = append(rts, rt)
+		}
+	}
+	if len(rts) == 0 {
+		return nil, errors.NewNotFound("no rating found after ID")
+	}
+	return rts, nil
+}
+
+// genderValidator rejects genders other than male and female and formats
+// ICEPhones by removing spaces.
+type genderValidator struct{}
+
+func (genderValidator) ValidateUpdate(uu *user.UserUpdate) error {
+	if uu.Gender.IsUpdating && uu.Gender.NewValue != "male" && uu.Gender.NewValue != "female" {
+		return errors.NewClient("invalid gender value")
+	}
+	uu.ICEPhone.NewValue = strings.Replace(uu.ICEPhone.NewValue, " ", "", -1)
+	return nil
+}
+
+type seqIDEr struct{ next int }
+
+func (s *seqIDEr) NextID() (string, error) {
+	s.next++
+	return "gen" + string(rune('0'+s.next)), nil
+}
+
+func TestManager_Import(t *testing.T) {
+	existing := []user.User{{ID: "1"}, {ID: "2"}, {ID: "3", Deactivated: time.Now()}}
+	tt := []struct {
+		name        string
+		kind        string
+		format      string
+		in          string
+		skip        int64
+		dryRun      bool
+		expBatches  [][]string
+		expProgress Progress
+		expRejects  []string
+		expErr      bool
+	}{
+		{
+			name:   "users csv",
+			kind:   KindUsers,
+			format: FormatCSV,
+			in: "ID,name,gender,ICEPhone,attributes\n" +
+				"1,Jane,female,+254 712 345678,\"{\"\"bike\"\":\"\"boda\"\"}\"\n" +
+				"2,John,other,,\n" +
+				"3,Jim,male,,\n" +
+				"4,Jill,female\n" +
+				",Jack,male,,\n" +
+				"5,Joy,female,,\n",
+			expBatches:  [][]string{{"1", "3"}, {"5"}},
+			expProgress: Progress{Kind: KindUsers, Records: 6, Imported: 3, Rejected: 3},
+			expRejects:  []string{`"record":2`, `"record":4`, `"record":5`},
+		},
+		{
+			name:   "users jsonl",
+			kind:   KindUsers,
+			format: FormatJSONL,
+			in: `{"ID":"1","name":"Jane","gender":"female","privacy":{"name":"private"}}` + "\n" +
+				"\n" +
+				`{"ID":"2","name":"John","age":30}` + "\n" +
+				`not json` + "\n" +
+				`{"ID":"3","name":"Jim"}`,
+			expBatches:  [][]string{{"1", "3"}},
+			expProgress: Progress{Kind: KindUsers, Records: 4, Imported: 2, Rejected: 2},
+			expRejects:  []string{`"record":2`, `"record":3`},
+		},
+		{
+			name:        "resume",
+			kind:        KindUsers,
+			format:      FormatCSV,
+			in:          "ID,name\n1,Jane\n2,John\n3,Jim\n",
+			skip:        2,
+			expBatches:  [][]string{{"3"}},
+			expProgress: Progress{Kind: KindUsers, Records: 3, Imported: 1},
+		},
+		{
+			name:        "dry run",
+			kind:        KindUsers,
+			format:      FormatCSV,
+			in:          "ID,name\n1,Jane\n2,John\n3,Jim\n",
+			dryRun:      true,
+			expProgress: Progress{Kind: KindUsers, Records: 3, Imported: 3},
+		},
+		{
+			name:        "failed batch saved one at a time",
+			kind:        KindUsers,
+			format:      FormatCSV,
+			in:          "ID,name\n1,Jane\nfail,John\n3,Jim\n",
+			expBatches:  [][]string{{"1"}, {"3"}},
+			expProgress: Progress{Kind: KindUsers, Records: 3, Imported: 2, Rejected: 1},
+			expRejects:  []string{`"record":2,"ID":"fail"`},
+		},
+		{
+			name:   "ratings",
+			kind:   KindRatings,
+			format: FormatCSV,
+			in: "ID,forSection,forUserID,byUserID,rating,created\n" +
+				"r1,driving,1,2,5,2018-01-01T00:00:00Z\n" +
+				",driving,2,1,4,\n" +
+				"r3,driving,3,1,4,\n" +
+				"r4,driving,1,9,4,\n" +
+				"r5,driving,1,2,6,\n",
+			expBatches:  [][]string{{"r1", "gen1"}},
+			expProgress: Progress{Kind: KindRatings, Records: 5, Imported: 2, Rejected: 3},
+			expRejects: []string{`"record":3,"ID":"r3"`, `"record":4,"ID":"r4"`,
+				`"record":5,"ID":"r5"`},
+		},
+		{
+			name:   "unknown csv column",
+			kind:   KindUsers,
+			format: FormatCSV,
+			in:     "ID,age\n1,30\n",
+			expErr: true,
+		},
+		{
+			name:   "invalid format",
+			kind:   KindUsers,
+			format: "xml",
+			in:     "<users/>",
+			expErr: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &bulkDB{existing: existing}
+			rejects := &bytes.Buffer{}
+			opts := []Option{WithBatchSize(2), WithRejects(rejects)}
+			if tc.dryRun {
+				opts = append(opts, WithDryRun())
+			}
+			m, err := NewManager(db, genderValidator{}, &seqIDEr{}, opts...)
+			if err != nil {
+				t.Fatalf("NewManager(): %v", err)
+			}
+
+			p, err := m.Import(tc.kind, tc.format, strings.NewReader(tc.in), tc.skip)
+			if tc.expErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+
+			if p != tc.expProgress {
+				t.Errorf("Expected progress %+v, got %+v", tc.expProgress, p)
+			}
+			var batches [][]string
+			for _, uus := range db.users {
+				var IDs []string
+				for _, uu := range uus {
+					IDs = append(IDs, uu.UserID)
+				}
+				batches = append(batches, IDs)
+			}
+			for _, rts := range db.ratings {
+				var IDs []string
+				for _, rt := range rts {
+					IDs = append(IDs, rt.ID)
+				}
+				batches = append(batches, IDs)
+			}
+			if len(batches) != len(tc.expBatches) {
+				t.Fatalf("Expected batches %v, got %v", tc.expBatches, batches)
+			}
+			for i := range batches {
+				if strings.Join(batches[i], ",") != strings.Join(tc.expBatches[i], ",") {
+					t.Errorf("Expected batches %v, got %v", tc.expBatches, batches)
+				}
+			}
+			rejected := strings.Split(strings.TrimSpace(rejects.String()), "\n")
+			if len(tc.expRejects) == 0 && rejects.Len() > 0 {
+				t.Errorf("Expected no rejects, got %v", rejected)
+			}
+			if len(tc.expRejects) > 0 && len(rejected) != len(tc.expRejects) {
+				t.Fatalf("Expected rejects %v, got %v", tc.expRejects, rejected)
+			}
+			for i, expRj := range tc.expRejects {
+				if !strings.Contains(rejected[i], expRj) {
+					t.Errorf("Expected reject %d to contain %s, got %s", i, expRj, rejected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestManager_Import_values(t *testing.T) {
+	db := &bulkDB{}
+	m, err := NewManager(db, genderValidator{}, &seqIDEr{})
+	if err != nil {
+		t.Fatalf("NewManager(): %v", err)
+	}
+	in := `{"ID":"1","name":"Jane","bio":"","ICEPhone":"+254 712 345678","attributes":{"seats":3}}`
+	if _, err := m.Import(KindUsers, FormatJSONL, strings.NewReader(in), 0); err != nil {
+		t.Fatalf("Import(): %v", err)
+	}
+	if len(db.users) != 1 || len(db.users[0]) != 1 {
+		t.Fatalf("Expected 1 batch of 1 user, got %v", db.users)
+	}
+	uu := db.users[0][0]
+	if uu.Name != (user.StringUpdate{IsUpdating: true, NewValue: "Jane"}) {
+		t.Errorf("Expected name to be updated to Jane, got %+v", uu.Name)
+	}
+	if uu.Bio.IsUpdating {
+		t.Errorf("Expected empty bio not to be updated")
+	}
+	if uu.ICEPhone.NewValue != "+254712345678" {
+		t.Errorf("Expected ICEPhone to be formatted, got %s", uu.ICEPhone.NewValue)
+	}
+	if uu.Attributes["seats"] != 3.0 {
+		t.Errorf("Expected seats attribute 3, got %v", uu.Attributes["seats"])
+	}
+	if uu.ActorUserID != ImportActorID || uu.Time.IsZero() {
+		t.Errorf("Expected actor and time to be set, got %s and %v", uu.ActorUserID, uu.Time)
+	}
+}
+
+func TestManager_Export(t *testing.T) {
+	created := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	db := &bulkDB{
+		existing: []user.User{
+			{ID: "1", Name: "Jane, Doe", Gender: "female", Attributes: map[string]interface{}{"seats": 3.0}},
+			{ID: "2", Name: "", Erased: created},
+			{ID: "3", Name: "Jim", Gender: "male", MergedInto: "1"},
+			{ID: "4", Name: "Joy", Gender: "female", Privacy: user.Privacy{user.FieldName: user.VisibilityPrivate}},
+		},
+		allRts: []rating.Rating{
+			{ID: "r1", ForSection: "driving", ForUserID: "1", ByUserID: "4", Rating: 5,
+				Created: created, LastUpdated: created},
+		},
+	}
+	tt := []struct {
+		name   string
+		kind   string
+		format string
+		exp    string
+	}{
+		{
+			name:   "users csv",
+			kind:   KindUsers,
+			format: FormatCSV,
+			exp: "ID,handle,name,gender,ICEPhone,avatarURL,bio,country,locale,timezone,email,attributes,privacy\n" +
+				"1,,\"Jane, Doe\",female,,,,,,,,\"{\"\"seats\"\":3}\",\n" +
+				"4,,Joy,female,,,,,,,,,\"{\"\"name\"\":\"\"private\"\"}\"\n",
+		},
+		{
+			name:   "users jsonl",
+			kind:   KindUsers,
+			format: FormatJSONL,
+			exp: `{"ID":"1","attributes":{"seats":3},"gender":"female","name":"Jane, Doe"}` + "\n" +
+				`{"ID":"4","gender":"female","name":"Joy","privacy":{"name":"private"}}` + "\n",
+		},
+		{
+			name:   "ratings csv",
+			kind:   KindRatings,
+			format: FormatCSV,
+			exp: "ID,forSection,forUserID,byUserID,rating,comment,created,lastUpdated\n" +
+				"r1,driving,1,4,5,,2018-01-01T00:00:00Z,2018-01-01T00:00:00Z\n",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := NewManager(db, genderValidator{}, &seqIDEr{}, WithBatchSize(2))
+			if err != nil {
+				t.Fatalf("NewManager(): %v", err)
+			}
+			out := &bytes.Buffer{}
+			if _, err := m.Export(tc.kind, tc.format, out); err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if out.String() != tc.exp {
+				t.Errorf("Expected\n%s\ngot\n%s", tc.exp, out.String())
+			}
+		})
+	}
+}
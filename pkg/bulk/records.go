@@ -0,0 +1,238 @@
+package bulk
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/rating"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+// Names of the columns (CSV) or keys (JSONL) of records that are not user
+// profile fields (the user.Field... values).
+const (
+	colID          = "ID"
+	colAttributes  = "attributes"
+	colPrivacy     = "privacy"
+	colForSection  = "forSection"
+	colForUserID   = "forUserID"
+	colByUserID    = "byUserID"
+	colRating      = "rating"
+	colComment     = "comment"
+	colCreated     = "created"
+	colLastUpdated = "lastUpdated"
+)
+
+// userStringFields maps the user profile fields that can be imported to the
+// corresponding value in a user.UserUpdate.
+var userStringFields = map[string]func(uu *user.UserUpdate) *user.StringUpdate{
+	user.FieldHandle:    func(uu *user.UserUpdate) *user.StringUpdate { return &uu.Handle },
+	user.FieldName:      func(uu *user.UserUpdate) *user.StringUpdate { return &uu.Name },
+	user.FieldGender:    func(uu *user.UserUpdate) *user.StringUpdate { return &uu.Gender },
+	user.FieldICEPhone:  func(uu *user.UserUpdate) *user.StringUpdate { return &uu.ICEPhone },
+	user.FieldAvatarURL: func(uu *user.UserUpdate) *user.StringUpdate { return &uu.AvatarURL },
+	user.FieldBio:       func(uu *user.UserUpdate) *user.StringUpdate { return &uu.Bio },
+	user.FieldCountry:   func(uu *user.UserUpdate) *user.StringUpdate { return &uu.Country },
+	user.FieldLocale:    func(uu *user.UserUpdate) *user.StringUpdate { return &uu.Locale },
+	user.FieldTimezone:  func(uu *user.UserUpdate) *user.StringUpdate { return &uu.Timezone },
+	user.FieldEmail:     func(uu *user.UserUpdate) *user.StringUpdate { return &uu.Email },
+}
+
+// userColumns and ratingColumns are the columns of user and rating records
+// in the order they are exported.
+var userColumns = []string{colID, user.FieldHandle, user.FieldName,
+	user.FieldGender, user.FieldICEPhone, user.FieldAvatarURL, user.FieldBio,
+	user.FieldCountry, user.FieldLocale, user.FieldTimezone, user.FieldEmail,
+	colAttributes, colPrivacy}
+var ratingColumns = []string{colID, colForSection, colForUserID, colByUserID,
+	colRating, colComment, colCreated, colLastUpdated}
+
+// record is a single user or rating read from or written to a file keyed by
+// column name. Values are strings except for the JSON-decoded attributes,
+// privacy and rating values of JSONL records.
+type record map[string]interface{}
+
+// userUpdate converts rec into an update of the user with the record's ID.
+// Empty values are not updated so that importing never clears a user's
+// existing values.
+func userUpdate(rec record) (user.UserUpdate, error) {
+
+	uu := user.UserUpdate{}
+	for col, val := range rec {
+		if col == colAttributes || col == colPrivacy {
+			continue
+		}
+		str, err := stringValue(col, val)
+		if err != nil {
+			return uu, err
+		}
+		if col == colID {
+			uu.UserID = str
+			continue
+		}
+		field, ok := userStringFields[col]
+		if !ok {
+			return uu, errors.NewClientf("unknown user column '%s'", col)
+		}
+		if str != "" {
+			*field(&uu) = user.StringUpdate{IsUpdating: true, NewValue: str}
+		}
+	}
+
+	if uu.UserID == "" {
+		return uu, errors.NewClientf("%s was empty", colID)
+	}
+	if err := objectValue(colAttributes, rec[colAttributes], &uu.Attributes); err != nil {
+		return uu, err
+	}
+	if err := objectValue(colPrivacy, rec[colPrivacy], &uu.Privacy); err != nil {
+		return uu, err
+	}
+
+	return uu, nil
+}
+
+// userRecord converts usr into a record, leaving out empty values.
+func userRecord(usr user.User) record {
+	rec := record{colID: usr.ID}
+	for col, val := range map[string]string{
+		user.FieldHandle:    usr.Handle,
+		user.FieldName:      usr.Name,
+		user.FieldGender:    usr.Gender,
+		user.FieldICEPhone:  usr.ICEPhone,
+		user.FieldAvatarURL: usr.AvatarURL,
+		user.FieldBio:       usr.Bio,
+		user.FieldCountry:   usr.Country,
+		user.FieldLocale:    usr.Locale,
+		user.FieldTimezone:  usr.Timezone,
+		user.FieldEmail:     usr.Email,
+	} {
+		if val != "" {
+			rec[col] = val
+		}
+	}
+	if len(usr.Attributes) > 0 {
+		rec[colAttributes] = usr.Attributes
+	}
+	if len(usr.Privacy) > 0 {
+		rec[colPrivacy] = map[string]string(usr.Privacy)
+	}
+	return rec
+}
+
+// ratingValue converts rec into a rating. Created and LastUpdated default to
+// now if empty.
+func ratingValue(rec record, now time.Time) (rating.Rating, error) {
+
+	rt := rating.Rating{Created: now, LastUpdated: now}
+	for col, val := range rec {
+		if col == colRating {
+			continue
+		}
+		str, err := stringValue(col, val)
+		if err != nil {
+			return rt, err
+		}
+		switch col {
+		case colID:
+			rt.ID = str
+		case colForSection:
+			rt.ForSection = str
+		case colForUserID:
+			rt.ForUserID = str
+		case colByUserID:
+			rt.ByUserID = str
+		case colComment:
+			rt.Comment = str
+		case colCreated, colLastUpdated:
+			if str == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339Nano, str)
+			if err != nil {
+				return rt, errors.NewClientf("%s must be an RFC3339 time: %v", col, err)
+			}
+			if col == colCreated {
+				rt.Created = t
+			} else {
+				rt.LastUpdated = t
+			}
+		default:
+			return rt, errors.NewClientf("unknown rating column '%s'", col)
+		}
+	}
+
+	var rtStr string
+	switch val := rec[colRating].(type) {
+	case string:
+		rtStr = val
+	case json.Number:
+		rtStr = val.String()
+	case nil:
+	default:
+		return rt, errors.NewClientf("%s must be a whole number", colRating)
+	}
+	rtVal, err := strconv.ParseInt(strings.TrimSpace(rtStr), 10, 32)
+	if err != nil {
+		return rt, errors.NewClientf("%s must be a whole number", colRating)
+	}
+	rt.Rating = int32(rtVal)
+
+	return rt, nil
+}
+
+// ratingRecord converts rt into a record, leaving out an empty comment.
+func ratingRecord(rt rating.Rating) record {
+	rec := record{
+		colID:          rt.ID,
+		colForSection:  rt.ForSection,
+		colForUserID:   rt.ForUserID,
+		colByUserID:    rt.ByUserID,
+		colRating:      rt.Rating,
+		colCreated:     rt.Created.Format(time.RFC3339Nano),
+		colLastUpdated: rt.LastUpdated.Format(time.RFC3339Nano),
+	}
+	if rt.Comment != "" {
+		rec[colComment] = rt.Comment
+	}
+	return rec
+}
+
+// stringValue returns val, the value of column col, as a string.
+func stringValue(col string, val interface{}) (string, error) {
+	switch v := val.(type) {
+	case string:
+		return strings.TrimSpace(v), nil
+	case nil:
+		return "", nil
+	default:
+		return "", errors.NewClientf("%s must be a string", col)
+	}
+}
+
+// objectValue decodes val, the value of column col, into into. val is a JSON
+// encoded object in CSV records and already decoded in JSONL records.
+func objectValue(col string, val interface{}, into interface{}) error {
+	var valB []byte
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return nil
+		}
+		valB = []byte(v)
+	default:
+		var err error
+		if valB, err = json.Marshal(v); err != nil {
+			return errors.NewClientf("%s must be an object: %v", col, err)
+		}
+	}
+	if err := json.Unmarshal(valB, into); err != nil {
+		return errors.NewClientf("%s must be an object: %v", col, err)
+	}
+	return nil
+}
@@ -31,6 +31,7 @@ var (
 	defaultInstallDir       = path.Join("/usr", "local", "bin")
 	defaultSysDUnitFilePath = path.Join("/etc", "systemd", "system", DefaultSysDUnitName())
 	sysDConfDir             = path.Join("/etc", Name)
+	defaultAvatarsDir       = path.Join("/var", "lib", Name, "avatars")
 	defaultConfDir          = sysDConfDir
 )
 
@@ -93,6 +94,10 @@ func DefaultDocsDir() string {
 	return path.Join(defaultConfDir, DocsPath)
 }
 
+func DefaultAvatarsDir() string {
+	return defaultAvatarsDir
+}
+
 func DefaultConfPath() string {
 	return path.Join(defaultConfDir, CanonicalName()+".conf.yml")
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/tomogoma/crdb"
 	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/user"
 	"gopkg.in/yaml.v2"
 )
 
@@ -21,10 +22,92 @@ type Ratings struct {
 	SyncInterval time.Duration `json:"syncInterval" yaml:"syncInterval"`
 }
 
+type Users struct {
+	Attributes      []user.AttributeSpec `json:"attributes" yaml:"attributes"`
+	ReservedHandles []string             `json:"reservedHandles" yaml:"reservedHandles"`
+	HandleCooldown  time.Duration        `json:"handleCooldown" yaml:"handleCooldown"`
+	// CompletenessWeights replaces the default weights of profile fields
+	// in the completeness score if not empty.
+	CompletenessWeights map[string]int `json:"completenessWeights" yaml:"completenessWeights"`
+	// Genders replaces the default genders users can choose from if not
+	// empty.
+	Genders []user.Gender `json:"genders" yaml:"genders"`
+}
+
+type Phones struct {
+	DefaultRegion string   `json:"defaultRegion" yaml:"defaultRegion"`
+	NumberTypes   []string `json:"numberTypes" yaml:"numberTypes"`
+	E164          bool     `json:"e164" yaml:"e164"`
+	// CodeValidity and MaxCodeAttempts configure ICEPhone verification codes.
+	CodeValidity    time.Duration `json:"codeValidity" yaml:"codeValidity"`
+	MaxCodeAttempts int32         `json:"maxCodeAttempts" yaml:"maxCodeAttempts"`
+}
+
+type SMTP struct {
+	Host     string `json:"host" yaml:"host"`
+	Port     int    `json:"port" yaml:"port"`
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	From     string `json:"from" yaml:"from"`
+}
+
+type Emails struct {
+	VerifyURL     string        `json:"verifyURL" yaml:"verifyURL"`
+	TokenValidity time.Duration `json:"tokenValidity" yaml:"tokenValidity"`
+	SMTP          SMTP          `json:"smtp" yaml:"smtp"`
+}
+
+type Avatars struct {
+	StoreDir     string `json:"storeDir" yaml:"storeDir"`
+	URLPrefix    string `json:"urlPrefix" yaml:"urlPrefix"`
+	MaxBytes     int64  `json:"maxBytes" yaml:"maxBytes"`
+	MinDimension int    `json:"minDimension" yaml:"minDimension"`
+	MaxDimension int    `json:"maxDimension" yaml:"maxDimension"`
+	Sizes        []int  `json:"sizes" yaml:"sizes"`
+	// AllowedHosts are the hosts, other than this service, that a user's
+	// avatarURL may point at. Defaults to none.
+	AllowedHosts []string `json:"allowedHosts" yaml:"allowedHosts"`
+}
+
+type Moderation struct {
+	// Words lists the words and phrases that flag new names, bios and
+	// avatar URLs for review by staff. Moderation is disabled if empty.
+	Words []string `json:"words" yaml:"words"`
+	// Mode is how flagged values are handled pending review, one of
+	// user.ModerationModeHold or user.ModerationModeHide. Defaults to
+	// user.ModerationModeHold.
+	Mode string `json:"mode" yaml:"mode"`
+}
+
+type Events struct {
+	// DispatchInterval is how often the outbox is checked for events to
+	// publish. Defaults to events.DefaultInterval.
+	DispatchInterval time.Duration `json:"dispatchInterval" yaml:"dispatchInterval"`
+	BatchSize        int32         `json:"batchSize" yaml:"batchSize"`
+	Lease            time.Duration `json:"lease" yaml:"lease"`
+	// MinBackoff and MaxBackoff bound the delay before retrying an event
+	// that failed to publish.
+	MinBackoff time.Duration `json:"minBackoff" yaml:"minBackoff"`
+	MaxBackoff time.Duration `json:"maxBackoff" yaml:"maxBackoff"`
+	// FeedRetention is how long events are kept for clients of the change
+	// streams to resume from. Defaults to feed.DefaultRetention.
+	FeedRetention time.Duration `json:"feedRetention" yaml:"feedRetention"`
+	// StreamInterval is how often change streams check for new events.
+	StreamInterval time.Duration `json:"streamInterval" yaml:"streamInterval"`
+}
+
 type General struct {
 	Service  Service     `json:"serviceConfig,omitempty" yaml:"serviceConfig"`
 	Database crdb.Config `json:"database,omitempty" yaml:"database"`
 	Ratings  Ratings     `json:"ratings" yaml:"ratings"`
+	Users    Users       `json:"users" yaml:"users"`
+	Phones   Phones      `json:"phones" yaml:"phones"`
+	Emails   Emails      `json:"emails" yaml:"emails"`
+	Avatars  Avatars     `json:"avatars" yaml:"avatars"`
+	// Moderation configures checking of user submitted content.
+	Moderation Moderation `json:"moderation" yaml:"moderation"`
+	// Events configures publishing of domain events.
+	Events Events `json:"events" yaml:"events"`
 }
 
 func ReadFile(fName string) (conf General, err error) {
@@ -0,0 +1,189 @@
+package roach
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+var allBlockCols = ColDesc(ColUserID, ColBlockedID, ColCreated)
+
+// Blocks fetches the blocks made by the user with userID, most recent first.
+func (r *Roach) Blocks(userID string) ([]user.Block, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	q := `
+		SELECT ` + allBlockCols + ` FROM ` + TblBlocks + `
+			WHERE ` + ColUserID + `=$1
+			ORDER BY ` + ColCreated + ` DESC, ` + ColBlockedID + `
+	`
+	rows, err := r.db.Query(q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bs []user.Block
+	for rows.Next() {
+		b, err := scanBlock(rows)
+		if err != nil {
+			return nil, errors.Newf("scan block from row: %v", err)
+		}
+		bs = append(bs, *b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterate result set: %v", err)
+	}
+
+	if len(bs) == 0 {
+		return nil, errors.NewNotFound("no blocks found")
+	}
+
+	return bs, nil
+}
+
+// InsertBlock inserts b or returns the existing block if the user with
+// b.UserID has already blocked the user with b.BlockedUserID. Follows in
+// either direction and any connection or pending connection request between
+// the two users are removed within the same transaction. A not found error
+// is returned if the blocker does not exist.
+func (r *Roach) InsertBlock(b user.Block) (*user.Block, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	var saved *user.Block
+	err := r.ExecuteTx(func(tx *sql.Tx) error {
+
+		q := `
+			INSERT INTO ` + TblBlocks + ` (` + allBlockCols + `)
+				SELECT $1, $2, $3 WHERE EXISTS (
+					SELECT ` + ColID + ` FROM ` + TblUsers + ` WHERE ` + ColID + `=$1
+				)
+				ON CONFLICT (` + ColUserID + `, ` + ColBlockedID + `) DO NOTHING
+		`
+		if _, err := tx.Exec(q, b.UserID, b.BlockedUserID, b.Created); err != nil {
+			return err
+		}
+
+		q = `
+			SELECT ` + allBlockCols + ` FROM ` + TblBlocks + `
+				WHERE ` + ColUserID + `=$1 AND ` + ColBlockedID + `=$2
+		`
+		var err error
+		saved, err = scanBlock(tx.QueryRow(q, b.UserID, b.BlockedUserID))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errors.NewNotFound("blocking user not found")
+			}
+			return err
+		}
+
+		return deleteRelationsBetween(tx, b.UserID, b.BlockedUserID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+// DeleteBlock removes the block of the user with blockedUserID by the user
+// with userID.
+func (r *Roach) DeleteBlock(userID, blockedUserID string) error {
+	if err := r.InitDBIfNot(); err != nil {
+		return err
+	}
+
+	q := `
+		DELETE FROM ` + TblBlocks + `
+			WHERE ` + ColUserID + `=$1 AND ` + ColBlockedID + `=$2
+	`
+	res, err := r.db.Exec(q, userID, blockedUserID)
+	return checkRowsAffected(res, err, 1)
+}
+
+// BlockersOf returns those of otherUserIDs that have blocked the user with
+// userID.
+func (r *Roach) BlockersOf(userID string, otherUserIDs []string) ([]string, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	q := `
+		SELECT ` + ColUserID + ` FROM ` + TblBlocks + `
+			WHERE ` + ColBlockedID + `=$1 AND ` + ColUserID + ` = ANY($2)
+	`
+	rows, err := r.db.Query(q, userID, pq.Array(otherUserIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var IDs []string
+	for rows.Next() {
+		var ID string
+		if err := rows.Scan(&ID); err != nil {
+			return nil, errors.Newf("scan row in result set: %v", err)
+		}
+		IDs = append(IDs, ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterating result set: %v", err)
+	}
+
+	if len(IDs) == 0 {
+		return nil, errors.NewNotFound("no blockers found")
+	}
+
+	return IDs, nil
+}
+
+// EitherBlocked returns true if either of the users with userID and
+// otherUserID has blocked the other.
+func (r *Roach) EitherBlocked(userID, otherUserID string) (bool, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return false, err
+	}
+
+	q := `
+		SELECT EXISTS (
+			SELECT ` + ColUserID + ` FROM ` + TblBlocks + `
+				WHERE (` + ColUserID + `=$1 AND ` + ColBlockedID + `=$2)
+					OR (` + ColUserID + `=$2 AND ` + ColBlockedID + `=$1)
+		)
+	`
+	var blocked bool
+	if err := r.db.QueryRow(q, userID, otherUserID).Scan(&blocked); err != nil {
+		return false, err
+	}
+	return blocked, nil
+}
+
+// deleteRelationsBetween removes the follows in either direction and any
+// connection or pending connection request between the users with userID and
+// otherUserID using tx.
+func deleteRelationsBetween(tx *sql.Tx, userID, otherUserID string) error {
+	if err := deleteFollowsBetween(tx, userID, otherUserID); err != nil {
+		return err
+	}
+	q := `DELETE FROM ` + TblConnections + ` WHERE ` + eitherDirection
+	if _, err := tx.Exec(q, userID, otherUserID); err != nil {
+		return errors.Newf("delete connection: %v", err)
+	}
+	return nil
+}
+
+// scanBlock extracts a block from s or returns an error if reported by s.
+// The column order for s must be same order as allBlockCols variable.
+func scanBlock(s multiScanner) (*user.Block, error) {
+	b := &user.Block{}
+	if err := s.Scan(&b.UserID, &b.BlockedUserID, &b.Created); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,169 @@
+package roach
+
+import (
+	"database/sql"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/rating"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+// ImportUsers upserts each of uus as UpsertUser would, all within a single
+// transaction.
+func (r *Roach) ImportUsers(uus []user.UserUpdate) error {
+	if err := r.InitDBIfNot(); err != nil {
+		return err
+	}
+	return r.ExecuteTx(func(tx *sql.Tx) error {
+		for _, uu := range uus {
+			if _, err := upsertUserTx(tx, uu); err != nil {
+				return errors.Newf("upsert user %s: %v", uu.UserID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// ImportRatings saves rts within a single transaction and recomputes the
+// ratings of the users rated. A rating replaces any existing rating by the
+// same user in the same section for the same user, keeping the existing
+// rating's ID and Created values.
+func (r *Roach) ImportRatings(rts []rating.Rating) error {
+	if err := r.InitDBIfNot(); err != nil {
+		return err
+	}
+	return r.ExecuteTx(func(tx *sql.Tx) error {
+
+		rated := make(map[string]bool)
+		var ratedIDs []string
+		for _, rt := range rts {
+			if err := importRating(tx, rt); err != nil {
+				return errors.Newf("import rating %s: %v", rt.ID, err)
+			}
+			if !rated[rt.ForUserID] {
+				rated[rt.ForUserID] = true
+				ratedIDs = append(ratedIDs, rt.ForUserID)
+			}
+		}
+
+		for _, userID := range ratedIDs {
+			if err := syncUserRating(tx, userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// importRating updates the rating matching rt's rater, section and rated user
+// using tx or inserts rt if there is none, writing a rating created event to
+// the outbox for an inserted rating.
+func importRating(tx *sql.Tx, rt rating.Rating) error {
+
+	updCols := ColDesc(ColRating, ColComment, ColLastUpdated)
+	q := `
+		UPDATE ` + TblRatings + ` SET (` + updCols + `) = ($1, $2, $3)
+			WHERE ` + ColByUserID + `=$4
+				AND ` + ColForSection + `=$5
+				AND ` + ColForUserID + `=$6
+	`
+	res, err := tx.Exec(q, rt.Rating, rt.Comment, rt.LastUpdated, rt.ByUserID,
+		rt.ForSection, rt.ForUserID)
+	if err != nil {
+		return errors.Newf("update existing rating: %v", err)
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return errors.Newf("check rows affected: %v", err)
+	}
+	if updated > 0 {
+		return nil
+	}
+
+	q = `
+		INSERT INTO ` + TblRatings + ` (` + allRatingCols + `)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	res, err = tx.Exec(q, rt.ID, rt.ForSection, rt.ForUserID, rt.ByUserID,
+		rt.Rating, rt.Comment, rt.Created, rt.LastUpdated)
+	if err := checkRowsAffected(res, err, 1); err != nil {
+		return err
+	}
+	return insertRatingCreatedEvent(tx, rt)
+}
+
+// UsersAfter fetches up to count users whose IDs sort after afterID, in
+// order of ID. Use an empty afterID to start from the first user.
+func (r *Roach) UsersAfter(afterID string, count int32) ([]user.User, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	q := `
+		SELECT ` + allUserCols + ` FROM ` + TblUsers + `
+			WHERE ` + ColID + ` > $1
+			ORDER BY ` + ColID + `
+			LIMIT $2
+	`
+	rows, err := r.db.Query(q, afterID, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usrs []user.User
+	for rows.Next() {
+		usr, err := scanUser(rows)
+		if err != nil {
+			return nil, errors.Newf("scan user from row: %v", err)
+		}
+		usrs = append(usrs, *usr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterate result set: %v", err)
+	}
+
+	if len(usrs) == 0 {
+		return nil, errors.NewNotFound("no user found after ID")
+	}
+
+	return usrs, nil
+}
+
+// RatingsAfter fetches up to count ratings whose IDs sort after afterID, in
+// order of ID. Use an empty afterID to start from the first rating.
+func (r *Roach) RatingsAfter(afterID string, count int32) ([]rating.Rating, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	q := `
+		SELECT ` + allRatingCols + ` FROM ` + TblRatings + `
+			WHERE ` + ColID + ` > $1
+			ORDER BY ` + ColID + `
+			LIMIT $2
+	`
+	rows, err := r.db.Query(q, afterID, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rts []rating.Rating
+	for rows.Next() {
+		rt, err := scanRating(rows)
+		if err != nil {
+			return nil, errors.Newf("scan rating from row: %v", err)
+		}
+		rts = append(rts, *rt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterate result set: %v", err)
+	}
+
+	if len(rts) == 0 {
+		return nil, errors.NewNotFound("no rating found after ID")
+	}
+
+	return rts, nil
+}
@@ -0,0 +1,215 @@
+package roach
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tomogoma/crdb"
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+var allConnectionCols = ColDesc(ColUserID, ColConnectedID, ColCreated, ColAccepted)
+
+// eitherDirection matches connections between the users in params $1 and $2
+// regardless of who requested them.
+var eitherDirection = `((` + ColUserID + `=$1 AND ` + ColConnectedID + `=$2) OR
+	(` + ColUserID + `=$2 AND ` + ColConnectedID + `=$1))`
+
+// Connection fetches the connection between the users with userID and
+// otherUserID regardless of who requested it.
+func (r *Roach) Connection(userID, otherUserID string) (*user.Connection, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	q := `SELECT ` + allConnectionCols + ` FROM ` + TblConnections + ` WHERE ` + eitherDirection
+	c, err := scanConnection(r.db.QueryRow(q, userID, otherUserID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.NewNotFound("connection not found")
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// InsertConnection inserts the pending connection c. A conflict error is
+// returned if a connection between the two users already exists.
+func (r *Roach) InsertConnection(c user.Connection) (*user.Connection, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	var saved *user.Connection
+	err := r.ExecuteTx(func(tx *sql.Tx) error {
+
+		q := `SELECT EXISTS (SELECT ` + ColUserID + ` FROM ` + TblConnections + ` WHERE ` + eitherDirection + `)`
+		var exists bool
+		if err := tx.QueryRow(q, c.UserID, c.ConnectedUserID).Scan(&exists); err != nil {
+			return errors.Newf("check connection exists: %v", err)
+		}
+		if exists {
+			return errors.NewConflict("a connection between the users exists")
+		}
+
+		cols := ColDesc(ColUserID, ColConnectedID, ColCreated)
+		q = `
+			INSERT INTO ` + TblConnections + ` (` + cols + `)
+				VALUES ($1, $2, $3)
+				RETURNING ` + allConnectionCols + `
+		`
+		var err error
+		saved, err = scanConnection(tx.QueryRow(q, c.UserID, c.ConnectedUserID, c.Created))
+		if err != nil {
+			if isUniqueViolation(err) {
+				return errors.NewConflict("a connection between the users exists")
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+// AcceptConnection accepts the pending connection requested by the user with
+// requesterID from the user with userID.
+func (r *Roach) AcceptConnection(requesterID, userID string, at time.Time) (*user.Connection, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	q := `
+		UPDATE ` + TblConnections + ` SET ` + ColAccepted + `=$1
+			WHERE ` + ColUserID + `=$2 AND ` + ColConnectedID + `=$3
+				AND ` + ColAccepted + ` IS NULL
+			RETURNING ` + allConnectionCols + `
+	`
+	c, err := scanConnection(r.db.QueryRow(q, at, requesterID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.NewNotFound("no pending connection found")
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// DeleteConnection removes the connection between the users with userID and
+// otherUserID regardless of who requested it.
+func (r *Roach) DeleteConnection(userID, otherUserID string) error {
+	if err := r.InitDBIfNot(); err != nil {
+		return err
+	}
+
+	q := `DELETE FROM ` + TblConnections + ` WHERE ` + eitherDirection
+	res, err := r.db.Exec(q, userID, otherUserID)
+	return checkRowsAffected(res, err, 1)
+}
+
+// Connections fetches the accepted (or pending if not accepted) connections
+// of the user with userID, most recent first.
+func (r *Roach) Connections(userID string, accepted bool, offset int64, count int32) ([]user.Connection, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	acceptedCond := ColAccepted + ` IS NULL`
+	orderCol := ColCreated
+	if accepted {
+		acceptedCond = ColAccepted + ` IS NOT NULL`
+		orderCol = ColAccepted
+	}
+
+	limit, args := crdb.Pagination(offset, int64(count), []interface{}{userID})
+	q := `
+		SELECT ` + allConnectionCols + ` FROM ` + TblConnections + `
+			WHERE (` + ColUserID + `=$1 OR ` + ColConnectedID + `=$1)
+				AND ` + acceptedCond + `
+			ORDER BY ` + orderCol + ` DESC, ` + ColUserID + `, ` + ColConnectedID + `
+			` + limit
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cs []user.Connection
+	for rows.Next() {
+		c, err := scanConnection(rows)
+		if err != nil {
+			return nil, errors.Newf("scan connection from row: %v", err)
+		}
+		cs = append(cs, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterate result set: %v", err)
+	}
+
+	if len(cs) == 0 {
+		return nil, errors.NewNotFound("no connections found")
+	}
+
+	return cs, nil
+}
+
+// AcceptedConnections returns those of otherUserIDs that have an accepted
+// connection with the user with userID.
+func (r *Roach) AcceptedConnections(userID string, otherUserIDs []string) ([]string, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	q := `
+		SELECT ` + ColConnectedID + ` FROM ` + TblConnections + `
+			WHERE ` + ColUserID + `=$1 AND ` + ColConnectedID + ` = ANY($2)
+				AND ` + ColAccepted + ` IS NOT NULL
+		UNION
+		SELECT ` + ColUserID + ` FROM ` + TblConnections + `
+			WHERE ` + ColConnectedID + `=$1 AND ` + ColUserID + ` = ANY($2)
+				AND ` + ColAccepted + ` IS NOT NULL
+	`
+	rows, err := r.db.Query(q, userID, pq.Array(otherUserIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var IDs []string
+	for rows.Next() {
+		var ID string
+		if err := rows.Scan(&ID); err != nil {
+			return nil, errors.Newf("scan row in result set: %v", err)
+		}
+		IDs = append(IDs, ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterating result set: %v", err)
+	}
+
+	if len(IDs) == 0 {
+		return nil, errors.NewNotFound("no accepted connections found")
+	}
+
+	return IDs, nil
+}
+
+// scanConnection extracts a connection from s or returns an error if
+// reported by s. The column order for s must be same order as
+// allConnectionCols variable.
+func scanConnection(s multiScanner) (*user.Connection, error) {
+	c := &user.Connection{}
+	accepted := pq.NullTime{}
+	if err := s.Scan(&c.UserID, &c.ConnectedUserID, &c.Created, &accepted); err != nil {
+		return nil, err
+	}
+	c.Accepted = accepted.Time
+	return c, nil
+}
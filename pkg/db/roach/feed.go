@@ -0,0 +1,131 @@
+package roach
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/events"
+)
+
+var allFeedCols = ColDesc(ColID, ColUserID, ColTopic, ColPayload, ColCreated)
+
+// feedSettleDelay is how long after being written a change feed event is
+// read. IDs follow the order events are written rather than the order their
+// transactions commit so an event can commit after one with a higher ID has
+// been read. Only reading events up to the highest ID committed
+// feedSettleDelay ago ensures transactions that took less than that to
+// commit are not missed.
+const feedSettleDelay = 10 * time.Second
+
+// LastFeedEventID returns the ID of the most recent change feed event that
+// has settled (see feedSettleDelay). A not found error is returned if there
+// is no such event.
+func (r *Roach) LastFeedEventID() (string, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return "", err
+	}
+	ID, err := r.settledFeedEventID()
+	if err != nil {
+		return "", err
+	}
+	if ID == 0 {
+		return "", errors.NewNotFound("change feed is empty")
+	}
+	return strconv.FormatInt(ID, 10), nil
+}
+
+// FeedEvents fetches up to count settled change feed events (see
+// feedSettleDelay) with IDs after afterID, in order of ID. Only events about
+// the user with userID are fetched unless userID is empty. afterID must be
+// the ID of a change feed event or "0".
+func (r *Roach) FeedEvents(userID, afterID string, count int32) ([]events.Event, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	settledID, err := r.settledFeedEventID()
+	if err != nil {
+		return nil, err
+	}
+
+	where := ColID + ` > $1 AND ` + ColID + ` <= $2`
+	args := []interface{}{afterID, settledID}
+	if userID != "" {
+		args = append(args, userID)
+		where = fmt.Sprintf("%s AND %s=$%d", where, ColUserID, len(args))
+	}
+	args = append(args, count)
+	q := `
+		SELECT ` + allFeedCols + ` FROM ` + TblChangeFeed + `
+			WHERE ` + where + `
+			ORDER BY ` + ColID + `
+			LIMIT $` + fmt.Sprint(len(args))
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var evs []events.Event
+	for rows.Next() {
+		ev := events.Event{}
+		err := rows.Scan(&ev.ID, &ev.UserID, &ev.Topic, &ev.Payload, &ev.Created)
+		if err != nil {
+			return nil, errors.Newf("scan event from row: %v", err)
+		}
+		evs = append(evs, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterate result set: %v", err)
+	}
+
+	if len(evs) == 0 {
+		return nil, errors.NewNotFound("no events found")
+	}
+
+	return evs, nil
+}
+
+// settledFeedEventID returns the highest ID of the change feed events
+// committed feedSettleDelay ago, or 0 if there were none.
+func (r *Roach) settledFeedEventID() (int64, error) {
+	q := `
+		SELECT COALESCE(MAX(` + ColID + `), 0) FROM ` + TblChangeFeed + `
+			AS OF SYSTEM TIME '-` + feedSettleDelay.String() + `'
+	`
+	var ID int64
+	if err := r.db.QueryRow(q).Scan(&ID); err != nil {
+		return 0, errors.Newf("fetch settled change ID: %v", err)
+	}
+	return ID, nil
+}
+
+// PruneFeed deletes the change feed events created before before.
+func (r *Roach) PruneFeed(before time.Time) error {
+	if err := r.InitDBIfNot(); err != nil {
+		return err
+	}
+	q := `DELETE FROM ` + TblChangeFeed + ` WHERE ` + ColCreated + ` < $1`
+	_, err := r.db.Exec(q, before)
+	return err
+}
+
+// insertFeedEvents appends evs to the change feed using tx.
+func insertFeedEvents(tx *sql.Tx, evs []events.Event) error {
+
+	cols := ColDesc(ColUserID, ColTopic, ColPayload, ColCreated)
+	var values string
+	var args []interface{}
+	for _, ev := range evs {
+		firstParam := len(args) + 1
+		args = append(args, ev.UserID, ev.Topic, ev.Payload, ev.Created)
+		values = ColDesc(values, fmt.Sprintf("(%s)", genParamsFrom(firstParam, len(args))))
+	}
+
+	q := `INSERT INTO ` + TblChangeFeed + ` (` + cols + `) VALUES ` + values
+	res, err := tx.Exec(q, args...)
+	return checkRowsAffected(res, err, int64(len(evs)))
+}
@@ -0,0 +1,234 @@
+package roach
+
+import (
+	"database/sql"
+
+	"github.com/tomogoma/crdb"
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+var allFollowCols = ColDesc(ColUserID, ColFollowedID, ColCreated)
+
+// InsertFollow inserts f and increments the follow counts of both users
+// within the same transaction. The existing follow is returned if the user
+// with f.UserID already follows the user with f.FollowedUserID.
+func (r *Roach) InsertFollow(f user.Follow) (*user.Follow, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	var saved *user.Follow
+	err := r.ExecuteTx(func(tx *sql.Tx) error {
+
+		q := `
+			INSERT INTO ` + TblFollows + ` (` + allFollowCols + `)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (` + ColUserID + `, ` + ColFollowedID + `) DO NOTHING
+		`
+		res, err := tx.Exec(q, f.UserID, f.FollowedUserID, f.Created)
+		if err != nil {
+			return err
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return errors.Newf("check rows affected: %v", err)
+		}
+		if inserted == 1 {
+			if err := updateFollowCounts(tx, f.UserID, f.FollowedUserID, 1); err != nil {
+				return err
+			}
+		}
+
+		q = `
+			SELECT ` + allFollowCols + ` FROM ` + TblFollows + `
+				WHERE ` + ColUserID + `=$1 AND ` + ColFollowedID + `=$2
+		`
+		saved, err = scanFollow(tx.QueryRow(q, f.UserID, f.FollowedUserID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+// DeleteFollow removes the follow of the user with followedUserID by the
+// user with userID and decrements the follow counts of both users within the
+// same transaction.
+func (r *Roach) DeleteFollow(userID, followedUserID string) error {
+	if err := r.InitDBIfNot(); err != nil {
+		return err
+	}
+
+	return r.ExecuteTx(func(tx *sql.Tx) error {
+		q := `
+			DELETE FROM ` + TblFollows + `
+				WHERE ` + ColUserID + `=$1 AND ` + ColFollowedID + `=$2
+		`
+		res, err := tx.Exec(q, userID, followedUserID)
+		if err := checkRowsAffected(res, err, 1); err != nil {
+			return err
+		}
+		return updateFollowCounts(tx, userID, followedUserID, -1)
+	})
+}
+
+// Followers fetches the follows of the user with userID, most recent first.
+func (r *Roach) Followers(userID string, offset int64, count int32) ([]user.Follow, error) {
+	return r.follows(ColFollowedID, userID, offset, count)
+}
+
+// Following fetches the follows made by the user with userID, most recent
+// first.
+func (r *Roach) Following(userID string, offset int64, count int32) ([]user.Follow, error) {
+	return r.follows(ColUserID, userID, offset, count)
+}
+
+// Follows returns true if the user with userID follows the user with
+// followedUserID.
+func (r *Roach) Follows(userID, followedUserID string) (bool, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return false, err
+	}
+
+	q := `
+		SELECT EXISTS (
+			SELECT ` + ColUserID + ` FROM ` + TblFollows + `
+				WHERE ` + ColUserID + `=$1 AND ` + ColFollowedID + `=$2
+		)
+	`
+	var follows bool
+	if err := r.db.QueryRow(q, userID, followedUserID).Scan(&follows); err != nil {
+		return false, err
+	}
+	return follows, nil
+}
+
+// follows fetches the follows whose col is userID, most recent first.
+func (r *Roach) follows(col, userID string, offset int64, count int32) ([]user.Follow, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	limit, args := crdb.Pagination(offset, int64(count), []interface{}{userID})
+	q := `
+		SELECT ` + allFollowCols + ` FROM ` + TblFollows + `
+			WHERE ` + col + `=$1
+			ORDER BY ` + ColCreated + ` DESC, ` + ColUserID + `, ` + ColFollowedID + `
+			` + limit
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fs []user.Follow
+	for rows.Next() {
+		f, err := scanFollow(rows)
+		if err != nil {
+			return nil, errors.Newf("scan follow from row: %v", err)
+		}
+		fs = append(fs, *f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterate result set: %v", err)
+	}
+
+	if len(fs) == 0 {
+		return nil, errors.NewNotFound("no follows found")
+	}
+
+	return fs, nil
+}
+
+// updateFollowCounts adds delta to the number of users followed by the user
+// with userID and to the number of followers of the user with followedUserID
+// using tx.
+func updateFollowCounts(tx *sql.Tx, userID, followedUserID string, delta int) error {
+	q := `
+		UPDATE ` + TblUsers + ` SET ` + ColNumFollwng + `=` + ColNumFollwng + `+$1
+			WHERE ` + ColID + `=$2
+	`
+	res, err := tx.Exec(q, delta, userID)
+	if err := checkRowsAffected(res, err, 1); err != nil {
+		return errors.Newf("update following count: %v", err)
+	}
+	q = `
+		UPDATE ` + TblUsers + ` SET ` + ColNumFollwrs + `=` + ColNumFollwrs + `+$1
+			WHERE ` + ColID + `=$2
+	`
+	res, err = tx.Exec(q, delta, followedUserID)
+	if err := checkRowsAffected(res, err, 1); err != nil {
+		return errors.Newf("update followers count: %v", err)
+	}
+	return nil
+}
+
+// deleteFollowsBetween removes the follows in either direction between the
+// users with userID and otherUserID using tx, decrementing the follow counts
+// of both users.
+func deleteFollowsBetween(tx *sql.Tx, userID, otherUserID string) error {
+	for _, f := range [][2]string{{userID, otherUserID}, {otherUserID, userID}} {
+		q := `DELETE FROM ` + TblFollows + ` WHERE ` + ColUserID + `=$1 AND ` + ColFollowedID + `=$2`
+		res, err := tx.Exec(q, f[0], f[1])
+		if err != nil {
+			return errors.Newf("delete follow: %v", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return errors.Newf("count deleted follows: %v", err)
+		}
+		if n == 0 {
+			continue
+		}
+		if err := updateFollowCounts(tx, f[0], f[1], -1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteUserFollows removes the follows made by and of the user with userID
+// using tx, decrementing the follow counts of the other users involved.
+func deleteUserFollows(tx *sql.Tx, userID string) error {
+	q := `
+		UPDATE ` + TblUsers + ` SET ` + ColNumFollwrs + `=` + ColNumFollwrs + `-1
+			WHERE ` + ColID + ` IN (
+				SELECT ` + ColFollowedID + ` FROM ` + TblFollows + ` WHERE ` + ColUserID + `=$1
+			)
+	`
+	if _, err := tx.Exec(q, userID); err != nil {
+		return errors.Newf("update followers counts: %v", err)
+	}
+	q = `
+		UPDATE ` + TblUsers + ` SET ` + ColNumFollwng + `=` + ColNumFollwng + `-1
+			WHERE ` + ColID + ` IN (
+				SELECT ` + ColUserID + ` FROM ` + TblFollows + ` WHERE ` + ColFollowedID + `=$1
+			)
+	`
+	if _, err := tx.Exec(q, userID); err != nil {
+		return errors.Newf("update following counts: %v", err)
+	}
+	cols := ColDesc(ColNumFollwrs, ColNumFollwng)
+	q = `UPDATE ` + TblUsers + ` SET (` + cols + `) = (0, 0) WHERE ` + ColID + `=$1`
+	if _, err := tx.Exec(q, userID); err != nil {
+		return errors.Newf("reset follow counts: %v", err)
+	}
+	q = `DELETE FROM ` + TblFollows + ` WHERE ` + ColUserID + `=$1 OR ` + ColFollowedID + `=$1`
+	if _, err := tx.Exec(q, userID); err != nil {
+		return errors.Newf("delete follows: %v", err)
+	}
+	return nil
+}
+
+// scanFollow extracts a follow from s or returns an error if reported by s.
+// The column order for s must be same order as allFollowCols variable.
+func scanFollow(s multiScanner) (*user.Follow, error) {
+	f := &user.Follow{}
+	if err := s.Scan(&f.UserID, &f.FollowedUserID, &f.Created); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
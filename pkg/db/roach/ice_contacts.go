@@ -0,0 +1,273 @@
+package roach
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+var allICEContactCols = ColDesc(ColID, ColUserID, ColName, ColRelation,
+	ColPhone, ColPriority, ColCreated, ColLastUpdated)
+
+// defaultICEContactName names the ICE contacts created when a user's ICEPhone
+// is set without any ICE contacts (see mirrorICEPhone and migrate12To13).
+const defaultICEContactName = "Emergency contact"
+
+// orderICEContacts orders ICE contacts by priority, the first being the
+// primary contact.
+var orderICEContacts = ColPriority + `, ` + ColCreated + `, ` + ColID
+
+// ICEContacts fetches the ICE contacts of the user with userID in order of
+// priority.
+func (r *Roach) ICEContacts(userID string) ([]user.ICEContact, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	q := `
+		SELECT ` + allICEContactCols + ` FROM ` + TblICEContacts + `
+			WHERE ` + ColUserID + `=$1
+			ORDER BY ` + orderICEContacts
+	rows, err := r.db.Query(q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cs []user.ICEContact
+	for rows.Next() {
+		c, err := scanICEContact(rows)
+		if err != nil {
+			return nil, errors.Newf("scan ICE contact from row: %v", err)
+		}
+		cs = append(cs, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterate result set: %v", err)
+	}
+
+	if len(cs) == 0 {
+		return nil, errors.NewNotFound("no ICE contacts found for user")
+	}
+
+	return cs, nil
+}
+
+// InsertICEContact inserts c and mirrors the user's primary ICE contact
+// phone to the user's ICEPhone within the same transaction. A conflict error
+// is returned if the user already has maxContacts ICE contacts.
+func (r *Roach) InsertICEContact(c user.ICEContact, maxContacts int, by user.Actor) (*user.ICEContact, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	var saved *user.ICEContact
+	err := r.ExecuteTx(func(tx *sql.Tx) error {
+
+		// Counting in the same statement keeps concurrent inserts from
+		// exceeding maxContacts.
+		cols := ColDesc(ColUserID, ColName, ColRelation, ColPhone, ColPriority,
+			ColCreated, ColLastUpdated)
+		q := `
+			INSERT INTO ` + TblICEContacts + ` (` + cols + `)
+				SELECT $1, $2, $3, $4, $5, $6, $7
+					WHERE (
+						SELECT COUNT(*) FROM ` + TblICEContacts + `
+							WHERE ` + ColUserID + `=$1
+					) < $8
+				RETURNING ` + allICEContactCols
+		var err error
+		saved, err = scanICEContact(tx.QueryRow(q, c.UserID, c.Name,
+			c.Relationship, c.Phone, c.Priority, c.Created, c.LastUpdated,
+			maxContacts))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errors.NewConflictf("user already has %d ICE contacts", maxContacts)
+			}
+			return err
+		}
+
+		return syncPrimaryICEPhone(tx, c.UserID, by, c.LastUpdated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+// UpdateICEContact replaces the ICE contact with c.ID and c.UserID with c and
+// mirrors the user's primary ICE contact phone to the user's ICEPhone within
+// the same transaction. A not found error is returned if no such contact
+// exists.
+func (r *Roach) UpdateICEContact(c user.ICEContact, by user.Actor) (*user.ICEContact, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	var updated *user.ICEContact
+	err := r.ExecuteTx(func(tx *sql.Tx) error {
+
+		cols := ColDesc(ColName, ColRelation, ColPhone, ColPriority, ColLastUpdated)
+		q := `
+			UPDATE ` + TblICEContacts + `
+				SET (` + cols + `) = ($1, $2, $3, $4, $5)
+				WHERE ` + ColID + `=$6 AND ` + ColUserID + `=$7
+				RETURNING ` + allICEContactCols
+		var err error
+		updated, err = scanICEContact(tx.QueryRow(q, c.Name, c.Relationship,
+			c.Phone, c.Priority, c.LastUpdated, c.ID, c.UserID))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errors.NewNotFound("ICE contact not found")
+			}
+			return err
+		}
+
+		return syncPrimaryICEPhone(tx, c.UserID, by, c.LastUpdated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// DeleteICEContact deletes the ICE contact with contactID belonging to the
+// user with userID and mirrors the user's new primary ICE contact phone (if
+// any) to the user's ICEPhone within the same transaction.
+func (r *Roach) DeleteICEContact(userID, contactID string, by user.Actor, at time.Time) error {
+	if err := r.InitDBIfNot(); err != nil {
+		return err
+	}
+
+	return r.ExecuteTx(func(tx *sql.Tx) error {
+
+		q := `DELETE FROM ` + TblICEContacts + ` WHERE ` + ColID + `=$1 AND ` + ColUserID + `=$2`
+		res, err := tx.Exec(q, contactID, userID)
+		if err := checkRowsAffected(res, err, 1); err != nil {
+			return err
+		}
+
+		return syncPrimaryICEPhone(tx, userID, by, at)
+	})
+}
+
+// syncPrimaryICEPhone sets the ICEPhone of the user with userID to the phone
+// of their primary ICE contact (or NULL if they have none), recording the
+// change in the user's history. A changed ICEPhone is marked unverified.
+func syncPrimaryICEPhone(tx *sql.Tx, userID string, by user.Actor, at time.Time) error {
+
+	q := `SELECT ` + ColICEPhone + ` FROM ` + TblUsers + ` WHERE ` + ColID + `=$1`
+	current := sql.NullString{}
+	if err := tx.QueryRow(q, userID).Scan(&current); err != nil {
+		return errors.Newf("fetch current ICE phone: %v", err)
+	}
+
+	q = `
+		SELECT ` + ColPhone + ` FROM ` + TblICEContacts + `
+			WHERE ` + ColUserID + `=$1
+			ORDER BY ` + orderICEContacts + `
+			LIMIT 1
+	`
+	primary := sql.NullString{}
+	if err := tx.QueryRow(q, userID).Scan(&primary); err != nil && err != sql.ErrNoRows {
+		return errors.Newf("fetch primary ICE contact phone: %v", err)
+	}
+
+	if current.String == primary.String {
+		return nil
+	}
+
+	cols := ColDesc(ColICEPhone, ColICEPhoneVrf, ColLastUpdated)
+	q = `UPDATE ` + TblUsers + ` SET (` + cols + `) = ($1, FALSE, $2) WHERE ` + ColID + `=$3`
+	res, err := tx.Exec(q, primary, at, userID)
+	if err := checkRowsAffected(res, err, 1); err != nil {
+		return errors.Newf("update ICE phone: %v", err)
+	}
+
+	return insertUserChanges(tx, []user.Change{{
+		UserID:           userID,
+		Field:            user.FieldICEPhone,
+		OldValue:         current.String,
+		NewValue:         primary.String,
+		ActorUserID:      by.UserID,
+		ActorAccessLevel: by.AccessLevel,
+		Created:          at,
+	}})
+}
+
+// mirrorICEPhone makes the phone of the primary ICE contact of the user with
+// userID match their newly set ICEPhone phone using tx. A primary contact
+// named defaultICEContactName is created if the user has no contacts. An
+// empty phone deletes the user's only contact; a conflict error is returned
+// if the user has more than one contact since the next contact's phone would
+// otherwise become the ICEPhone.
+func mirrorICEPhone(tx *sql.Tx, userID, phone string, at time.Time) error {
+
+	if phone == "" {
+		q := `SELECT COUNT(*) FROM ` + TblICEContacts + ` WHERE ` + ColUserID + `=$1`
+		var count int
+		if err := tx.QueryRow(q, userID).Scan(&count); err != nil {
+			return errors.Newf("count ICE contacts: %v", err)
+		}
+		if count > 1 {
+			return errors.NewConflict("the ICE phone cannot be cleared while" +
+				" the user has more than one emergency contact, delete the" +
+				" emergency contacts instead")
+		}
+		q = `DELETE FROM ` + TblICEContacts + ` WHERE ` + ColUserID + `=$1`
+		if _, err := tx.Exec(q, userID); err != nil {
+			return errors.Newf("delete primary ICE contact: %v", err)
+		}
+		return nil
+	}
+
+	cols := ColDesc(ColPhone, ColLastUpdated)
+	q := `
+		UPDATE ` + TblICEContacts + ` SET (` + cols + `) = ($1, $2)
+			WHERE ` + ColID + ` = (
+				SELECT ` + ColID + ` FROM ` + TblICEContacts + `
+					WHERE ` + ColUserID + `=$3
+					ORDER BY ` + orderICEContacts + `
+					LIMIT 1
+			)
+	`
+	res, err := tx.Exec(q, phone, at, userID)
+	if err != nil {
+		return errors.Newf("update primary ICE contact phone: %v", err)
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return errors.Newf("check rows affected: %v", err)
+	}
+	if updated > 0 {
+		return nil
+	}
+
+	cols = ColDesc(ColUserID, ColName, ColPhone, ColPriority, ColCreated,
+		ColLastUpdated)
+	q = `INSERT INTO ` + TblICEContacts + ` (` + cols + `) VALUES ($1, $2, $3, 1, $4, $4)`
+	res, err = tx.Exec(q, userID, defaultICEContactName, phone, at)
+	if err := checkRowsAffected(res, err, 1); err != nil {
+		return errors.Newf("insert primary ICE contact: %v", err)
+	}
+	return nil
+}
+
+// scanICEContact extracts an ICE contact from s or returns an error if
+// reported by s. The column order for s must be same order as
+// allICEContactCols.
+func scanICEContact(s multiScanner) (*user.ICEContact, error) {
+	c := &user.ICEContact{}
+	relationship := sql.NullString{}
+	err := s.Scan(&c.ID, &c.UserID, &c.Name, &relationship, &c.Phone,
+		&c.Priority, &c.Created, &c.LastUpdated)
+	if err != nil {
+		return nil, err
+	}
+	c.Relationship = relationship.String
+	return c, nil
+}
@@ -0,0 +1,686 @@
+package roach
+
+import (
+	"database/sql"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/events"
+	"github.com/tomogoma/usersms/pkg/rating"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+// MergeUsers merges the duplicate user in mrg into the surviving user within
+// a single transaction. The duplicate user's profile is scrubbed and marked
+// as merged into (and deactivated in favour of) the surviving user whose
+// profile is updated with mrg.Update. Ratings given and received by the
+// duplicate user are moved to the surviving user, dropping the ones that
+// would collide (see mergedRatingCollisions), and the affected users' ratings
+// are recomputed. Likewise the duplicate user's ICE contacts (see
+// mergedICEContacts), follows, connections (see mergedConnectionCollisions)
+// and blocks are moved to the surviving user. A user.PreconditionFailedError
+// is returned if either user has been updated since their values were
+// reconciled.
+func (r *Roach) MergeUsers(mrg user.Merge) (*user.User, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	var usr *user.User
+	err := r.ExecuteTx(func(tx *sql.Tx) error {
+
+		// The duplicate is scrubbed first to release its handle, which the
+		// survivor may take over.
+		if err := tombstoneUser(tx, mrg); err != nil {
+			return err
+		}
+
+		// ICE contacts are merged before the update so that the surviving
+		// user's primary contact already has the reconciled ICEPhone.
+		if err := mergeICEContacts(tx, mrg); err != nil {
+			return errors.Newf("merge ICE contacts: %v", err)
+		}
+
+		survivor, err := upsertUserTx(tx, mrg.Update)
+		if err != nil {
+			return err
+		}
+		if err := setMergedVerifications(tx, mrg, *survivor); err != nil {
+			return err
+		}
+
+		if err := mergeRatings(tx, mrg.SurvivorID, mrg.DuplicateID); err != nil {
+			return errors.Newf("merge ratings: %v", err)
+		}
+		if err := mergeFollows(tx, mrg.SurvivorID, mrg.DuplicateID); err != nil {
+			return errors.Newf("merge follows: %v", err)
+		}
+		if err := mergeConnections(tx, mrg.SurvivorID, mrg.DuplicateID); err != nil {
+			return errors.Newf("merge connections: %v", err)
+		}
+		// Blocks are merged last since they remove the relations the
+		// surviving user has with users they block or are blocked by.
+		if err := mergeBlocks(tx, mrg.SurvivorID, mrg.DuplicateID); err != nil {
+			return errors.Newf("merge blocks: %v", err)
+		}
+
+		q := `SELECT ` + allUserCols + ` FROM ` + TblUsers + ` WHERE ` + ColID + `=$1`
+		usr, err = scanUser(tx.QueryRow(q, mrg.SurvivorID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return usr, nil
+}
+
+// tombstoneUser scrubs the profile of the duplicate user in mrg using tx and
+// marks it as merged into the surviving user, recording the merge in the
+// duplicate user's history. The duplicate user's pending moderations are
+// deleted.
+func tombstoneUser(tx *sql.Tx, mrg user.Merge) error {
+
+	at := mrg.Update.Time
+	scrubCols := ColDesc(ColName, ColGender, ColICEPhone, ColAvatarURL, ColBio,
+		ColCountry, ColLocale, ColTimezone, ColEmail, ColAttributes, ColPrivacy,
+		ColHiddenFlds, ColHandle, ColHandleLower, ColRating, ColNumRaters,
+		ColICEPhoneVrf, ColEmailVerif, ColMergedInto, ColDeactivated,
+		ColLastUpdated)
+	q := `
+		UPDATE ` + TblUsers + `
+			SET (` + scrubCols + `) = (NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, FALSE, FALSE, $1, COALESCE(` + ColDeactivated + `, $2), $2)
+			WHERE ` + ColID + `=$3 AND ` + ColLastUpdated + `=$4
+				AND ` + ColMergedInto + ` IS NULL AND ` + ColErased + ` IS NULL
+	`
+	res, err := tx.Exec(q, mrg.SurvivorID, at, mrg.DuplicateID, mrg.DuplicateLastUpdated)
+	if err != nil {
+		return errors.Newf("scrub duplicate user: %v", err)
+	}
+	scrubbed, err := res.RowsAffected()
+	if err != nil {
+		return errors.Newf("check rows affected: %v", err)
+	}
+	if scrubbed == 0 {
+		return user.PreconditionFailedError{Data: "duplicate user has been updated" +
+			" since " + mrg.DuplicateLastUpdated.Format(time.RFC3339Nano) +
+			", try the merge again"}
+	}
+
+	q = `
+		DELETE FROM ` + TblModerations + `
+			WHERE ` + ColUserID + `=$1 AND ` + ColStatus + `=$2
+	`
+	if _, err := tx.Exec(q, mrg.DuplicateID, user.ModerationPending); err != nil {
+		return errors.Newf("delete duplicate user's pending moderations: %v", err)
+	}
+
+	err = insertEvent(tx, events.TopicUserDeleted, mrg.DuplicateID, events.UserDeleted{
+		UserID:     mrg.DuplicateID,
+		MergedInto: mrg.SurvivorID,
+		Deleted:    at,
+	}, at)
+	if err != nil {
+		return err
+	}
+
+	return insertUserChanges(tx, []user.Change{{
+		UserID:           mrg.DuplicateID,
+		Field:            user.FieldMergedInto,
+		NewValue:         mrg.SurvivorID,
+		ActorUserID:      mrg.Update.ActorUserID,
+		ActorAccessLevel: mrg.Update.ActorAccessLevel,
+		Created:          at,
+	}})
+}
+
+// setMergedVerifications sets the verification states of the surviving
+// user's email and ICEPhone to those in mrg using tx, recording any change
+// in the user's history. survivor is the surviving user's current state.
+func setMergedVerifications(tx *sql.Tx, mrg user.Merge, survivor user.User) error {
+
+	cols := ColDesc(ColEmailVerif, ColICEPhoneVrf)
+	q := `UPDATE ` + TblUsers + ` SET (` + cols + `) = ($1, $2) WHERE ` + ColID + `=$3`
+	res, err := tx.Exec(q, mrg.EmailVerified, mrg.ICEPhoneVerified, mrg.SurvivorID)
+	if err := checkRowsAffected(res, err, 1); err != nil {
+		return errors.Newf("set verifications: %v", err)
+	}
+
+	var chs []user.Change
+	addChange := func(field string, oldVal, newVal bool) {
+		if oldVal == newVal {
+			return
+		}
+		chs = append(chs, user.Change{
+			UserID:           mrg.SurvivorID,
+			Field:            field,
+			OldValue:         strconv.FormatBool(oldVal),
+			NewValue:         strconv.FormatBool(newVal),
+			ActorUserID:      mrg.Update.ActorUserID,
+			ActorAccessLevel: mrg.Update.ActorAccessLevel,
+			Created:          mrg.Update.Time,
+		})
+	}
+	addChange(user.FieldEmailVerified, survivor.EmailVerified, mrg.EmailVerified)
+	addChange(user.FieldICEPhoneVerified, survivor.ICEPhoneVerified, mrg.ICEPhoneVerified)
+	return insertUserChanges(tx, chs)
+}
+
+// mergeRatings moves the ratings given and received by the user with
+// duplicateID to the user with survivorID using tx and recomputes the
+// ratings of the affected users.
+func mergeRatings(tx *sql.Tx, survivorID, duplicateID string) error {
+
+	IDs := pq.Array([]string{survivorID, duplicateID})
+	q := `
+		SELECT ` + allRatingCols + ` FROM ` + TblRatings + `
+			WHERE ` + ColByUserID + ` = ANY($1) OR ` + ColForUserID + ` = ANY($1)
+	`
+	rows, err := tx.Query(q, IDs)
+	if err != nil {
+		return errors.Newf("fetch ratings: %v", err)
+	}
+	defer rows.Close()
+
+	var rts []rating.Rating
+	for rows.Next() {
+		rt, err := scanRating(rows)
+		if err != nil {
+			return errors.Newf("scan rating from row: %v", err)
+		}
+		rts = append(rts, *rt)
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Newf("iterate result set: %v", err)
+	}
+
+	dropIDs, affectedIDs := mergedRatingCollisions(rts, survivorID, duplicateID)
+	if len(dropIDs) > 0 {
+		q = `DELETE FROM ` + TblRatings + ` WHERE ` + ColID + ` = ANY($1)`
+		res, err := tx.Exec(q, pq.Array(dropIDs))
+		if err := checkRowsAffected(res, err, int64(len(dropIDs))); err != nil {
+			return errors.Newf("delete colliding ratings: %v", err)
+		}
+	}
+
+	q = `UPDATE ` + TblRatings + ` SET ` + ColByUserID + `=$1 WHERE ` + ColByUserID + `=$2`
+	if _, err := tx.Exec(q, survivorID, duplicateID); err != nil {
+		return errors.Newf("move ratings given: %v", err)
+	}
+	q = `UPDATE ` + TblRatings + ` SET ` + ColForUserID + `=$1 WHERE ` + ColForUserID + `=$2`
+	if _, err := tx.Exec(q, survivorID, duplicateID); err != nil {
+		return errors.Newf("move ratings received: %v", err)
+	}
+
+	for _, userID := range affectedIDs {
+		if err := syncUserRating(tx, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergedRatingCollisions returns the IDs of the ratings in rts that should be
+// dropped when the user with duplicateID is merged into the user with
+// survivorID and the IDs of the users whose ratings should be recomputed as
+// a result. Ratings between the two users would become self ratings and are
+// dropped. Of the ratings that would share the same rater, section and
+// rated user only the most recently updated one is kept.
+func mergedRatingCollisions(rts []rating.Rating, survivorID, duplicateID string) (dropIDs, affectedIDs []string) {
+
+	merged := func(ID string) string {
+		if ID == duplicateID {
+			return survivorID
+		}
+		return ID
+	}
+	newer := func(a, b rating.Rating) bool {
+		if !a.LastUpdated.Equal(b.LastUpdated) {
+			return a.LastUpdated.After(b.LastUpdated)
+		}
+		if !a.Created.Equal(b.Created) {
+			return a.Created.After(b.Created)
+		}
+		return a.ID > b.ID
+	}
+
+	type key struct{ by, section, forUser string }
+	kept := make(map[key]rating.Rating)
+	affected := map[string]bool{survivorID: true}
+	drop := func(rt rating.Rating) {
+		dropIDs = append(dropIDs, rt.ID)
+		affected[merged(rt.ForUserID)] = true
+	}
+
+	involvesDuplicate := func(rt rating.Rating) bool {
+		return rt.ByUserID == duplicateID || rt.ForUserID == duplicateID
+	}
+
+	for _, rt := range rts {
+		if involvesDuplicate(rt) && merged(rt.ByUserID) == merged(rt.ForUserID) {
+			drop(rt)
+			continue
+		}
+		k := key{by: merged(rt.ByUserID), section: rt.ForSection, forUser: merged(rt.ForUserID)}
+		other, ok := kept[k]
+		switch {
+		case !ok:
+			kept[k] = rt
+		case !involvesDuplicate(rt) && !involvesDuplicate(other):
+			// Only ratings moved from the duplicate can collide.
+		case newer(rt, other):
+			drop(other)
+			kept[k] = rt
+		default:
+			drop(rt)
+		}
+	}
+
+	for ID := range affected {
+		affectedIDs = append(affectedIDs, ID)
+	}
+	sort.Strings(dropIDs)
+	sort.Strings(affectedIDs)
+	return dropIDs, affectedIDs
+}
+
+// syncUserRating recomputes the rating and number of raters of the user with
+// userID from the ratings they have received using tx.
+func syncUserRating(tx *sql.Tx, userID string) error {
+
+	q := `
+		SELECT AVG(` + ColRating + `), COUNT(` + ColRating + `) FROM ` + TblRatings + `
+			WHERE ` + ColForUserID + `=$1
+	`
+	avg := sql.NullFloat64{}
+	var numRaters int64
+	if err := tx.QueryRow(q, userID).Scan(&avg, &numRaters); err != nil {
+		return errors.Newf("compute rating of user %s: %v", userID, err)
+	}
+
+	cols := ColDesc(ColRating, ColNumRaters)
+	q = `UPDATE ` + TblUsers + ` SET (` + cols + `) = ($1, $2) WHERE ` + ColID + `=$3`
+	if _, err := tx.Exec(q, avg, numRaters, userID); err != nil {
+		return errors.Newf("update rating of user %s: %v", userID, err)
+	}
+	return nil
+}
+
+// mergeICEContacts moves the ICE contacts of the duplicate user in mrg to the
+// surviving user using tx, dropping and re-prioritizing contacts as
+// described by mergedICEContacts. The merged contacts are not limited to the
+// maximum a user can add.
+func mergeICEContacts(tx *sql.Tx, mrg user.Merge) error {
+
+	ICEPhone := mrg.Update.ICEPhone.NewValue
+	if !mrg.Update.ICEPhone.IsUpdating {
+		q := `SELECT ` + ColICEPhone + ` FROM ` + TblUsers + ` WHERE ` + ColID + `=$1`
+		current := sql.NullString{}
+		if err := tx.QueryRow(q, mrg.SurvivorID).Scan(&current); err != nil {
+			return errors.Newf("fetch surviving user's ICE phone: %v", err)
+		}
+		ICEPhone = current.String
+	}
+
+	q := `
+		SELECT ` + allICEContactCols + ` FROM ` + TblICEContacts + `
+			WHERE ` + ColUserID + ` = ANY($1)
+			ORDER BY ` + orderICEContacts
+	rows, err := tx.Query(q, pq.Array([]string{mrg.SurvivorID, mrg.DuplicateID}))
+	if err != nil {
+		return errors.Newf("fetch ICE contacts: %v", err)
+	}
+	defer rows.Close()
+
+	var cs []user.ICEContact
+	for rows.Next() {
+		c, err := scanICEContact(rows)
+		if err != nil {
+			return errors.Newf("scan ICE contact from row: %v", err)
+		}
+		cs = append(cs, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Newf("iterate result set: %v", err)
+	}
+
+	kept, dropIDs := mergedICEContacts(cs, mrg.SurvivorID, mrg.DuplicateID, ICEPhone)
+	if len(dropIDs) > 0 {
+		q = `DELETE FROM ` + TblICEContacts + ` WHERE ` + ColID + ` = ANY($1)`
+		res, err := tx.Exec(q, pq.Array(dropIDs))
+		if err := checkRowsAffected(res, err, int64(len(dropIDs))); err != nil {
+			return errors.Newf("delete duplicate ICE contacts: %v", err)
+		}
+	}
+
+	current := make(map[string]user.ICEContact)
+	for _, c := range cs {
+		current[c.ID] = c
+	}
+	cols := ColDesc(ColUserID, ColPhone, ColPriority, ColLastUpdated)
+	q = `UPDATE ` + TblICEContacts + ` SET (` + cols + `) = ($1, $2, $3, $4) WHERE ` + ColID + `=$5`
+	for _, c := range kept {
+		if c == current[c.ID] {
+			continue
+		}
+		res, err := tx.Exec(q, c.UserID, c.Phone, c.Priority, mrg.Update.Time, c.ID)
+		if err := checkRowsAffected(res, err, 1); err != nil {
+			return errors.Newf("update ICE contact: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// mergedICEContacts returns the ICE contacts in cs (ordered by priority) that
+// the user with survivorID keeps when the user with duplicateID is merged
+// into them and the IDs of the contacts to drop. The contacts of whichever
+// user's primary contact phone is ICEPhone (the surviving user's if neither)
+// are placed first and contacts with the same phone as a preceding one are
+// dropped. Kept contacts belong to the surviving user and are prioritized
+// from 1 in order. The primary contact's phone is set to ICEPhone if not
+// empty since it mirrors the surviving user's ICEPhone.
+func mergedICEContacts(cs []user.ICEContact, survivorID, duplicateID, ICEPhone string) (kept []user.ICEContact, dropIDs []string) {
+
+	var first, second []user.ICEContact
+	for _, c := range cs {
+		if c.UserID == survivorID {
+			first = append(first, c)
+		} else if c.UserID == duplicateID {
+			second = append(second, c)
+		}
+	}
+	if len(second) > 0 && second[0].Phone == ICEPhone &&
+		(len(first) == 0 || first[0].Phone != ICEPhone) {
+		first, second = second, first
+	}
+
+	phones := make(map[string]bool)
+	for _, c := range append(first, second...) {
+		if len(kept) == 0 && ICEPhone != "" {
+			c.Phone = ICEPhone
+		}
+		if phones[c.Phone] {
+			dropIDs = append(dropIDs, c.ID)
+			continue
+		}
+		phones[c.Phone] = true
+		c.UserID = survivorID
+		c.Priority = int32(len(kept) + 1)
+		kept = append(kept, c)
+	}
+	sort.Strings(dropIDs)
+	return kept, dropIDs
+}
+
+// mergeFollows moves the follows made by and of the user with duplicateID to
+// the user with survivorID using tx and recomputes the follow counts of the
+// affected users. Follows between the two users and ones the surviving user
+// already has are dropped.
+func mergeFollows(tx *sql.Tx, survivorID, duplicateID string) error {
+
+	q := `
+		SELECT ` + ColFollowedID + ` FROM ` + TblFollows + ` WHERE ` + ColUserID + `=$1
+		UNION
+		SELECT ` + ColUserID + ` FROM ` + TblFollows + ` WHERE ` + ColFollowedID + `=$1
+	`
+	rows, err := tx.Query(q, duplicateID)
+	if err != nil {
+		return errors.Newf("fetch followed and following users: %v", err)
+	}
+	defer rows.Close()
+
+	affectedIDs := []string{survivorID, duplicateID}
+	for rows.Next() {
+		var ID string
+		if err := rows.Scan(&ID); err != nil {
+			return errors.Newf("scan user ID from row: %v", err)
+		}
+		if ID != survivorID {
+			affectedIDs = append(affectedIDs, ID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Newf("iterate result set: %v", err)
+	}
+
+	q = `
+		DELETE FROM ` + TblFollows + `
+			WHERE (` + ColUserID + `=$1 AND ` + ColFollowedID + `=$2)
+				OR (` + ColUserID + `=$2 AND ` + ColFollowedID + `=$1)
+	`
+	if _, err := tx.Exec(q, survivorID, duplicateID); err != nil {
+		return errors.Newf("delete follows between the users: %v", err)
+	}
+	q = `
+		DELETE FROM ` + TblFollows + `
+			WHERE ` + ColUserID + `=$2 AND ` + ColFollowedID + ` IN (
+				SELECT ` + ColFollowedID + ` FROM ` + TblFollows + ` WHERE ` + ColUserID + `=$1
+			)
+	`
+	if _, err := tx.Exec(q, survivorID, duplicateID); err != nil {
+		return errors.Newf("delete colliding follows made: %v", err)
+	}
+	q = `
+		DELETE FROM ` + TblFollows + `
+			WHERE ` + ColFollowedID + `=$2 AND ` + ColUserID + ` IN (
+				SELECT ` + ColUserID + ` FROM ` + TblFollows + ` WHERE ` + ColFollowedID + `=$1
+			)
+	`
+	if _, err := tx.Exec(q, survivorID, duplicateID); err != nil {
+		return errors.Newf("delete colliding follows received: %v", err)
+	}
+
+	q = `UPDATE ` + TblFollows + ` SET ` + ColUserID + `=$1 WHERE ` + ColUserID + `=$2`
+	if _, err := tx.Exec(q, survivorID, duplicateID); err != nil {
+		return errors.Newf("move follows made: %v", err)
+	}
+	q = `UPDATE ` + TblFollows + ` SET ` + ColFollowedID + `=$1 WHERE ` + ColFollowedID + `=$2`
+	if _, err := tx.Exec(q, survivorID, duplicateID); err != nil {
+		return errors.Newf("move follows received: %v", err)
+	}
+
+	for _, userID := range affectedIDs {
+		if err := syncFollowCounts(tx, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncFollowCounts recomputes the number of followers and followed users of
+// the user with userID using tx.
+func syncFollowCounts(tx *sql.Tx, userID string) error {
+	cols := ColDesc(ColNumFollwrs, ColNumFollwng)
+	q := `
+		UPDATE ` + TblUsers + ` SET (` + cols + `) = (
+			(SELECT COUNT(*) FROM ` + TblFollows + ` WHERE ` + ColFollowedID + `=$1),
+			(SELECT COUNT(*) FROM ` + TblFollows + ` WHERE ` + ColUserID + `=$1)
+		) WHERE ` + ColID + `=$1
+	`
+	res, err := tx.Exec(q, userID)
+	if err := checkRowsAffected(res, err, 1); err != nil {
+		return errors.Newf("update follow counts of user %s: %v", userID, err)
+	}
+	return nil
+}
+
+// mergeConnections moves the connections and pending connection requests of
+// the user with duplicateID to the user with survivorID using tx, dropping
+// the ones that would collide (see mergedConnectionCollisions).
+func mergeConnections(tx *sql.Tx, survivorID, duplicateID string) error {
+
+	q := `
+		SELECT ` + allConnectionCols + ` FROM ` + TblConnections + `
+			WHERE ` + ColUserID + ` = ANY($1) OR ` + ColConnectedID + ` = ANY($1)
+	`
+	rows, err := tx.Query(q, pq.Array([]string{survivorID, duplicateID}))
+	if err != nil {
+		return errors.Newf("fetch connections: %v", err)
+	}
+	defer rows.Close()
+
+	var cs []user.Connection
+	for rows.Next() {
+		c, err := scanConnection(rows)
+		if err != nil {
+			return errors.Newf("scan connection from row: %v", err)
+		}
+		cs = append(cs, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Newf("iterate result set: %v", err)
+	}
+
+	q = `DELETE FROM ` + TblConnections + ` WHERE ` + ColUserID + `=$1 AND ` + ColConnectedID + `=$2`
+	for _, c := range mergedConnectionCollisions(cs, survivorID, duplicateID) {
+		res, err := tx.Exec(q, c.UserID, c.ConnectedUserID)
+		if err := checkRowsAffected(res, err, 1); err != nil {
+			return errors.Newf("delete colliding connection: %v", err)
+		}
+	}
+
+	q = `UPDATE ` + TblConnections + ` SET ` + ColUserID + `=$1 WHERE ` + ColUserID + `=$2`
+	if _, err := tx.Exec(q, survivorID, duplicateID); err != nil {
+		return errors.Newf("move connections requested: %v", err)
+	}
+	q = `UPDATE ` + TblConnections + ` SET ` + ColConnectedID + `=$1 WHERE ` + ColConnectedID + `=$2`
+	if _, err := tx.Exec(q, survivorID, duplicateID); err != nil {
+		return errors.Newf("move connections received: %v", err)
+	}
+
+	return nil
+}
+
+// mergedConnectionCollisions returns the connections in cs that should be
+// dropped when the user with duplicateID is merged into the user with
+// survivorID. Connections between the two users are dropped. Of the
+// connections that would be between the same users accepted ones are
+// preferred over pending requests, then the oldest one is kept.
+func mergedConnectionCollisions(cs []user.Connection, survivorID, duplicateID string) []user.Connection {
+
+	merged := func(ID string) string {
+		if ID == duplicateID {
+			return survivorID
+		}
+		return ID
+	}
+	involvesDuplicate := func(c user.Connection) bool {
+		return c.UserID == duplicateID || c.ConnectedUserID == duplicateID
+	}
+	preferred := func(a, b user.Connection) bool {
+		if a.Accepted.IsZero() != b.Accepted.IsZero() {
+			return !a.Accepted.IsZero()
+		}
+		if !a.Created.Equal(b.Created) {
+			return a.Created.Before(b.Created)
+		}
+		return !involvesDuplicate(a)
+	}
+
+	var drop []user.Connection
+	kept := make(map[string]user.Connection)
+	for _, c := range cs {
+		userID, connectedID := merged(c.UserID), merged(c.ConnectedUserID)
+		if userID == connectedID {
+			drop = append(drop, c)
+			continue
+		}
+		otherID := connectedID
+		if otherID == survivorID {
+			otherID = userID
+		}
+		other, ok := kept[otherID]
+		switch {
+		case !ok:
+			kept[otherID] = c
+		case preferred(c, other):
+			drop = append(drop, other)
+			kept[otherID] = c
+		default:
+			drop = append(drop, c)
+		}
+	}
+
+	return drop
+}
+
+// mergeBlocks moves the blocks made by and of the user with duplicateID to
+// the user with survivorID using tx, dropping blocks between the two users
+// and ones the surviving user already has. Follows and connections between
+// the surviving user and the users in blocks with them are then removed as
+// they would be when blocking (see Roach.InsertBlock).
+func mergeBlocks(tx *sql.Tx, survivorID, duplicateID string) error {
+
+	q := `
+		DELETE FROM ` + TblBlocks + `
+			WHERE (` + ColUserID + `=$1 AND ` + ColBlockedID + `=$2)
+				OR (` + ColUserID + `=$2 AND ` + ColBlockedID + `=$1)
+	`
+	if _, err := tx.Exec(q, survivorID, duplicateID); err != nil {
+		return errors.Newf("delete blocks between the users: %v", err)
+	}
+	q = `
+		DELETE FROM ` + TblBlocks + `
+			WHERE ` + ColUserID + `=$2 AND ` + ColBlockedID + ` IN (
+				SELECT ` + ColBlockedID + ` FROM ` + TblBlocks + ` WHERE ` + ColUserID + `=$1
+			)
+	`
+	if _, err := tx.Exec(q, survivorID, duplicateID); err != nil {
+		return errors.Newf("delete colliding blocks made: %v", err)
+	}
+	q = `
+		DELETE FROM ` + TblBlocks + `
+			WHERE ` + ColBlockedID + `=$2 AND ` + ColUserID + ` IN (
+				SELECT ` + ColUserID + ` FROM ` + TblBlocks + ` WHERE ` + ColBlockedID + `=$1
+			)
+	`
+	if _, err := tx.Exec(q, survivorID, duplicateID); err != nil {
+		return errors.Newf("delete colliding blocks received: %v", err)
+	}
+
+	q = `UPDATE ` + TblBlocks + ` SET ` + ColUserID + `=$1 WHERE ` + ColUserID + `=$2`
+	if _, err := tx.Exec(q, survivorID, duplicateID); err != nil {
+		return errors.Newf("move blocks made: %v", err)
+	}
+	q = `UPDATE ` + TblBlocks + ` SET ` + ColBlockedID + `=$1 WHERE ` + ColBlockedID + `=$2`
+	if _, err := tx.Exec(q, survivorID, duplicateID); err != nil {
+		return errors.Newf("move blocks received: %v", err)
+	}
+
+	q = `
+		SELECT ` + ColBlockedID + ` FROM ` + TblBlocks + ` WHERE ` + ColUserID + `=$1
+		UNION
+		SELECT ` + ColUserID + ` FROM ` + TblBlocks + ` WHERE ` + ColBlockedID + `=$1
+	`
+	rows, err := tx.Query(q, survivorID)
+	if err != nil {
+		return errors.Newf("fetch blocked and blocking users: %v", err)
+	}
+	defer rows.Close()
+
+	var otherIDs []string
+	for rows.Next() {
+		var ID string
+		if err := rows.Scan(&ID); err != nil {
+			return errors.Newf("scan user ID from row: %v", err)
+		}
+		otherIDs = append(otherIDs, ID)
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Newf("iterate result set: %v", err)
+	}
+
+	for _, otherID := range otherIDs {
+		if err := deleteRelationsBetween(tx, survivorID, otherID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package roach
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tomogoma/usersms/pkg/rating"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+func TestMergedRatingCollisions(t *testing.T) {
+	older := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	tt := []struct {
+		name           string
+		rts            []rating.Rating
+		expDropIDs     []string
+		expAffectedIDs []string
+	}{
+		{
+			name: "no collisions",
+			rts: []rating.Rating{
+				{ID: "1", ByUserID: "dup", ForUserID: "a", ForSection: "s", LastUpdated: older},
+				{ID: "2", ByUserID: "b", ForUserID: "dup", ForSection: "s", LastUpdated: older},
+			},
+			expAffectedIDs: []string{"surv"},
+		},
+		{
+			name: "self ratings dropped",
+			rts: []rating.Rating{
+				{ID: "1", ByUserID: "dup", ForUserID: "surv", ForSection: "s", LastUpdated: older},
+				{ID: "2", ByUserID: "surv", ForUserID: "dup", ForSection: "s", LastUpdated: older},
+			},
+			expDropIDs:     []string{"1", "2"},
+			expAffectedIDs: []string{"surv"},
+		},
+		{
+			name: "newer rating given kept",
+			rts: []rating.Rating{
+				{ID: "1", ByUserID: "surv", ForUserID: "a", ForSection: "s", LastUpdated: older},
+				{ID: "2", ByUserID: "dup", ForUserID: "a", ForSection: "s", LastUpdated: newer},
+				{ID: "3", ByUserID: "dup", ForUserID: "a", ForSection: "t", LastUpdated: older},
+			},
+			expDropIDs:     []string{"1"},
+			expAffectedIDs: []string{"a", "surv"},
+		},
+		{
+			name: "newer rating received kept",
+			rts: []rating.Rating{
+				{ID: "1", ByUserID: "b", ForUserID: "dup", ForSection: "s", LastUpdated: newer},
+				{ID: "2", ByUserID: "b", ForUserID: "surv", ForSection: "s", LastUpdated: older},
+			},
+			expDropIDs:     []string{"2"},
+			expAffectedIDs: []string{"surv"},
+		},
+		{
+			name: "tie broken by created",
+			rts: []rating.Rating{
+				{ID: "1", ByUserID: "b", ForUserID: "dup", ForSection: "s", Created: older, LastUpdated: newer},
+				{ID: "2", ByUserID: "b", ForUserID: "surv", ForSection: "s", Created: newer, LastUpdated: newer},
+			},
+			expDropIDs:     []string{"1"},
+			expAffectedIDs: []string{"surv"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dropIDs, affectedIDs := mergedRatingCollisions(tc.rts, "surv", "dup")
+			if !reflect.DeepEqual(dropIDs, tc.expDropIDs) {
+				t.Errorf("Expected dropped %v, got %v", tc.expDropIDs, dropIDs)
+			}
+			if !reflect.DeepEqual(affectedIDs, tc.expAffectedIDs) {
+				t.Errorf("Expected affected %v, got %v", tc.expAffectedIDs, affectedIDs)
+			}
+		})
+	}
+}
+
+func TestMergedICEContacts(t *testing.T) {
+	tt := []struct {
+		name       string
+		cs         []user.ICEContact
+		ICEPhone   string
+		expKept    []user.ICEContact
+		expDropIDs []string
+	}{
+		{
+			name: "survivor's contacts first",
+			cs: []user.ICEContact{
+				{ID: "1", UserID: "dup", Phone: "+1", Priority: 1},
+				{ID: "2", UserID: "surv", Phone: "+2", Priority: 1},
+				{ID: "3", UserID: "surv", Phone: "+3", Priority: 2},
+			},
+			ICEPhone: "+2",
+			expKept: []user.ICEContact{
+				{ID: "2", UserID: "surv", Phone: "+2", Priority: 1},
+				{ID: "3", UserID: "surv", Phone: "+3", Priority: 2},
+				{ID: "1", UserID: "surv", Phone: "+1", Priority: 3},
+			},
+		},
+		{
+			name: "duplicate's primary taken",
+			cs: []user.ICEContact{
+				{ID: "1", UserID: "dup", Phone: "+1", Priority: 1},
+				{ID: "2", UserID: "surv", Phone: "+2", Priority: 1},
+				{ID: "3", UserID: "dup", Phone: "+2", Priority: 2},
+			},
+			ICEPhone: "+1",
+			expKept: []user.ICEContact{
+				{ID: "1", UserID: "surv", Phone: "+1", Priority: 1},
+				{ID: "3", UserID: "surv", Phone: "+2", Priority: 2},
+			},
+			expDropIDs: []string{"2"},
+		},
+		{
+			name: "primary phone set to ICEPhone",
+			cs: []user.ICEContact{
+				{ID: "1", UserID: "dup", Phone: "+1", Priority: 1},
+				{ID: "2", UserID: "dup", Phone: "+3", Priority: 2},
+			},
+			ICEPhone: "+3",
+			expKept: []user.ICEContact{
+				{ID: "1", UserID: "surv", Phone: "+3", Priority: 1},
+			},
+			expDropIDs: []string{"2"},
+		},
+		{
+			name: "no contacts",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			kept, dropIDs := mergedICEContacts(tc.cs, "surv", "dup", tc.ICEPhone)
+			if !reflect.DeepEqual(kept, tc.expKept) {
+				t.Errorf("Expected kept %+v, got %+v", tc.expKept, kept)
+			}
+			if !reflect.DeepEqual(dropIDs, tc.expDropIDs) {
+				t.Errorf("Expected dropped %v, got %v", tc.expDropIDs, dropIDs)
+			}
+		})
+	}
+}
+
+func TestMergedConnectionCollisions(t *testing.T) {
+	older := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	tt := []struct {
+		name    string
+		cs      []user.Connection
+		expDrop []user.Connection
+	}{
+		{
+			name: "no collisions",
+			cs: []user.Connection{
+				{UserID: "dup", ConnectedUserID: "a", Created: older},
+				{UserID: "b", ConnectedUserID: "surv", Created: older},
+			},
+		},
+		{
+			name: "connections between the users dropped",
+			cs: []user.Connection{
+				{UserID: "dup", ConnectedUserID: "surv", Created: older, Accepted: newer},
+			},
+			expDrop: []user.Connection{
+				{UserID: "dup", ConnectedUserID: "surv", Created: older, Accepted: newer},
+			},
+		},
+		{
+			name: "accepted preferred over pending",
+			cs: []user.Connection{
+				{UserID: "surv", ConnectedUserID: "a", Created: older},
+				{UserID: "a", ConnectedUserID: "dup", Created: newer, Accepted: newer},
+			},
+			expDrop: []user.Connection{
+				{UserID: "surv", ConnectedUserID: "a", Created: older},
+			},
+		},
+		{
+			name: "oldest kept",
+			cs: []user.Connection{
+				{UserID: "dup", ConnectedUserID: "a", Created: newer, Accepted: newer},
+				{UserID: "a", ConnectedUserID: "surv", Created: older, Accepted: newer},
+			},
+			expDrop: []user.Connection{
+				{UserID: "dup", ConnectedUserID: "a", Created: newer, Accepted: newer},
+			},
+		},
+		{
+			name: "tie keeps survivor's",
+			cs: []user.Connection{
+				{UserID: "dup", ConnectedUserID: "a", Created: older},
+				{UserID: "surv", ConnectedUserID: "a", Created: older},
+			},
+			expDrop: []user.Connection{
+				{UserID: "dup", ConnectedUserID: "a", Created: older},
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			drop := mergedConnectionCollisions(tc.cs, "surv", "dup")
+			if !reflect.DeepEqual(drop, tc.expDrop) {
+				t.Errorf("Expected dropped %+v, got %+v", tc.expDrop, drop)
+			}
+		})
+	}
+}
@@ -14,14 +14,39 @@ func (r *Roach) migrate(fromVersion, toVersion int) error {
 		return fmt.Errorf("connect to db: %v", err)
 	}
 
-	if fromVersion == 0 && toVersion == 1 {
-		if err := r.migrate0To1(); err != nil {
+	if fromVersion < 0 || fromVersion >= toVersion {
+		return errors.New("not supported")
+	}
+
+	// migrations maps a version to the step that migrates it to the next
+	// version.
+	migrations := map[int]func() error{
+		0:  r.migrate0To1,
+		1:  r.migrate1To2,
+		2:  r.migrate2To3,
+		3:  r.migrate3To4,
+		4:  r.migrate4To5,
+		5:  r.migrate5To6,
+		6:  r.migrate6To7,
+		7:  r.migrate7To8,
+		8:  r.migrate8To9,
+		9:  r.migrate9To10,
+		10: r.migrate10To11,
+		11: r.migrate11To12,
+		12: r.migrate12To13,
+	}
+
+	for version := fromVersion; version < toVersion; version++ {
+		migrateStep, ok := migrations[version]
+		if !ok {
+			return errors.Newf("migrating from version %d not supported", version)
+		}
+		if err := migrateStep(); err != nil {
 			return err
 		}
-		return r.setRunningVersionCurrent()
 	}
 
-	return errors.New("not supported")
+	return r.setRunningVersionCurrent()
 }
 
 func (r *Roach) migrate0To1() error {
@@ -36,3 +61,156 @@ func (r *Roach) migrate0To1() error {
 	}
 	return nil
 }
+
+func (r *Roach) migrate1To2() error {
+	q := `
+		ALTER TABLE ` + TblUsers + `
+			ADD COLUMN IF NOT EXISTS ` + ColDeactivated + ` TIMESTAMPTZ,
+			ADD COLUMN IF NOT EXISTS ` + ColErased + ` TIMESTAMPTZ
+	`
+	_, err := r.db.Exec(q)
+	if err != nil {
+		return fmt.Errorf("migrate %s table: %v", TblUsers, err)
+	}
+	return nil
+}
+
+func (r *Roach) migrate2To3() error {
+	q := `ALTER TABLE ` + TblUsers + ` ADD COLUMN IF NOT EXISTS ` + ColAttributes + ` JSONB`
+	_, err := r.db.Exec(q)
+	if err != nil {
+		return fmt.Errorf("migrate %s table: %v", TblUsers, err)
+	}
+	return nil
+}
+
+func (r *Roach) migrate3To4() error {
+	q := `ALTER TABLE ` + TblUsers + ` ADD COLUMN IF NOT EXISTS ` + ColPrivacy + ` JSONB`
+	_, err := r.db.Exec(q)
+	if err != nil {
+		return fmt.Errorf("migrate %s table: %v", TblUsers, err)
+	}
+	return nil
+}
+
+func (r *Roach) migrate4To5() error {
+	q := `
+		ALTER TABLE ` + TblUsers + `
+			ADD COLUMN IF NOT EXISTS ` + ColHandle + ` VARCHAR(30),
+			ADD COLUMN IF NOT EXISTS ` + ColHandleLower + ` VARCHAR(30) UNIQUE,
+			ADD COLUMN IF NOT EXISTS ` + ColHandleUpdt + ` TIMESTAMPTZ
+	`
+	_, err := r.db.Exec(q)
+	if err != nil {
+		return fmt.Errorf("migrate %s table: %v", TblUsers, err)
+	}
+	return nil
+}
+
+func (r *Roach) migrate5To6() error {
+	q := `
+		ALTER TABLE ` + TblUsers + `
+			ADD COLUMN IF NOT EXISTS ` + ColCountry + ` VARCHAR(2),
+			ADD COLUMN IF NOT EXISTS ` + ColLocale + ` VARCHAR(35),
+			ADD COLUMN IF NOT EXISTS ` + ColTimezone + ` VARCHAR(64)
+	`
+	_, err := r.db.Exec(q)
+	if err != nil {
+		return fmt.Errorf("migrate %s table: %v", TblUsers, err)
+	}
+	return nil
+}
+
+func (r *Roach) migrate6To7() error {
+	q := `
+		ALTER TABLE ` + TblUsers + `
+			ADD COLUMN IF NOT EXISTS ` + ColEmail + ` VARCHAR(256),
+			ADD COLUMN IF NOT EXISTS ` + ColEmailVerif + ` BOOL NOT NULL DEFAULT FALSE
+	`
+	_, err := r.db.Exec(q)
+	if err != nil {
+		return fmt.Errorf("migrate %s table: %v", TblUsers, err)
+	}
+	return nil
+}
+
+func (r *Roach) migrate7To8() error {
+	q := `
+		ALTER TABLE ` + TblUsers + `
+			ADD COLUMN IF NOT EXISTS ` + ColICEPhoneVrf + ` BOOL NOT NULL DEFAULT FALSE
+	`
+	_, err := r.db.Exec(q)
+	if err != nil {
+		return fmt.Errorf("migrate %s table: %v", TblUsers, err)
+	}
+	return nil
+}
+
+func (r *Roach) migrate8To9() error {
+	q := `
+		ALTER TABLE ` + TblUsers + `
+			ADD COLUMN IF NOT EXISTS ` + ColNumFollwrs + ` INT NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS ` + ColNumFollwng + ` INT NOT NULL DEFAULT 0
+	`
+	_, err := r.db.Exec(q)
+	if err != nil {
+		return fmt.Errorf("migrate %s table: %v", TblUsers, err)
+	}
+	return nil
+}
+
+// migrate9To10 replaces the CHECK constraint that limited genders to a fixed
+// list with one that only rejects empty values since the allowed genders
+// are now configurable (see user.WithGenders).
+func (r *Roach) migrate9To10() error {
+	q := `ALTER TABLE ` + TblUsers + ` DROP CONSTRAINT IF EXISTS ` + ChkGender
+	if _, err := r.db.Exec(q); err != nil {
+		return fmt.Errorf("migrate %s table: drop gender constraint: %v", TblUsers, err)
+	}
+	q = `
+		ALTER TABLE ` + TblUsers + `
+			ADD CONSTRAINT ` + ChkGender + ` CHECK (` + ColGender + ` != '')
+	`
+	if _, err := r.db.Exec(q); err != nil {
+		return fmt.Errorf("migrate %s table: add gender constraint: %v", TblUsers, err)
+	}
+	return nil
+}
+
+func (r *Roach) migrate10To11() error {
+	q := `ALTER TABLE ` + TblUsers + ` ADD COLUMN IF NOT EXISTS ` + ColHiddenFlds + ` JSONB`
+	_, err := r.db.Exec(q)
+	if err != nil {
+		return fmt.Errorf("migrate %s table: %v", TblUsers, err)
+	}
+	return nil
+}
+
+func (r *Roach) migrate11To12() error {
+	q := `ALTER TABLE ` + TblUsers + ` ADD COLUMN IF NOT EXISTS ` + ColMergedInto + ` VARCHAR(56)`
+	_, err := r.db.Exec(q)
+	if err != nil {
+		return fmt.Errorf("migrate %s table: %v", TblUsers, err)
+	}
+	return nil
+}
+
+// migrate12To13 creates a primary ICE contact for every user whose ICEPhone
+// was set before ICE contacts existed so that the ICEPhone keeps mirroring
+// the primary contact's phone.
+func (r *Roach) migrate12To13() error {
+	cols := ColDesc(ColUserID, ColName, ColPhone, ColPriority, ColCreated,
+		ColLastUpdated)
+	q := `
+		INSERT INTO ` + TblICEContacts + ` (` + cols + `)
+			SELECT ` + ColID + `, $1, ` + ColICEPhone + `, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+				FROM ` + TblUsers + `
+				WHERE ` + ColICEPhone + ` IS NOT NULL AND ` + ColICEPhone + ` != ''
+					AND ` + ColID + ` NOT IN (SELECT ` + ColUserID + ` FROM ` + TblICEContacts + `)
+	`
+	_, err := r.db.Exec(q, defaultICEContactName)
+	if err != nil {
+		return fmt.Errorf("migrate %s table: %v", TblICEContacts, err)
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package roach
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tomogoma/crdb"
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+var allModerationCols = ColDesc(ColID, ColUserID, ColField, ColValue,
+	ColPrevValue, ColReason, ColHeld, ColStatus, ColResolvedBy, ColResolved,
+	ColCreated)
+
+// moderatedCols maps the moderated user.Field... values to their respective
+// columns.
+var moderatedCols = map[string]string{
+	user.FieldName:      ColName,
+	user.FieldBio:       ColBio,
+	user.FieldAvatarURL: ColAvatarURL,
+}
+
+// UserModerations fetches the moderations of the user with userID, most
+// recent first.
+func (r *Roach) UserModerations(userID string, offset int64, count int32) ([]user.Moderation, error) {
+	return r.moderations(ColUserID, userID, "DESC", offset, count)
+}
+
+// ModerationQueue fetches the moderations with status, oldest first.
+func (r *Roach) ModerationQueue(status string, offset int64, count int32) ([]user.Moderation, error) {
+	return r.moderations(ColStatus, status, "ASC", offset, count)
+}
+
+// ResolveModeration sets the status of the pending moderation with ID and
+// applies it to the user's profile within the same transaction: an approved
+// held value is set and a rejected hidden value is reverted to the value it
+// replaced, recording the change in the user's history. A not found error
+// is returned if no pending moderation with ID exists.
+func (r *Roach) ResolveModeration(ID, status string, by user.Actor, at time.Time) (*user.Moderation, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	var mod *user.Moderation
+	err := r.ExecuteTx(func(tx *sql.Tx) error {
+
+		cols := ColDesc(ColStatus, ColResolvedBy, ColResolved)
+		q := `
+			UPDATE ` + TblModerations + ` SET (` + cols + `) = ($1, $2, $3)
+				WHERE ` + ColID + `=$4 AND ` + ColStatus + `=$5
+				RETURNING ` + allModerationCols + `
+		`
+		var err error
+		mod, err = scanModeration(tx.QueryRow(q, status, by.UserID, at, ID, user.ModerationPending))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errors.NewNotFound("no pending moderation found")
+			}
+			return err
+		}
+
+		switch {
+		case status == user.ModerationApproved && mod.Held:
+			err = setModeratedField(tx, *mod, mod.Value, by, at)
+		case status == user.ModerationRejected && !mod.Held:
+			err = setModeratedField(tx, *mod, mod.PreviousValue, by, at)
+		}
+		if err != nil {
+			return errors.Newf("apply moderation: %v", err)
+		}
+
+		_, err = syncHiddenFields(tx, mod.UserID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mod, nil
+}
+
+// moderations fetches the moderations whose col is val ordered by creation
+// date in dir.
+func (r *Roach) moderations(col, val, dir string, offset int64, count int32) ([]user.Moderation, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	limit, args := crdb.Pagination(offset, int64(count), []interface{}{val})
+	q := `
+		SELECT ` + allModerationCols + ` FROM ` + TblModerations + `
+			WHERE ` + col + `=$1
+			ORDER BY ` + ColCreated + ` ` + dir + `, ` + ColID + ` ` + dir + `
+			` + limit
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ms []user.Moderation
+	for rows.Next() {
+		m, err := scanModeration(rows)
+		if err != nil {
+			return nil, errors.Newf("scan moderation from row: %v", err)
+		}
+		ms = append(ms, *m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterate result set: %v", err)
+	}
+
+	if len(ms) == 0 {
+		return nil, errors.NewNotFound("no moderations found")
+	}
+
+	return ms, nil
+}
+
+// replaceModerations deletes the pending moderations of the moderated fields
+// in changes or uu.Moderations then inserts uu.Moderations using tx. The
+// hidden fields of usr are updated to match.
+func replaceModerations(tx *sql.Tx, uu user.UserUpdate, changes []user.Change, usr *user.User) error {
+
+	var fields []string
+	for _, ch := range changes {
+		if _, ok := moderatedCols[ch.Field]; ok {
+			fields = append(fields, ch.Field)
+		}
+	}
+	for _, m := range uu.Moderations {
+		fields = append(fields, m.Field)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	q := `
+		DELETE FROM ` + TblModerations + `
+			WHERE ` + ColUserID + `=$1 AND ` + ColStatus + `=$2 AND ` + ColField + ` = ANY($3)
+	`
+	if _, err := tx.Exec(q, uu.UserID, user.ModerationPending, pq.Array(fields)); err != nil {
+		return errors.Newf("delete replaced moderations: %v", err)
+	}
+
+	cols := ColDesc(ColUserID, ColField, ColValue, ColPrevValue, ColReason,
+		ColHeld, ColStatus, ColCreated)
+	q = `INSERT INTO ` + TblModerations + ` (` + cols + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	for _, m := range uu.Moderations {
+		prev := sql.NullString{String: m.PreviousValue, Valid: m.PreviousValue != ""}
+		_, err := tx.Exec(q, m.UserID, m.Field, m.Value, prev, m.Reason, m.Held,
+			m.Status, m.Created)
+		if err != nil {
+			return errors.Newf("insert %s moderation: %v", m.Field, err)
+		}
+	}
+
+	hidden, err := syncHiddenFields(tx, uu.UserID)
+	if err != nil {
+		return err
+	}
+	usr.HiddenFields = hidden
+	return nil
+}
+
+// setModeratedField sets the moderated field of the user in m to val using
+// tx, recording the change in the user's history. An empty val clears the
+// field.
+func setModeratedField(tx *sql.Tx, m user.Moderation, val string, by user.Actor, at time.Time) error {
+
+	col, ok := moderatedCols[m.Field]
+	if !ok {
+		return errors.Newf("unknown moderated field '%s'", m.Field)
+	}
+
+	q := `SELECT ` + col + ` FROM ` + TblUsers + ` WHERE ` + ColID + `=$1 AND ` + ColErased + ` IS NULL`
+	current := sql.NullString{}
+	if err := tx.QueryRow(q, m.UserID).Scan(&current); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.NewNotFound("user not found")
+		}
+		return err
+	}
+	if current.String == val {
+		return nil
+	}
+
+	cols := ColDesc(col, ColLastUpdated)
+	q = `UPDATE ` + TblUsers + ` SET (` + cols + `) = ($1, $2) WHERE ` + ColID + `=$3`
+	res, err := tx.Exec(q, sql.NullString{String: val, Valid: val != ""}, at, m.UserID)
+	if err := checkRowsAffected(res, err, 1); err != nil {
+		return err
+	}
+
+	return insertUserChanges(tx, []user.Change{{
+		UserID:           m.UserID,
+		Field:            m.Field,
+		OldValue:         current.String,
+		NewValue:         val,
+		ActorUserID:      by.UserID,
+		ActorAccessLevel: by.AccessLevel,
+		Created:          at,
+	}})
+}
+
+// syncHiddenFields sets the hidden fields of the user with userID to the
+// fields with pending moderations whose values were published (not held)
+// using tx. It returns the hidden fields.
+func syncHiddenFields(tx *sql.Tx, userID string) ([]string, error) {
+
+	q := `
+		SELECT DISTINCT ` + ColField + ` FROM ` + TblModerations + `
+			WHERE ` + ColUserID + `=$1 AND ` + ColStatus + `=$2 AND NOT ` + ColHeld + `
+			ORDER BY ` + ColField + `
+	`
+	rows, err := tx.Query(q, userID, user.ModerationPending)
+	if err != nil {
+		return nil, errors.Newf("fetch hidden fields: %v", err)
+	}
+	defer rows.Close()
+
+	var hidden []string
+	for rows.Next() {
+		var field string
+		if err := rows.Scan(&field); err != nil {
+			return nil, errors.Newf("scan hidden field: %v", err)
+		}
+		hidden = append(hidden, field)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterate result set: %v", err)
+	}
+
+	var hiddenB []byte
+	if len(hidden) > 0 {
+		if hiddenB, err = json.Marshal(hidden); err != nil {
+			return nil, errors.Newf("marshal hidden fields: %v", err)
+		}
+	}
+	q = `UPDATE ` + TblUsers + ` SET ` + ColHiddenFlds + `=$1 WHERE ` + ColID + `=$2`
+	if _, err := tx.Exec(q, hiddenB, userID); err != nil {
+		return nil, errors.Newf("update hidden fields: %v", err)
+	}
+
+	return hidden, nil
+}
+
+// scanModeration extracts a moderation from s or returns an error if reported
+// by s. The column order for s must be same order as allModerationCols.
+func scanModeration(s multiScanner) (*user.Moderation, error) {
+	m := &user.Moderation{}
+	prev := sql.NullString{}
+	resolvedBy := sql.NullString{}
+	resolved := pq.NullTime{}
+	err := s.Scan(&m.ID, &m.UserID, &m.Field, &m.Value, &prev, &m.Reason,
+		&m.Held, &m.Status, &resolvedBy, &resolved, &m.Created)
+	if err != nil {
+		return nil, err
+	}
+	m.PreviousValue = prev.String
+	m.ResolvedBy = resolvedBy.String
+	m.Resolved = resolved.Time
+	return m, nil
+}
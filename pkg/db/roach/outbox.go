@@ -0,0 +1,183 @@
+package roach
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/events"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+var allOutboxCols = ColDesc(ColID, ColTopic, ColPayload, ColAttempts,
+	ColNextAttempt, ColLastError, ColCreated)
+
+// ClaimEvents reserves up to count outbox events that are due for publishing
+// at now, oldest first, by moving their next attempt to leaseUntil so that
+// concurrent callers do not claim them too. A not found error is returned if
+// no events are due.
+func (r *Roach) ClaimEvents(now, leaseUntil time.Time, count int32) ([]events.Event, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	q := `
+		UPDATE ` + TblOutbox + ` SET ` + ColNextAttempt + `=$1
+			WHERE ` + ColID + ` IN (
+				SELECT ` + ColID + ` FROM ` + TblOutbox + `
+					WHERE ` + ColNextAttempt + ` <= $2
+					ORDER BY ` + ColNextAttempt + `, ` + ColID + `
+					LIMIT $3
+			)
+			RETURNING ` + allOutboxCols
+	rows, err := r.db.Query(q, leaseUntil, now, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var evs []events.Event
+	for rows.Next() {
+		ev, err := scanEvent(rows)
+		if err != nil {
+			return nil, errors.Newf("scan event from row: %v", err)
+		}
+		evs = append(evs, *ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterate result set: %v", err)
+	}
+
+	if len(evs) == 0 {
+		return nil, errors.NewNotFound("no events due")
+	}
+
+	// RETURNING does not preserve the sub-query's order.
+	sort.SliceStable(evs, func(i, j int) bool {
+		return evs[i].Created.Before(evs[j].Created)
+	})
+
+	return evs, nil
+}
+
+// DeleteEvent removes the published event with ID from the outbox.
+func (r *Roach) DeleteEvent(ID string) error {
+	if err := r.InitDBIfNot(); err != nil {
+		return err
+	}
+	q := `DELETE FROM ` + TblOutbox + ` WHERE ` + ColID + `=$1`
+	res, err := r.db.Exec(q, ID)
+	return checkRowsAffected(res, err, 1)
+}
+
+// RetryEvent records a failed attempt to publish the event with ID and
+// schedules the next attempt for nextAttempt.
+func (r *Roach) RetryEvent(ID string, attempts int32, nextAttempt time.Time, lastErr string) error {
+	if err := r.InitDBIfNot(); err != nil {
+		return err
+	}
+	cols := ColDesc(ColAttempts, ColNextAttempt, ColLastError)
+	q := `
+		UPDATE ` + TblOutbox + ` SET (` + cols + `) = ($1, $2, $3)
+			WHERE ` + ColID + `=$4
+	`
+	res, err := r.db.Exec(q, attempts, nextAttempt, lastErr, ID)
+	return checkRowsAffected(res, err, 1)
+}
+
+// insertEvents writes evs to the outbox and the change feed using tx so that
+// they are only published if tx commits.
+func insertEvents(tx *sql.Tx, evs ...events.Event) error {
+	if len(evs) == 0 {
+		return nil
+	}
+
+	cols := ColDesc(ColTopic, ColPayload, ColNextAttempt, ColCreated)
+	var values string
+	var args []interface{}
+	for _, ev := range evs {
+		firstParam := len(args) + 1
+		args = append(args, ev.Topic, ev.Payload, ev.NextAttempt, ev.Created)
+		values = ColDesc(values, fmt.Sprintf("(%s)", genParamsFrom(firstParam, len(args))))
+	}
+
+	q := `INSERT INTO ` + TblOutbox + ` (` + cols + `) VALUES ` + values
+	res, err := tx.Exec(q, args...)
+	if err := checkRowsAffected(res, err, int64(len(evs))); err != nil {
+		return err
+	}
+
+	return insertFeedEvents(tx, evs)
+}
+
+// insertEvent writes an event on topic about the user with userID with
+// payload occurring at to the outbox and the change feed using tx.
+func insertEvent(tx *sql.Tx, topic, userID string, payload interface{}, at time.Time) error {
+	ev, err := events.New(topic, userID, payload, at)
+	if err != nil {
+		return err
+	}
+	return insertEvents(tx, ev)
+}
+
+// userUpdatedEvents groups chs by user into TopicUserUpdated events, in the
+// order each user first appears in chs.
+func userUpdatedEvents(chs []user.Change) ([]events.Event, error) {
+
+	var order []string
+	updates := make(map[string]*events.UserUpdated)
+	for _, ch := range chs {
+		upd, ok := updates[ch.UserID]
+		if !ok {
+			upd = &events.UserUpdated{
+				UserID:      ch.UserID,
+				ActorUserID: ch.ActorUserID,
+				Updated:     ch.Created,
+			}
+			updates[ch.UserID] = upd
+			order = append(order, ch.UserID)
+		}
+		if !in(upd.Fields, ch.Field) {
+			upd.Fields = append(upd.Fields, ch.Field)
+		}
+		if ch.Created.After(upd.Updated) {
+			upd.Updated = ch.Created
+		}
+	}
+
+	evs := make([]events.Event, 0, len(order))
+	for _, userID := range order {
+		upd := updates[userID]
+		ev, err := events.New(events.TopicUserUpdated, userID, upd, upd.Updated)
+		if err != nil {
+			return nil, err
+		}
+		evs = append(evs, ev)
+	}
+	return evs, nil
+}
+
+// scanEvent extracts an outbox event from s or returns an error if reported
+// by s. The column order for s must be same order as allOutboxCols.
+func scanEvent(s multiScanner) (*events.Event, error) {
+	ev := &events.Event{}
+	lastErr := sql.NullString{}
+	err := s.Scan(&ev.ID, &ev.Topic, &ev.Payload, &ev.Attempts,
+		&ev.NextAttempt, &lastErr, &ev.Created)
+	if err != nil {
+		return nil, err
+	}
+	ev.LastError = lastErr.String
+	return ev, nil
+}
+
+func in(vals []string, val string) bool {
+	for _, v := range vals {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
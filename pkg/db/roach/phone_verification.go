@@ -0,0 +1,127 @@
+package roach
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+var allPhoneVerifCols = ColDesc(ColUserID, ColPhone, ColCodeHash, ColAttempts,
+	ColExpires, ColCreated)
+
+// PhoneVerification fetches the pending ICEPhone verification of the user
+// with userID.
+func (r *Roach) PhoneVerification(userID string) (*user.PhoneVerification, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	q := `SELECT ` + allPhoneVerifCols + ` FROM ` + TblPhoneVerifs + ` WHERE ` + ColUserID + `=$1`
+	pv := user.PhoneVerification{}
+	err := r.db.QueryRow(q, userID).Scan(&pv.UserID, &pv.Phone, &pv.CodeHash,
+		&pv.Attempts, &pv.Expires, &pv.Created)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.NewNotFound("no pending phone verification")
+		}
+		return nil, err
+	}
+
+	return &pv, nil
+}
+
+// SetPhoneVerification inserts pv, replacing any pending verification of the
+// user with pv.UserID and resetting the number of attempts.
+func (r *Roach) SetPhoneVerification(pv user.PhoneVerification) error {
+	if err := r.InitDBIfNot(); err != nil {
+		return err
+	}
+
+	updCols := ColDesc(ColPhone, ColCodeHash, ColAttempts, ColExpires, ColCreated)
+	q := `
+		INSERT INTO ` + TblPhoneVerifs + ` (` + allPhoneVerifCols + `)
+			VALUES ($1, $2, $3, 0, $4, $5)
+			ON CONFLICT (` + ColUserID + `)
+			DO UPDATE SET (` + updCols + `) = ($2, $3, 0, $4, $5)`
+	res, err := r.db.Exec(q, pv.UserID, pv.Phone, pv.CodeHash, pv.Expires, pv.Created)
+	return checkRowsAffected(res, err, 1)
+}
+
+// ClaimPhoneVerificationAttempt counts an attempt to verify the ICEPhone of
+// the user with userID and returns the pending verification with the attempt
+// counted. The attempt is only counted if the verification has not expired
+// by at and has had fewer than maxAttempts attempts, otherwise a not found
+// error is returned. Counting and checking in one statement keeps
+// concurrent attempts from exceeding maxAttempts.
+func (r *Roach) ClaimPhoneVerificationAttempt(userID string, maxAttempts int32, at time.Time) (*user.PhoneVerification, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	q := `
+		UPDATE ` + TblPhoneVerifs + ` SET ` + ColAttempts + `=` + ColAttempts + `+1
+			WHERE ` + ColUserID + `=$1 AND ` + ColAttempts + `<$2 AND ` + ColExpires + `>$3
+			RETURNING ` + allPhoneVerifCols
+	pv := user.PhoneVerification{}
+	err := r.db.QueryRow(q, userID, maxAttempts, at).Scan(&pv.UserID, &pv.Phone,
+		&pv.CodeHash, &pv.Attempts, &pv.Expires, &pv.Created)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.NewNotFound("no claimable phone verification")
+		}
+		return nil, err
+	}
+
+	return &pv, nil
+}
+
+// SetICEPhoneVerified marks the ICEPhone of the user with userID as verified
+// if it is still phone, removes the pending verification and records the
+// change in the user's history within the same transaction.
+func (r *Roach) SetICEPhoneVerified(userID, phone string, by user.Actor, at time.Time) (*user.User, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	var usr *user.User
+	err := r.ExecuteTx(func(tx *sql.Tx) error {
+
+		cols := ColDesc(ColICEPhoneVrf, ColLastUpdated)
+		q := `
+			UPDATE ` + TblUsers + ` SET (` + cols + `) = (TRUE, $1)
+				WHERE ` + ColID + `=$2 AND ` + ColICEPhone + `=$3 AND ` + ColErased + ` IS NULL
+				RETURNING ` + allUserCols + `
+		`
+		var err error
+		usr, err = scanUser(tx.QueryRow(q, at, userID, phone))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errors.NewNotFound("no user found with the ICEPhone")
+			}
+			return err
+		}
+
+		q = `DELETE FROM ` + TblPhoneVerifs + ` WHERE ` + ColUserID + `=$1`
+		if _, err := tx.Exec(q, userID); err != nil {
+			return errors.Newf("delete phone verification: %v", err)
+		}
+
+		return insertUserChanges(tx, []user.Change{{
+			UserID:           userID,
+			Field:            user.FieldICEPhoneVerified,
+			OldValue:         strconv.FormatBool(false),
+			NewValue:         strconv.FormatBool(true),
+			ActorUserID:      by.UserID,
+			ActorAccessLevel: by.AccessLevel,
+			Created:          at,
+		}})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return usr, nil
+}
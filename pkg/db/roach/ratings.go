@@ -2,25 +2,46 @@ package roach
 
 import (
 	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
 	"github.com/tomogoma/crdb"
 	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/events"
 	"github.com/tomogoma/usersms/pkg/rating"
 )
 
 var allRatingCols = ColDesc(ColID, ColForSection, ColForUserID, ColByUserID,
 	ColRating, ColComment, ColCreated, ColLastUpdated)
 
+// SaveRating inserts rt and writes a rating created event to the outbox
+// within the same transaction.
 func (r *Roach) SaveRating(rt rating.Rating) error {
 	if err := r.InitDBIfNot(); err != nil {
 		return err
 	}
-	cols := ColDesc(ColID, ColForSection, ColForUserID, ColByUserID, ColRating,
-		ColComment, ColCreated, ColLastUpdated)
-	q := `INSERT INTO ` + TblRatings + `(` + cols + `)
-			VALUES $1, $2, $3, $4, $5, $6, $7, $8`
-	res, err := r.db.Exec(q, rt.ID, rt.ForSection, rt.ForUserID, rt.ByUserID,
-		rt.Rating, rt.Comment, rt.Created, rt.LastUpdated)
-	return checkRowsAffected(res, err, 1)
+	return r.ExecuteTx(func(tx *sql.Tx) error {
+		q := `INSERT INTO ` + TblRatings + `(` + allRatingCols + `)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+		res, err := tx.Exec(q, rt.ID, rt.ForSection, rt.ForUserID, rt.ByUserID,
+			rt.Rating, rt.Comment, rt.Created, rt.LastUpdated)
+		if err := checkRowsAffected(res, err, 1); err != nil {
+			return err
+		}
+		return insertRatingCreatedEvent(tx, rt)
+	})
+}
+
+// insertRatingCreatedEvent writes a rating created event for rt to the
+// outbox using tx.
+func insertRatingCreatedEvent(tx *sql.Tx, rt rating.Rating) error {
+	return insertEvent(tx, events.TopicRatingCreated, rt.ForUserID, events.RatingCreated{
+		ID:         rt.ID,
+		ForSection: rt.ForSection,
+		ForUserID:  rt.ForUserID,
+		ByUserID:   rt.ByUserID,
+		Rating:     rt.Rating,
+		Created:    rt.Created,
+	}, rt.Created)
 }
 
 func (r *Roach) Rating(byUserID, forSection, forUserID string) (*rating.Rating, error) {
@@ -54,13 +75,19 @@ func (r *Roach) Ratings(f rating.Filter) ([]rating.Rating, error) {
 	whereOp := "AND"
 	var where string
 	var args []interface{}
-	where, args = crdb.ConcatWhereClause(f.ForSection, ColForUserID, where, whereOp, args)
+	where, args = crdb.ConcatWhereClause(f.ForSection, ColForSection, where, whereOp, args)
 	where, args = crdb.ConcatWhereClause(f.ForUserID, ColForUserID, where, whereOp, args)
 	where, args = crdb.ConcatWhereClause(f.ByUserID, ColByUserID, where, whereOp, args)
+	if f.HideBlockedBy != "" {
+		args = append(args, f.HideBlockedBy)
+		where = fmt.Sprintf("%s %s %s NOT IN (SELECT %s FROM %s WHERE %s = $%d)",
+			where, whereOp, ColByUserID, ColBlockedID, TblBlocks, ColUserID, len(args))
+	}
 
 	limit, args := crdb.Pagination(f.Offset, int64(f.Count), args)
 
-	q := `SELECT ` + allRatingCols + ` FROM ` + TblRatings + ` WHERE ` + where + ` ` + limit
+	q := `SELECT ` + allRatingCols + ` FROM ` + TblRatings + ` WHERE ` + where + `
+			ORDER BY ` + ColCreated + `, ` + ColID + ` ` + limit
 	rows, err := r.db.Query(q, args...)
 	if err != nil {
 		return nil, err
@@ -86,6 +113,45 @@ func (r *Roach) Ratings(f rating.Filter) ([]rating.Rating, error) {
 	return rts, nil
 }
 
+// RatedConnections returns those of otherUserIDs that have rated or been
+// rated by the user with userID.
+func (r *Roach) RatedConnections(userID string, otherUserIDs []string) ([]string, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	q := `
+		SELECT ` + ColForUserID + ` FROM ` + TblRatings + `
+			WHERE ` + ColByUserID + `=$1 AND ` + ColForUserID + ` = ANY($2)
+		UNION
+		SELECT ` + ColByUserID + ` FROM ` + TblRatings + `
+			WHERE ` + ColForUserID + `=$1 AND ` + ColByUserID + ` = ANY($2)
+	`
+	rows, err := r.db.Query(q, userID, pq.Array(otherUserIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var IDs []string
+	for rows.Next() {
+		var ID string
+		if err := rows.Scan(&ID); err != nil {
+			return nil, errors.Newf("scan row in result set: %v", err)
+		}
+		IDs = append(IDs, ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterating result set: %v", err)
+	}
+
+	if len(IDs) == 0 {
+		return nil, errors.NewNotFound("no rated connections found")
+	}
+
+	return IDs, nil
+}
+
 func (r *Roach) AverageUserRatings(offset int64, count int32) ([]rating.AverageUser, error) {
 
 	if err := r.InitDBIfNot(); err != nil {
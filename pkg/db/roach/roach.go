@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	"github.com/cockroachdb/cockroach-go/crdb"
+	"github.com/lib/pq"
 	crdbH "github.com/tomogoma/crdb"
 	"github.com/tomogoma/go-typed-errors"
 	"github.com/tomogoma/usersms/pkg/config"
@@ -18,6 +19,7 @@ import (
 // Use NewRoach() to instantiate.
 type Roach struct {
 	errors.NotFoundErrCheck
+	errors.ConflictErrCheck
 	dsn              string
 	dbName           string
 	db               *sql.DB
@@ -33,6 +35,10 @@ type multiScanner interface {
 
 const (
 	keyDBVersion = "db.version"
+
+	// pgCodeUniqueViolation is the postgres error code reported when a
+	// UNIQUE constraint is violated.
+	pgCodeUniqueViolation = "23505"
 )
 
 // NewRoach creates an instance of *Roach. A db connection is only established
@@ -151,6 +157,13 @@ func (r *Roach) setRunningVersionCurrent() error {
 	return nil
 }
 
+// isUniqueViolation returns true if err was reported by the DB because a
+// UNIQUE constraint would have been violated.
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == pgCodeUniqueViolation
+}
+
 func checkRowsAffected(r sql.Result, err error, expAffected int64) error {
 	if err != nil {
 		if err == sql.ErrNoRows {
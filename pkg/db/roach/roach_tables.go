@@ -2,13 +2,22 @@ package roach
 
 const (
 	// Database definition version
-	Version = 1
+	Version = 13
 
 	// Table names
 	TblConfigurations = "configurations"
 	TblAPIKeys        = "api_keys"
 	TblUsers          = "users"
 	TblRatings        = "ratings"
+	TblUserHistory    = "user_history"
+	TblICEContacts    = "ice_contacts"
+	TblPhoneVerifs    = "phone_verifications"
+	TblBlocks         = "blocks"
+	TblFollows        = "follows"
+	TblConnections    = "connections"
+	TblModerations    = "moderations"
+	TblOutbox         = "outbox"
+	TblChangeFeed     = "change_feed"
 
 	// DB Table Columns
 	ColID          = "ID"
@@ -28,6 +37,51 @@ const (
 	ColAvatarURL   = "avatar_url"
 	ColBio         = "bio"
 	ColNumRaters   = "num_raters"
+	ColField       = "field"
+	ColOldValue    = "old_value"
+	ColNewValue    = "new_value"
+	ColActorUserID = "actor_user_id"
+	ColActorACL    = "actor_access_level"
+	ColDeactivated = "deactivated"
+	ColErased      = "erased"
+	ColAttributes  = "attributes"
+	ColPrivacy     = "privacy"
+	ColRelation    = "relationship"
+	ColPhone       = "phone"
+	ColPriority    = "priority"
+	ColHandle      = "handle"
+	ColHandleLower = "handle_lower"
+	ColHandleUpdt  = "handle_updated"
+	ColCountry     = "country"
+	ColLocale      = "locale"
+	ColTimezone    = "timezone"
+	ColEmail       = "email"
+	ColEmailVerif  = "email_verified"
+	ColICEPhoneVrf = "ice_phone_verified"
+	ColCodeHash    = "code_hash"
+	ColAttempts    = "attempts"
+	ColExpires     = "expires"
+	ColBlockedID   = "blocked_user_id"
+	ColFollowedID  = "followed_user_id"
+	ColConnectedID = "connected_user_id"
+	ColAccepted    = "accepted"
+	ColNumFollwrs  = "num_followers"
+	ColNumFollwng  = "num_following"
+	ColHiddenFlds  = "hidden_fields"
+	ColPrevValue   = "previous_value"
+	ColReason      = "reason"
+	ColHeld        = "held"
+	ColStatus      = "status"
+	ColResolvedBy  = "resolved_by"
+	ColResolved    = "resolved"
+	ColMergedInto  = "merged_into"
+	ColTopic       = "topic"
+	ColPayload     = "payload"
+	ColNextAttempt = "next_attempt"
+	ColLastError   = "last_error"
+
+	// Constraint names
+	ChkGender = "check_gender"
 
 	// CREATE TABLE DESCRIPTIONS
 	TblDescConfigurations = `
@@ -52,12 +106,29 @@ const (
 	CREATE TABLE IF NOT EXISTS ` + TblUsers + ` (
 		` + ColID + ` VARCHAR(56) PRIMARY KEY CHECK (` + ColID + ` != ''),
 		` + ColName + ` VARCHAR(256) CHECK (` + ColName + ` != ''),
-		` + ColGender + ` VARCHAR(16) CHECK (` + ColGender + ` IN ('MALE', 'FEMALE', 'OTHER')),
+		` + ColGender + ` VARCHAR(16) CONSTRAINT ` + ChkGender + ` CHECK (` + ColGender + ` != ''),
 		` + ColICEPhone + ` VARCHAR(24),
+		` + ColICEPhoneVrf + ` BOOL NOT NULL DEFAULT FALSE,
 		` + ColAvatarURL + ` VARCHAR(256),
 		` + ColBio + ` TEXT,
+		` + ColCountry + ` VARCHAR(2),
+		` + ColLocale + ` VARCHAR(35),
+		` + ColTimezone + ` VARCHAR(64),
+		` + ColEmail + ` VARCHAR(256),
+		` + ColEmailVerif + ` BOOL NOT NULL DEFAULT FALSE,
 		` + ColRating + ` REAL,
 		` + ColNumRaters + ` INT,
+		` + ColNumFollwrs + ` INT NOT NULL DEFAULT 0,
+		` + ColNumFollwng + ` INT NOT NULL DEFAULT 0,
+		` + ColAttributes + ` JSONB,
+		` + ColPrivacy + ` JSONB,
+		` + ColHiddenFlds + ` JSONB,
+		` + ColHandle + ` VARCHAR(30),
+		` + ColHandleLower + ` VARCHAR(30) UNIQUE,
+		` + ColHandleUpdt + ` TIMESTAMPTZ,
+		` + ColMergedInto + ` VARCHAR(56),
+		` + ColDeactivated + ` TIMESTAMPTZ,
+		` + ColErased + ` TIMESTAMPTZ,
 		` + ColCreated + ` TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		` + ColLastUpdated + ` TIMESTAMPTZ NOT NULL
 	);
@@ -75,6 +146,120 @@ const (
 		` + ColLastUpdated + ` TIMESTAMPTZ NOT NULL
 	);
 	`
+
+	TblDescUserHistory = `
+	CREATE TABLE IF NOT EXISTS ` + TblUserHistory + ` (
+		` + ColID + ` SERIAL PRIMARY KEY NOT NULL CHECK (` + ColID + `>0),
+		` + ColUserID + ` VARCHAR(56) NOT NULL REFERENCES ` + TblUsers + ` (` + ColID + `),
+		` + ColField + ` VARCHAR(56) NOT NULL CHECK (` + ColField + ` != ''),
+		` + ColOldValue + ` TEXT,
+		` + ColNewValue + ` TEXT,
+		` + ColActorUserID + ` VARCHAR(56) NOT NULL,
+		` + ColActorACL + ` REAL NOT NULL,
+		` + ColCreated + ` TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		INDEX (` + ColUserID + `, ` + ColCreated + `)
+	);
+	`
+
+	TblDescICEContacts = `
+	CREATE TABLE IF NOT EXISTS ` + TblICEContacts + ` (
+		` + ColID + ` SERIAL PRIMARY KEY NOT NULL CHECK (` + ColID + `>0),
+		` + ColUserID + ` VARCHAR(56) NOT NULL REFERENCES ` + TblUsers + ` (` + ColID + `),
+		` + ColName + ` VARCHAR(256) NOT NULL CHECK (` + ColName + ` != ''),
+		` + ColRelation + ` VARCHAR(56),
+		` + ColPhone + ` VARCHAR(24) NOT NULL CHECK (` + ColPhone + ` != ''),
+		` + ColPriority + ` INT NOT NULL CHECK (` + ColPriority + ` >= 1),
+		` + ColCreated + ` TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		` + ColLastUpdated + ` TIMESTAMPTZ NOT NULL,
+		INDEX (` + ColUserID + `, ` + ColPriority + `)
+	);
+	`
+
+	TblDescPhoneVerifs = `
+	CREATE TABLE IF NOT EXISTS ` + TblPhoneVerifs + ` (
+		` + ColUserID + ` VARCHAR(56) PRIMARY KEY REFERENCES ` + TblUsers + ` (` + ColID + `),
+		` + ColPhone + ` VARCHAR(24) NOT NULL CHECK (` + ColPhone + ` != ''),
+		` + ColCodeHash + ` VARCHAR(64) NOT NULL CHECK (` + ColCodeHash + ` != ''),
+		` + ColAttempts + ` INT NOT NULL DEFAULT 0,
+		` + ColExpires + ` TIMESTAMPTZ NOT NULL,
+		` + ColCreated + ` TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+
+	TblDescBlocks = `
+	CREATE TABLE IF NOT EXISTS ` + TblBlocks + ` (
+		` + ColUserID + ` VARCHAR(56) NOT NULL REFERENCES ` + TblUsers + ` (` + ColID + `),
+		` + ColBlockedID + ` VARCHAR(56) NOT NULL REFERENCES ` + TblUsers + ` (` + ColID + `),
+		` + ColCreated + ` TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (` + ColUserID + `, ` + ColBlockedID + `),
+		INDEX (` + ColBlockedID + `)
+	);
+	`
+
+	TblDescFollows = `
+	CREATE TABLE IF NOT EXISTS ` + TblFollows + ` (
+		` + ColUserID + ` VARCHAR(56) NOT NULL REFERENCES ` + TblUsers + ` (` + ColID + `),
+		` + ColFollowedID + ` VARCHAR(56) NOT NULL REFERENCES ` + TblUsers + ` (` + ColID + `),
+		` + ColCreated + ` TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (` + ColUserID + `, ` + ColFollowedID + `),
+		INDEX (` + ColUserID + `, ` + ColCreated + `),
+		INDEX (` + ColFollowedID + `, ` + ColCreated + `)
+	);
+	`
+
+	TblDescConnections = `
+	CREATE TABLE IF NOT EXISTS ` + TblConnections + ` (
+		` + ColUserID + ` VARCHAR(56) NOT NULL REFERENCES ` + TblUsers + ` (` + ColID + `),
+		` + ColConnectedID + ` VARCHAR(56) NOT NULL REFERENCES ` + TblUsers + ` (` + ColID + `),
+		` + ColCreated + ` TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		` + ColAccepted + ` TIMESTAMPTZ,
+		PRIMARY KEY (` + ColUserID + `, ` + ColConnectedID + `),
+		INDEX (` + ColConnectedID + `)
+	);
+	`
+
+	TblDescModerations = `
+	CREATE TABLE IF NOT EXISTS ` + TblModerations + ` (
+		` + ColID + ` SERIAL PRIMARY KEY NOT NULL CHECK (` + ColID + `>0),
+		` + ColUserID + ` VARCHAR(56) NOT NULL REFERENCES ` + TblUsers + ` (` + ColID + `),
+		` + ColField + ` VARCHAR(56) NOT NULL CHECK (` + ColField + ` != ''),
+		` + ColValue + ` TEXT NOT NULL,
+		` + ColPrevValue + ` TEXT,
+		` + ColReason + ` TEXT NOT NULL,
+		` + ColHeld + ` BOOL NOT NULL,
+		` + ColStatus + ` VARCHAR(16) NOT NULL CHECK (` + ColStatus + ` != ''),
+		` + ColResolvedBy + ` VARCHAR(56),
+		` + ColResolved + ` TIMESTAMPTZ,
+		` + ColCreated + ` TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		INDEX (` + ColStatus + `, ` + ColCreated + `),
+		INDEX (` + ColUserID + `, ` + ColCreated + `)
+	);
+	`
+
+	TblDescOutbox = `
+	CREATE TABLE IF NOT EXISTS ` + TblOutbox + ` (
+		` + ColID + ` SERIAL PRIMARY KEY NOT NULL CHECK (` + ColID + `>0),
+		` + ColTopic + ` VARCHAR(56) NOT NULL CHECK (` + ColTopic + ` != ''),
+		` + ColPayload + ` BYTEA NOT NULL,
+		` + ColAttempts + ` INT NOT NULL DEFAULT 0,
+		` + ColNextAttempt + ` TIMESTAMPTZ NOT NULL,
+		` + ColLastError + ` TEXT,
+		` + ColCreated + ` TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		INDEX (` + ColNextAttempt + `)
+	);
+	`
+
+	TblDescChangeFeed = `
+	CREATE TABLE IF NOT EXISTS ` + TblChangeFeed + ` (
+		` + ColID + ` SERIAL PRIMARY KEY NOT NULL CHECK (` + ColID + `>0),
+		` + ColUserID + ` VARCHAR(56) NOT NULL,
+		` + ColTopic + ` VARCHAR(56) NOT NULL CHECK (` + ColTopic + ` != ''),
+		` + ColPayload + ` BYTEA NOT NULL,
+		` + ColCreated + ` TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		INDEX (` + ColUserID + `, ` + ColID + `),
+		INDEX (` + ColCreated + `)
+	);
+	`
 )
 
 // AllTableDescs lists all CREATE TABLE DESCRIPTIONS in order of dependency
@@ -84,6 +269,15 @@ var AllTableDescs = []string{
 	TblDescAPIKeys,
 	TblDescUsers,
 	TblDescRatings,
+	TblDescUserHistory,
+	TblDescICEContacts,
+	TblDescPhoneVerifs,
+	TblDescBlocks,
+	TblDescFollows,
+	TblDescConnections,
+	TblDescModerations,
+	TblDescOutbox,
+	TblDescChangeFeed,
 }
 
 // AllTableNames lists all table names in order of dependency
@@ -93,4 +287,13 @@ var AllTableNames = []string{
 	TblAPIKeys,
 	TblUsers,
 	TblRatings,
+	TblUserHistory,
+	TblICEContacts,
+	TblPhoneVerifs,
+	TblBlocks,
+	TblFollows,
+	TblConnections,
+	TblModerations,
+	TblOutbox,
+	TblChangeFeed,
 }
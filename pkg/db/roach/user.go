@@ -2,34 +2,148 @@ package roach
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"github.com/lib/pq"
+	"github.com/tomogoma/crdb"
 	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/events"
 	"github.com/tomogoma/usersms/pkg/user"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
-var allUserCols = ColDesc(ColID, ColName, ColGender, ColICEPhone, ColAvatarURL,
-	ColBio, ColRating, ColNumRaters, ColCreated, ColLastUpdated)
+var allUserCols = ColDesc(ColID, ColName, ColGender, ColICEPhone,
+	ColICEPhoneVrf, ColAvatarURL, ColBio, ColCountry, ColLocale, ColTimezone,
+	ColEmail, ColEmailVerif, ColRating, ColNumRaters, ColNumFollwrs,
+	ColNumFollwng, ColAttributes, ColPrivacy, ColHiddenFlds, ColHandle,
+	ColHandleUpdt, ColMergedInto, ColDeactivated, ColErased, ColCreated,
+	ColLastUpdated)
 
+// UpsertUser inserts or updates the user in uu, recording each changed field
+// in the user's history and saving uu.Moderations within the same
+// transaction. Pending moderations of the fields being changed or moderated
+// are replaced.
 func (r *Roach) UpsertUser(uu user.UserUpdate) (*user.User, error) {
 	if err := r.InitDBIfNot(); err != nil {
 		return nil, err
 	}
 
+	var usr *user.User
+	err := r.ExecuteTx(func(tx *sql.Tx) error {
+		var err error
+		usr, err = upsertUserTx(tx, uu)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return usr, nil
+}
+
+// upsertUserTx performs UpsertUser using tx. A user.MergedError is returned
+// if the user has been merged into another user.
+func upsertUserTx(tx *sql.Tx, uu user.UserUpdate) (*user.User, error) {
+
+	q := `SELECT ` + allUserCols + ` FROM ` + TblUsers + ` WHERE ` + ColID + `=$1`
+	current, err := scanUser(tx.QueryRow(q, uu.UserID))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return nil, errors.Newf("fetch current user: %v", err)
+		}
+		current = &user.User{}
+	}
+	if current.MergedInto != "" {
+		return nil, user.MergedError{UserID: current.ID, MergedInto: current.MergedInto}
+	}
+
+	usr, err := upsertUser(tx, uu, *current)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := uu.Changes(*current)
+	if err := insertUserChanges(tx, changes); err != nil {
+		return nil, errors.Newf("record user history: %v", err)
+	}
+
+	if err := replaceModerations(tx, uu, changes, usr); err != nil {
+		return nil, errors.Newf("save moderations: %v", err)
+	}
+
+	// ICEPhone mirrors the primary ICE contact's phone.
+	if uu.ICEPhone.IsUpdating {
+		if err := mirrorICEPhone(tx, uu.UserID, uu.ICEPhone.NewValue, uu.Time); err != nil {
+			return nil, err
+		}
+	}
+
+	return usr, nil
+}
+
+// upsertUser inserts or updates the user in uu using tx. current is the
+// user's current state (empty for new users).
+func upsertUser(tx *sql.Tx, uu user.UserUpdate, current user.User) (*user.User, error) {
+
 	// updCols columns and their args/params will only be used during update of
 	// existing user.
 
 	updCols, args := addStrUpdate(uu.Name, ColName, "", []interface{}{})
 	updCols, args = addStrUpdate(uu.ICEPhone, ColICEPhone, updCols, args)
+	if uu.ICEPhone.IsUpdating && uu.ICEPhone.NewValue != current.ICEPhone {
+		// A changed ICEPhone needs to be verified afresh.
+		updCols = ColDesc(updCols, ColICEPhoneVrf)
+		args = append(args, false)
+	}
 	updCols, args = addStrUpdate(uu.Gender, ColGender, updCols, args)
 	updCols, args = addStrUpdate(uu.AvatarURL, ColAvatarURL, updCols, args)
 	updCols, args = addStrUpdate(uu.Bio, ColBio, updCols, args)
+	updCols, args = addStrUpdate(uu.Country, ColCountry, updCols, args)
+	updCols, args = addStrUpdate(uu.Locale, ColLocale, updCols, args)
+	updCols, args = addStrUpdate(uu.Timezone, ColTimezone, updCols, args)
+
+	// A changed email needs to be verified afresh.
+	if uu.Email.IsUpdating && uu.Email.NewValue != current.Email {
+		updCols = ColDesc(updCols, ColEmail, ColEmailVerif)
+		args = append(args, uu.Email.NewValue, false)
+	}
+
+	if uu.Handle.IsUpdating && uu.Handle.NewValue != current.Handle {
+		handle := sql.NullString{String: uu.Handle.NewValue, Valid: uu.Handle.NewValue != ""}
+		handleLower := sql.NullString{String: strings.ToLower(handle.String), Valid: handle.Valid}
+		updCols = ColDesc(updCols, ColHandle, ColHandleLower, ColHandleUpdt)
+		args = append(args, handle, handleLower, uu.Time)
+	}
+
+	if len(uu.Attributes) > 0 {
+		attrsB, err := json.Marshal(user.MergeAttributes(current.Attributes, uu.Attributes))
+		if err != nil {
+			return nil, errors.Newf("marshal attributes: %v", err)
+		}
+		updCols = ColDesc(updCols, ColAttributes)
+		args = append(args, attrsB)
+	}
+
+	if len(uu.Privacy) > 0 {
+		privacyB, err := json.Marshal(user.MergePrivacy(current.Privacy, uu.Privacy))
+		if err != nil {
+			return nil, errors.Newf("marshal privacy: %v", err)
+		}
+		updCols = ColDesc(updCols, ColPrivacy)
+		args = append(args, privacyB)
+	}
 
 	updCols = ColDesc(updCols, ColLastUpdated)
 	args = append(args, uu.Time)
 	updParams := genParams(len(args))
 
+	if !uu.IfLastUpdated.IsZero() {
+		return updateUserIfUnmodified(tx, uu, updCols, updParams, args)
+	}
+
 	// insCols columns and their args/params includes update columns and
 	// columns inserted only during inserts.
 	insCols := ColDesc(updCols, ColID, ColCreated)
@@ -43,8 +157,42 @@ func (r *Roach) UpsertUser(uu user.UserUpdate) (*user.User, error) {
 				UPDATE SET (` + updCols + `) = (` + updParams + `)
 			RETURNING ` + allUserCols + `
 	`
-	usr, err := scanUser(r.db.QueryRow(q, args...))
+	usr, err := scanUser(tx.QueryRow(q, args...))
 	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.NewConflict("handle is already taken")
+		}
+		return nil, err
+	}
+	return usr, nil
+}
+
+// updateUserIfUnmodified updates the existing user in uu only if the stored
+// last_updated value still equals uu.IfLastUpdated. The check is part of the
+// UPDATE statement so that a concurrent update between reading and writing
+// cannot slip through. A user.PreconditionFailedError is returned if the
+// user does not exist or has been updated since uu.IfLastUpdated.
+func updateUserIfUnmodified(tx *sql.Tx, uu user.UserUpdate, updCols,
+	updParams string, args []interface{}) (*user.User, error) {
+
+	args = append(args, uu.UserID, uu.IfLastUpdated)
+	q := `
+		UPDATE ` + TblUsers + `
+			SET (` + updCols + `) = (` + updParams + `)
+			WHERE ` + ColID + `=$` + strconv.Itoa(len(args)-1) + `
+				AND ` + ColLastUpdated + `=$` + strconv.Itoa(len(args)) + `
+			RETURNING ` + allUserCols + `
+	`
+	usr, err := scanUser(tx.QueryRow(q, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.PreconditionFailedError{Data: fmt.Sprintf(
+				"user has been updated since %s, fetch the user and try again",
+				uu.IfLastUpdated.Format(time.RFC3339Nano))}
+		}
+		if isUniqueViolation(err) {
+			return nil, errors.NewConflict("handle is already taken")
+		}
 		return nil, err
 	}
 	return usr, nil
@@ -87,6 +235,428 @@ func (r *Roach) User(userID string, offsetUpdateDate time.Time) (*user.User, err
 	return usr, nil
 }
 
+// UserByHandle fetches the user whose handle matches handle (case
+// insensitive).
+func (r *Roach) UserByHandle(handle string) (*user.User, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	q := `SELECT ` + allUserCols + ` FROM ` + TblUsers + ` WHERE ` + ColHandleLower + `=$1`
+	usr, err := scanUser(r.db.QueryRow(q, strings.ToLower(handle)))
+	if err != nil {
+		if sql.ErrNoRows == err {
+			return nil, errors.NewNotFound("no user found for handle")
+		}
+		return nil, err
+	}
+
+	return usr, nil
+}
+
+// SetEmailVerified marks the email of the user with userID as verified,
+// recording the change in the user's history within the same transaction.
+// A not found error is returned if the user's email is no longer email.
+func (r *Roach) SetEmailVerified(userID, email string, by user.Actor, at time.Time) (*user.User, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	var usr *user.User
+	err := r.ExecuteTx(func(tx *sql.Tx) error {
+
+		cols := ColDesc(ColEmailVerif, ColLastUpdated)
+		q := `
+			UPDATE ` + TblUsers + ` SET (` + cols + `) = (TRUE, $1)
+				WHERE ` + ColID + `=$2 AND ` + ColEmail + `=$3 AND ` + ColErased + ` IS NULL
+				RETURNING ` + allUserCols + `
+		`
+		var err error
+		usr, err = scanUser(tx.QueryRow(q, at, userID, email))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errors.NewNotFound("no user found with the email")
+			}
+			return err
+		}
+
+		return insertUserChanges(tx, []user.Change{{
+			UserID:           userID,
+			Field:            user.FieldEmailVerified,
+			OldValue:         strconv.FormatBool(false),
+			NewValue:         strconv.FormatBool(true),
+			ActorUserID:      by.UserID,
+			ActorAccessLevel: by.AccessLevel,
+			Created:          at,
+		}})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return usr, nil
+}
+
+// Users fetches the users whose IDs are in IDs. IDs without a matching user
+// are ignored; a not found error is returned only if none of the IDs match.
+func (r *Roach) Users(IDs []string) ([]user.User, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	q := `SELECT ` + allUserCols + ` FROM ` + TblUsers + ` WHERE ` + ColID + ` = ANY($1)`
+	rows, err := r.db.Query(q, pq.Array(IDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usrs []user.User
+	for rows.Next() {
+		usr, err := scanUser(rows)
+		if err != nil {
+			return nil, errors.Newf("scan user from row: %v", err)
+		}
+		usrs = append(usrs, *usr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterate result set: %v", err)
+	}
+
+	if len(usrs) == 0 {
+		return nil, errors.NewNotFound("no user found for provided IDs")
+	}
+
+	return usrs, nil
+}
+
+// SetUserDeactivated marks the user with userID as deactivated at the
+// provided time or re-activates them if deactivated is zero. Erased users
+// cannot be re-activated.
+func (r *Roach) SetUserDeactivated(userID string, deactivated, now time.Time) error {
+	if err := r.InitDBIfNot(); err != nil {
+		return err
+	}
+
+	cols := ColDesc(ColDeactivated, ColLastUpdated)
+	q := `
+		UPDATE ` + TblUsers + ` SET (` + cols + `) = ($1, $2)
+			WHERE ` + ColID + `=$3 AND ` + ColErased + ` IS NULL
+	`
+	res, err := r.db.Exec(q, pq.NullTime{Time: deactivated, Valid: !deactivated.IsZero()},
+		now, userID)
+	return checkRowsAffected(res, err, 1)
+}
+
+// EraseUser scrubs the personally identifiable values of the user with userID
+// and anonymizes their ratings. The user's row is retained (marked as erased
+// and deactivated) so that foreign keys to it remain valid. Ratings given by
+// the user are re-assigned to user.AnonymousUserID, comments on ratings given
+// and received are removed, and the user's profile history, ICE contacts,
+// pending phone verification, moderations, blocks, follows, connections
+// (made by or involving the user) and change feed events are deleted.
+func (r *Roach) EraseUser(userID string, at time.Time) error {
+	if err := r.InitDBIfNot(); err != nil {
+		return err
+	}
+
+	return r.ExecuteTx(func(tx *sql.Tx) error {
+
+		scrubCols := ColDesc(ColName, ColGender, ColICEPhone, ColAvatarURL,
+			ColBio, ColCountry, ColLocale, ColTimezone, ColEmail, ColAttributes,
+			ColHiddenFlds, ColHandle, ColHandleLower, ColICEPhoneVrf, ColEmailVerif,
+			ColErased, ColDeactivated, ColLastUpdated)
+		q := `
+			UPDATE ` + TblUsers + `
+				SET (` + scrubCols + `) = (NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, FALSE, FALSE, $1, COALESCE(` + ColDeactivated + `, $1), $1)
+				WHERE ` + ColID + `=$2 AND ` + ColErased + ` IS NULL
+		`
+		res, err := tx.Exec(q, at, userID)
+		if err := checkRowsAffected(res, err, 1); err != nil {
+			return err
+		}
+
+		insCols := ColDesc(ColID, ColErased, ColDeactivated, ColLastUpdated)
+		q = `
+			INSERT INTO ` + TblUsers + ` (` + insCols + `)
+				VALUES ($1, $2, $2, $2)
+				ON CONFLICT (` + ColID + `) DO NOTHING
+		`
+		if _, err := tx.Exec(q, user.AnonymousUserID, at); err != nil {
+			return errors.Newf("ensure anonymous user exists: %v", err)
+		}
+
+		updCols := ColDesc(ColByUserID, ColComment, ColLastUpdated)
+		q = `
+			UPDATE ` + TblRatings + ` SET (` + updCols + `) = ($1, NULL, $2)
+				WHERE ` + ColByUserID + `=$3
+		`
+		if _, err := tx.Exec(q, user.AnonymousUserID, at, userID); err != nil {
+			return errors.Newf("anonymize ratings given: %v", err)
+		}
+
+		updCols = ColDesc(ColComment, ColLastUpdated)
+		q = `
+			UPDATE ` + TblRatings + ` SET (` + updCols + `) = (NULL, $1)
+				WHERE ` + ColForUserID + `=$2
+		`
+		if _, err := tx.Exec(q, at, userID); err != nil {
+			return errors.Newf("anonymize ratings received: %v", err)
+		}
+
+		q = `DELETE FROM ` + TblUserHistory + ` WHERE ` + ColUserID + `=$1`
+		if _, err := tx.Exec(q, userID); err != nil {
+			return errors.Newf("delete user history: %v", err)
+		}
+
+		q = `DELETE FROM ` + TblICEContacts + ` WHERE ` + ColUserID + `=$1`
+		if _, err := tx.Exec(q, userID); err != nil {
+			return errors.Newf("delete ICE contacts: %v", err)
+		}
+
+		q = `DELETE FROM ` + TblPhoneVerifs + ` WHERE ` + ColUserID + `=$1`
+		if _, err := tx.Exec(q, userID); err != nil {
+			return errors.Newf("delete phone verifications: %v", err)
+		}
+
+		q = `DELETE FROM ` + TblModerations + ` WHERE ` + ColUserID + `=$1`
+		if _, err := tx.Exec(q, userID); err != nil {
+			return errors.Newf("delete moderations: %v", err)
+		}
+
+		q = `DELETE FROM ` + TblBlocks + ` WHERE ` + ColUserID + `=$1 OR ` + ColBlockedID + `=$1`
+		if _, err := tx.Exec(q, userID); err != nil {
+			return errors.Newf("delete blocks: %v", err)
+		}
+
+		if err := deleteUserFollows(tx, userID); err != nil {
+			return err
+		}
+
+		q = `DELETE FROM ` + TblConnections + ` WHERE ` + ColUserID + `=$1 OR ` + ColConnectedID + `=$1`
+		if _, err := tx.Exec(q, userID); err != nil {
+			return errors.Newf("delete connections: %v", err)
+		}
+
+		q = `DELETE FROM ` + TblChangeFeed + ` WHERE ` + ColUserID + `=$1`
+		if _, err := tx.Exec(q, userID); err != nil {
+			return errors.Newf("delete change feed events: %v", err)
+		}
+
+		return insertEvent(tx, events.TopicUserDeleted, userID,
+			events.UserDeleted{UserID: userID, Deleted: at}, at)
+	})
+}
+
+// UserDeactivated returns true if the user with userID is deactivated (or
+// erased) or a not found error if no such user exists.
+func (r *Roach) UserDeactivated(userID string) (bool, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return false, err
+	}
+
+	q := `SELECT ` + ColDeactivated + ` IS NOT NULL FROM ` + TblUsers + ` WHERE ` + ColID + `=$1`
+	var deactivated bool
+	if err := r.db.QueryRow(q, userID).Scan(&deactivated); err != nil {
+		if err == sql.ErrNoRows {
+			return false, errors.NewNotFound("user not found")
+		}
+		return false, err
+	}
+
+	return deactivated, nil
+}
+
+// SearchUsers fetches the users matching f. Results are ordered by f.Sort
+// then by ID so that pagination is stable.
+func (r *Roach) SearchUsers(f user.Filter) ([]user.User, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	whereOp := "AND"
+	var where string
+	var args []interface{}
+
+	if f.NamePrefix != "" {
+		c := &crdb.Comparison{Op: "ILIKE", Val: escapeLike(f.NamePrefix) + "%"}
+		where, args = crdb.ConcatWhereClause(c, ColName, where, whereOp, args)
+	}
+
+	for _, term := range strings.Fields(f.Query) {
+		args = append(args, "%"+escapeLike(term)+"%")
+		termWhere := fmt.Sprintf("%s ILIKE $%d", ColName, len(args))
+		if !f.PublicOnly {
+			termWhere = fmt.Sprintf("(%s OR %s ILIKE $%d)", termWhere, ColBio, len(args))
+		}
+		if where != "" {
+			where = where + " " + whereOp + " "
+		}
+		where = where + termWhere
+	}
+
+	// Users that have hidden their name from the public should not be
+	// discoverable by it.
+	if f.PublicOnly && (f.NamePrefix != "" || f.Query != "") {
+		args = append(args, user.FieldName, user.VisibilityPublic)
+		namePublic := fmt.Sprintf("(%s->>$%d IS NULL OR %s->>$%d = $%d)",
+			ColPrivacy, len(args)-1, ColPrivacy, len(args)-1, len(args))
+		if where != "" {
+			where = where + " " + whereOp + " "
+		}
+		where = where + namePublic
+	}
+
+	if f.ExcludeBlockersOf != "" {
+		args = append(args, f.ExcludeBlockersOf)
+		notBlocker := fmt.Sprintf("%s NOT IN (SELECT %s FROM %s WHERE %s = $%d)",
+			ColID, ColUserID, TblBlocks, ColBlockedID, len(args))
+		if where != "" {
+			where = where + " " + whereOp + " "
+		}
+		where = where + notBlocker
+	}
+
+	if !f.IncludeDeactivated {
+		c := &crdb.Comparison{Op: crdb.OpIsNull}
+		where, args = crdb.ConcatWhereClause(c, ColDeactivated, where, whereOp, args)
+	}
+
+	where, args = crdb.ConcatWhereClause(f.Gender, ColGender, where, whereOp, args)
+	if f.Gender != nil && len(f.GenderVisibleTo) > 0 {
+		args = append(args, user.FieldGender,
+			user.Privacy{}.Visibility(user.FieldGender), pq.Array(f.GenderVisibleTo))
+		genderVisible := fmt.Sprintf("COALESCE(%s->>$%d, $%d) = ANY($%d)",
+			ColPrivacy, len(args)-2, len(args)-1, len(args))
+		where = where + " " + whereOp + " " + genderVisible
+	}
+	for i := range f.Rating {
+		where, args = crdb.ConcatWhereClause(&f.Rating[i], ColRating, where, whereOp, args)
+	}
+	for i := range f.Created {
+		where, args = crdb.ConcatWhereClause(&f.Created[i], ColCreated, where, whereOp, args)
+	}
+	for i := range f.LastUpdated {
+		where, args = crdb.ConcatWhereClause(&f.LastUpdated[i], ColLastUpdated, where, whereOp, args)
+	}
+	if len(f.Completeness) > 0 {
+		score, err := completenessExpr(f.CompletenessWeights)
+		if err != nil {
+			return nil, err
+		}
+		for i := range f.Completeness {
+			where, args = crdb.ConcatWhereClause(&f.Completeness[i], score, where, whereOp, args)
+		}
+	}
+	if where != "" {
+		where = " WHERE " + where
+	}
+
+	orderBy, err := crdb.OrderBy(f.Sort, userSortCol)
+	if err != nil {
+		return nil, errors.NewClientf("sort: %v", err)
+	}
+	if orderBy == "" {
+		orderBy = "ORDER BY " + ColID
+	} else {
+		orderBy = ColDesc(orderBy, ColID)
+	}
+
+	limit, args := crdb.Pagination(f.Offset, int64(f.Count), args)
+
+	q := `SELECT ` + allUserCols + ` FROM ` + TblUsers + where + ` ` + orderBy + ` ` + limit
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usrs []user.User
+	for rows.Next() {
+		usr, err := scanUser(rows)
+		if err != nil {
+			return nil, errors.Newf("scan user from row: %v", err)
+		}
+		usrs = append(usrs, *usr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterate result set: %v", err)
+	}
+
+	if len(usrs) == 0 {
+		return nil, errors.NewNotFound("no user found for filter")
+	}
+
+	return usrs, nil
+}
+
+// userSortCol maps the user.Sort... values to their respective columns.
+func userSortCol(modelCol interface{}) (string, error) {
+	switch modelCol {
+	case user.SortName:
+		return ColName, nil
+	case user.SortRating:
+		return ColRating, nil
+	case user.SortCreated:
+		return ColCreated, nil
+	case user.SortLastUpdated:
+		return ColLastUpdated, nil
+	default:
+		return "", errors.Newf("unknown sort field '%v'", modelCol)
+	}
+}
+
+// completenessCols maps the user.Field... values that can be weighted for
+// profile completeness to their respective columns.
+var completenessCols = map[string]string{
+	user.FieldName:      ColName,
+	user.FieldICEPhone:  ColICEPhone,
+	user.FieldGender:    ColGender,
+	user.FieldAvatarURL: ColAvatarURL,
+	user.FieldBio:       ColBio,
+	user.FieldHandle:    ColHandle,
+	user.FieldCountry:   ColCountry,
+	user.FieldLocale:    ColLocale,
+	user.FieldTimezone:  ColTimezone,
+	user.FieldEmail:     ColEmail,
+}
+
+// completenessExpr returns an SQL expression that evaluates to the profile
+// completeness score (see user.Completeness.Score) of a user given weights.
+func completenessExpr(weights map[string]int) (string, error) {
+	fields := make([]string, 0, len(weights))
+	for field := range weights {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var filled []string
+	total := 0
+	for _, field := range fields {
+		col, ok := completenessCols[field]
+		if !ok {
+			return "", errors.Newf("unknown completeness field '%s'", field)
+		}
+		if weights[field] <= 0 {
+			continue
+		}
+		total += weights[field]
+		filled = append(filled, fmt.Sprintf(
+			"CASE WHEN COALESCE(%s, '') != '' THEN %d ELSE 0 END", col, weights[field]))
+	}
+	if total == 0 {
+		return "", errors.New("no completeness weights provided")
+	}
+
+	return fmt.Sprintf("FLOOR((%s) * 100 / %d)", strings.Join(filled, " + "), total), nil
+}
+
+// escapeLike escapes the LIKE/ILIKE wildcard characters in val so that they
+// are matched literally.
+func escapeLike(val string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(val)
+}
+
 // addStrUpdate adds the value of su to cols and args if su.IsUpdating.
 // It returns the resulting cols, args.
 func addStrUpdate(su user.StringUpdate, col, cols string, args []interface{}) (string, []interface{}) {
@@ -98,8 +668,13 @@ func addStrUpdate(su user.StringUpdate, col, cols string, args []interface{}) (s
 }
 
 func genParams(count int) string {
+	return genParamsFrom(1, count)
+}
+
+// genParamsFrom generates params of the form "$from, ..., $to".
+func genParamsFrom(from, to int) string {
 	params := ""
-	for i := 1; i <= count; i++ {
+	for i := from; i <= to; i++ {
 		params = fmt.Sprintf("%s$%d, ", params, i)
 	}
 	return strings.TrimSuffix(params, ", ")
@@ -109,24 +684,68 @@ func genParams(count int) string {
 // The column order for s must be same order as allUserCols variable.
 func scanUser(s multiScanner) (*user.User, error) {
 
+	name := sql.NullString{}
+	gender := sql.NullString{}
 	ICEPhone := sql.NullString{}
 	avatarURL := sql.NullString{}
 	bio := sql.NullString{}
+	country := sql.NullString{}
+	locale := sql.NullString{}
+	timezone := sql.NullString{}
+	email := sql.NullString{}
 	rating := sql.NullFloat64{}
 	numRaters := sql.NullInt64{}
+	var attrsB, privacyB, hiddenFieldsB []byte
+	handle := sql.NullString{}
+	handleUpdated := pq.NullTime{}
+	mergedInto := sql.NullString{}
+	deactivated := pq.NullTime{}
+	erased := pq.NullTime{}
 	usr := &user.User{}
 
-	err := s.Scan(&usr.ID, &usr.Name, &usr.Gender, &ICEPhone, &avatarURL,
-		&bio, &rating, &numRaters, &usr.Created, &usr.LastUpdated)
+	err := s.Scan(&usr.ID, &name, &gender, &ICEPhone, &usr.ICEPhoneVerified,
+		&avatarURL, &bio, &country, &locale, &timezone, &email, &usr.EmailVerified,
+		&rating, &numRaters, &usr.NumFollowers, &usr.NumFollowing, &attrsB,
+		&privacyB, &hiddenFieldsB, &handle, &handleUpdated, &mergedInto,
+		&deactivated, &erased, &usr.Created, &usr.LastUpdated)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(attrsB) > 0 {
+		if err := json.Unmarshal(attrsB, &usr.Attributes); err != nil {
+			return nil, errors.Newf("unmarshal attributes: %v", err)
+		}
+	}
+
+	if len(privacyB) > 0 {
+		if err := json.Unmarshal(privacyB, &usr.Privacy); err != nil {
+			return nil, errors.Newf("unmarshal privacy: %v", err)
+		}
+	}
+
+	if len(hiddenFieldsB) > 0 {
+		if err := json.Unmarshal(hiddenFieldsB, &usr.HiddenFields); err != nil {
+			return nil, errors.Newf("unmarshal hidden fields: %v", err)
+		}
+	}
+
+	usr.Name = name.String
+	usr.Gender = gender.String
 	usr.ICEPhone = ICEPhone.String
 	usr.AvatarURL = avatarURL.String
 	usr.Bio = bio.String
+	usr.Country = country.String
+	usr.Locale = locale.String
+	usr.Timezone = timezone.String
+	usr.Email = email.String
 	usr.Rating = float32(rating.Float64)
 	usr.NumRaters = numRaters.Int64
+	usr.Handle = handle.String
+	usr.HandleUpdated = handleUpdated.Time
+	usr.MergedInto = mergedInto.String
+	usr.Deactivated = deactivated.Time
+	usr.Erased = erased.Time
 
 	return usr, nil
 }
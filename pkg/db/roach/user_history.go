@@ -0,0 +1,98 @@
+package roach
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/tomogoma/crdb"
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+var allUserHistoryCols = ColDesc(ColID, ColUserID, ColField, ColOldValue,
+	ColNewValue, ColActorUserID, ColActorACL, ColCreated)
+
+// UserHistory fetches the recorded profile changes for userID, most recent
+// first.
+func (r *Roach) UserHistory(userID string, offset int64, count int32) ([]user.Change, error) {
+	if err := r.InitDBIfNot(); err != nil {
+		return nil, err
+	}
+
+	limit, args := crdb.Pagination(offset, int64(count), []interface{}{userID})
+	q := `
+		SELECT ` + allUserHistoryCols + ` FROM ` + TblUserHistory + `
+			WHERE ` + ColUserID + `=$1
+			ORDER BY ` + ColCreated + ` DESC, ` + ColID + ` DESC
+			` + limit
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chs []user.Change
+	for rows.Next() {
+		ch, err := scanUserChange(rows)
+		if err != nil {
+			return nil, errors.Newf("scan change from row: %v", err)
+		}
+		chs = append(chs, *ch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Newf("iterate result set: %v", err)
+	}
+
+	if len(chs) == 0 {
+		return nil, errors.NewNotFound("no history found for user")
+	}
+
+	return chs, nil
+}
+
+// insertUserChanges inserts chs into the user history table using tx,
+// writing a user updated event to the outbox for each user changed.
+func insertUserChanges(tx *sql.Tx, chs []user.Change) error {
+	if len(chs) == 0 {
+		return nil
+	}
+
+	cols := ColDesc(ColUserID, ColField, ColOldValue, ColNewValue,
+		ColActorUserID, ColActorACL, ColCreated)
+	var values string
+	var args []interface{}
+	for _, ch := range chs {
+		firstParam := len(args) + 1
+		args = append(args, ch.UserID, ch.Field, ch.OldValue, ch.NewValue,
+			ch.ActorUserID, ch.ActorAccessLevel, ch.Created)
+		values = ColDesc(values, fmt.Sprintf("(%s)", genParamsFrom(firstParam, len(args))))
+	}
+
+	q := `INSERT INTO ` + TblUserHistory + ` (` + cols + `) VALUES ` + values
+	res, err := tx.Exec(q, args...)
+	if err := checkRowsAffected(res, err, int64(len(chs))); err != nil {
+		return err
+	}
+
+	evs, err := userUpdatedEvents(chs)
+	if err != nil {
+		return err
+	}
+	return insertEvents(tx, evs...)
+}
+
+// scanUserChange extracts a user change from s or returns an error if reported
+// by s. The column order for s must be same order as allUserHistoryCols.
+func scanUserChange(s multiScanner) (*user.Change, error) {
+	ch := &user.Change{}
+	oldValue := sql.NullString{}
+	newValue := sql.NullString{}
+	err := s.Scan(&ch.ID, &ch.UserID, &ch.Field, &oldValue, &newValue,
+		&ch.ActorUserID, &ch.ActorAccessLevel, &ch.Created)
+	if err != nil {
+		return nil, err
+	}
+	ch.OldValue = oldValue.String
+	ch.NewValue = newValue.String
+	return ch, nil
+}
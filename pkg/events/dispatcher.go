@@ -0,0 +1,183 @@
+package events
+
+import (
+	"time"
+
+	"github.com/micro/go-micro/broker"
+	"github.com/tomogoma/go-typed-errors"
+)
+
+// Defaults used by Dispatcher unless overridden by the With... Options.
+const (
+	DefaultBatchSize  = 100
+	DefaultLease      = time.Minute
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = 10 * time.Minute
+	// DefaultInterval is a suggested interval for DispatchEvery.
+	DefaultInterval = 5 * time.Second
+)
+
+type DB interface {
+	errors.IsNotFoundErrChecker
+	// ClaimEvents reserves up to count events due for publishing at now
+	// by moving their NextAttempt to leaseUntil, returning them.
+	ClaimEvents(now, leaseUntil time.Time, count int32) ([]Event, error)
+	DeleteEvent(ID string) error
+	RetryEvent(ID string, attempts int32, nextAttempt time.Time, lastErr string) error
+}
+
+// Dispatcher publishes the events written to the outbox to a broker. Events
+// are only deleted from the outbox once published, so each is delivered at
+// least once: an event is published again if the Dispatcher stops between
+// publishing and deleting it. Events that fail to publish are retried with
+// exponential backoff until they succeed.
+type Dispatcher struct {
+	db         DB
+	broker     broker.Broker
+	batchSize  int32
+	lease      time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// Option allows extra configuration for instantiating Dispatcher. Use the
+// With... functions (e.g. WithBatchSize) to set options.
+type Option func(*Dispatcher) error
+
+// WithBatchSize sets the maximum number of events claimed per Dispatch.
+func WithBatchSize(n int32) Option {
+	return func(d *Dispatcher) error {
+		if n < 1 {
+			return errors.Newf("batch size must be > 0")
+		}
+		d.batchSize = n
+		return nil
+	}
+}
+
+// WithLease sets how long claimed events are reserved for the Dispatcher,
+// during which other Dispatchers (e.g. of other instances of the service)
+// do not publish them. It should be much longer than it takes to publish a
+// batch.
+func WithLease(d time.Duration) Option {
+	return func(dp *Dispatcher) error {
+		if d <= 0 {
+			return errors.Newf("lease must be > 0")
+		}
+		dp.lease = d
+		return nil
+	}
+}
+
+// WithBackoff sets the delay before retrying an event that failed to publish
+// to min, doubling with each failed attempt up to max.
+func WithBackoff(min, max time.Duration) Option {
+	return func(d *Dispatcher) error {
+		if min <= 0 || max < min {
+			return errors.Newf("backoff must satisfy 0 < min <= max")
+		}
+		d.minBackoff = min
+		d.maxBackoff = max
+		return nil
+	}
+}
+
+func NewDispatcher(db DB, b broker.Broker, opts ...Option) (*Dispatcher, error) {
+	if db == nil {
+		return nil, errors.Newf("nil DB")
+	}
+	if b == nil {
+		return nil, errors.Newf("nil broker")
+	}
+	d := &Dispatcher{
+		db:         db,
+		broker:     b,
+		batchSize:  DefaultBatchSize,
+		lease:      DefaultLease,
+		minBackoff: DefaultMinBackoff,
+		maxBackoff: DefaultMaxBackoff,
+	}
+	for i, opt := range opts {
+		if opt == nil {
+			return nil, errors.Newf("received nil Option at index %d", i)
+		}
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// DispatchEvery calls Dispatch every interval, or immediately if the previous
+// call found a full batch of events. It only returns if Dispatch fails.
+func (d *Dispatcher) DispatchEvery(interval time.Duration) error {
+	for {
+		start := time.Now()
+		n, err := d.Dispatch()
+		if err != nil {
+			return err
+		}
+		if int32(n) == d.batchSize {
+			continue
+		}
+		dispatchDur := time.Now().Sub(start)
+		if dispatchDur < interval {
+			time.Sleep(interval - dispatchDur)
+		}
+	}
+}
+
+// Dispatch publishes a batch of the events that are due, returning the number
+// of events claimed. Published events are deleted and the rest are scheduled
+// for a retry. An error is only returned if the outbox cannot be accessed.
+func (d *Dispatcher) Dispatch() (int, error) {
+
+	now := time.Now()
+	evs, err := d.db.ClaimEvents(now, now.Add(d.lease), d.batchSize)
+	if err != nil {
+		if d.db.IsNotFoundError(err) {
+			return 0, nil
+		}
+		return 0, errors.Newf("claim events: %v", err)
+	}
+
+	for _, ev := range evs {
+		if pubErr := d.publish(ev); pubErr != nil {
+			attempts := ev.Attempts + 1
+			nextAttempt := time.Now().Add(d.backoff(attempts))
+			if err := d.db.RetryEvent(ev.ID, attempts, nextAttempt, pubErr.Error()); err != nil {
+				return len(evs), errors.Newf("schedule retry of event %s: %v", ev.ID, err)
+			}
+			continue
+		}
+		if err := d.db.DeleteEvent(ev.ID); err != nil {
+			return len(evs), errors.Newf("delete published event %s: %v", ev.ID, err)
+		}
+	}
+
+	return len(evs), nil
+}
+
+func (d *Dispatcher) publish(ev Event) error {
+	return d.broker.Publish(ev.Topic, &broker.Message{
+		Header: map[string]string{
+			HeaderID:      ev.ID,
+			HeaderTopic:   ev.Topic,
+			HeaderCreated: ev.Created.Format(time.RFC3339Nano),
+		},
+		Body: ev.Payload,
+	})
+}
+
+// backoff returns the delay before the next attempt to publish an event that
+// has failed attempts times.
+func (d *Dispatcher) backoff(attempts int32) time.Duration {
+	delay := d.minBackoff
+	for i := int32(1); i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.maxBackoff {
+		return d.maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,197 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/broker"
+	"github.com/tomogoma/go-typed-errors"
+)
+
+// outboxDB holds events in memory. Claimed events are removed from due and
+// recorded as deleted or retried.
+type outboxDB struct {
+	errors.NotFoundErrCheck
+	due      []Event
+	claimErr error
+	deleted  []string
+	retried  map[string]Event
+}
+
+func (db *outboxDB) ClaimEvents(now, leaseUntil time.Time, count int32) ([]Event, error) {
+	if db.claimErr != nil {
+		return nil, db.claimErr
+	}
+	if len(db.due) == 0 {
+		return nil, errors.NewNotFound("no events due")
+	}
+	n := int(count)
+	if n > len(db.due) {
+		n = len(db.due)
+	}
+	evs := db.due[:n]
+	db.due = db.due[n:]
+	return evs, nil
+}
+
+func (db *outboxDB) DeleteEvent(ID string) error {
+	db.deleted = append(db.deleted, ID)
+	return nil
+}
+
+func (db *outboxDB) RetryEvent(ID string, attempts int32, nextAttempt time.Time, lastErr string) error {
+	if db.retried == nil {
+		db.retried = make(map[string]Event)
+	}
+	db.retried[ID] = Event{ID: ID, Attempts: attempts, NextAttempt: nextAttempt, LastError: lastErr}
+	return nil
+}
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	created := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	tt := []struct {
+		name       string
+		due        []Event
+		claimErr   error
+		failTopic  string
+		expN       int
+		expDeleted []string
+		expRetried map[string]int32
+		expErr     bool
+	}{
+		{
+			name: "published",
+			due: []Event{
+				{ID: "1", Topic: TopicUserUpdated, Payload: []byte(`{"userID":"u1"}`), Created: created},
+				{ID: "2", Topic: TopicRatingCreated, Payload: []byte(`{"ID":"r1"}`), Created: created},
+			},
+			expN:       2,
+			expDeleted: []string{"1", "2"},
+		},
+		{
+			name: "failed publish retried",
+			due: []Event{
+				{ID: "1", Topic: TopicUserUpdated, Created: created},
+				{ID: "2", Topic: TopicUserDeleted, Created: created, Attempts: 3},
+			},
+			failTopic:  TopicUserDeleted,
+			expN:       2,
+			expDeleted: []string{"1"},
+			expRetried: map[string]int32{"2": 4},
+		},
+		{
+			name: "none due",
+			expN: 0,
+		},
+		{
+			name:     "claim error",
+			claimErr: errors.New("some error"),
+			expErr:   true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &outboxDB{due: tc.due, claimErr: tc.claimErr}
+			b := NewMemoryBroker()
+			if err := b.Connect(); err != nil {
+				t.Fatalf("Connect memory broker: %v", err)
+			}
+			var received []*broker.Message
+			handler := func(p broker.Publication) error {
+				if p.Topic() == tc.failTopic {
+					return errors.New("some error")
+				}
+				received = append(received, p.Message())
+				return nil
+			}
+			for _, topic := range []string{TopicUserUpdated, TopicUserDeleted, TopicRatingCreated} {
+				if _, err := b.Subscribe(topic, handler); err != nil {
+					t.Fatalf("Subscribe to %s: %v", topic, err)
+				}
+			}
+			d, err := NewDispatcher(db, b, WithBackoff(time.Second, time.Minute))
+			if err != nil {
+				t.Fatalf("NewDispatcher: %v", err)
+			}
+
+			start := time.Now()
+			n, err := d.Dispatch()
+			if tc.expErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Dispatch error: %v", err)
+			}
+			if n != tc.expN {
+				t.Errorf("Expected %d events dispatched, got %d", tc.expN, n)
+			}
+
+			if len(db.deleted) != len(tc.expDeleted) {
+				t.Fatalf("Expected deleted %v, got %v", tc.expDeleted, db.deleted)
+			}
+			for i, ID := range tc.expDeleted {
+				if db.deleted[i] != ID {
+					t.Errorf("Expected deleted %v, got %v", tc.expDeleted, db.deleted)
+				}
+			}
+
+			if len(db.retried) != len(tc.expRetried) {
+				t.Fatalf("Expected %d retried events, got %+v", len(tc.expRetried), db.retried)
+			}
+			for ID, expAttempts := range tc.expRetried {
+				ev := db.retried[ID]
+				if ev.Attempts != expAttempts {
+					t.Errorf("Expected event %s attempts %d, got %d", ID, expAttempts, ev.Attempts)
+				}
+				if ev.LastError == "" {
+					t.Errorf("Expected event %s last error to be set", ID)
+				}
+				if !ev.NextAttempt.After(start) {
+					t.Errorf("Expected event %s next attempt after %s, got %s", ID, start, ev.NextAttempt)
+				}
+			}
+
+			if len(received) != len(tc.expDeleted) {
+				t.Fatalf("Expected %d messages received, got %d", len(tc.expDeleted), len(received))
+			}
+			for i, msg := range received {
+				ev := tc.due[i]
+				if msg.Header[HeaderID] != ev.ID || msg.Header[HeaderTopic] != ev.Topic {
+					t.Errorf("Expected headers for event %s on %s, got %v", ev.ID, ev.Topic, msg.Header)
+				}
+				if msg.Header[HeaderCreated] != created.Format(time.RFC3339Nano) {
+					t.Errorf("Expected created header %s, got %s",
+						created.Format(time.RFC3339Nano), msg.Header[HeaderCreated])
+				}
+				if string(msg.Body) != string(ev.Payload) {
+					t.Errorf("Expected body %s, got %s", ev.Payload, msg.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcher_backoff(t *testing.T) {
+	d, err := NewDispatcher(&outboxDB{}, NewMemoryBroker(), WithBackoff(time.Second, time.Minute))
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	tt := []struct {
+		attempts int32
+		exp      time.Duration
+	}{
+		{attempts: 1, exp: time.Second},
+		{attempts: 2, exp: 2 * time.Second},
+		{attempts: 4, exp: 8 * time.Second},
+		{attempts: 7, exp: time.Minute},
+		{attempts: 1000, exp: time.Minute},
+	}
+	for _, tc := range tt {
+		if got := d.backoff(tc.attempts); got != tc.exp {
+			t.Errorf("backoff(%d): expected %s, got %s", tc.attempts, tc.exp, got)
+		}
+	}
+}
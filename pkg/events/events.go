@@ -0,0 +1,91 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+)
+
+// Topics that events are published to. The body of each event is the JSON
+// encoding of the matching payload type e.g. UserUpdated for TopicUserUpdated.
+const (
+	TopicUserUpdated   = "user.updated"
+	TopicUserDeleted   = "user.deleted"
+	TopicRatingCreated = "rating.created"
+)
+
+// Headers set on each published message.
+const (
+	// HeaderID is the event's ID. An event may be delivered more than once
+	// so consumers should use it to discard duplicates.
+	HeaderID = "id"
+	// HeaderTopic is the topic the event was published to.
+	HeaderTopic = "topic"
+	// HeaderCreated is the RFC3339 time the event occurred.
+	HeaderCreated = "created"
+)
+
+// Event is a domain event waiting in the outbox to be published.
+type Event struct {
+	ID    string
+	Topic string
+	// UserID is the ID of the user the event is about e.g. the rated user
+	// of a TopicRatingCreated event.
+	UserID  string
+	Payload []byte
+	Created time.Time
+	// Attempts is the number of failed attempts to publish the event.
+	Attempts int32
+	// NextAttempt is the earliest time the event can be (re-)published.
+	NextAttempt time.Time
+	LastError   string
+}
+
+// UserUpdated is the payload of TopicUserUpdated events. Only the names of the
+// fields changed are included since the values may be private; consumers
+// should fetch the user for the values they are allowed to see.
+type UserUpdated struct {
+	UserID string `json:"userID"`
+	// Fields lists the changed fields (the user.Field... values).
+	Fields      []string  `json:"fields"`
+	ActorUserID string    `json:"actorUserID,omitempty"`
+	Updated     time.Time `json:"updated"`
+}
+
+// UserDeleted is the payload of TopicUserDeleted events, emitted when a user
+// is erased or merged into another user.
+type UserDeleted struct {
+	UserID string `json:"userID"`
+	// MergedInto is the ID of the user the deleted user was merged into,
+	// if any.
+	MergedInto string    `json:"mergedInto,omitempty"`
+	Deleted    time.Time `json:"deleted"`
+}
+
+// RatingCreated is the payload of TopicRatingCreated events.
+type RatingCreated struct {
+	ID         string    `json:"ID"`
+	ForSection string    `json:"forSection"`
+	ForUserID  string    `json:"forUserID"`
+	ByUserID   string    `json:"byUserID"`
+	Rating     int32     `json:"rating"`
+	Created    time.Time `json:"created"`
+}
+
+// New creates an Event on topic about the user with userID with payload (one
+// of the payload types matching topic) occurring at created, ready to be
+// published immediately.
+func New(topic, userID string, payload interface{}, created time.Time) (Event, error) {
+	payloadB, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, errors.Newf("marshal %s payload: %v", topic, err)
+	}
+	return Event{
+		Topic:       topic,
+		UserID:      userID,
+		Payload:     payloadB,
+		Created:     created,
+		NextAttempt: created,
+	}, nil
+}
@@ -0,0 +1,149 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/micro/go-micro/broker"
+	"github.com/tomogoma/go-typed-errors"
+)
+
+// MemoryBroker is a broker.Broker that delivers published messages to the
+// subscribers of their topic synchronously and within the process. It is
+// meant for tests. Unlike a real broker, Publish fails if a subscriber
+// returns an error, which simulates failed deliveries.
+// Use NewMemoryBroker to instantiate.
+type MemoryBroker struct {
+	mu        sync.RWMutex
+	opts      broker.Options
+	connected bool
+	subs      map[string][]*memorySubscriber
+}
+
+type memorySubscriber struct {
+	b       *MemoryBroker
+	topic   string
+	handler broker.Handler
+	opts    broker.SubscribeOptions
+}
+
+type memoryPublication struct {
+	topic string
+	msg   *broker.Message
+}
+
+func NewMemoryBroker(opts ...broker.Option) *MemoryBroker {
+	b := &MemoryBroker{subs: make(map[string][]*memorySubscriber)}
+	for _, opt := range opts {
+		opt(&b.opts)
+	}
+	return b
+}
+
+func (b *MemoryBroker) Options() broker.Options {
+	return b.opts
+}
+
+func (b *MemoryBroker) Address() string {
+	return "memory"
+}
+
+func (b *MemoryBroker) Connect() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.connected = true
+	return nil
+}
+
+func (b *MemoryBroker) Disconnect() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.connected = false
+	return nil
+}
+
+func (b *MemoryBroker) Init(opts ...broker.Option) error {
+	for _, opt := range opts {
+		opt(&b.opts)
+	}
+	return nil
+}
+
+// Publish delivers msg to each subscriber of topic. Of the subscribers that
+// share a queue (see broker.Queue) only the first is delivered to.
+func (b *MemoryBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	b.mu.RLock()
+	if !b.connected {
+		b.mu.RUnlock()
+		return errors.New("memory broker not connected")
+	}
+	subs := append([]*memorySubscriber{}, b.subs[topic]...)
+	b.mu.RUnlock()
+
+	queues := make(map[string]bool)
+	pub := &memoryPublication{topic: topic, msg: msg}
+	for _, sub := range subs {
+		if queue := sub.opts.Queue; queue != "" {
+			if queues[queue] {
+				continue
+			}
+			queues[queue] = true
+		}
+		if err := sub.handler(pub); err != nil {
+			return errors.Newf("deliver to subscriber: %v", err)
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	if h == nil {
+		return nil, errors.New("nil handler")
+	}
+	subOpts := broker.SubscribeOptions{AutoAck: true}
+	for _, opt := range opts {
+		opt(&subOpts)
+	}
+	sub := &memorySubscriber{b: b, topic: topic, handler: h, opts: subOpts}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[topic] = append(b.subs[topic], sub)
+	return sub, nil
+}
+
+func (b *MemoryBroker) String() string {
+	return "memory"
+}
+
+func (s *memorySubscriber) Options() broker.SubscribeOptions {
+	return s.opts
+}
+
+func (s *memorySubscriber) Topic() string {
+	return s.topic
+}
+
+func (s *memorySubscriber) Unsubscribe() error {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	subs := s.b.subs[s.topic]
+	for i, sub := range subs {
+		if sub == s {
+			s.b.subs[s.topic] = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (p *memoryPublication) Topic() string {
+	return p.topic
+}
+
+func (p *memoryPublication) Message() *broker.Message {
+	return p.msg
+}
+
+func (p *memoryPublication) Ack() error {
+	return nil
+}
@@ -0,0 +1,61 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/micro/go-micro/broker"
+)
+
+func TestMemoryBroker_Publish(t *testing.T) {
+	b := NewMemoryBroker()
+	msg := &broker.Message{Header: map[string]string{HeaderID: "1"}, Body: []byte("{}")}
+	if err := b.Publish(TopicUserUpdated, msg); err == nil {
+		t.Fatalf("Expected an error publishing before Connect, got nil")
+	}
+	if err := b.Connect(); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+
+	var all, queued int
+	subscribe := func(counter *int, opts ...broker.SubscribeOption) broker.Subscriber {
+		sub, err := b.Subscribe(TopicUserUpdated, func(p broker.Publication) error {
+			if p.Message() != msg {
+				t.Errorf("Expected message %+v, got %+v", msg, p.Message())
+			}
+			*counter++
+			return nil
+		}, opts...)
+		if err != nil {
+			t.Fatalf("Subscribe error: %v", err)
+		}
+		return sub
+	}
+	subscribe(&all)
+	subscribe(&all)
+	subscribe(&queued, broker.Queue("q"))
+	subscribe(&queued, broker.Queue("q"))
+	otherSub, err := b.Subscribe(TopicUserDeleted, func(p broker.Publication) error {
+		t.Errorf("Received a message published to another topic")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+
+	if err := b.Publish(TopicUserUpdated, msg); err != nil {
+		t.Fatalf("Publish error: %v", err)
+	}
+	if all != 2 {
+		t.Errorf("Expected 2 deliveries to unqueued subscribers, got %d", all)
+	}
+	if queued != 1 {
+		t.Errorf("Expected 1 delivery to queued subscribers, got %d", queued)
+	}
+
+	if err := otherSub.Unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribe error: %v", err)
+	}
+	if len(b.subs[TopicUserDeleted]) != 0 {
+		t.Errorf("Expected no subscribers after Unsubscribe, got %d", len(b.subs[TopicUserDeleted]))
+	}
+}
@@ -0,0 +1,255 @@
+package feed
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/events"
+	"github.com/tomogoma/usersms/pkg/jwt"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+const (
+	DefaultBatchSize = 100
+	DefaultRetention = 24 * time.Hour
+)
+
+type JWTEr interface {
+	errors.IsAuthErrChecker
+	JWTValid(JWT string) (*jwt.AuthMSClaim, error)
+	JWTHasAccess(JWT string, acl float32) (*jwt.AuthMSClaim, error)
+}
+
+type DB interface {
+	errors.IsNotFoundErrChecker
+	LastFeedEventID() (string, error)
+	FeedEvents(userID, afterID string, count int32) ([]events.Event, error)
+	PruneFeed(before time.Time) error
+	EitherBlocked(userID, otherUserID string) (bool, error)
+}
+
+// UserViewer fetches a user as seen by the bearer of a JWT. user.Manager
+// is an implementation.
+type UserViewer interface {
+	User(JWT, ID string, offsetUpdateDate time.Time) (*user.User, error)
+}
+
+// Change is an event in the change feed. Data is the event's JSON payload
+// (a json.RawMessage) for Changes. For UserChanges it depends on Topic:
+//
+//	events.TopicUserUpdated   *user.User
+//	events.TopicUserDeleted   events.UserDeleted
+//	events.TopicRatingCreated events.RatingCreated
+type Change struct {
+	ID    string
+	Topic string
+	Data  interface{}
+}
+
+// Manager reads the change feed i.e. the domain events recorded over the
+// retention period (see PruneEvery). Clients poll it for the changes after
+// the last change they received.
+type Manager struct {
+	errors.ErrToHTTP
+
+	jwter     JWTEr
+	db        DB
+	usrs      UserViewer
+	batchSize int32
+}
+
+// Option allows extra configuration for instantiating Manager. Use the With...
+// functions (e.g. WithBatchSize) to set options.
+type Option func(*Manager) error
+
+// WithBatchSize sets the maximum number of changes returned per call.
+// Defaults to DefaultBatchSize.
+func WithBatchSize(n int32) Option {
+	return func(m *Manager) error {
+		if n < 1 {
+			return errors.Newf("batch size must be > 0")
+		}
+		m.batchSize = n
+		return nil
+	}
+}
+
+func NewManager(jwter JWTEr, db DB, usrs UserViewer, opts ...Option) (*Manager, error) {
+	if jwter == nil {
+		return nil, errors.Newf("nil JWTEr")
+	}
+	if db == nil {
+		return nil, errors.Newf("nil DB")
+	}
+	if usrs == nil {
+		return nil, errors.Newf("nil UserViewer")
+	}
+	m := &Manager{jwter: jwter, db: db, usrs: usrs, batchSize: DefaultBatchSize}
+	for i, opt := range opts {
+		if opt == nil {
+			return nil, errors.Newf("received nil Option at index %d", i)
+		}
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// PruneEvery deletes the changes older than retention every interval. It
+// only returns if pruning fails.
+func (m *Manager) PruneEvery(retention, interval time.Duration) error {
+	for {
+		start := time.Now()
+		if err := m.db.PruneFeed(start.Add(-retention)); err != nil {
+			return errors.Newf("prune change feed: %v", err)
+		}
+		pruneDur := time.Now().Sub(start)
+		if pruneDur < interval {
+			time.Sleep(interval - pruneDur)
+		}
+	}
+}
+
+// UserChanges returns the changes to the user with userID after the change
+// with afterID, along with the ID to pass as afterID in the next call, which
+// may be later than the ID of the last change returned. Only the latest of
+// the user's updates is included, with the user as the bearer of JWT sees
+// them, and none if the user is deleted. Changes after the user is deleted
+// are not included. Provide an empty afterID to start from the most recent
+// change.
+func (m *Manager) UserChanges(JWT, userID, afterID string) ([]Change, string, error) {
+
+	clm, err := m.jwter.JWTValid(JWT)
+	if err != nil {
+		return nil, "", m.parseJWTErError(err, "check JWT valid")
+	}
+
+	evs, lastID, err := m.events(userID, afterID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var chs []Change
+	updatedAt := -1
+	for _, ev := range evs {
+		switch ev.Topic {
+		case events.TopicUserUpdated:
+			if updatedAt >= 0 {
+				chs = append(chs[:updatedAt], chs[updatedAt+1:]...)
+			}
+			updatedAt = len(chs)
+			chs = append(chs, Change{ID: ev.ID, Topic: ev.Topic})
+		case events.TopicUserDeleted:
+			data := events.UserDeleted{}
+			if err := json.Unmarshal(ev.Payload, &data); err != nil {
+				return nil, "", errors.Newf("unmarshal %s event %s: %v", ev.Topic, ev.ID, err)
+			}
+			if updatedAt >= 0 {
+				chs = append(chs[:updatedAt], chs[updatedAt+1:]...)
+			}
+			return append(chs, Change{ID: ev.ID, Topic: ev.Topic, Data: data}), ev.ID, nil
+		case events.TopicRatingCreated:
+			data := events.RatingCreated{}
+			if err := json.Unmarshal(ev.Payload, &data); err != nil {
+				return nil, "", errors.Newf("unmarshal %s event %s: %v", ev.Topic, ev.ID, err)
+			}
+			visible, err := m.ratingVisible(clm, data)
+			if err != nil {
+				return nil, "", err
+			}
+			if visible {
+				chs = append(chs, Change{ID: ev.ID, Topic: ev.Topic, Data: data})
+			}
+		}
+	}
+
+	// Fetching the user also confirms that the bearer of JWT can see them.
+	usr, err := m.usrs.User(JWT, userID, time.Time{})
+	if err != nil {
+		return nil, "", err
+	}
+	if updatedAt >= 0 {
+		chs[updatedAt].Data = usr
+	}
+
+	return chs, lastID, nil
+}
+
+// Changes returns the changes to all users after the change with afterID,
+// along with the ID to pass as afterID in the next call. Provide an empty
+// afterID to start from the most recent change. Only staff can read all
+// changes.
+func (m *Manager) Changes(JWT, afterID string) ([]Change, string, error) {
+
+	if _, err := m.jwter.JWTHasAccess(JWT, jwt.AccessLevelStaff); err != nil {
+		return nil, "", m.parseJWTErError(err, "validate JWT has access")
+	}
+
+	evs, lastID, err := m.events("", afterID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	chs := make([]Change, 0, len(evs))
+	for _, ev := range evs {
+		chs = append(chs, Change{ID: ev.ID, Topic: ev.Topic, Data: json.RawMessage(ev.Payload)})
+	}
+	return chs, lastID, nil
+}
+
+// events fetches a batch of the change feed events about the user with userID
+// (or all users if empty) after afterID, and the ID of the last event
+// fetched, or afterID if none.
+func (m *Manager) events(userID, afterID string) ([]events.Event, string, error) {
+
+	if afterID == "" {
+		lastID, err := m.db.LastFeedEventID()
+		if err != nil {
+			if m.db.IsNotFoundError(err) {
+				return nil, "0", nil
+			}
+			return nil, "", errors.Newf("fetch last change ID: %v", err)
+		}
+		return nil, lastID, nil
+	}
+
+	if ID, err := strconv.ParseInt(afterID, 10, 64); err != nil || ID < 0 {
+		return nil, "", errors.NewClientf("invalid change ID '%s'", afterID)
+	}
+
+	evs, err := m.db.FeedEvents(userID, afterID, m.batchSize)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, afterID, nil
+		}
+		return nil, "", errors.Newf("fetch changes: %v", err)
+	}
+
+	return evs, evs[len(evs)-1].ID, nil
+}
+
+// ratingVisible returns false if the rating in rc was made by a user who
+// blocked, or was blocked by, the bearer of clm. Staff see all ratings.
+func (m *Manager) ratingVisible(clm *jwt.AuthMSClaim, rc events.RatingCreated) (bool, error) {
+	if clm.Group.AccessLevel <= jwt.AccessLevelStaff || clm.UsrID == rc.ByUserID {
+		return true, nil
+	}
+	blocked, err := m.db.EitherBlocked(clm.UsrID, rc.ByUserID)
+	if err != nil {
+		return false, errors.Newf("check blocks: %v", err)
+	}
+	return !blocked, nil
+}
+
+func (m *Manager) parseJWTErError(err error, errCtx string) error {
+	if m.jwter.IsAuthError(err) || m.jwter.IsUnauthorizedError(err) {
+		return errors.NewUnauthorized(err)
+	}
+	if m.jwter.IsForbiddenError(err) {
+		return errors.NewForbidden(err)
+	}
+	return errors.Newf("%s: %v", errCtx, err)
+}
@@ -0,0 +1,274 @@
+package feed
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/events"
+	"github.com/tomogoma/usersms/pkg/jwt"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+// claimJWTEr treats JWTs as the ID of the user they belong to. The JWT
+// "staff" has staff access.
+type claimJWTEr struct {
+	errors.AuthErrCheck
+}
+
+func (claimJWTEr) JWTValid(JWT string) (*jwt.AuthMSClaim, error) {
+	if JWT == "" {
+		return nil, errors.NewUnauthorized("empty JWT")
+	}
+	acl := jwt.AccessLevelUser
+	if JWT == "staff" {
+		acl = jwt.AccessLevelStaff
+	}
+	return &jwt.AuthMSClaim{UsrID: JWT, Group: jwt.Group{AccessLevel: acl}}, nil
+}
+
+func (j claimJWTEr) JWTHasAccess(JWT string, acl float32) (*jwt.AuthMSClaim, error) {
+	clm, err := j.JWTValid(JWT)
+	if err != nil {
+		return nil, err
+	}
+	if clm.Group.AccessLevel > acl {
+		return nil, errors.NewForbidden("insufficient access")
+	}
+	return clm, nil
+}
+
+// feedDB holds the change feed in memory. blocks maps users to the users
+// they blocked.
+type feedDB struct {
+	errors.NotFoundErrCheck
+	evs    []events.Event
+	blocks map[string]string
+}
+
+func (db *feedDB) LastFeedEventID() (string, error) {
+	if len(db.evs) == 0 {
+		return "", errors.NewNotFound("change feed is empty")
+	}
+	return db.evs[len(db.evs)-1].ID, nil
+}
+
+func (db *feedDB) FeedEvents(userID, afterID string, count int32) ([]events.Event, error) {
+	after, _ := strconv.Atoi(afterID)
+	var evs []events.Event
+	for _, ev := range db.evs {
+		ID, _ := strconv.Atoi(ev.ID)
+		if ID > after && (userID == "" || ev.UserID == userID) && int32(len(evs)) < count {
+			evs = append(evs, ev)
+		}
+	}
+	if len(evs) == 0 {
+		return nil, errors.NewNotFound("no events found")
+	}
+	return evs, nil
+}
+
+func (db *feedDB) PruneFeed(before time.Time) error {
+	return nil
+}
+
+func (db *feedDB) EitherBlocked(userID, otherUserID string) (bool, error) {
+	return db.blocks[userID] == otherUserID || db.blocks[otherUserID] == userID, nil
+}
+
+type userViewer struct {
+	usr *user.User
+	err error
+}
+
+func (v userViewer) User(JWT, ID string, offsetUpdateDate time.Time) (*user.User, error) {
+	return v.usr, v.err
+}
+
+func newEvent(t *testing.T, ID, topic, userID string, payload interface{}) events.Event {
+	ev, err := events.New(topic, userID, payload, time.Now())
+	if err != nil {
+		t.Fatalf("events.New: %v", err)
+	}
+	ev.ID = ID
+	return ev
+}
+
+func TestManager_UserChanges(t *testing.T) {
+	usr := &user.User{ID: "u1", Name: "Jane"}
+	tt := []struct {
+		name      string
+		JWT       string
+		evs       []events.Event
+		blocks    map[string]string
+		viewErr   error
+		afterID   string
+		expIDs    []string
+		expLastID string
+		expData   map[string]interface{}
+		expErr    bool
+	}{
+		{
+			name:      "latest",
+			JWT:       "u2",
+			evs:       []events.Event{{ID: "7", Topic: events.TopicUserUpdated, UserID: "u1"}},
+			expLastID: "7",
+		},
+		{
+			name:      "empty feed",
+			JWT:       "u2",
+			expLastID: "0",
+		},
+		{
+			name: "updates collapsed",
+			JWT:  "u2",
+			evs: func() []events.Event {
+				return []events.Event{
+					newEvent(t, "1", events.TopicUserUpdated, "u1", events.UserUpdated{UserID: "u1"}),
+					newEvent(t, "2", events.TopicRatingCreated, "u1", events.RatingCreated{ID: "r1", ByUserID: "u3"}),
+					newEvent(t, "3", events.TopicUserUpdated, "u1", events.UserUpdated{UserID: "u1"}),
+					newEvent(t, "4", events.TopicUserUpdated, "u9", events.UserUpdated{UserID: "u9"}),
+				}
+			}(),
+			afterID:   "0",
+			expIDs:    []string{"2", "3"},
+			expLastID: "3",
+			expData: map[string]interface{}{
+				"2": events.RatingCreated{ID: "r1", ByUserID: "u3"},
+				"3": usr,
+			},
+		},
+		{
+			name: "ratings by blocked users hidden",
+			JWT:  "u2",
+			evs: func() []events.Event {
+				return []events.Event{
+					newEvent(t, "1", events.TopicRatingCreated, "u1", events.RatingCreated{ID: "r1", ByUserID: "u3"}),
+					newEvent(t, "2", events.TopicRatingCreated, "u1", events.RatingCreated{ID: "r2", ByUserID: "u4"}),
+				}
+			}(),
+			blocks:    map[string]string{"u3": "u2"},
+			afterID:   "0",
+			expIDs:    []string{"2"},
+			expLastID: "2",
+		},
+		{
+			name: "staff see ratings by blocked users",
+			JWT:  "staff",
+			evs: func() []events.Event {
+				return []events.Event{
+					newEvent(t, "1", events.TopicRatingCreated, "u1", events.RatingCreated{ID: "r1", ByUserID: "u3"}),
+				}
+			}(),
+			blocks:    map[string]string{"u3": "staff"},
+			afterID:   "0",
+			expIDs:    []string{"1"},
+			expLastID: "1",
+		},
+		{
+			name: "deleted",
+			JWT:  "u2",
+			evs: func() []events.Event {
+				return []events.Event{
+					newEvent(t, "1", events.TopicUserUpdated, "u1", events.UserUpdated{UserID: "u1"}),
+					newEvent(t, "2", events.TopicUserDeleted, "u1", events.UserDeleted{UserID: "u1", MergedInto: "u5"}),
+					newEvent(t, "3", events.TopicRatingCreated, "u1", events.RatingCreated{ID: "r1", ByUserID: "u3"}),
+				}
+			}(),
+			viewErr:   errors.NewNotFound("user not found"),
+			afterID:   "0",
+			expIDs:    []string{"2"},
+			expLastID: "2",
+			expData: map[string]interface{}{
+				"2": events.UserDeleted{UserID: "u1", MergedInto: "u5"},
+			},
+		},
+		{
+			name:    "user not visible",
+			JWT:     "u2",
+			viewErr: errors.NewNotFound("user not found"),
+			afterID: "0",
+			expErr:  true,
+		},
+		{
+			name:    "invalid after ID",
+			JWT:     "u2",
+			afterID: "abc",
+			expErr:  true,
+		},
+		{
+			name:   "no JWT",
+			expErr: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := NewManager(&claimJWTEr{}, &feedDB{evs: tc.evs, blocks: tc.blocks},
+				userViewer{usr: usr, err: tc.viewErr})
+			if err != nil {
+				t.Fatalf("NewManager: %v", err)
+			}
+			chs, lastID, err := m.UserChanges(tc.JWT, "u1", tc.afterID)
+			if tc.expErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UserChanges error: %v", err)
+			}
+			if lastID != tc.expLastID {
+				t.Errorf("Expected last ID %s, got %s", tc.expLastID, lastID)
+			}
+			var IDs []string
+			for _, ch := range chs {
+				IDs = append(IDs, ch.ID)
+				if expData, ok := tc.expData[ch.ID]; ok && !reflect.DeepEqual(ch.Data, expData) {
+					t.Errorf("Expected change %s data %+v, got %+v", ch.ID, expData, ch.Data)
+				}
+			}
+			if !reflect.DeepEqual(IDs, tc.expIDs) {
+				t.Errorf("Expected change IDs %v, got %v", tc.expIDs, IDs)
+			}
+		})
+	}
+}
+
+func TestManager_Changes(t *testing.T) {
+	db := &feedDB{evs: []events.Event{
+		newEvent(t, "1", events.TopicUserUpdated, "u1", events.UserUpdated{UserID: "u1", Fields: []string{"name"}}),
+		newEvent(t, "2", events.TopicRatingCreated, "u2", events.RatingCreated{ID: "r1"}),
+		newEvent(t, "3", events.TopicUserDeleted, "u3", events.UserDeleted{UserID: "u3"}),
+	}}
+	m, err := NewManager(&claimJWTEr{}, db, userViewer{}, WithBatchSize(2))
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+
+	if _, _, err := m.Changes("u1", "0"); !(&errors.AuthErrCheck{}).IsAuthError(err) {
+		t.Errorf("Expected an auth error for a non-staff JWT, got %v", err)
+	}
+
+	chs, lastID, err := m.Changes("staff", "0")
+	if err != nil {
+		t.Fatalf("Changes error: %v", err)
+	}
+	if len(chs) != 2 || lastID != "2" {
+		t.Fatalf("Expected 2 changes up to ID 2, got %d up to %s", len(chs), lastID)
+	}
+	if data, ok := chs[0].Data.(json.RawMessage); !ok || string(data) != string(db.evs[0].Payload) {
+		t.Errorf("Expected data %s, got %v", db.evs[0].Payload, chs[0].Data)
+	}
+
+	chs, lastID, err = m.Changes("staff", lastID)
+	if err != nil {
+		t.Fatalf("Changes error: %v", err)
+	}
+	if len(chs) != 1 || chs[0].ID != "3" || lastID != "3" {
+		t.Errorf("Expected change 3, got %+v up to %s", chs, lastID)
+	}
+}
@@ -1,10 +1,16 @@
 package http
 
 import (
+	"time"
+
 	"github.com/tomogoma/usersms/pkg/logging"
 	"github.com/tomogoma/go-typed-errors"
 )
 
+// DefaultStreamInterval is how often streams check for changes unless
+// Config.StreamInterval is set.
+const DefaultStreamInterval = time.Second
+
 type Config struct {
 	BaseURL        string
 	AllowedOrigins []string
@@ -12,6 +18,9 @@ type Config struct {
 	Logger         logging.Logger
 	Rater          Rater
 	UserProfiler   UserProfiler
+	Avatars        Avatarer
+	Streams        Streamer
+	StreamInterval time.Duration
 }
 
 func (c Config) Validate() error {
@@ -27,5 +36,11 @@ func (c Config) Validate() error {
 	if c.UserProfiler == nil {
 		return errors.Newf("UserProfiler was nil")
 	}
+	if c.Avatars == nil {
+		return errors.Newf("Avatars was nil")
+	}
+	if c.Streams == nil {
+		return errors.Newf("Streams was nil")
+	}
 	return nil
 }
@@ -2,7 +2,10 @@ package http
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/gorilla/handlers"
@@ -11,10 +14,14 @@ import (
 	"github.com/tomogoma/crdb"
 	"github.com/tomogoma/go-typed-errors"
 	"github.com/tomogoma/usersms/pkg/config"
+	"github.com/tomogoma/usersms/pkg/events"
+	"github.com/tomogoma/usersms/pkg/feed"
 	"github.com/tomogoma/usersms/pkg/logging"
 	"github.com/tomogoma/usersms/pkg/rating"
 	"github.com/tomogoma/usersms/pkg/user"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/url"
 	"strconv"
 	"strings"
@@ -37,27 +44,108 @@ type UserProfiler interface {
 	errors.ToHTTPResponser
 	Update(token string, update user.UserUpdate) (*user.User, error)
 	User(token, ID string, offsetUpdateDate time.Time) (*user.User, error)
+	UserByHandle(token, handle string) (*user.User, error)
+	Users(token string, IDs []string) ([]user.User, []string, error)
+	Search(token string, f user.Filter) ([]user.User, error)
+	History(token, userID string, offset int64, count int32) ([]user.Change, error)
+	Deactivate(token, userID string) error
+	Reactivate(token, userID string) error
+	Erase(token, userID string) error
+	Merge(token, survivorID, duplicateID, strategy string) (*user.User, error)
+	Export(token, userID string) (*user.Export, error)
+	ICEContacts(token, userID string) ([]user.ICEContact, error)
+	AddICEContact(token string, c user.ICEContact) (*user.ICEContact, error)
+	UpdateICEContact(token string, c user.ICEContact) (*user.ICEContact, error)
+	DeleteICEContact(token, userID, contactID string) error
+	Blocks(token, userID string) ([]user.Block, error)
+	Block(token, userID, blockedUserID string) (*user.Block, error)
+	Unblock(token, userID, blockedUserID string) error
+	Follow(token, userID, followedUserID string) (*user.Follow, error)
+	Unfollow(token, userID, followedUserID string) error
+	Followers(token, userID string, offset int64, count int32) ([]user.Follow, error)
+	Following(token, userID string, offset int64, count int32) ([]user.Follow, error)
+	RequestConnection(token, userID, otherUserID string) (*user.Connection, error)
+	AcceptConnection(token, userID, requesterID string) (*user.Connection, error)
+	RemoveConnection(token, userID, otherUserID string) error
+	Connections(token, userID, status string, offset int64, count int32) ([]user.Connection, error)
+	Moderations(token, userID string, offset int64, count int32) ([]user.Moderation, error)
+	ModerationQueue(token, status string, offset int64, count int32) ([]user.Moderation, error)
+	ApproveModeration(token, moderationID string) (*user.Moderation, error)
+	RejectModeration(token, moderationID string) (*user.Moderation, error)
+	VerifyEmail(userID, verificationToken string) (*user.User, error)
+	VerifyICEPhone(token, userID, code string) (*user.User, error)
+	Genders() []user.Gender
+}
+
+type Avatarer interface {
+	errors.ToHTTPResponser
+	Upload(token, userID string, img io.Reader) (*user.User, error)
+	Avatar(token, userID string, size int) ([]byte, error)
+}
+
+type Streamer interface {
+	errors.ToHTTPResponser
+	UserChanges(token, userID, afterID string) ([]feed.Change, string, error)
+	Changes(token, afterID string) ([]feed.Change, string, error)
 }
 
 type handler struct {
 	errors.ErrToHTTP
 
-	guard  Guard
-	logger logging.Logger
-	rater  Rater
-	usrs   UserProfiler
+	guard          Guard
+	logger         logging.Logger
+	rater          Rater
+	usrs           UserProfiler
+	avatars        Avatarer
+	streams        Streamer
+	streamInterval time.Duration
 }
 
 const (
 	keyAPIKey           = "x-api-key"
 	keyUserID           = "userID"
+	keyContactID        = "contactID"
+	keyBlockedUserID    = "blockedUserID"
+	keyFollowedUserID   = "followedUserID"
+	keyOtherUserID      = "otherUserID"
+	keyModerationID     = "moderationID"
+	keyLocation         = "Location"
+	keyStatus           = "status"
+	keyHandle           = "handle"
+	keyIDs              = "ids"
 	keyAuthorization    = "Authorization"
+	keyIfMatch          = "If-Match"
+	keyETag             = "ETag"
+	keyIfNoneMatch      = "If-None-Match"
+	keyIfModifiedSince  = "If-Modified-Since"
+	keyLastEventID      = "Last-Event-ID"
+	keyLastModified     = "Last-Modified"
+	keyCacheControl     = "Cache-Control"
+	keyVary             = "Vary"
 	keyOffsetUpdateDate = "offsetUpdateDate"
+	keyPhoneRegion      = "phoneRegion"
+	keyContentType      = "Content-Type"
+	keyAcceptPatch      = "Accept-Patch"
 	keyOffset           = "offset"
 	keyCount            = "count"
 	keyByUserID         = "byUserID"
 	keyForUserID        = "forUserID"
 	keyForSection       = "forSection"
+	keyQuery            = "q"
+	keyNamePrefix       = "namePrefix"
+	keyGender           = "gender"
+	keyMinRating        = "minRating"
+	keyMaxRating        = "maxRating"
+	keyMinCompleteness  = "minCompleteness"
+	keyMaxCompleteness  = "maxCompleteness"
+	keyCreatedFrom      = "createdFrom"
+	keyCreatedTo        = "createdTo"
+	keyUpdatedFrom      = "updatedFrom"
+	keyUpdatedTo        = "updatedTo"
+	keySort             = "sort"
+	keyInclDeactivated  = "includeDeactivated"
+	keyAvatar           = "avatar"
+	keySize             = "size"
 
 	valBearerAuthPrefix = "bearer "
 
@@ -70,121 +158,1991 @@ func NewHandler(conf Config) (http.Handler, error) {
 		return nil, err
 	}
 
+	streamInterval := conf.StreamInterval
+	if streamInterval <= 0 {
+		streamInterval = DefaultStreamInterval
+	}
+
 	r := mux.NewRouter().PathPrefix(conf.BaseURL).Subrouter()
-	handler{guard: conf.Guard, logger: conf.Logger, rater: conf.Rater, usrs: conf.UserProfiler}.
-		handleRoute(r)
+	handler{guard: conf.Guard, logger: conf.Logger, rater: conf.Rater,
+		usrs: conf.UserProfiler, avatars: conf.Avatars, streams: conf.Streams,
+		streamInterval: streamInterval}.handleRoute(r)
 
 	corsOpts := []handlers.CORSOption{
 		handlers.AllowedHeaders([]string{
 			"X-Requested-With", "Accept", "Content-Type", "Content-Length",
 			"Accept-Encoding", "X-CSRF-Token", "Authorization", "X-api-key",
+			"If-Match", "If-None-Match", "If-Modified-Since", "Last-Event-ID",
 		}),
+		handlers.ExposedHeaders([]string{"ETag", "Last-Modified", "Cache-Control"}),
 		handlers.AllowedOrigins(conf.AllowedOrigins),
-		handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "OPTIONS"}),
+		handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
 	}
 	return handlers.CORS(corsOpts...)(r), nil
 }
 
-func (s handler) handleRoute(r *mux.Router) {
-	s.handleStatus(r)
-	s.handleUserUpdate(r)
-	s.handleGetUser(r)
-	s.handleRateUser(r)
-	s.handleGetRatings(r)
-	s.handleDocs(r)
-	s.handleNotFound(r)
+func (s handler) handleRoute(r *mux.Router) {
+	s.handleStatus(r)
+	s.handleGetGenders(r)
+	s.handleGetICEContacts(r)
+	s.handleAddICEContact(r)
+	s.handleUpdateICEContact(r)
+	s.handleDeleteICEContact(r)
+	s.handleGetBlocks(r)
+	s.handleBlockUser(r)
+	s.handleUnblockUser(r)
+	s.handleGetFollowers(r)
+	s.handleGetFollowing(r)
+	s.handleFollowUser(r)
+	s.handleUnfollowUser(r)
+	s.handleGetConnections(r)
+	s.handleRequestConnection(r)
+	s.handleAcceptConnection(r)
+	s.handleRemoveConnection(r)
+	s.handleGetUserModerations(r)
+	s.handleGetModerationQueue(r)
+	s.handleApproveModeration(r)
+	s.handleRejectModeration(r)
+	s.handleVerifyEmail(r)
+	s.handleVerifyICEPhone(r)
+	s.handleUserUpdate(r)
+	s.handlePatchUser(r)
+	s.handleGetUsers(r)
+	s.handleSearchUsers(r)
+	s.handleGetUserHistory(r)
+	s.handleExportUser(r)
+	s.handleDeactivateUser(r)
+	s.handleReactivateUser(r)
+	s.handleEraseUser(r)
+	s.handleMergeUser(r)
+	s.handleStreamUser(r)
+	s.handleStreamChanges(r)
+	s.handleUploadAvatar(r)
+	s.handleGetAvatar(r)
+	s.handleGetUserByHandle(r)
+	s.handleGetUser(r)
+	s.handleRateUser(r)
+	s.handleGetRatings(r)
+	s.handleDocs(r)
+	s.handleNotFound(r)
+}
+
+/**
+ * @api {get} /status Status
+ * @apiName Status
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ *
+ * @apiHeader x-api-key the api key
+ *
+ * @apiSuccess (200) {String} name Micro-service name.
+ * @apiSuccess (200)  {String} version http://semver.org version.
+ * @apiSuccess (200)  {String} description Short description of the micro-service.
+ * @apiSuccess (200)  {String} canonicalName Canonical name of the micro-service.
+ *
+ */
+func (s *handler) handleStatus(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		PathPrefix("/status").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				s.respondJsonOn(w, r, nil, struct {
+					Name          string `json:"name"`
+					Version       string `json:"version"`
+					Description   string `json:"description"`
+					CanonicalName string `json:"canonicalName"`
+				}{
+					Name:          config.Name,
+					Version:       config.VersionFull,
+					Description:   config.Description,
+					CanonicalName: config.CanonicalWebName(),
+				}, http.StatusOK, nil, s)
+			}),
+		)
+}
+
+/**
+ * @api {GET} /meta/genders GetGenders
+ * @apiName Get genders
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Lists the values users can set as their gender, in the
+ *		order they should be displayed. No Authorization header is required.
+ *
+ * @apiHeader x-api-key the api key
+ *
+ * @apiSuccess (200 JSON Response) {Object[]} genders List of genders.
+ * @apiSuccess (200 JSON Response) {String} genders.value Value to set as the user's gender e.g. "FEMALE".
+ * @apiSuccess (200 JSON Response) {String} genders.label Display name of the value e.g. "Female".
+ *
+ */
+func (s *handler) handleGetGenders(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/meta/genders").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(keyCacheControl, "public, max-age=300")
+				s.respondJsonOn(w, r, nil, NewGenders(s.usrs.Genders()),
+					http.StatusOK, nil, s)
+			}),
+		)
+}
+
+/**
+ * @api {POST} /users/{userID}/email/verify VerifyEmail
+ * @apiName Verify user email
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Confirms that the user owns the email on their profile
+ *		using the token sent to the email when it was set. No
+ *		Authorization header is required.
+ *
+ * @apiHeader x-api-key the api key
+ *
+ * @apiParam (URL Param) {String} userID ID of the user whose email to verify.
+ *
+ * @apiParam (JSON Request Body) {String} verificationToken The token sent to the email.
+ *
+ * @apiUse User200
+ *
+ */
+func (s *handler) handleVerifyEmail(r *mux.Router) {
+	r.Methods(http.MethodPost).
+		Path("/users/{" + keyUserID + "}/email/verify").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID            string `json:"userID"`
+					VerificationToken string `json:"verificationToken"`
+				}{}
+
+				if err := unmarshalJSONBody(r, &req); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				req.UserID = mux.Vars(r)[keyUserID]
+
+				usr, err := s.usrs.VerifyEmail(req.UserID, req.VerificationToken)
+				s.respondJsonOn(w, r, req, NewUser(usr), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {POST} /users/{userID}/ICEPhone/verify VerifyICEPhone
+ * @apiName Verify user ICEPhone
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Confirms the user's ICEPhone using the code sent to it by
+ *		SMS when it was set. Codes expire and only a limited number of
+ *		incorrect codes can be submitted; update the ICEPhone to get a new
+ *		code. Only the user or staff can verify a user's ICEPhone.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user whose ICEPhone to verify.
+ *
+ * @apiParam (JSON Request Body) {String} code The code sent to the ICEPhone.
+ *
+ * @apiUse User200
+ *
+ */
+func (s *handler) handleVerifyICEPhone(r *mux.Router) {
+	r.Methods(http.MethodPost).
+		Path("/users/{" + keyUserID + "}/ICEPhone/verify").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID string `json:"userID"`
+					Token  string `json:"token"`
+					Code   string `json:"code"`
+				}{}
+
+				if err := unmarshalJSONBody(r, &req); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				req.UserID = mux.Vars(r)[keyUserID]
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				usr, err := s.usrs.VerifyICEPhone(req.Token, req.UserID, req.Code)
+				s.respondJsonOn(w, r, req, NewUser(usr), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {PUT} /users/{userID} UpdateUser
+ * @apiName Update User Profile
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription All declared JSON values are used, including empty strings, except null values.
+ *		New names, bios and avatar URLs may be checked for unacceptable
+ *		content. Depending on the service's configuration, flagged values
+ *		are either kept off the profile or published but hidden from other
+ *		users until staff review them (see GetUserModerations). Updates
+ *		made by staff are not checked.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ * @apiHeader [If-Match] The ETag of the user as last fetched. The update
+ *		is rejected with a 412 (Precondition Failed) if the user has been
+ *		updated since.
+ *
+ * @apiParam (JSON Request Body) {String} [handle] New unique username. 3
+ *		to 30 letters, digits or underscores starting with a letter.
+ *		Handles are case insensitive when checking uniqueness and some
+ *		handles are reserved. Once set, a handle can only be changed
+ *		again after a cooldown period (30 days by default). An empty
+ *		value removes the handle.
+ * @apiParam (JSON Request Body) {String} [name] New Name.
+ * @apiParam (JSON Request Body) {String} [ICEPhone] New (In Case of Emergency) phone number.
+ *		Numbers not in international format are assumed to be from the
+ *		phoneRegion, the user's country or the service's default region
+ *		in that order. A new ICEPhone is unverified until confirmed with
+ *		the code sent to it by SMS (see VerifyICEPhone). Re-submitting an
+ *		unverified ICEPhone re-sends the code. The ICEPhone is the phone
+ *		of the user's primary emergency contact, which is created if the
+ *		user has none. An empty value deletes the user's only emergency
+ *		contact and is rejected with a 409 (Conflict) if the user has
+ *		more than one.
+ * @apiParam (JSON Request Body) {String} [phoneRegion] ISO 3166-1 alpha-2
+ *		region code (e.g. "UG") assumed for the ICEPhone in this request.
+ * @apiParam (JSON Request Body) {String} [email] New contact email. The
+ *		email is unverified until confirmed with the token sent to it (see
+ *		VerifyEmail). Re-submitting an unverified email re-sends the token.
+ * @apiParam (JSON Request Body) {String} [gender] New gender, one of the
+ *		values listed by GetGenders.
+ * @apiParam (JSON Request Body) {Object} [avatarURL] New profile picture URL.
+ * @apiParam (JSON Request Body) {Object} [bio] New brief description of user.
+ * @apiParam (JSON Request Body) {String} [country] New ISO 3166-1 alpha-2
+ *		country code e.g. "KE".
+ * @apiParam (JSON Request Body) {String} [locale] New preferred BCP 47
+ *		language tag e.g. "en-KE".
+ * @apiParam (JSON Request Body) {String} [timezone] New IANA time zone name
+ *		e.g. "Africa/Nairobi".
+ * @apiParam (JSON Request Body) {Object} [attributes] New values of custom
+ *		attributes keyed by attribute name e.g. {"language": "sw"}. Only
+ *		the attributes included are updated. A null value removes the
+ *		attribute.
+ * @apiParam (JSON Request Body) {Object} [privacy] New visibility of profile
+ *		fields keyed by field name (one of name, ICEPhone, gender,
+ *		avatarURL, bio, country, locale, timezone or email) e.g.
+ *		{"ICEPhone": "connections"}. Visibility is
+ *		one of:
+ *		"public" - everyone, including callers without a token,
+ *		"authenticated" - callers with a valid token,
+ *		"connections" - users the user has rated, been rated by or
+ *		is connected to,
+ *		"private" - the user and staff only.
+ *		An empty value reverts the field to its default visibility
+ *		(public for name and avatarURL, private for timezone and email,
+ *		authenticated for the rest). Unverified emails are only visible
+ *		to the user and staff.
+ *
+ * @apiUse User200
+ * @apiSuccess (200 Response Header) {String} ETag The new ETag of the user.
+ *
+ */
+func (s *handler) handleUserUpdate(r *mux.Router) {
+	r.Methods(http.MethodPut).
+		PathPrefix("/users/{" + keyUserID + "}").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID      string                 `json:"userID"`
+					Token       string                 `json:"token"`
+					Handle      JSONString             `json:"handle"`
+					Name        JSONString             `json:"name"`
+					ICEPhone    JSONString             `json:"ICEPhone"`
+					PhoneRegion string                 `json:"phoneRegion"`
+					Gender      JSONString             `json:"gender"`
+					AvatarURL   JSONString             `json:"avatarURL"`
+					Bio         JSONString             `json:"bio"`
+					Country     JSONString             `json:"country"`
+					Locale      JSONString             `json:"locale"`
+					Timezone    JSONString             `json:"timezone"`
+					Email       JSONString             `json:"email"`
+					Attrs       map[string]interface{} `json:"attributes"`
+					Privacy     map[string]string      `json:"privacy"`
+				}{}
+
+				if err := unmarshalJSONBody(r, &req); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				req.UserID = mux.Vars(r)[keyUserID]
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				ifLastUpdated, err := getIfMatch(r)
+				if err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				usr, err := s.usrs.Update(req.Token, user.UserUpdate{
+					UserID:        req.UserID,
+					Handle:        req.Handle.ToStringUpdate(),
+					Name:          req.Name.ToStringUpdate(),
+					ICEPhone:      req.ICEPhone.ToStringUpdate(),
+					PhoneRegion:   req.PhoneRegion,
+					Gender:        req.Gender.ToStringUpdate(),
+					AvatarURL:     req.AvatarURL.ToStringUpdate(),
+					Bio:           req.Bio.ToStringUpdate(),
+					Country:       req.Country.ToStringUpdate(),
+					Locale:        req.Locale.ToStringUpdate(),
+					Timezone:      req.Timezone.ToStringUpdate(),
+					Email:         req.Email.ToStringUpdate(),
+					Attributes:    req.Attrs,
+					Privacy:       req.Privacy,
+					IfLastUpdated: ifLastUpdated,
+				})
+				if err == nil && usr != nil {
+					w.Header().Set(keyETag, userETag(usr))
+				}
+				s.respondJsonOn(w, r, req, NewUser(usr), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {PATCH} /users/{userID} PatchUser
+ * @apiName Patch User Profile
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Updates the user by applying a patch to the document
+ *		{"handle", "name", "ICEPhone", "gender", "avatarURL", "bio",
+ *		"country", "locale", "timezone", "email", "attributes", "privacy"}
+ *		of the user's current values (see UpdateUser for the meaning and
+ *		validation of each). All members are present, empty strings for
+ *		unset values and objects for attributes and privacy (privacy only
+ *		contains the fields whose visibility has been set). Removing or
+ *		nulling a member clears it. The patch is rejected with a 412
+ *		(Precondition Failed) if the user is updated while it is being
+ *		applied.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ * @apiHeader Content-Type Either "application/merge-patch+json" for an RFC
+ *		7396 JSON Merge Patch e.g. {"bio": "Rider", "gender": null} or
+ *		"application/json-patch+json" for an RFC 6902 JSON Patch e.g.
+ *		[{"op": "test", "path": "/bio", "value": ""},
+ *		{"op": "replace", "path": "/bio", "value": "Rider"}].
+ *		Any other value is rejected with a 415 (Unsupported Media Type).
+ * @apiHeader [If-Match] The ETag of the user as last fetched. The patch
+ *		is rejected with a 412 (Precondition Failed) if the user has been
+ *		updated since.
+ *
+ * @apiParam (URL Param) {String} userID ID of the user to patch.
+ *
+ * @apiParam (URL Query) {String} [phoneRegion] ISO 3166-1 alpha-2 region
+ *		code (e.g. "UG") assumed for the ICEPhone in this request.
+ *
+ * @apiUse User200
+ * @apiSuccess (200 Response Header) {String} ETag The new ETag of the user.
+ * @apiError (409 Conflict) TestFailed A JSON Patch test operation failed.
+ *
+ */
+func (s *handler) handlePatchUser(r *mux.Router) {
+	r.Methods(http.MethodPatch).
+		Path("/users/{" + keyUserID + "}").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID      string `json:"userID"`
+					Token       string `json:"token"`
+					ContentType string `json:"contentType"`
+					PhoneRegion string `json:"phoneRegion"`
+					Patch       string `json:"patch"`
+				}{
+					UserID:      mux.Vars(r)[keyUserID],
+					PhoneRegion: r.URL.Query().Get(keyPhoneRegion),
+				}
+
+				req.ContentType, _, _ = mime.ParseMediaType(r.Header.Get(keyContentType))
+				if req.ContentType != contentTypeMergePatch && req.ContentType != contentTypeJSONPatch {
+					w.Header().Set(keyAcceptPatch, contentTypeMergePatch+", "+contentTypeJSONPatch)
+					log := r.Context().Value(ctxKeyLog).(logging.Logger)
+					log.WithField(logging.FieldResponseCode, http.StatusUnsupportedMediaType).
+						Warnf("unsupported patch Content-Type '%s'", req.ContentType)
+					http.Error(w, fmt.Sprintf("Content-Type must be one of %s or %s",
+						contentTypeMergePatch, contentTypeJSONPatch),
+						http.StatusUnsupportedMediaType)
+					return
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				ifLastUpdated, err := getIfMatch(r)
+				if err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				patchB, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					handleError(w, r, req, errors.NewClientf("unable to read request body: %v", err), s)
+					return
+				}
+				defer r.Body.Close()
+				req.Patch = string(patchB)
+
+				current, err := s.usrs.User(req.Token, req.UserID, time.Time{})
+				if err != nil {
+					handleError(w, r, req, err, s.usrs)
+					return
+				}
+				if ifLastUpdated.IsZero() {
+					// Guard against updates made since current was fetched.
+					ifLastUpdated = current.LastUpdated
+				}
+
+				original, err := userPatchDoc(current)
+				if err != nil {
+					handleError(w, r, req, errors.Newf("build patch document: %v", err), s)
+					return
+				}
+				patched, err := userPatchDoc(current)
+				if err != nil {
+					handleError(w, r, req, errors.Newf("build patch document: %v", err), s)
+					return
+				}
+
+				if req.ContentType == contentTypeMergePatch {
+					patched, err = applyMergePatch(patched, patchB)
+				} else {
+					patched, err = applyJSONPatch(patched, patchB)
+				}
+				if err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				update, err := patchedUserUpdate(req.UserID, original, patched)
+				if err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+				update.PhoneRegion = req.PhoneRegion
+				update.IfLastUpdated = ifLastUpdated
+
+				usr, err := s.usrs.Update(req.Token, update)
+				if err == nil && usr != nil {
+					w.Header().Set(keyETag, userETag(usr))
+				}
+				s.respondJsonOn(w, r, req, NewUser(usr), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {GET} /users/{userID}/history GetUserHistory
+ * @apiName Get user profile change history
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Lists every change made to a user's profile, most recent
+ *		first. Only accessible to staff.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user whose history to fetch.
+ * @apiUse OffsetCount
+ *
+ * @apiUse UserHistory200
+ *
+ */
+func (s *handler) handleGetUserHistory(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/users/{" + keyUserID + "}/history").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				URLQ := r.URL.Query()
+				req := struct {
+					UserID string `json:"userID"`
+					Token  string `json:"token"`
+					Offset int64  `json:"offset"`
+					Count  int32  `json:"count"`
+				}{
+					UserID: mux.Vars(r)[keyUserID],
+				}
+
+				var err error
+
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				if req.Offset, err = getOffset(URLQ); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				if req.Count, err = getCount(URLQ); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				chs, err := s.usrs.History(req.Token, req.UserID, req.Offset, req.Count)
+				s.respondJsonOn(w, r, req, NewChanges(chs), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {GET} /users/{userID}/export ExportUser
+ * @apiName Export user data
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Downloads all data held about a user as a single JSON
+ *		document. Only the user or staff can export a user's data.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user whose data to export.
+ *
+ * @apiUse UserExport200
+ *
+ */
+func (s *handler) handleExportUser(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/users/{" + keyUserID + "}/export").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID string `json:"userID"`
+					Token  string `json:"token"`
+				}{
+					UserID: mux.Vars(r)[keyUserID],
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				exp, err := s.usrs.Export(req.Token, req.UserID)
+				if err != nil {
+					handleError(w, r, req, err, s.usrs)
+					return
+				}
+
+				w.Header().Set("Content-Disposition", fmt.Sprintf(
+					`attachment; filename="%s-%s-export.json"`, config.Name, req.UserID))
+				s.respondJsonOn(w, r, req, NewExport(exp), http.StatusOK, nil, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {POST} /users/{userID}/deactivate DeactivateUser
+ * @apiName Deactivate user
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Hides the user's profile from everyone but the user and
+ *		staff. Deactivated users cannot be rated. Only the user or staff
+ *		can deactivate a profile.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user to deactivate.
+ *
+ * @apiSuccess (200 Response) nil an empty body
+ *
+ */
+func (s *handler) handleDeactivateUser(r *mux.Router) {
+	r.Methods(http.MethodPost).
+		Path("/users/{" + keyUserID + "}/deactivate").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID string `json:"userID"`
+					Token  string `json:"token"`
+				}{
+					UserID: mux.Vars(r)[keyUserID],
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				err = s.usrs.Deactivate(req.Token, req.UserID)
+				s.respondJsonOn(w, r, req, nil, http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {POST} /users/{userID}/reactivate ReactivateUser
+ * @apiName Reactivate user
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Reverses DeactivateUser. Erased profiles cannot be
+ *		re-activated. Only the user or staff can re-activate a profile.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user to re-activate.
+ *
+ * @apiSuccess (200 Response) nil an empty body
+ *
+ */
+func (s *handler) handleReactivateUser(r *mux.Router) {
+	r.Methods(http.MethodPost).
+		Path("/users/{" + keyUserID + "}/reactivate").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID string `json:"userID"`
+					Token  string `json:"token"`
+				}{
+					UserID: mux.Vars(r)[keyUserID],
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				err = s.usrs.Reactivate(req.Token, req.UserID)
+				s.respondJsonOn(w, r, req, nil, http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {DELETE} /users/{userID} EraseUser
+ * @apiName Erase user
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Permanently removes the user's personal data (name,
+ *		gender, ICEPhone, bio, avatarURL, attributes and profile history). Ratings the
+ *		user gave are re-assigned to an anonymous user and comments on
+ *		ratings given or received are removed. The profile remains
+ *		deactivated thereafter. Only the user or staff can erase a profile.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user to erase.
+ *
+ * @apiSuccess (200 Response) nil an empty body
+ *
+ */
+func (s *handler) handleEraseUser(r *mux.Router) {
+	r.Methods(http.MethodDelete).
+		Path("/users/{" + keyUserID + "}").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID string `json:"userID"`
+					Token  string `json:"token"`
+				}{
+					UserID: mux.Vars(r)[keyUserID],
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				err = s.usrs.Erase(req.Token, req.UserID)
+				s.respondJsonOn(w, r, req, nil, http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {POST} /users/{userID}/merge MergeUser
+ * @apiName Merge duplicate user
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Merges a duplicate user's profile into the user's. Empty
+ *		profile fields are filled in from the other profile and the rest
+ *		are chosen by the strategy. All ratings given and received by the
+ *		duplicate user are moved to the user. Where both users rated, or
+ *		were rated by, the same user in the same section only the most
+ *		recently updated rating is kept and ratings the two users gave
+ *		each other are removed. The duplicate user's profile is scrubbed,
+ *		deactivated and thereafter redirects to the user's with a 308
+ *		(Permanent Redirect). The duplicate user's ICE contacts,
+ *		follows, connections and blocks are likewise moved, dropping
+ *		the ones the user already has or that would be with themselves.
+ *		Only staff can merge users.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the surviving user.
+ *
+ * @apiParam (JSON Request Body) {String} duplicateUserID ID of the user to merge into the surviving user.
+ * @apiParam (JSON Request Body) {String="survivor","duplicate","latest"} [strategy=survivor]
+ *		Whose profile field values to keep: the surviving user's, the
+ *		duplicate user's or those of whichever profile was updated most
+ *		recently.
+ *
+ * @apiUse User200
+ *
+ */
+func (s *handler) handleMergeUser(r *mux.Router) {
+	r.Methods(http.MethodPost).
+		Path("/users/{" + keyUserID + "}/merge").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID          string `json:"userID"`
+					Token           string `json:"token"`
+					DuplicateUserID string `json:"duplicateUserID"`
+					Strategy        string `json:"strategy"`
+				}{}
+
+				if err := unmarshalJSONBody(r, &req); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				req.UserID = mux.Vars(r)[keyUserID]
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				usr, err := s.usrs.Merge(req.Token, req.UserID, req.DuplicateUserID, req.Strategy)
+				s.respondJsonOn(w, r, req, NewUser(usr), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {GET} /stream/users/{userID} StreamUser
+ * @apiName Stream user changes
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Streams changes to a user as they happen, as
+ *		text/event-stream (Server-Sent Events). Each event has the ID of the
+ *		change, the topic as its type and JSON data:
+ *
+ *		user.updated - the user (as in GetUser) after the latest updates.
+ *		rating.created - {ID, forSection, forUserID, byUserID, rating, created}.
+ *		user.deleted - {userID, mergedInto, deleted}. The stream ends after it.
+ *
+ *		Provide the ID of the last event received as Last-Event-ID when
+ *		reconnecting to receive the changes missed (changes are kept for a
+ *		limited time). Otherwise only changes after connecting are streamed.
+ *		Changes are streamed about 10 seconds after they happen so that
+ *		none committed late are skipped.
+ *		Events without data may be sent only to update the last event ID.
+ *		The stream ends if the token expires, after which reconnecting
+ *		responds with the error.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ * @apiHeader [Last-Event-ID] ID of the last event received.
+ *
+ * @apiParam (URL Param) {String} userID ID of the user whose changes to stream.
+ *
+ */
+func (s *handler) handleStreamUser(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/stream/users/{" + keyUserID + "}").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID      string `json:"userID"`
+					Token       string `json:"token"`
+					LastEventID string `json:"lastEventID"`
+				}{
+					UserID:      mux.Vars(r)[keyUserID],
+					LastEventID: r.Header.Get(keyLastEventID),
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				s.streamOn(w, r, req, req.LastEventID, events.TopicUserDeleted,
+					func(afterID string) ([]feed.Change, string, error) {
+						return s.streams.UserChanges(req.Token, req.UserID, afterID)
+					})
+			}),
+		)
+}
+
+/**
+ * @api {GET} /stream/changes StreamChanges
+ * @apiName Stream all changes
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Streams changes to all users as they happen, as
+ *		text/event-stream (Server-Sent Events). Each event has the ID of the
+ *		change, the topic as its type and JSON data:
+ *
+ *		user.updated - {userID, fields, actorUserID, updated} where fields
+ *			lists the names of the fields updated.
+ *		rating.created - {ID, forSection, forUserID, byUserID, rating, created}.
+ *		user.deleted - {userID, mergedInto, deleted}.
+ *
+ *		Resume with Last-Event-ID as in StreamUser. Only accessible to staff.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ * @apiHeader [Last-Event-ID] ID of the last event received.
+ *
+ */
+func (s *handler) handleStreamChanges(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/stream/changes").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					Token       string `json:"token"`
+					LastEventID string `json:"lastEventID"`
+				}{
+					LastEventID: r.Header.Get(keyLastEventID),
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				s.streamOn(w, r, req, req.LastEventID, "",
+					func(afterID string) ([]feed.Change, string, error) {
+						return s.streams.Changes(req.Token, afterID)
+					})
+			}),
+		)
+}
+
+/**
+ * @api {POST} /users/{userID}/avatar UploadAvatar
+ * @apiName Upload user avatar
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Upload a JPEG, PNG or WebP profile picture as
+ *		multipart/form-data. Square thumbnails are generated from the
+ *		centre of the image and the user's avatarURL is updated to point
+ *		at them (see GetAvatar). Only the user or staff can upload a
+ *		user's avatar.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user whose avatar to upload.
+ * @apiParam (Multipart Form Field) {File} avatar The image file.
+ *
+ * @apiUse User200
+ *
+ */
+func (s *handler) handleUploadAvatar(r *mux.Router) {
+	r.Methods(http.MethodPost).
+		Path("/users/{" + keyUserID + "}/avatar").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID string `json:"userID"`
+					Token  string `json:"token"`
+				}{
+					UserID: mux.Vars(r)[keyUserID],
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				img, err := getMultipartFile(r, keyAvatar)
+				if err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				usr, err := s.avatars.Upload(req.Token, req.UserID, img)
+				s.respondJsonOn(w, r, req, NewUser(usr), http.StatusOK, err, s.avatars)
+			}),
+		)
+}
+
+/**
+ * @api {GET} /users/{userID}/avatar GetAvatar
+ * @apiName Get user avatar
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Serves the user's uploaded avatar image. Does not require an
+ *		API key so that the URL can be used directly e.g. in HTML img tags.
+ *		The avatar is only served if the caller can view the user and their
+ *		avatarURL as per the user's privacy settings (see GetUser), which
+ *		without an Authorization header is only if they are public.
+ *		Responses to anonymous callers may be cached by shared caches.
+ *
+ * @apiHeader [Authorization] Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user whose avatar to fetch.
+ *
+ * @apiParam (URL Query) {Integer} [size] Desired width (and height) in
+ *		pixels. The smallest stored size that is at least this large is
+ *		served. The largest stored size is served if not provided.
+ *
+ * @apiSuccess (200) {File} avatar The image.
+ *
+ */
+func (s *handler) handleGetAvatar(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/users/{" + keyUserID + "}/avatar").
+		HandlerFunc(
+			s.prepLogger(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID string `json:"userID"`
+					Size   string `json:"size"`
+					Token  string `json:"token"`
+				}{
+					UserID: mux.Vars(r)[keyUserID],
+					Size:   r.URL.Query().Get(keySize),
+				}
+				req.Token, _ = getToken(r)
+
+				size := 0
+				if req.Size != "" {
+					var err error
+					if size, err = strconv.Atoi(req.Size); err != nil {
+						err = errors.NewClientf("invalid size: %v", err)
+						handleError(w, r, req, err, s)
+						return
+					}
+				}
+
+				img, err := s.avatars.Avatar(req.Token, req.UserID, size)
+				if err != nil {
+					handleError(w, r, req, err, s.avatars)
+					return
+				}
+
+				// A new upload changes the avatar URL so the image can be
+				// cached for long. Only images served to anonymous callers
+				// are public.
+				cacheScope := "public"
+				if req.Token != "" {
+					cacheScope = "private"
+				}
+				w.Header().Set("Content-Type", http.DetectContentType(img))
+				w.Header().Set("Cache-Control", cacheScope+", max-age=86400")
+				w.WriteHeader(http.StatusOK)
+				if _, err := w.Write(img); err != nil {
+					log := r.Context().Value(ctxKeyLog).(logging.Logger)
+					log.Errorf("unable write data to response stream: %v", err)
+				}
+			}),
+		)
+}
+
+/**
+ * @api {GET} /users/{userID}/ice-contacts GetICEContacts
+ * @apiName Get user's emergency contacts
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Lists the user's (In Case of Emergency) contacts in order of
+ *		priority. Accessible to callers who can view the user's ICEPhone as
+ *		per the user's privacy settings.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader [Authorization] Bearer token containing auth token e.g. "Bearer [value.of.jwt]".
+ *
+ * @apiParam (URL Param) {String} userID ID of the user whose contacts to fetch.
+ *
+ * @apiUse ICEContacts200
+ *
+ */
+func (s *handler) handleGetICEContacts(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/users/{" + keyUserID + "}/ice-contacts").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID string `json:"userID"`
+					Token  string `json:"token"`
+				}{
+					UserID: mux.Vars(r)[keyUserID],
+				}
+
+				req.Token, _ = getToken(r)
+
+				cs, err := s.usrs.ICEContacts(req.Token, req.UserID)
+				s.respondJsonOn(w, r, req, NewICEContacts(cs), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {POST} /users/{userID}/ice-contacts AddICEContact
+ * @apiName Add an emergency contact
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Adds an (In Case of Emergency) contact to the user. A user
+ *		can have at most 3 contacts. If the contact becomes the primary
+ *		contact, the user's ICEPhone is set to its phone and a
+ *		verification code is sent to it (see VerifyICEPhone). Only the user
+ *		or staff can add a user's contacts.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user to add the contact to.
+ *
+ * @apiParam (JSON Request Body) {String} name Name of the contact.
+ * @apiParam (JSON Request Body) {String} [relationship] How the contact relates to the user e.g. "spouse".
+ * @apiParam (JSON Request Body) {String} phone The contact's phone number.
+ *		Numbers not in international format are assumed to be from the
+ *		phoneRegion, the user's country or the service's default region
+ *		in that order. A new ICEPhone is unverified until confirmed with
+ *		the code sent to it by SMS (see VerifyICEPhone). Re-submitting an
+ *		unverified ICEPhone re-sends the code.
+ * @apiParam (JSON Request Body) {String} [phoneRegion] ISO 3166-1 alpha-2
+ *		region code (e.g. "UG") assumed for the phone.
+ * @apiParam (JSON Request Body) {Integer} [priority] Order in which to reach
+ *		the contact, lowest first. Defaults to after all existing contacts.
+ *
+ * @apiUse ICEContact200
+ *
+ */
+func (s *handler) handleAddICEContact(r *mux.Router) {
+	r.Methods(http.MethodPost).
+		Path("/users/{" + keyUserID + "}/ice-contacts").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID       string `json:"userID"`
+					Token        string `json:"token"`
+					Name         string `json:"name"`
+					Relationship string `json:"relationship"`
+					Phone        string `json:"phone"`
+					PhoneRegion  string `json:"phoneRegion"`
+					Priority     int32  `json:"priority"`
+				}{}
+
+				if err := unmarshalJSONBody(r, &req); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				req.UserID = mux.Vars(r)[keyUserID]
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				c, err := s.usrs.AddICEContact(req.Token, user.ICEContact{
+					UserID:       req.UserID,
+					Name:         req.Name,
+					Relationship: req.Relationship,
+					Phone:        req.Phone,
+					PhoneRegion:  req.PhoneRegion,
+					Priority:     req.Priority,
+				})
+				s.respondJsonOn(w, r, req, NewICEContact(c), http.StatusCreated, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {PUT} /users/{userID}/ice-contacts/{contactID} UpdateICEContact
+ * @apiName Update an emergency contact
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Replaces the values of the contact with those provided.
+ *		A verification code is sent if the user's ICEPhone changes as a
+ *		result. Only the user or staff can update a user's contacts.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user the contact belongs to.
+ * @apiParam (URL Param) {String} contactID ID of the contact to update.
+ *
+ * @apiParam (JSON Request Body) {String} name Name of the contact.
+ * @apiParam (JSON Request Body) {String} [relationship] How the contact relates to the user e.g. "spouse".
+ * @apiParam (JSON Request Body) {String} phone The contact's phone number.
+ *		Numbers not in international format are assumed to be from the
+ *		phoneRegion, the user's country or the service's default region
+ *		in that order. A new ICEPhone is unverified until confirmed with
+ *		the code sent to it by SMS (see VerifyICEPhone). Re-submitting an
+ *		unverified ICEPhone re-sends the code.
+ * @apiParam (JSON Request Body) {String} [phoneRegion] ISO 3166-1 alpha-2
+ *		region code (e.g. "UG") assumed for the phone.
+ * @apiParam (JSON Request Body) {Integer} priority Order in which to reach
+ *		the contact, lowest first.
+ *
+ * @apiUse ICEContact200
+ *
+ */
+func (s *handler) handleUpdateICEContact(r *mux.Router) {
+	r.Methods(http.MethodPut).
+		Path("/users/{" + keyUserID + "}/ice-contacts/{" + keyContactID + "}").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID       string `json:"userID"`
+					ContactID    string `json:"contactID"`
+					Token        string `json:"token"`
+					Name         string `json:"name"`
+					Relationship string `json:"relationship"`
+					Phone        string `json:"phone"`
+					PhoneRegion  string `json:"phoneRegion"`
+					Priority     int32  `json:"priority"`
+				}{}
+
+				if err := unmarshalJSONBody(r, &req); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				req.UserID = mux.Vars(r)[keyUserID]
+				req.ContactID = mux.Vars(r)[keyContactID]
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				c, err := s.usrs.UpdateICEContact(req.Token, user.ICEContact{
+					ID:           req.ContactID,
+					UserID:       req.UserID,
+					Name:         req.Name,
+					Relationship: req.Relationship,
+					Phone:        req.Phone,
+					PhoneRegion:  req.PhoneRegion,
+					Priority:     req.Priority,
+				})
+				s.respondJsonOn(w, r, req, NewICEContact(c), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {DELETE} /users/{userID}/ice-contacts/{contactID} DeleteICEContact
+ * @apiName Delete an emergency contact
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription A verification code is sent if the user's ICEPhone
+ *		changes to the next contact's phone. Only the user or staff can
+ *		delete a user's contacts.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user the contact belongs to.
+ * @apiParam (URL Param) {String} contactID ID of the contact to delete.
+ *
+ * @apiSuccess (200 Response) nil an empty body
+ *
+ */
+func (s *handler) handleDeleteICEContact(r *mux.Router) {
+	r.Methods(http.MethodDelete).
+		Path("/users/{" + keyUserID + "}/ice-contacts/{" + keyContactID + "}").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID    string `json:"userID"`
+					ContactID string `json:"contactID"`
+					Token     string `json:"token"`
+				}{
+					UserID:    mux.Vars(r)[keyUserID],
+					ContactID: mux.Vars(r)[keyContactID],
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				err = s.usrs.DeleteICEContact(req.Token, req.UserID, req.ContactID)
+				s.respondJsonOn(w, r, req, nil, http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {GET} /users/{userID}/blocks GetBlocks
+ * @apiName Get users blocked by user
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Lists the users blocked by the user, most recent first.
+ *		Only the user or staff can list a user's blocks.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user whose blocks to fetch.
+ *
+ * @apiUse Blocks200
+ *
+ */
+func (s *handler) handleGetBlocks(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/users/{" + keyUserID + "}/blocks").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID string `json:"userID"`
+					Token  string `json:"token"`
+				}{
+					UserID: mux.Vars(r)[keyUserID],
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				bs, err := s.usrs.Blocks(req.Token, req.UserID)
+				s.respondJsonOn(w, r, req, NewBlocks(bs), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {POST} /users/{userID}/blocks BlockUser
+ * @apiName Block a user
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Blocks another user on behalf of the user. A blocked user
+ *		cannot view the blocker's profile, the two users cannot rate each
+ *		other, follow each other or connect and ratings given by the
+ *		blocked user are hidden from the blocker. Existing follows and
+ *		connections (or connection requests) between the two users are
+ *		removed. Blocking an already blocked user has no effect. Only the
+ *		user or staff can block on a user's behalf.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user blocking.
+ *
+ * @apiParam (JSON Request Body) {String} blockedUserID ID of the user to block.
+ *
+ * @apiUse Block200
+ *
+ */
+func (s *handler) handleBlockUser(r *mux.Router) {
+	r.Methods(http.MethodPost).
+		Path("/users/{" + keyUserID + "}/blocks").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID        string `json:"userID"`
+					Token         string `json:"token"`
+					BlockedUserID string `json:"blockedUserID"`
+				}{}
+
+				if err := unmarshalJSONBody(r, &req); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				req.UserID = mux.Vars(r)[keyUserID]
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				b, err := s.usrs.Block(req.Token, req.UserID, req.BlockedUserID)
+				s.respondJsonOn(w, r, req, NewBlock(b), http.StatusCreated, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {DELETE} /users/{userID}/blocks/{blockedUserID} UnblockUser
+ * @apiName Unblock a user
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Only the user or staff can unblock on a user's behalf.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user who blocked.
+ * @apiParam (URL Param) {String} blockedUserID ID of the user to unblock.
+ *
+ * @apiSuccess (200 Response) nil an empty body
+ *
+ */
+func (s *handler) handleUnblockUser(r *mux.Router) {
+	r.Methods(http.MethodDelete).
+		Path("/users/{" + keyUserID + "}/blocks/{" + keyBlockedUserID + "}").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID        string `json:"userID"`
+					BlockedUserID string `json:"blockedUserID"`
+					Token         string `json:"token"`
+				}{
+					UserID:        mux.Vars(r)[keyUserID],
+					BlockedUserID: mux.Vars(r)[keyBlockedUserID],
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				err = s.usrs.Unblock(req.Token, req.UserID, req.BlockedUserID)
+				s.respondJsonOn(w, r, req, nil, http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {GET} /users/{userID}/followers GetFollowers
+ * @apiName Get user's followers
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Lists the users following the user, most recent first.
+ *		The same access rules as GetUser apply.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader [Authorization] Bearer token containing auth token e.g. "Bearer [value.of.jwt]".
+ *
+ * @apiParam (URL Param) {String} userID ID of the user whose followers to fetch.
+ * @apiUse OffsetCount
+ *
+ * @apiUse Follows200
+ *
+ */
+func (s *handler) handleGetFollowers(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/users/{" + keyUserID + "}/followers").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				URLQ := r.URL.Query()
+				req := struct {
+					UserID string `json:"userID"`
+					Token  string `json:"token"`
+					Offset int64  `json:"offset"`
+					Count  int32  `json:"count"`
+				}{
+					UserID: mux.Vars(r)[keyUserID],
+				}
+
+				req.Token, _ = getToken(r)
+
+				var err error
+				if req.Offset, err = getOffset(URLQ); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+				if req.Count, err = getCount(URLQ); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				fs, err := s.usrs.Followers(req.Token, req.UserID, req.Offset, req.Count)
+				s.respondJsonOn(w, r, req, NewFollows(fs), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {GET} /users/{userID}/following GetFollowing
+ * @apiName Get users followed by user
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Lists the users followed by the user, most recent first.
+ *		The same access rules as GetUser apply.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader [Authorization] Bearer token containing auth token e.g. "Bearer [value.of.jwt]".
+ *
+ * @apiParam (URL Param) {String} userID ID of the user whose follows to fetch.
+ * @apiUse OffsetCount
+ *
+ * @apiUse Follows200
+ *
+ */
+func (s *handler) handleGetFollowing(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/users/{" + keyUserID + "}/following").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				URLQ := r.URL.Query()
+				req := struct {
+					UserID string `json:"userID"`
+					Token  string `json:"token"`
+					Offset int64  `json:"offset"`
+					Count  int32  `json:"count"`
+				}{
+					UserID: mux.Vars(r)[keyUserID],
+				}
+
+				req.Token, _ = getToken(r)
+
+				var err error
+				if req.Offset, err = getOffset(URLQ); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+				if req.Count, err = getCount(URLQ); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				fs, err := s.usrs.Following(req.Token, req.UserID, req.Offset, req.Count)
+				s.respondJsonOn(w, r, req, NewFollows(fs), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {POST} /users/{userID}/following FollowUser
+ * @apiName Follow a user
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Makes the user follow another user. Following an already
+ *		followed user has no effect. Users that have blocked each other
+ *		cannot follow each other. Only the user or staff can follow on a
+ *		user's behalf.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user following.
+ *
+ * @apiParam (JSON Request Body) {String} followedUserID ID of the user to follow.
+ *
+ * @apiUse Follow200
+ *
+ */
+func (s *handler) handleFollowUser(r *mux.Router) {
+	r.Methods(http.MethodPost).
+		Path("/users/{" + keyUserID + "}/following").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID         string `json:"userID"`
+					Token          string `json:"token"`
+					FollowedUserID string `json:"followedUserID"`
+				}{}
+
+				if err := unmarshalJSONBody(r, &req); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				req.UserID = mux.Vars(r)[keyUserID]
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				f, err := s.usrs.Follow(req.Token, req.UserID, req.FollowedUserID)
+				s.respondJsonOn(w, r, req, NewFollow(f), http.StatusCreated, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {DELETE} /users/{userID}/following/{followedUserID} UnfollowUser
+ * @apiName Unfollow a user
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Only the user or staff can unfollow on a user's behalf.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user following.
+ * @apiParam (URL Param) {String} followedUserID ID of the user to unfollow.
+ *
+ * @apiSuccess (200 Response) nil an empty body
+ *
+ */
+func (s *handler) handleUnfollowUser(r *mux.Router) {
+	r.Methods(http.MethodDelete).
+		Path("/users/{" + keyUserID + "}/following/{" + keyFollowedUserID + "}").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID         string `json:"userID"`
+					FollowedUserID string `json:"followedUserID"`
+					Token          string `json:"token"`
+				}{
+					UserID:         mux.Vars(r)[keyUserID],
+					FollowedUserID: mux.Vars(r)[keyFollowedUserID],
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				err = s.usrs.Unfollow(req.Token, req.UserID, req.FollowedUserID)
+				s.respondJsonOn(w, r, req, nil, http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {GET} /users/{userID}/connections GetConnections
+ * @apiName Get user's connections
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Lists the user's connections, most recent first. Only the
+ *		user or staff can list a user's connections.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user whose connections to fetch.
+ *
+ * @apiParam (URL Query) {String="accepted","pending"} [status=accepted]
+ *		Pending connections include requests made by and to the user.
+ * @apiUse OffsetCount
+ *
+ * @apiUse Connections200
+ *
+ */
+func (s *handler) handleGetConnections(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/users/{" + keyUserID + "}/connections").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				URLQ := r.URL.Query()
+				req := struct {
+					UserID string `json:"userID"`
+					Token  string `json:"token"`
+					Status string `json:"status"`
+					Offset int64  `json:"offset"`
+					Count  int32  `json:"count"`
+				}{
+					UserID: mux.Vars(r)[keyUserID],
+					Status: URLQ.Get(keyStatus),
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+				if req.Offset, err = getOffset(URLQ); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+				if req.Count, err = getCount(URLQ); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				cs, err := s.usrs.Connections(req.Token, req.UserID, req.Status,
+					req.Offset, req.Count)
+				s.respondJsonOn(w, r, req, NewConnections(cs), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {POST} /users/{userID}/connections RequestConnection
+ * @apiName Request a connection
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Requests a mutual connection with another user which the
+ *		other user can accept (see AcceptConnection). If the other user
+ *		had already requested a connection with the user, their request
+ *		is accepted instead. Users that have blocked each other cannot
+ *		connect. Only the user or staff can request a connection on a
+ *		user's behalf.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user requesting.
+ *
+ * @apiParam (JSON Request Body) {String} connectedUserID ID of the user to connect with.
+ *
+ * @apiUse Connection200
+ *
+ */
+func (s *handler) handleRequestConnection(r *mux.Router) {
+	r.Methods(http.MethodPost).
+		Path("/users/{" + keyUserID + "}/connections").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID          string `json:"userID"`
+					Token           string `json:"token"`
+					ConnectedUserID string `json:"connectedUserID"`
+				}{}
+
+				if err := unmarshalJSONBody(r, &req); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				req.UserID = mux.Vars(r)[keyUserID]
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				c, err := s.usrs.RequestConnection(req.Token, req.UserID, req.ConnectedUserID)
+				s.respondJsonOn(w, r, req, NewConnection(c), http.StatusCreated, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {POST} /users/{userID}/connections/{otherUserID}/accept AcceptConnection
+ * @apiName Accept a connection
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Accepts the connection requested by the other user. Only
+ *		the user or staff can accept a connection on a user's behalf.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user accepting.
+ * @apiParam (URL Param) {String} otherUserID ID of the user who requested the connection.
+ *
+ * @apiUse Connection200
+ *
+ */
+func (s *handler) handleAcceptConnection(r *mux.Router) {
+	r.Methods(http.MethodPost).
+		Path("/users/{" + keyUserID + "}/connections/{" + keyOtherUserID + "}/accept").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID      string `json:"userID"`
+					OtherUserID string `json:"otherUserID"`
+					Token       string `json:"token"`
+				}{
+					UserID:      mux.Vars(r)[keyUserID],
+					OtherUserID: mux.Vars(r)[keyOtherUserID],
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				c, err := s.usrs.AcceptConnection(req.Token, req.UserID, req.OtherUserID)
+				s.respondJsonOn(w, r, req, NewConnection(c), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {DELETE} /users/{userID}/connections/{otherUserID} RemoveConnection
+ * @apiName Remove a connection
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Cancels, declines or ends the connection between the user
+ *		and the other user regardless of who requested it. Only the user or
+ *		staff can remove a connection on a user's behalf.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user removing the connection.
+ * @apiParam (URL Param) {String} otherUserID ID of the other user in the connection.
+ *
+ * @apiSuccess (200 Response) nil an empty body
+ *
+ */
+func (s *handler) handleRemoveConnection(r *mux.Router) {
+	r.Methods(http.MethodDelete).
+		Path("/users/{" + keyUserID + "}/connections/{" + keyOtherUserID + "}").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					UserID      string `json:"userID"`
+					OtherUserID string `json:"otherUserID"`
+					Token       string `json:"token"`
+				}{
+					UserID:      mux.Vars(r)[keyUserID],
+					OtherUserID: mux.Vars(r)[keyOtherUserID],
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				err = s.usrs.RemoveConnection(req.Token, req.UserID, req.OtherUserID)
+				s.respondJsonOn(w, r, req, nil, http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {GET} /users/{userID}/moderations GetUserModerations
+ * @apiName Get user's moderations
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Lists the user's flagged name, bio and avatar URL updates
+ *		and the status of their review by staff, most recent first. Only
+ *		the user or staff can list a user's moderations.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Param) {String} userID ID of the user whose moderations to fetch.
+ *
+ * @apiUse OffsetCount
+ *
+ * @apiUse Moderations200
+ *
+ */
+func (s *handler) handleGetUserModerations(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/users/{" + keyUserID + "}/moderations").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				URLQ := r.URL.Query()
+				req := struct {
+					UserID string `json:"userID"`
+					Token  string `json:"token"`
+					Offset int64  `json:"offset"`
+					Count  int32  `json:"count"`
+				}{
+					UserID: mux.Vars(r)[keyUserID],
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+				if req.Offset, err = getOffset(URLQ); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+				if req.Count, err = getCount(URLQ); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				ms, err := s.usrs.Moderations(req.Token, req.UserID, req.Offset, req.Count)
+				s.respondJsonOn(w, r, req, NewModerations(ms), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {GET} /moderations GetModerationQueue
+ * @apiName Get moderation queue
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Lists flagged name, bio and avatar URL updates with the
+ *		status, oldest first. Only staff can view the queue.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
+ *
+ * @apiParam (URL Query) {String="pending","approved","rejected"} [status=pending]
+ * @apiUse OffsetCount
+ *
+ * @apiUse Moderations200
+ *
+ */
+func (s *handler) handleGetModerationQueue(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/moderations").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				URLQ := r.URL.Query()
+				req := struct {
+					Token  string `json:"token"`
+					Status string `json:"status"`
+					Offset int64  `json:"offset"`
+					Count  int32  `json:"count"`
+				}{
+					Status: URLQ.Get(keyStatus),
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+				if req.Offset, err = getOffset(URLQ); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+				if req.Count, err = getCount(URLQ); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				ms, err := s.usrs.ModerationQueue(req.Token, req.Status, req.Offset, req.Count)
+				s.respondJsonOn(w, r, req, NewModerations(ms), http.StatusOK, err, s.usrs)
+			}),
+		)
 }
 
 /**
- * @api {get} /status Status
- * @apiName Status
+ * @api {POST} /moderations/{moderationID}/approve ApproveModeration
+ * @apiName Approve a moderation
  * @apiVersion 0.1.0
  * @apiGroup Service
+ * @apiDescription Approves a pending flagged value. A held value is set on
+ *		the user's profile and a hidden value is made visible to other
+ *		users. Only staff can approve moderations.
  *
  * @apiHeader x-api-key the api key
+ * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
  *
- * @apiSuccess (200) {String} name Micro-service name.
- * @apiSuccess (200)  {String} version http://semver.org version.
- * @apiSuccess (200)  {String} description Short description of the micro-service.
- * @apiSuccess (200)  {String} canonicalName Canonical name of the micro-service.
+ * @apiParam (URL Param) {String} moderationID ID of the pending moderation.
+ *
+ * @apiUse Moderation200
  *
  */
-func (s *handler) handleStatus(r *mux.Router) {
-	r.Methods(http.MethodGet).
-		PathPrefix("/status").
+func (s *handler) handleApproveModeration(r *mux.Router) {
+	r.Methods(http.MethodPost).
+		Path("/moderations/{" + keyModerationID + "}/approve").
 		HandlerFunc(
 			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
-				s.respondJsonOn(w, r, nil, struct {
-					Name          string `json:"name"`
-					Version       string `json:"version"`
-					Description   string `json:"description"`
-					CanonicalName string `json:"canonicalName"`
+				req := struct {
+					ModerationID string `json:"moderationID"`
+					Token        string `json:"token"`
 				}{
-					Name:          config.Name,
-					Version:       config.VersionFull,
-					Description:   config.Description,
-					CanonicalName: config.CanonicalWebName(),
-				}, http.StatusOK, nil, s)
+					ModerationID: mux.Vars(r)[keyModerationID],
+				}
+
+				var err error
+				if req.Token, err = getToken(r); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				m, err := s.usrs.ApproveModeration(req.Token, req.ModerationID)
+				s.respondJsonOn(w, r, req, NewModeration(m), http.StatusOK, err, s.usrs)
 			}),
 		)
 }
 
 /**
- * @api {PUT} /users/{userID} UpdateUser
- * @apiName Update User Profile
+ * @api {POST} /moderations/{moderationID}/reject RejectModeration
+ * @apiName Reject a moderation
  * @apiVersion 0.1.0
  * @apiGroup Service
- * @apiDescription All declared JSON values are used, including empty strings, except null values.
+ * @apiDescription Rejects a pending flagged value. A held value is
+ *		discarded and a hidden value is reverted to the value it replaced.
+ *		Only staff can reject moderations.
  *
  * @apiHeader x-api-key the api key
  * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
  *
- * @apiParam (JSON Request Body) {String} [name] New Name.
- * @apiParam (JSON Request Body) {String} [ICEPhone] New (In Case of Emergency) phone number.
- * @apiParam (JSON Request Body) {String="MALE","FEMALE","OTHER"} [gender] New gender.
- * @apiParam (JSON Request Body) {Object} [avatarURL] New profile picture URL.
- * @apiParam (JSON Request Body) {Object} [bio] New brief description of user.
+ * @apiParam (URL Param) {String} moderationID ID of the pending moderation.
  *
- * @apiUse User200
+ * @apiUse Moderation200
  *
  */
-func (s *handler) handleUserUpdate(r *mux.Router) {
-	r.Methods(http.MethodPut).
-		PathPrefix("/users/{" + keyUserID + "}").
+func (s *handler) handleRejectModeration(r *mux.Router) {
+	r.Methods(http.MethodPost).
+		Path("/moderations/{" + keyModerationID + "}/reject").
 		HandlerFunc(
 			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
 				req := struct {
-					UserID    string     `json:"userID"`
-					Token     string     `json:"token"`
-					Name      JSONString `json:"name"`
-					ICEPhone  JSONString `json:"ICEPhone"`
-					Gender    JSONString `json:"gender"`
-					AvatarURL JSONString `json:"avatarURL"`
-					Bio       JSONString `json:"bio"`
-				}{}
-
-				if err := unmarshalJSONBody(r, &req); err != nil {
-					handleError(w, r, req, err, s)
-					return
+					ModerationID string `json:"moderationID"`
+					Token        string `json:"token"`
+				}{
+					ModerationID: mux.Vars(r)[keyModerationID],
 				}
 
-				req.UserID = mux.Vars(r)[keyUserID]
-
 				var err error
 				if req.Token, err = getToken(r); err != nil {
 					handleError(w, r, req, err, s)
 					return
 				}
 
-				usr, err := s.usrs.Update(req.Token, user.UserUpdate{
-					UserID:    req.UserID,
-					Name:      req.Name.ToStringUpdate(),
-					ICEPhone:  req.ICEPhone.ToStringUpdate(),
-					Gender:    req.Gender.ToStringUpdate(),
-					AvatarURL: req.AvatarURL.ToStringUpdate(),
-					Bio:       req.Bio.ToStringUpdate(),
-				})
-				s.respondJsonOn(w, r, req, NewUser(usr), http.StatusOK, err, s.usrs)
+				m, err := s.usrs.RejectModeration(req.Token, req.ModerationID)
+				s.respondJsonOn(w, r, req, NewModeration(m), http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {GET} /users/by-handle/{handle} GetUserByHandle
+ * @apiName Get user by handle
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Values are provided as per GetUser.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader [Authorization] Bearer token containing auth token e.g. "Bearer [value.of.jwt]".
+ * Only public accessible values will be provided if this is not provided.
+ *
+ * @apiParam (URL Param) {String} handle Handle of the user to fetch (case insensitive).
+ *
+ * @apiUse ConditionalGET
+ * @apiUse User200
+ * @apiUse UserCacheHeaders
+ *
+ */
+func (s *handler) handleGetUserByHandle(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/users/by-handle/{" + keyHandle + "}").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					Handle string `json:"handle"`
+					Token  string `json:"token"`
+				}{
+					Handle: mux.Vars(r)[keyHandle],
+				}
+
+				req.Token, _ = getToken(r)
+
+				usr, err := s.usrs.UserByHandle(req.Token, req.Handle)
+				s.respondUserOn(w, r, req, usr, req.Token != "", err)
 			}),
 		)
 }
@@ -194,6 +2152,12 @@ func (s *handler) handleUserUpdate(r *mux.Router) {
  * @apiName Get user
  * @apiVersion 0.1.0
  * @apiGroup Service
+ * @apiDescription Values are provided according to the privacy settings of
+ *		the user and how the caller relates to the user. The user and
+ *		staff are provided with all values. A 404 is returned to callers
+ *		that the user has blocked. A 308 (Permanent Redirect) whose
+ *		Location header points to the surviving user is returned for
+ *		users that have been merged into another user (see MergeUser).
  *
  * @apiHeader x-api-key the api key
  * @apiHeader [Authorization] Bearer token containing auth token e.g. "Bearer [value.of.jwt]".
@@ -203,9 +2167,12 @@ func (s *handler) handleUserUpdate(r *mux.Router) {
  *
  * @apiParam (URL Query) {Integer} [offsetUpdateDate] Earliest ISO8601 date that
  * 		the user should have been updated. If the userID exists but the update
- *		date is earlier than this value then a 404 will be returned.
+ *		date is earlier than this value then a 404 will be returned. Prefer
+ *		If-None-Match or If-Modified-Since which are understood by HTTP caches.
  *
+ * @apiUse ConditionalGET
  * @apiUse User200
+ * @apiUse UserCacheHeaders
  *
  */
 func (s *handler) handleGetUser(r *mux.Router) {
@@ -235,7 +2202,181 @@ func (s *handler) handleGetUser(r *mux.Router) {
 				}
 
 				usr, err := s.usrs.User(req.Token, req.UserID, oud)
-				s.respondJsonOn(w, r, req, NewUser(usr), http.StatusOK, err, s.usrs)
+				s.respondUserOn(w, r, req, usr, req.Token != "", err)
+			}),
+		)
+}
+
+/**
+ * @api {GET} /users GetUsers
+ * @apiName Get multiple users
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription Fetch up to 100 users in a single request. IDs that do not
+ *		exist are listed in missingIDs rather than failing the request.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader [Authorization] Bearer token containing auth token e.g. "Bearer [value.of.jwt]".
+ * Only public accessible values will be provided if this is not provided.
+ *
+ * @apiParam (URL Query) {String} ids Comma separated list of user IDs to fetch.
+ *
+ * @apiUse BulkUsers200
+ *
+ */
+func (s *handler) handleGetUsers(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/users").
+		Queries(keyIDs, "{"+keyIDs+"}").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				req := struct {
+					Token string   `json:"token"`
+					IDs   []string `json:"IDs"`
+				}{
+					IDs: strings.Split(r.URL.Query().Get(keyIDs), ","),
+				}
+
+				req.Token, _ = getToken(r)
+
+				usrs, missingIDs, err := s.usrs.Users(req.Token, req.IDs)
+				s.respondJsonOn(w, r, req, NewBulkUsers(usrs, missingIDs),
+					http.StatusOK, err, s.usrs)
+			}),
+		)
+}
+
+/**
+ * @api {GET} /users SearchUsers
+ * @apiName Search users
+ * @apiVersion 0.1.0
+ * @apiGroup Service
+ * @apiDescription List users matching the provided filters. Staff get every
+ *		field of each user and can use every filter. Everyone else gets
+ *		the values each user's privacy settings allow them to view and can
+ *		only filter and sort by those: anonymous callers by name and
+ *		gender, and authenticated callers additionally by rating and
+ *		dates. Gender filters only match users whose gender the caller
+ *		can view.
+ *
+ * @apiHeader x-api-key the api key
+ * @apiHeader [Authorization] Bearer token containing auth token e.g. "Bearer [value.of.jwt]".
+ *
+ * @apiParam (URL Query) {String} [namePrefix] Match users whose name starts
+ *		with this value (case insensitive).
+ * @apiParam (URL Query) {String} [q] Match users with every word of this value
+ *		in their name (or bio for staff).
+ * @apiParam (URL Query) {String} [gender] Match users of this gender.
+ * @apiParam (URL Query) {Float} [minRating] Minimum (inclusive) rating
+ *		(authenticated only).
+ * @apiParam (URL Query) {Float} [maxRating] Maximum (inclusive) rating
+ *		(authenticated only).
+ * @apiParam (URL Query) {Integer{0-100}} [minCompleteness] Minimum
+ *		(inclusive) profile completeness score (staff only).
+ * @apiParam (URL Query) {Integer{0-100}} [maxCompleteness] Maximum
+ *		(inclusive) profile completeness score (staff only).
+ * @apiParam (URL Query) {String} [createdFrom] Earliest (inclusive) ISO8601
+ *		creation date (authenticated only).
+ * @apiParam (URL Query) {String} [createdTo] Latest (inclusive) ISO8601
+ *		creation date (authenticated only).
+ * @apiParam (URL Query) {String} [updatedFrom] Earliest (inclusive) ISO8601
+ *		update date (authenticated only).
+ * @apiParam (URL Query) {String} [updatedTo] Latest (inclusive) ISO8601
+ *		update date (authenticated only).
+ * @apiParam (URL Query) {Boolean} [includeDeactivated=false] Include
+ *		deactivated and erased users (staff only).
+ * @apiParam (URL Query) {String} [sort] Comma separated list of fields to
+ *		sort by from name, rating, created and lastUpdated (all but name
+ *		authenticated only). Prefix a field with "-" to sort in descending
+ *		order e.g. "-rating,name".
+ * @apiUse OffsetCount
+ *
+ * @apiUse UsersList200
+ *
+ */
+func (s *handler) handleSearchUsers(r *mux.Router) {
+	r.Methods(http.MethodGet).
+		Path("/users").
+		HandlerFunc(
+			s.guardChain(func(w http.ResponseWriter, r *http.Request) {
+				URLQ := r.URL.Query()
+				req := struct {
+					Token       string `json:"token"`
+					Query       string `json:"q"`
+					NamePrefix  string `json:"namePrefix"`
+					Gender      string `json:"gender"`
+					MinRating   string `json:"minRating"`
+					MaxRating   string `json:"maxRating"`
+					MinComplete string `json:"minCompleteness"`
+					MaxComplete string `json:"maxCompleteness"`
+					CreatedFrom string `json:"createdFrom"`
+					CreatedTo   string `json:"createdTo"`
+					UpdatedFrom string `json:"updatedFrom"`
+					UpdatedTo   string `json:"updatedTo"`
+					Sort        string `json:"sort"`
+					InclDeactiv bool   `json:"includeDeactivated"`
+					Offset      int64  `json:"offset"`
+					Count       int32  `json:"count"`
+				}{
+					Query:       URLQ.Get(keyQuery),
+					NamePrefix:  URLQ.Get(keyNamePrefix),
+					Gender:      URLQ.Get(keyGender),
+					MinRating:   URLQ.Get(keyMinRating),
+					MaxRating:   URLQ.Get(keyMaxRating),
+					MinComplete: URLQ.Get(keyMinCompleteness),
+					MaxComplete: URLQ.Get(keyMaxCompleteness),
+					CreatedFrom: URLQ.Get(keyCreatedFrom),
+					CreatedTo:   URLQ.Get(keyCreatedTo),
+					UpdatedFrom: URLQ.Get(keyUpdatedFrom),
+					UpdatedTo:   URLQ.Get(keyUpdatedTo),
+					Sort:        URLQ.Get(keySort),
+				}
+
+				req.Token, _ = getToken(r)
+
+				var err error
+				if req.InclDeactiv, err = getBool(URLQ, keyInclDeactivated); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				f := user.Filter{
+					Query:              req.Query,
+					NamePrefix:         req.NamePrefix,
+					Gender:             crdb.NewComparisonString(crdb.OpET, req.Gender),
+					Sort:               getSort(req.Sort),
+					IncludeDeactivated: req.InclDeactiv,
+				}
+
+				if f.Rating, err = getRange(req.MinRating, req.MaxRating, parseFloat); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+				if f.Completeness, err = getRange(req.MinComplete, req.MaxComplete, parseFloat); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+				if f.Created, err = getRange(req.CreatedFrom, req.CreatedTo, parseTime); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+				if f.LastUpdated, err = getRange(req.UpdatedFrom, req.UpdatedTo, parseTime); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+
+				if req.Offset, err = getOffset(URLQ); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+				if req.Count, err = getCount(URLQ); err != nil {
+					handleError(w, r, req, err, s)
+					return
+				}
+				f.Offset, f.Count = req.Offset, req.Count
+
+				usrs, err := s.usrs.Search(req.Token, f)
+				s.respondJsonOn(w, r, req, NewUsers(usrs), http.StatusOK, err, s.usrs)
 			}),
 		)
 }
@@ -245,6 +2386,8 @@ func (s *handler) handleGetUser(r *mux.Router) {
  * @apiName Rate a user
  * @apiVersion 0.1.0
  * @apiGroup Service
+ * @apiDescription A 403 is returned if either the rater or ratee has
+ *		blocked the other.
  *
  * @apiHeader x-api-key the api key
  * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
@@ -293,6 +2436,8 @@ func (s *handler) handleRateUser(r *mux.Router) {
  * @apiName Get Ratings On User
  * @apiVersion 0.1.0
  * @apiGroup Service
+ * @apiDescription Ratings given by users that the caller has blocked are
+ *		not included.
  *
  * @apiHeader x-api-key the api key
  * @apiHeader Authorization Bearer token containing auth token e.g. "Bearer [value.of.jwt]"
@@ -414,6 +2559,73 @@ func (s *handler) guardRoute(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+/**
+ * @apiDefine ConditionalGET
+ *
+ * @apiHeader [If-None-Match] ETag(s) of a previously fetched response. A 304
+ *		with no body is returned if the response would have the same ETag.
+ * @apiHeader [If-Modified-Since] Last-Modified date of a previously fetched
+ *		response. A 304 with no body is returned if the user has not been
+ *		updated since. Ignored if If-None-Match is provided.
+ */
+
+/**
+ * @apiDefine UserCacheHeaders
+ *
+ * @apiSuccess (200 Response Header) {String} ETag Identifies this response
+ *		(it differs between the public and authenticated views of the user).
+ *		It can also be provided as If-Match when updating the user.
+ * @apiSuccess (200 Response Header) {String} Last-Modified Date when the user was last updated.
+ * @apiSuccess (200 Response Header) {String} Cache-Control "public, no-cache"
+ *		if no Authorization was provided, otherwise "private, no-cache".
+ * @apiSuccess (200 Response Header) {String} Vary Authorization
+ */
+
+// respondUserOn writes usr as json to w like respondJsonOn, along with
+// caching headers that depend on whether the response is the authenticated
+// or the public projection of usr. A 304 without a body is written instead
+// if the conditional headers of r match usr.
+func (s *handler) respondUserOn(w http.ResponseWriter, r *http.Request, reqData interface{},
+	usr *user.User, authenticated bool, err error) {
+
+	if err != nil {
+		handleError(w, r, reqData, err, s.usrs)
+		return
+	}
+
+	respBytes, err := json.Marshal(NewUser(usr))
+	if err != nil {
+		handleError(w, r, reqData, err, s.usrs)
+		return
+	}
+
+	w.Header().Set(keyVary, keyAuthorization)
+	if authenticated {
+		w.Header().Set(keyCacheControl, "private, no-cache")
+	} else {
+		w.Header().Set(keyCacheControl, "public, no-cache")
+	}
+
+	var ETag string
+	if usr != nil && !usr.LastUpdated.IsZero() {
+		ETag = representationETag(usr, respBytes)
+		w.Header().Set(keyETag, ETag)
+		w.Header().Set(keyLastModified, usr.LastUpdated.UTC().Format(http.TimeFormat))
+	}
+
+	if ETag != "" && notModified(r, ETag, usr.LastUpdated) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(respBytes); err != nil {
+		log := r.Context().Value(ctxKeyLog).(logging.Logger)
+		log.Errorf("unable write data to response stream: %v", err)
+	}
+}
+
 // respondJsonOn marshals respData to json and writes it and the code as the
 // http header to w. If err is not nil, handleError is called instead of the
 // documented write to w.
@@ -452,6 +2664,12 @@ func handleError(w http.ResponseWriter, r *http.Request, reqData interface{}, er
 	log := r.Context().Value(ctxKeyLog).(logging.Logger).
 		WithField(logging.FieldRequest, string(reqDataB))
 
+	if mErr, ok := err.(user.MergedError); ok {
+		URL := *r.URL
+		URL.Path = mergedUserPath(URL.Path, mErr)
+		w.Header().Set(keyLocation, URL.String())
+	}
+
 	if code, ok := errSrc.ToHTTPResponse(err, w); ok {
 		log.WithField(logging.FieldResponseCode, code).Warn(err)
 		return
@@ -463,6 +2681,19 @@ func handleError(w http.ResponseWriter, r *http.Request, reqData interface{}, er
 		http.StatusInternalServerError)
 }
 
+// mergedUserPath returns path with the ID of the merged user in e replaced
+// by the ID of the user it was merged into.
+func mergedUserPath(path string, e user.MergedError) string {
+	segs := strings.Split(path, "/")
+	for i := 1; i < len(segs); i++ {
+		if segs[i-1] == "users" && segs[i] == e.UserID {
+			segs[i] = e.MergedInto
+			break
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
 func unmarshalJSONBody(r *http.Request, into interface{}) error {
 
 	bodyB, err := ioutil.ReadAll(r.Body)
@@ -478,6 +2709,28 @@ func unmarshalJSONBody(r *http.Request, into interface{}) error {
 	return nil
 }
 
+// getMultipartFile returns a reader of the contents of the file in the
+// multipart/form-data field named field. The body is streamed rather than
+// buffered so the consumer should enforce its own size limits.
+func getMultipartFile(r *http.Request, field string) (io.Reader, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, errors.NewClientf("expected a multipart/form-data body: %v", err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errors.NewClientf("missing multipart field '%s'", field)
+		}
+		if err != nil {
+			return nil, errors.NewClientf("invalid multipart body: %v", err)
+		}
+		if part.FormName() == field {
+			return part, nil
+		}
+	}
+}
+
 func getToken(r *http.Request) (string, error) {
 
 	authHeaders := r.Header[keyAuthorization]
@@ -495,6 +2748,62 @@ func getToken(r *http.Request) (string, error) {
 		valBearerAuthPrefix, keyAuthorization)
 }
 
+// userETag returns a strong entity tag for usr derived from the time it was
+// last updated.
+func userETag(usr *user.User) string {
+	return `"` + strconv.FormatInt(usr.LastUpdated.UnixNano(), 10) + `"`
+}
+
+// representationETag returns a strong entity tag for the response body of
+// usr. It extends userETag with a digest of body so that different
+// projections of the same version of usr have different tags.
+func representationETag(usr *user.User, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strings.TrimSuffix(userETag(usr), `"`) + "-" +
+		hex.EncodeToString(sum[:8]) + `"`
+}
+
+// notModified returns true if the conditional GET headers of r match the
+// response with ETag whose resource was last updated at lastUpdated.
+// If-None-Match takes precedence over If-Modified-Since.
+func notModified(r *http.Request, ETag string, lastUpdated time.Time) bool {
+	if ifNoneMatch := r.Header.Get(keyIfNoneMatch); ifNoneMatch != "" {
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == ETag {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get(keyIfModifiedSince))
+	if err != nil {
+		return false
+	}
+	return !lastUpdated.Truncate(time.Second).After(since)
+}
+
+// getIfMatch extracts the last update time encoded in the If-Match header
+// of r (see userETag and representationETag) or returns a zero time if the
+// header is not set or is "*". An error is returned if the header value is
+// not an ETag generated by either.
+func getIfMatch(r *http.Request) (time.Time, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get(keyIfMatch))
+	if ifMatch == "" || ifMatch == "*" {
+		return time.Time{}, nil
+	}
+	if len(ifMatch) < 2 || !strings.HasPrefix(ifMatch, `"`) || !strings.HasSuffix(ifMatch, `"`) {
+		return time.Time{}, errors.NewClientf("invalid %s value, expected a"+
+			" single strong ETag", keyIfMatch)
+	}
+	version := strings.SplitN(strings.Trim(ifMatch, `"`), "-", 2)[0]
+	nanos, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.NewClientf("invalid %s ETag: %v", keyIfMatch, err)
+	}
+	return time.Unix(0, nanos), nil
+}
+
 /**
  * @apiDefine OffsetCount
  *
@@ -516,6 +2825,74 @@ func getOffset(r url.Values) (int64, error) {
 	return offset, nil
 }
 
+// getBool extracts the boolean value of key from r or returns false if not
+// found. An error is returned if the value is not a valid boolean.
+func getBool(r url.Values, key string) (bool, error) {
+	valStr := r.Get(key)
+	if valStr == "" {
+		return false, nil
+	}
+	val, err := strconv.ParseBool(valStr)
+	if err != nil {
+		return false, errors.NewClientf("invalid %s provided: %v", key, err)
+	}
+	return val, nil
+}
+
+// getSort converts a comma separated list of fields e.g. "-rating,name" into
+// crdb.ColOrders. A field prefixed with "-" is ordered in descending order.
+// nil is returned if sortStr is empty.
+func getSort(sortStr string) *crdb.ColOrders {
+	if sortStr == "" {
+		return nil
+	}
+	co := &crdb.ColOrders{}
+	for _, field := range strings.Split(sortStr, ",") {
+		order := crdb.OrderAsc
+		if strings.HasPrefix(field, "-") {
+			order = crdb.OrderDesc
+			field = strings.TrimPrefix(field, "-")
+		}
+		co.Cols = append(co.Cols, field)
+		co.Orders = append(co.Orders, order)
+	}
+	return co
+}
+
+// getRange converts from and to into >= and <= comparisons respectively
+// using parse to convert the values. Empty values are skipped.
+func getRange(from, to string, parse func(string) (interface{}, error)) ([]crdb.Comparison, error) {
+	var cs []crdb.Comparison
+	ops := []string{crdb.OpGTOrET, crdb.OpLTOrET}
+	for i, valStr := range []string{from, to} {
+		if valStr == "" {
+			continue
+		}
+		val, err := parse(valStr)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, crdb.Comparison{Op: ops[i], Val: val})
+	}
+	return cs, nil
+}
+
+func parseFloat(valStr string) (interface{}, error) {
+	val, err := strconv.ParseFloat(valStr, 32)
+	if err != nil {
+		return nil, errors.NewClientf("invalid number '%s': %v", valStr, err)
+	}
+	return val, nil
+}
+
+func parseTime(valStr string) (interface{}, error) {
+	val, err := time.Parse(time.RFC3339, valStr)
+	if err != nil {
+		return nil, errors.NewClientf("invalid ISO8601 date '%s': %v", valStr, err)
+	}
+	return val, nil
+}
+
 // getCount extracts count from r or returns 10 if not found. An error is
 // returned if the offset in r is not a valid int32.
 func getCount(r url.Values) (int32, error) {
@@ -5,9 +5,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/events"
+	"github.com/tomogoma/usersms/pkg/feed"
 	"github.com/tomogoma/usersms/pkg/mocks"
+	"github.com/tomogoma/usersms/pkg/user"
 )
 
 func TestNewHandler(t *testing.T) {
@@ -23,6 +27,8 @@ func TestNewHandler(t *testing.T) {
 				Logger:       &mocks.Logger{},
 				Rater:        &mocks.Rater{},
 				UserProfiler: &mocks.User{},
+				Avatars:      &mocks.Avatar{},
+				Streams:      &mocks.Streams{},
 			},
 			expErr: false,
 		},
@@ -33,6 +39,8 @@ func TestNewHandler(t *testing.T) {
 				Logger: &mocks.Logger{},
 				Rater:        &mocks.Rater{},
 				UserProfiler: &mocks.User{},
+				Avatars:      &mocks.Avatar{},
+				Streams:      &mocks.Streams{},
 			},
 			expErr: false,
 		},
@@ -43,6 +51,8 @@ func TestNewHandler(t *testing.T) {
 				Logger: &mocks.Logger{},
 				Rater:        &mocks.Rater{},
 				UserProfiler: &mocks.User{},
+				Avatars:      &mocks.Avatar{},
+				Streams:      &mocks.Streams{},
 			},
 			expErr: true,
 		},
@@ -53,6 +63,8 @@ func TestNewHandler(t *testing.T) {
 				Logger: nil,
 				Rater:        &mocks.Rater{},
 				UserProfiler: &mocks.User{},
+				Avatars:      &mocks.Avatar{},
+				Streams:      &mocks.Streams{},
 			},
 			expErr: true,
 		},
@@ -63,6 +75,8 @@ func TestNewHandler(t *testing.T) {
 				Logger:       &mocks.Logger{},
 				Rater:        nil,
 				UserProfiler: &mocks.User{},
+				Avatars:      &mocks.Avatar{},
+				Streams:      &mocks.Streams{},
 			},
 			expErr: true,
 		},
@@ -73,6 +87,32 @@ func TestNewHandler(t *testing.T) {
 				Logger:       &mocks.Logger{},
 				Rater:        &mocks.Rater{},
 				UserProfiler: nil,
+				Avatars:      &mocks.Avatar{},
+				Streams:      &mocks.Streams{},
+			},
+			expErr: true,
+		},
+		{
+			name: "nil Streams",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				Logger:       &mocks.Logger{},
+				Rater:        &mocks.Rater{},
+				UserProfiler: &mocks.User{},
+				Avatars:      &mocks.Avatar{},
+				Streams:      nil,
+			},
+			expErr: true,
+		},
+		{
+			name: "nil Avatars",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				Logger:       &mocks.Logger{},
+				Rater:        &mocks.Rater{},
+				UserProfiler: &mocks.User{},
+				Avatars:      nil,
+				Streams:      &mocks.Streams{},
 			},
 			expErr: true,
 		},
@@ -102,6 +142,7 @@ func TestHandler_handleRoute(t *testing.T) {
 		reqURLSuffix  string
 		reqMethod     string
 		reqBody       string
+		reqHeader     http.Header
 		reqWBasicAuth bool
 		expStatusCode int
 		conf          Config
@@ -122,6 +163,659 @@ func TestHandler_handleRoute(t *testing.T) {
 			reqMethod:     http.MethodGet,
 			expStatusCode: http.StatusInternalServerError,
 		},
+		{
+			name:          "update user",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123",
+			reqMethod:     http.MethodPut,
+			reqBody:       `{"name": "Jane", "country": "UG", "locale": "en-UG", "timezone": "Africa/Kampala", "ICEPhone": "0772123456", "phoneRegion": "UG", "attributes": {"language": "sw", "plate": null}, "privacy": {"ICEPhone": "private"}}`,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "update user if match",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123",
+			reqMethod:     http.MethodPut,
+			reqBody:       `{"name": "Jane"}`,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}, "If-Match": {`"1514764800000000000"`}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "update user invalid if match",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123",
+			reqMethod:     http.MethodPut,
+			reqBody:       `{"name": "Jane"}`,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}, "If-Match": {"W/\"1514764800000000000\""}},
+			expStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:          "get users",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users?ids=a,b,c",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "get users manager error",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{UsrsErr: errors.NewClient("too many IDs")},
+			},
+			reqURLSuffix:  "/users?ids=a,b,c",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:          "search users",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users?namePrefix=jo&sort=-rating,name&minRating=3&createdFrom=2018-01-01T00:00:00Z",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "search users bad rating",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users?minRating=high",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:          "search users by completeness",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users?minCompleteness=50&maxCompleteness=80",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "search users bad completeness",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users?minCompleteness=half",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:          "user history",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/history?offset=10&count=5",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "user history no token",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/history",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name: "export user",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{ExprtExprt: &user.Export{}},
+			},
+			reqURLSuffix:  "/users/123/export",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "export user not found",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{ExprtErr: errors.NewNotFound("user not found")},
+			},
+			reqURLSuffix:  "/users/123/export",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "deactivate user",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/deactivate",
+			reqMethod:     http.MethodPost,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "reactivate user",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/reactivate",
+			reqMethod:     http.MethodPost,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "erase user forbidden",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{ErsErr: errors.NewForbidden("not owner")},
+			},
+			reqURLSuffix:  "/users/123",
+			reqMethod:     http.MethodDelete,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusForbidden,
+		},
+		{
+			name:         "upload avatar",
+			conf:         Config{Guard: &mocks.Guard{}},
+			reqURLSuffix: "/users/123/avatar",
+			reqMethod:    http.MethodPost,
+			reqBody: "--xxx\r\n" +
+				"Content-Disposition: form-data; name=\"avatar\"; filename=\"me.png\"\r\n" +
+				"Content-Type: image/png\r\n\r\n" +
+				"some image bytes\r\n" +
+				"--xxx--\r\n",
+			reqHeader: http.Header{
+				"Authorization": {"Bearer some.jwt"},
+				"Content-Type":  {"multipart/form-data; boundary=xxx"},
+			},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "upload avatar not multipart",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/avatar",
+			reqMethod:     http.MethodPost,
+			reqBody:       `{"avatar": "some image bytes"}`,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "get avatar without API key",
+			conf: Config{
+				Guard:   &mocks.Guard{ExpAPIKValidErr: errors.NewUnauthorized("no API key")},
+				Avatars: &mocks.Avatar{AvtrImg: []byte("some image bytes")},
+			},
+			reqURLSuffix:  "/users/123/avatar?size=128",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "get avatar with JWT",
+			conf: Config{
+				Guard:   &mocks.Guard{ExpAPIKValidErr: errors.NewUnauthorized("no API key")},
+				Avatars: &mocks.Avatar{AvtrImg: []byte("some image bytes")},
+			},
+			reqURLSuffix:  "/users/123/avatar",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "get avatar not found",
+			conf: Config{
+				Guard:   &mocks.Guard{},
+				Avatars: &mocks.Avatar{AvtrErr: errors.NewNotFound("avatar not found")},
+			},
+			reqURLSuffix:  "/users/123/avatar",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "get ICE contacts",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/ice-contacts",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "add ICE contact",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/ice-contacts",
+			reqMethod:     http.MethodPost,
+			reqBody:       `{"name": "John", "relationship": "brother", "phone": "+254712345678"}`,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name: "add ICE contact limit reached",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{AddICECntctErr: errors.NewClient("at most 3 contacts")},
+			},
+			reqURLSuffix:  "/users/123/ice-contacts",
+			reqMethod:     http.MethodPost,
+			reqBody:       `{"name": "John", "phone": "+254712345678"}`,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:          "update ICE contact",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/ice-contacts/1",
+			reqMethod:     http.MethodPut,
+			reqBody:       `{"name": "John", "phone": "+254712345678", "priority": 1}`,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "delete ICE contact",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/ice-contacts/1",
+			reqMethod:     http.MethodDelete,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "update user handle taken",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{UpdtErr: errors.NewConflict("handle is already taken")},
+			},
+			reqURLSuffix:  "/users/123",
+			reqMethod:     http.MethodPut,
+			reqBody:       `{"handle": "jane_doe"}`,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusConflict,
+		},
+		{
+			name: "get user by handle",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{UsrByHndlUsr: &user.User{ID: "123", Handle: "jane_doe"}},
+			},
+			reqURLSuffix:  "/users/by-handle/Jane_Doe",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "get user by handle not found",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{UsrByHndlErr: errors.NewNotFound("user not found")},
+			},
+			reqURLSuffix:  "/users/by-handle/jane_doe",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "verify email",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/email/verify",
+			reqMethod:     http.MethodPost,
+			reqBody:       `{"verificationToken": "some.jwt"}`,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "verify email bad token",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{VrfyEmlErr: errors.NewForbidden("token not valid for user")},
+			},
+			reqURLSuffix:  "/users/123/email/verify",
+			reqMethod:     http.MethodPost,
+			reqBody:       `{"verificationToken": "some.jwt"}`,
+			expStatusCode: http.StatusForbidden,
+		},
+		{
+			name:          "verify ICEPhone",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/ICEPhone/verify",
+			reqMethod:     http.MethodPost,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			reqBody:       `{"code": "123456"}`,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "verify ICEPhone incorrect code",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{VrfyICEPhnErr: errors.NewForbidden("incorrect code")},
+			},
+			reqURLSuffix:  "/users/123/ICEPhone/verify",
+			reqMethod:     http.MethodPost,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			reqBody:       `{"code": "654321"}`,
+			expStatusCode: http.StatusForbidden,
+		},
+		{
+			name:          "get blocks",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/blocks",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "block user",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/blocks",
+			reqMethod:     http.MethodPost,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			reqBody:       `{"blockedUserID": "456"}`,
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name: "block self",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{BlkErr: errors.NewClient("a user cannot block themselves")},
+			},
+			reqURLSuffix:  "/users/123/blocks",
+			reqMethod:     http.MethodPost,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			reqBody:       `{"blockedUserID": "123"}`,
+			expStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:          "unblock user",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/blocks/456",
+			reqMethod:     http.MethodDelete,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "unblock user not blocked",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{UnblkErr: errors.NewNotFound("user is not blocked")},
+			},
+			reqURLSuffix:  "/users/123/blocks/456",
+			reqMethod:     http.MethodDelete,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name: "get genders",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{GndrsGndrs: []user.Gender{{Value: "FEMALE", Label: "Female"}}},
+			},
+			reqURLSuffix:  "/meta/genders",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "merge patch user",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{UsrUsr: &user.User{ID: "123", Name: "Jane"}},
+			},
+			reqURLSuffix: "/users/123",
+			reqMethod:    http.MethodPatch,
+			reqHeader: http.Header{
+				"Authorization": {"Bearer some.jwt"},
+				"Content-Type":  {"application/merge-patch+json"},
+			},
+			reqBody:       `{"name": "Janet", "bio": null}`,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "json patch user failed test",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{UsrUsr: &user.User{ID: "123", Name: "Jane"}},
+			},
+			reqURLSuffix: "/users/123",
+			reqMethod:    http.MethodPatch,
+			reqHeader: http.Header{
+				"Authorization": {"Bearer some.jwt"},
+				"Content-Type":  {"application/json-patch+json"},
+			},
+			reqBody:       `[{"op": "test", "path": "/name", "value": "John"}]`,
+			expStatusCode: http.StatusConflict,
+		},
+		{
+			name:         "patch user unsupported content type",
+			conf:         Config{Guard: &mocks.Guard{}},
+			reqURLSuffix: "/users/123",
+			reqMethod:    http.MethodPatch,
+			reqHeader: http.Header{
+				"Authorization": {"Bearer some.jwt"},
+				"Content-Type":  {"application/json"},
+			},
+			reqBody:       `{"name": "Janet"}`,
+			expStatusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "get user not modified since",
+			conf: Config{
+				Guard: &mocks.Guard{},
+				UserProfiler: &mocks.User{UsrUsr: &user.User{ID: "123",
+					LastUpdated: time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)}},
+			},
+			reqURLSuffix:  "/users/123",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"If-Modified-Since": {"Wed, 03 Jan 2018 00:00:00 GMT"}},
+			expStatusCode: http.StatusNotModified,
+		},
+		{
+			name: "get user modified since",
+			conf: Config{
+				Guard: &mocks.Guard{},
+				UserProfiler: &mocks.User{UsrUsr: &user.User{ID: "123",
+					LastUpdated: time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)}},
+			},
+			reqURLSuffix:  "/users/123",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"If-Modified-Since": {"Mon, 01 Jan 2018 00:00:00 GMT"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "get followers",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/followers?offset=0&count=10",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "get following",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/following",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "follow user",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/following",
+			reqMethod:     http.MethodPost,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			reqBody:       `{"followedUserID": "456"}`,
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name: "follow blocked user",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{FlwErr: errors.NewForbidden("cannot follow a blocked user")},
+			},
+			reqURLSuffix:  "/users/123/following",
+			reqMethod:     http.MethodPost,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			reqBody:       `{"followedUserID": "456"}`,
+			expStatusCode: http.StatusForbidden,
+		},
+		{
+			name:          "unfollow user",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/following/456",
+			reqMethod:     http.MethodDelete,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "get connections",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/connections?status=pending",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "get connections no token",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/connections",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:          "request connection",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/connections",
+			reqMethod:     http.MethodPost,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			reqBody:       `{"connectedUserID": "456"}`,
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name:          "accept connection",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/connections/456/accept",
+			reqMethod:     http.MethodPost,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "accept connection not requested",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{AccConnErr: errors.NewNotFound("no connection request found")},
+			},
+			reqURLSuffix:  "/users/123/connections/456/accept",
+			reqMethod:     http.MethodPost,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "remove connection",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/connections/456",
+			reqMethod:     http.MethodDelete,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "get user moderations",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/users/123/moderations",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "get moderation queue",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/moderations?status=pending&offset=0&count=10",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "get moderation queue not staff",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{ModQErr: errors.NewForbidden("not staff")},
+			},
+			reqURLSuffix:  "/moderations",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusForbidden,
+		},
+		{
+			name: "approve moderation",
+			conf: Config{
+				Guard: &mocks.Guard{},
+				UserProfiler: &mocks.User{AprvModMod: &user.Moderation{
+					ID: "1", Field: user.FieldBio, Status: user.ModerationApproved}},
+			},
+			reqURLSuffix:  "/moderations/1/approve",
+			reqMethod:     http.MethodPost,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "reject moderation not pending",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{RejModErr: errors.NewNotFound("pending moderation not found")},
+			},
+			reqURLSuffix:  "/moderations/1/reject",
+			reqMethod:     http.MethodPost,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name: "merge user",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{MrgUsr: &user.User{ID: "123"}},
+			},
+			reqURLSuffix:  "/users/123/merge",
+			reqMethod:     http.MethodPost,
+			reqBody:       `{"duplicateUserID":"456","strategy":"latest"}`,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "merge user invalid strategy",
+			conf: Config{
+				Guard:        &mocks.Guard{},
+				UserProfiler: &mocks.User{MrgErr: errors.NewClient("invalid strategy")},
+			},
+			reqURLSuffix:  "/users/123/merge",
+			reqMethod:     http.MethodPost,
+			reqBody:       `{"duplicateUserID":"456","strategy":"newest"}`,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "stream user",
+			conf: Config{
+				Guard: &mocks.Guard{},
+				Streams: &mocks.Streams{UsrChs: []feed.Change{
+					{ID: "2", Topic: events.TopicUserUpdated, Data: &user.User{ID: "123"}},
+				}, UsrChsLastID: "2"},
+			},
+			reqURLSuffix:  "/stream/users/123",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}, "Last-Event-ID": {"1"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "stream user no token",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/stream/users/123",
+			reqMethod:     http.MethodGet,
+			expStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name: "stream user not found",
+			conf: Config{
+				Guard:   &mocks.Guard{},
+				Streams: &mocks.Streams{UsrChsErr: errors.NewNotFound("user not found")},
+			},
+			reqURLSuffix:  "/stream/users/123",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "stream changes",
+			conf:          Config{Guard: &mocks.Guard{}},
+			reqURLSuffix:  "/stream/changes",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "stream changes invalid last event ID",
+			conf: Config{
+				Guard:   &mocks.Guard{},
+				Streams: &mocks.Streams{ChsErr: errors.NewClient("invalid change ID")},
+			},
+			reqURLSuffix:  "/stream/changes",
+			reqMethod:     http.MethodGet,
+			reqHeader:     http.Header{"Authorization": {"Bearer some.jwt"}, "Last-Event-ID": {"abc"}},
+			expStatusCode: http.StatusBadRequest,
+		},
 		{
 			name:          "not found",
 			conf:          Config{Guard: &mocks.Guard{}},
@@ -135,8 +829,19 @@ func TestHandler_handleRoute(t *testing.T) {
 
 			lg := &mocks.Logger{}
 			tc.conf.Logger = lg
-			tc.conf.Rater = &mocks.Rater{}
-			tc.conf.UserProfiler = &mocks.User{}
+			if tc.conf.Rater == nil {
+				tc.conf.Rater = &mocks.Rater{}
+			}
+			if tc.conf.UserProfiler == nil {
+				tc.conf.UserProfiler = &mocks.User{}
+			}
+			if tc.conf.Avatars == nil {
+				tc.conf.Avatars = &mocks.Avatar{}
+			}
+			if tc.conf.Streams == nil {
+				tc.conf.Streams = &mocks.Streams{}
+			}
+			tc.conf.StreamInterval = time.Millisecond
 			h := newHandler(t, tc.conf)
 			srvr := httptest.NewServer(h)
 			defer srvr.Close()
@@ -149,6 +854,11 @@ func TestHandler_handleRoute(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Error setting up: new request: %v", err)
 			}
+			for k, vs := range tc.reqHeader {
+				for _, v := range vs {
+					req.Header.Add(k, v)
+				}
+			}
 			if tc.reqWBasicAuth {
 				req.SetBasicAuth("username", "password")
 			}
@@ -169,6 +879,70 @@ func TestHandler_handleRoute(t *testing.T) {
 	}
 }
 
+func TestGetIfMatch(t *testing.T) {
+	usr := &user.User{LastUpdated: time.Date(2018, 1, 2, 3, 4, 5, 678900000, time.UTC)}
+	r := httptest.NewRequest(http.MethodPut, "/users/123", nil)
+	r.Header.Set("If-Match", userETag(usr))
+	got, err := getIfMatch(r)
+	if err != nil {
+		t.Fatalf("getIfMatch(): %v", err)
+	}
+	if !got.Equal(usr.LastUpdated) {
+		t.Errorf("Expected %v, got %v", usr.LastUpdated, got)
+	}
+}
+
+func TestGetIfMatch_representationETag(t *testing.T) {
+	usr := &user.User{LastUpdated: time.Date(2018, 1, 2, 3, 4, 5, 678900000, time.UTC)}
+	r := httptest.NewRequest(http.MethodPut, "/users/123", nil)
+	r.Header.Set("If-Match", representationETag(usr, []byte(`{"ID":"123"}`)))
+	got, err := getIfMatch(r)
+	if err != nil {
+		t.Fatalf("getIfMatch(): %v", err)
+	}
+	if !got.Equal(usr.LastUpdated) {
+		t.Errorf("Expected %v, got %v", usr.LastUpdated, got)
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	lastUpdated := time.Date(2018, 1, 2, 3, 4, 5, 678900000, time.UTC)
+	ETag := representationETag(&user.User{LastUpdated: lastUpdated}, []byte(`{"ID":"123"}`))
+	otherETag := representationETag(&user.User{LastUpdated: lastUpdated}, []byte(`{}`))
+	tt := []struct {
+		name   string
+		header http.Header
+		exp    bool
+	}{
+		{name: "no conditions", header: http.Header{}, exp: false},
+		{name: "matching ETag", header: http.Header{"If-None-Match": {ETag}}, exp: true},
+		{name: "weak matching ETag", header: http.Header{"If-None-Match": {"W/" + ETag}}, exp: true},
+		{name: "ETag in list", header: http.Header{"If-None-Match": {otherETag + ", " + ETag}}, exp: true},
+		{name: "wildcard", header: http.Header{"If-None-Match": {"*"}}, exp: true},
+		{name: "other projection ETag", header: http.Header{"If-None-Match": {otherETag}}, exp: false},
+		{
+			name: "ETag takes precedence over date",
+			header: http.Header{
+				"If-None-Match":     {otherETag},
+				"If-Modified-Since": {lastUpdated.Format(http.TimeFormat)},
+			},
+			exp: false,
+		},
+		{name: "same second", header: http.Header{"If-Modified-Since": {lastUpdated.Format(http.TimeFormat)}}, exp: true},
+		{name: "modified since", header: http.Header{"If-Modified-Since": {lastUpdated.Add(-time.Second).Format(http.TimeFormat)}}, exp: false},
+		{name: "invalid date", header: http.Header{"If-Modified-Since": {"yesterday"}}, exp: false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/users/123", nil)
+			r.Header = tc.header
+			if act := notModified(r, ETag, lastUpdated); act != tc.exp {
+				t.Errorf("Expected %t, got %t", tc.exp, act)
+			}
+		})
+	}
+}
+
 func newHandler(t *testing.T, conf Config) http.Handler {
 	h, err := NewHandler(conf)
 	if err != nil {
@@ -0,0 +1,427 @@
+package http
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+// Content types of PATCH request bodies.
+const (
+	contentTypeMergePatch = "application/merge-patch+json"
+	contentTypeJSONPatch  = "application/json-patch+json"
+)
+
+// Names of the members of the patchable user document (see userPatchDoc).
+const (
+	patchKeyAttributes = "attributes"
+	patchKeyPrivacy    = "privacy"
+)
+
+// patchableStrings are the string members of the patchable user document.
+var patchableStrings = []string{"handle", "name", "ICEPhone", "gender",
+	"avatarURL", "bio", "country", "locale", "timezone", "email"}
+
+// patchOp is a single RFC 6902 JSON Patch operation.
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// userPatchDoc returns the JSON document of the patchable values of u to
+// which PATCH requests are applied. All members are always present so that
+// they can be tested and replaced.
+func userPatchDoc(u *user.User) (map[string]interface{}, error) {
+	doc := map[string]interface{}{
+		"handle":    u.Handle,
+		"name":      u.Name,
+		"ICEPhone":  u.ICEPhone,
+		"gender":    u.Gender,
+		"avatarURL": u.AvatarURL,
+		"bio":       u.Bio,
+		"country":   u.Country,
+		"locale":    u.Locale,
+		"timezone":  u.Timezone,
+		"email":     u.Email,
+	}
+	if u.Attributes == nil {
+		doc[patchKeyAttributes] = map[string]interface{}{}
+	} else {
+		doc[patchKeyAttributes] = u.Attributes
+	}
+	if u.Privacy == nil {
+		doc[patchKeyPrivacy] = map[string]string{}
+	} else {
+		doc[patchKeyPrivacy] = u.Privacy
+	}
+	// Round trip through JSON so that the document only contains the
+	// generic types produced by json.Unmarshal.
+	docB, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(docB, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// applyMergePatch applies the RFC 7396 JSON Merge Patch in patchB to doc.
+func applyMergePatch(doc map[string]interface{}, patchB []byte) (map[string]interface{}, error) {
+	var patch interface{}
+	if err := json.Unmarshal(patchB, &patch); err != nil {
+		return nil, errors.NewClientf("invalid merge patch: %v", err)
+	}
+	if _, ok := patch.(map[string]interface{}); !ok {
+		return nil, errors.NewClient("a merge patch must be a JSON object")
+	}
+	return mergePatch(doc, patch).(map[string]interface{}), nil
+}
+
+// mergePatch is the MergePatch function of RFC 7396.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for name, value := range patchObj {
+		if value == nil {
+			delete(targetObj, name)
+			continue
+		}
+		targetObj[name] = mergePatch(targetObj[name], value)
+	}
+	return targetObj
+}
+
+// applyJSONPatch applies the RFC 6902 JSON Patch in patchB to doc. A
+// ConflictError is returned if a test operation fails.
+func applyJSONPatch(doc map[string]interface{}, patchB []byte) (map[string]interface{}, error) {
+	var ops []patchOp
+	if err := json.Unmarshal(patchB, &ops); err != nil {
+		return nil, errors.NewClientf("invalid JSON patch: %v", err)
+	}
+
+	var res interface{} = doc
+	for i, op := range ops {
+		var err error
+		if res, err = op.apply(res); err != nil {
+			if tErr, ok := err.(errors.Error); ok && tErr.Conflict() {
+				return nil, errors.NewConflictf("operation %d: %v", i, err)
+			}
+			return nil, errors.NewClientf("operation %d: %v", i, err)
+		}
+	}
+
+	resObj, ok := res.(map[string]interface{})
+	if !ok {
+		return nil, errors.NewClient("the patched document must be a JSON object")
+	}
+	return resObj, nil
+}
+
+// apply applies op to doc and returns the resulting document.
+func (op patchOp) apply(doc interface{}) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, errors.Newf("%s requires a value", op.Op)
+		}
+		var val interface{}
+		if err := json.Unmarshal(op.Value, &val); err != nil {
+			return nil, errors.Newf("invalid value: %v", err)
+		}
+		switch op.Op {
+		case "add":
+			return pointerAdd(doc, path, val)
+		case "replace":
+			if _, err := pointerGet(doc, path); err != nil {
+				return nil, err
+			}
+			if doc, err = pointerRemove(doc, path); err != nil {
+				return nil, err
+			}
+			return pointerAdd(doc, path, val)
+		default:
+			actual, err := pointerGet(doc, path)
+			if err != nil {
+				return nil, errors.NewConflict(err.Error())
+			}
+			if !reflect.DeepEqual(actual, val) {
+				return nil, errors.NewConflictf("test failed for '%s'", op.Path)
+			}
+			return doc, nil
+		}
+	case "remove":
+		return pointerRemove(doc, path)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		val, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, errors.New("cannot move a value into itself")
+			}
+			if doc, err = pointerRemove(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			// Deep copy so that later operations do not alter the source.
+			valB, _ := json.Marshal(val)
+			json.Unmarshal(valB, &val)
+		}
+		return pointerAdd(doc, path, val)
+	default:
+		return nil, errors.Newf("unknown op '%s'", op.Op)
+	}
+}
+
+// parsePointer splits the RFC 6901 JSON Pointer p into its unescaped
+// reference tokens.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, errors.Newf("invalid path '%s'", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// pointerGet returns the value in doc referenced by path.
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]interface{}:
+			val, ok := container[token]
+			if !ok {
+				return nil, errors.Newf("path member '%s' not found", token)
+			}
+			doc = val
+		case []interface{}:
+			i, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[i]
+		default:
+			return nil, errors.Newf("path member '%s' not found", token)
+		}
+	}
+	return doc, nil
+}
+
+// pointerAdd adds val to doc at path as per the RFC 6902 add operation and
+// returns the resulting document.
+func pointerAdd(doc interface{}, path []string, val interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return val, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		container[token] = val
+		return doc, nil
+	case []interface{}:
+		i := len(container)
+		if token != "-" {
+			if i, err = arrayIndex(token, len(container)); err != nil {
+				return nil, err
+			}
+		}
+		container = append(container, nil)
+		copy(container[i+1:], container[i:])
+		container[i] = val
+		return pointerSet(doc, path[:len(path)-1], container)
+	default:
+		return nil, errors.Newf("cannot add member '%s' to a non container", token)
+	}
+}
+
+// pointerRemove removes the value in doc at path and returns the resulting
+// document.
+func pointerRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := container[token]; !ok {
+			return nil, errors.Newf("path member '%s' not found", token)
+		}
+		delete(container, token)
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+		container = append(container[:i], container[i+1:]...)
+		return pointerSet(doc, path[:len(path)-1], container)
+	default:
+		return nil, errors.Newf("path member '%s' not found", token)
+	}
+}
+
+// pointerSet replaces the value in doc at the existing path with val. It is
+// used to store arrays whose length has changed.
+func pointerSet(doc interface{}, path []string, val interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return val, nil
+	}
+	if _, err := pointerRemove(doc, path); err != nil {
+		return nil, err
+	}
+	return pointerAdd(doc, path, val)
+}
+
+// arrayIndex parses token as an array index no greater than max.
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, errors.Newf("invalid array index '%s'", token)
+	}
+	if i > max {
+		return 0, errors.Newf("array index %d out of bounds", i)
+	}
+	return i, nil
+}
+
+// patchedUserUpdate compares the patched user document with the original
+// (see userPatchDoc) and returns the resulting update of the user with
+// userID. Members that were removed are cleared.
+func patchedUserUpdate(userID string, original, patched map[string]interface{}) (user.UserUpdate, error) {
+
+	for key := range patched {
+		if key == patchKeyAttributes || key == patchKeyPrivacy {
+			continue
+		}
+		if _, ok := original[key]; !ok {
+			return user.UserUpdate{}, errors.NewClientf("unknown or"+
+				" read-only field '%s'", key)
+		}
+	}
+
+	strUpdts := make(map[string]user.StringUpdate, len(patchableStrings))
+	for _, key := range patchableStrings {
+		newVal, err := patchedString(key, patched[key])
+		if err != nil {
+			return user.UserUpdate{}, err
+		}
+		if newVal != original[key] {
+			strUpdts[key] = user.StringUpdate{IsUpdating: true, NewValue: newVal}
+		}
+	}
+
+	origAttrs, _ := original[patchKeyAttributes].(map[string]interface{})
+	newAttrs, ok := patched[patchKeyAttributes].(map[string]interface{})
+	if !ok && patched[patchKeyAttributes] != nil {
+		return user.UserUpdate{}, errors.NewClient("attributes must be an object")
+	}
+	var attrs map[string]interface{}
+	for name, val := range newAttrs {
+		if origVal, ok := origAttrs[name]; !ok || !reflect.DeepEqual(origVal, val) {
+			if attrs == nil {
+				attrs = make(map[string]interface{})
+			}
+			attrs[name] = val
+		}
+	}
+	for name := range origAttrs {
+		if _, ok := newAttrs[name]; !ok {
+			if attrs == nil {
+				attrs = make(map[string]interface{})
+			}
+			attrs[name] = nil
+		}
+	}
+
+	origPrivacy, _ := original[patchKeyPrivacy].(map[string]interface{})
+	newPrivacy, ok := patched[patchKeyPrivacy].(map[string]interface{})
+	if !ok && patched[patchKeyPrivacy] != nil {
+		return user.UserUpdate{}, errors.NewClient("privacy must be an object")
+	}
+	var privacy user.Privacy
+	for field, val := range newPrivacy {
+		visibility, err := patchedString(patchKeyPrivacy+"/"+field, val)
+		if err != nil {
+			return user.UserUpdate{}, err
+		}
+		if visibility != origPrivacy[field] {
+			if privacy == nil {
+				privacy = make(user.Privacy)
+			}
+			privacy[field] = visibility
+		}
+	}
+	for field := range origPrivacy {
+		if _, ok := newPrivacy[field]; !ok {
+			if privacy == nil {
+				privacy = make(user.Privacy)
+			}
+			privacy[field] = ""
+		}
+	}
+
+	return user.UserUpdate{
+		UserID:     userID,
+		Handle:     strUpdts["handle"],
+		Name:       strUpdts["name"],
+		ICEPhone:   strUpdts["ICEPhone"],
+		Gender:     strUpdts["gender"],
+		AvatarURL:  strUpdts["avatarURL"],
+		Bio:        strUpdts["bio"],
+		Country:    strUpdts["country"],
+		Locale:     strUpdts["locale"],
+		Timezone:   strUpdts["timezone"],
+		Email:      strUpdts["email"],
+		Attributes: attrs,
+		Privacy:    privacy,
+	}, nil
+}
+
+// patchedString returns the string value of the patched member named key. A
+// removed or null member is an empty string.
+func patchedString(key string, val interface{}) (string, error) {
+	if val == nil {
+		return "", nil
+	}
+	str, ok := val.(string)
+	if !ok {
+		return "", errors.NewClientf("%s must be a string", key)
+	}
+	return str, nil
+}
@@ -0,0 +1,179 @@
+package http
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+func TestPatchUser(t *testing.T) {
+	current := &user.User{
+		Name:       "Jane",
+		Bio:        "Rider",
+		Attributes: map[string]interface{}{"language": "sw", "plate": "KAA 123A"},
+		Privacy:    user.Privacy{user.FieldICEPhone: "private"},
+	}
+	tt := []struct {
+		name        string
+		jsonPatch   bool
+		patch       string
+		expUpdate   user.UserUpdate
+		expClErr    bool
+		expConflict bool
+	}{
+		{
+			name:  "merge patch",
+			patch: `{"name": "Janet", "bio": null, "attributes": {"plate": null, "seats": 4}, "privacy": {"ICEPhone": null, "bio": "private"}}`,
+			expUpdate: user.UserUpdate{
+				UserID:     "123",
+				Name:       user.StringUpdate{IsUpdating: true, NewValue: "Janet"},
+				Bio:        user.StringUpdate{IsUpdating: true, NewValue: ""},
+				Attributes: map[string]interface{}{"plate": nil, "seats": float64(4)},
+				Privacy:    user.Privacy{user.FieldICEPhone: "", user.FieldBio: "private"},
+			},
+		},
+		{
+			name:      "merge patch unchanged values",
+			patch:     `{"name": "Jane", "attributes": {"language": "sw"}}`,
+			expUpdate: user.UserUpdate{UserID: "123"},
+		},
+		{
+			name:     "merge patch read-only field",
+			patch:    `{"rating": 5}`,
+			expClErr: true,
+		},
+		{
+			name:     "merge patch non-string field",
+			patch:    `{"name": 5}`,
+			expClErr: true,
+		},
+		{
+			name:     "merge patch not an object",
+			patch:    `["name"]`,
+			expClErr: true,
+		},
+		{
+			name:      "json patch",
+			jsonPatch: true,
+			patch: `[
+				{"op": "test", "path": "/name", "value": "Jane"},
+				{"op": "replace", "path": "/name", "value": "Janet"},
+				{"op": "remove", "path": "/bio"},
+				{"op": "move", "from": "/attributes/plate", "path": "/attributes/reg"},
+				{"op": "copy", "from": "/name", "path": "/handle"},
+				{"op": "add", "path": "/privacy/bio", "value": "connections"}
+			]`,
+			expUpdate: user.UserUpdate{
+				UserID:     "123",
+				Handle:     user.StringUpdate{IsUpdating: true, NewValue: "Janet"},
+				Name:       user.StringUpdate{IsUpdating: true, NewValue: "Janet"},
+				Bio:        user.StringUpdate{IsUpdating: true, NewValue: ""},
+				Attributes: map[string]interface{}{"plate": nil, "reg": "KAA 123A"},
+				Privacy:    user.Privacy{user.FieldBio: "connections"},
+			},
+		},
+		{
+			name:      "json patch null attribute value",
+			jsonPatch: true,
+			patch:     `[{"op": "add", "path": "/attributes/language", "value": null}]`,
+			expUpdate: user.UserUpdate{
+				UserID:     "123",
+				Attributes: map[string]interface{}{"language": nil},
+			},
+		},
+		{
+			name:        "json patch failed test",
+			jsonPatch:   true,
+			patch:       `[{"op": "test", "path": "/name", "value": "John"}, {"op": "replace", "path": "/name", "value": "Janet"}]`,
+			expConflict: true,
+		},
+		{
+			name:        "json patch test missing member",
+			jsonPatch:   true,
+			patch:       `[{"op": "test", "path": "/attributes/seats", "value": 4}]`,
+			expConflict: true,
+		},
+		{
+			name:      "json patch replace missing member",
+			jsonPatch: true,
+			patch:     `[{"op": "replace", "path": "/attributes/seats", "value": 4}]`,
+			expClErr:  true,
+		},
+		{
+			name:      "json patch missing value",
+			jsonPatch: true,
+			patch:     `[{"op": "add", "path": "/name"}]`,
+			expClErr:  true,
+		},
+		{
+			name:      "json patch unknown op",
+			jsonPatch: true,
+			patch:     `[{"op": "merge", "path": "/name", "value": "Janet"}]`,
+			expClErr:  true,
+		},
+		{
+			name:      "json patch read-only field",
+			jsonPatch: true,
+			patch:     `[{"op": "add", "path": "/ID", "value": "456"}]`,
+			expClErr:  true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			original, err := userPatchDoc(current)
+			if err != nil {
+				t.Fatalf("userPatchDoc(): %v", err)
+			}
+			patched, err := userPatchDoc(current)
+			if err != nil {
+				t.Fatalf("userPatchDoc(): %v", err)
+			}
+			if tc.jsonPatch {
+				patched, err = applyJSONPatch(patched, []byte(tc.patch))
+			} else {
+				patched, err = applyMergePatch(patched, []byte(tc.patch))
+			}
+			var update user.UserUpdate
+			if err == nil {
+				update, err = patchedUserUpdate("123", original, patched)
+			}
+			if tc.expClErr || tc.expConflict {
+				tErr, ok := err.(errors.Error)
+				if !ok {
+					t.Fatalf("Expected a typed error, got %v", err)
+				}
+				if tc.expClErr && !tErr.Client() {
+					t.Errorf("Expected a client error, got %v", err)
+				}
+				if tc.expConflict && !tErr.Conflict() {
+					t.Errorf("Expected a conflict error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if !reflect.DeepEqual(update, tc.expUpdate) {
+				t.Errorf("Expected %+v, got %+v", tc.expUpdate, update)
+			}
+		})
+	}
+}
+
+func TestPointerAdd_array(t *testing.T) {
+	doc := map[string]interface{}{"a": []interface{}{"x", "z"}}
+	res, err := pointerAdd(doc, []string{"a", "1"}, "y")
+	if err != nil {
+		t.Fatalf("pointerAdd(): %v", err)
+	}
+	res, err = pointerAdd(res, []string{"a", "-"}, "end")
+	if err != nil {
+		t.Fatalf("pointerAdd(): %v", err)
+	}
+	exp := map[string]interface{}{"a": []interface{}{"x", "y", "z", "end"}}
+	if !reflect.DeepEqual(res, exp) {
+		t.Errorf("Expected %v, got %v", exp, res)
+	}
+}
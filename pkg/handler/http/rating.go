@@ -12,6 +12,7 @@ import (
  * @apiSuccess (200 JSON Response) {String} ratings.ID Unique identifier of this rating.
  * @apiSuccess (200 JSON Response) {String} ratings.forUserID Ratee' userID.
  * @apiSuccess (200 JSON Response) {String} ratings.byUserID Rater's userID.
+ * @apiSuccess (200 JSON Response) {String} ratings.forSection Section in which ratee was rated.
  * @apiSuccess (200 JSON Response) {String} ratings.comment
  * @apiSuccess (200 JSON Response) {Integer{1-5}} ratings.rating Rating awarded by rater to ratee.
  * @apiSuccess (200 JSON Response) {String} ratings.created ISO8601 date of rating creation.
@@ -21,6 +22,7 @@ type Rating struct {
 	ID          string `json:"ID,omitempty"`
 	ForUserID   string `json:"forUserID,omitempty"`
 	ByUserID    string `json:"byUserID,omitempty"`
+	ForSection  string `json:"forSection,omitempty"`
 	Comment     string `json:"comment,omitempty"`
 	Rating      int32  `json:"rating,omitempty"`
 	Created     string `json:"created,omitempty"`
@@ -35,6 +37,7 @@ func NewRating(r *rating.Rating) *Rating {
 		ID:          r.ID,
 		ForUserID:   r.ForUserID,
 		ByUserID:    r.ByUserID,
+		ForSection:  r.ForSection,
 		Comment:     r.Comment,
 		Rating:      r.Rating,
 		Created:     r.Created.Format(time.RFC3339),
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/feed"
+	"github.com/tomogoma/usersms/pkg/logging"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+// streamKeepAlive is how long a stream may go without writing before a
+// comment is written to keep proxies from closing the connection.
+const streamKeepAlive = 15 * time.Second
+
+// streamOn writes the changes returned by next to w as server-sent events
+// until the client disconnects, next fails or a change on topic endTopic is
+// written. next is called every s.streamInterval with the ID of the last
+// change, starting with lastEventID. An error from the first call is written
+// as the response instead, so a client reconnecting after the stream ends
+// receives the error.
+func (s *handler) streamOn(w http.ResponseWriter, r *http.Request, reqData interface{},
+	lastEventID, endTopic string, next func(afterID string) ([]feed.Change, string, error)) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		handleError(w, r, reqData, errors.New("response writer cannot stream"), s)
+		return
+	}
+
+	chs, lastID, err := next(lastEventID)
+	if err != nil {
+		handleError(w, r, reqData, err, s.streams)
+		return
+	}
+
+	w.Header().Set(keyContentType, "text/event-stream")
+	w.Header().Set(keyCacheControl, "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	log := r.Context().Value(ctxKeyLog).(logging.Logger)
+	ticker := time.NewTicker(s.streamInterval)
+	defer ticker.Stop()
+
+	sentID := lastEventID
+	lastWrite := time.Time{}
+	for {
+		if len(chs) > 0 || lastID != sentID {
+			ended, err := writeChanges(w, chs, lastID, endTopic)
+			if err != nil {
+				log.Warnf("write server-sent events: %v", err)
+				return
+			}
+			if ended {
+				flusher.Flush()
+				return
+			}
+			sentID = lastID
+			lastWrite = time.Now()
+			flusher.Flush()
+		} else if time.Since(lastWrite) >= streamKeepAlive {
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				log.Warnf("write server-sent events keep-alive: %v", err)
+				return
+			}
+			lastWrite = time.Now()
+			flusher.Flush()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		if chs, lastID, err = next(sentID); err != nil {
+			log.Warnf("end stream: %v", err)
+			return
+		}
+	}
+}
+
+// writeChanges writes chs to w as server-sent events followed by an event
+// without data setting the client's last event ID to lastID if chs does not
+// end with it. It returns true if a change on endTopic was written, in which
+// case the changes after it are not written.
+func writeChanges(w io.Writer, chs []feed.Change, lastID, endTopic string) (bool, error) {
+
+	for _, ch := range chs {
+
+		data := ch.Data
+		if usr, ok := data.(*user.User); ok {
+			data = NewUser(usr)
+		}
+		dataB, err := json.Marshal(data)
+		if err != nil {
+			return false, errors.Newf("marshal change %s: %v", ch.ID, err)
+		}
+
+		_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ch.ID, ch.Topic, dataB)
+		if err != nil {
+			return false, err
+		}
+
+		if endTopic != "" && ch.Topic == endTopic {
+			return true, nil
+		}
+	}
+
+	if len(chs) > 0 && chs[len(chs)-1].ID == lastID {
+		return false, nil
+	}
+	_, err := fmt.Fprintf(w, "id: %s\n\n", lastID)
+	return false, err
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/tomogoma/usersms/pkg/events"
+	"github.com/tomogoma/usersms/pkg/feed"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+func TestWriteChanges(t *testing.T) {
+	tt := []struct {
+		name     string
+		chs      []feed.Change
+		lastID   string
+		endTopic string
+		exp      string
+		expEnded bool
+	}{
+		{
+			name: "changes",
+			chs: []feed.Change{
+				{ID: "1", Topic: events.TopicRatingCreated, Data: events.RatingCreated{ID: "r1", Rating: 5}},
+				{ID: "2", Topic: events.TopicUserUpdated, Data: json.RawMessage(`{"userID":"u1"}`)},
+			},
+			lastID: "2",
+			exp: "id: 1\nevent: rating.created\n" +
+				`data: {"ID":"r1","forSection":"","forUserID":"","byUserID":"","rating":5,"created":"0001-01-01T00:00:00Z"}` + "\n\n" +
+				"id: 2\nevent: user.updated\ndata: {\"userID\":\"u1\"}\n\n",
+		},
+		{
+			name: "user",
+			chs: []feed.Change{
+				{ID: "3", Topic: events.TopicUserUpdated, Data: &user.User{ID: "u1", Name: "Jane"}},
+			},
+			lastID: "3",
+			exp:    "id: 3\nevent: user.updated\ndata: " + mustJSON(t, NewUser(&user.User{ID: "u1", Name: "Jane"})) + "\n\n",
+		},
+		{
+			name:   "last ID only",
+			lastID: "7",
+			exp:    "id: 7\n\n",
+		},
+		{
+			name: "last ID after changes",
+			chs: []feed.Change{
+				{ID: "3", Topic: events.TopicUserUpdated, Data: json.RawMessage(`{}`)},
+			},
+			lastID: "5",
+			exp:    "id: 3\nevent: user.updated\ndata: {}\n\nid: 5\n\n",
+		},
+		{
+			name: "ended",
+			chs: []feed.Change{
+				{ID: "4", Topic: events.TopicUserDeleted, Data: events.UserDeleted{UserID: "u1"}},
+				{ID: "5", Topic: events.TopicRatingCreated, Data: events.RatingCreated{}},
+			},
+			lastID:   "5",
+			endTopic: events.TopicUserDeleted,
+			exp: "id: 4\nevent: user.deleted\n" +
+				`data: {"userID":"u1","deleted":"0001-01-01T00:00:00Z"}` + "\n\n",
+			expEnded: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			ended, err := writeChanges(buf, tc.chs, tc.lastID, tc.endTopic)
+			if err != nil {
+				t.Fatalf("writeChanges error: %v", err)
+			}
+			if ended != tc.expEnded {
+				t.Errorf("Expected ended %t, got %t", tc.expEnded, ended)
+			}
+			if buf.String() != tc.exp {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tc.exp, buf.String())
+			}
+		})
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal %+v: %v", v, err)
+	}
+	return string(b)
+}
@@ -1,6 +1,8 @@
 package http
 
 import (
+	"time"
+
 	"github.com/tomogoma/usersms/pkg/user"
 )
 
@@ -8,25 +10,76 @@ import (
  * @apiDefine User200
  *
  * @apiSuccess (200 JSON Response) {String} ID (publicly accessible) User's ID.
- * @apiSuccess (200 JSON Response) {String} name (publicly accessible) name
+ * @apiSuccess (200 JSON Response) {String} [handle] (publicly accessible) User's unique username.
+ * @apiSuccess (200 JSON Response) {String} name (publicly accessible by default) name
  * @apiSuccess (200 JSON Response) {String} ICEPhone User's (In Case of Emergency) phone number.
- * @apiSuccess (200 JSON Response) {String="MALE","FEMALE","OTHER"} gender
- * @apiSuccess (200 JSON Response) {String} avatarURL (publicly accessible) User's profile picture URL.
+ * @apiSuccess (200 JSON Response) {Boolean} [ICEPhoneVerified] Whether the
+ *		ICEPhone has been verified. Provided whenever ICEPhone is.
+ * @apiSuccess (200 JSON Response) {String} gender One of the values listed
+ *		by GetGenders.
+ * @apiSuccess (200 JSON Response) {String} avatarURL (publicly accessible by default) User's profile picture URL.
  * @apiSuccess (200 JSON Response) {String} bio Brief description of user.
+ * @apiSuccess (200 JSON Response) {String} country User's ISO 3166-1 alpha-2 country code.
+ * @apiSuccess (200 JSON Response) {String} locale User's preferred BCP 47 language tag.
+ * @apiSuccess (200 JSON Response) {String} timezone User's IANA time zone name.
+ * @apiSuccess (200 JSON Response) {String} email User's contact email. Only
+ *		provided to other users once verified.
+ * @apiSuccess (200 JSON Response) {Boolean} [emailVerified] Whether the
+ *		email has been verified. Provided whenever email is.
  * @apiSuccess (200 JSON Response) {Float{1-5}} rating Overall rating of user.
+ * @apiSuccess (200 JSON Response) {Integer} numFollowers Number of users following the user.
+ * @apiSuccess (200 JSON Response) {Integer} numFollowing Number of users the user follows.
+ * @apiSuccess (200 JSON Response) {Boolean} [followed] Whether the caller
+ *		follows the user. Only provided to authenticated users other than
+ *		the user when fetching a single profile.
+ * @apiSuccess (200 JSON Response) {Object} attributes Custom attribute values
+ *		keyed by attribute name. Attributes declared public are publicly
+ *		accessible.
+ * @apiSuccess (200 JSON Response) {Object} [completeness] How much of the
+ *		profile has been filled in. Only provided to the user when
+ *		fetching their own profile.
+ * @apiSuccess (200 JSON Response) {Integer{0-100}} completeness.score
+ *		Percentage of the (weighted) profile fields that are filled in.
+ * @apiSuccess (200 JSON Response) {String[]} completeness.missing Names of
+ *		the empty profile fields, most valuable first e.g. ["avatarURL", "bio"].
+ * @apiSuccess (200 JSON Response) {Object} [privacy] Visibility of profile
+ *		fields keyed by field name e.g. {"ICEPhone": "private"}. Only
+ *		provided to the user and staff. Fields not included have their
+ *		default visibility.
+ * @apiSuccess (200 JSON Response) {String[]} [hiddenFields] Names of the
+ *		fields whose values are hidden from other users until staff
+ *		review them (see GetUserModerations). Only provided to the user
+ *		and staff.
+ * @apiSuccess (200 JSON Response) {String} [deactivated] ISO8601 date when the
+ *		profile was deactivated. Only provided for deactivated profiles.
  * @apiSuccess (200 JSON Response) {String} created ISO8601 date of user profile creation.
  * @apiSuccess (200 JSON Response) {String} lastUpdated last ISO8601 date when this profile was updated.
  */
 type User struct {
-	ID          string  `json:"ID,omitempty"`
-	Name        string  `json:"name,omitempty"`
-	ICEPhone    string  `json:"ICEPhone,omitempty"`
-	Gender      string  `json:"gender,omitempty"`
-	AvatarURL   string  `json:"avatarURL,omitempty"`
-	Bio         string  `json:"bio,omitempty"`
-	Rating      float32 `json:"rating,omitempty"`
-	Created     string  `json:"created,omitempty"`
-	LastUpdated string  `json:"lastUpdated,omitempty"`
+	ID               string                 `json:"ID,omitempty"`
+	Handle           string                 `json:"handle,omitempty"`
+	Name             string                 `json:"name,omitempty"`
+	ICEPhone         string                 `json:"ICEPhone,omitempty"`
+	ICEPhoneVerified *bool                  `json:"ICEPhoneVerified,omitempty"`
+	Gender           string                 `json:"gender,omitempty"`
+	AvatarURL        string                 `json:"avatarURL,omitempty"`
+	Bio              string                 `json:"bio,omitempty"`
+	Country          string                 `json:"country,omitempty"`
+	Locale           string                 `json:"locale,omitempty"`
+	Timezone         string                 `json:"timezone,omitempty"`
+	Email            string                 `json:"email,omitempty"`
+	EmailVerified    *bool                  `json:"emailVerified,omitempty"`
+	Rating           float32                `json:"rating,omitempty"`
+	NumFollowers     int64                  `json:"numFollowers"`
+	NumFollowing     int64                  `json:"numFollowing"`
+	Followed         *bool                  `json:"followed,omitempty"`
+	Attributes       map[string]interface{} `json:"attributes,omitempty"`
+	Completeness     *Completeness          `json:"completeness,omitempty"`
+	Privacy          map[string]string      `json:"privacy,omitempty"`
+	HiddenFields     []string               `json:"hiddenFields,omitempty"`
+	Deactivated      string                 `json:"deactivated,omitempty"`
+	Created          string                 `json:"created,omitempty"`
+	LastUpdated      string                 `json:"lastUpdated,omitempty"`
 }
 
 func NewUser(u *user.User) *User {
@@ -34,12 +87,457 @@ func NewUser(u *user.User) *User {
 		return nil
 	}
 	return &User{
-		ID:        u.ID,
-		Name:      u.Name,
-		ICEPhone:  u.ICEPhone,
-		Gender:    u.Gender,
-		AvatarURL: u.AvatarURL,
-		Bio:       u.Bio,
-		Rating:    u.Rating,
+		ID:               u.ID,
+		Handle:           u.Handle,
+		Name:             u.Name,
+		ICEPhone:         u.ICEPhone,
+		ICEPhoneVerified: icePhoneVerified(u),
+		Gender:           u.Gender,
+		AvatarURL:        u.AvatarURL,
+		Bio:              u.Bio,
+		Country:          u.Country,
+		Locale:           u.Locale,
+		Timezone:         u.Timezone,
+		Email:            u.Email,
+		EmailVerified:    emailVerified(u),
+		Rating:           u.Rating,
+		NumFollowers:     u.NumFollowers,
+		NumFollowing:     u.NumFollowing,
+		Followed:         u.Followed,
+		Attributes:       u.Attributes,
+		Completeness:     NewCompleteness(u.Completeness),
+		Privacy:          u.Privacy,
+		HiddenFields:     u.HiddenFields,
+		Deactivated:      formatTime(u.Deactivated),
+		Created:          formatTime(u.Created),
+		LastUpdated:      formatTime(u.LastUpdated),
+	}
+}
+
+type Completeness struct {
+	Score   int32    `json:"score"`
+	Missing []string `json:"missing"`
+}
+
+func NewCompleteness(c *user.Completeness) *Completeness {
+	if c == nil {
+		return nil
+	}
+	return &Completeness{Score: c.Score, Missing: c.Missing}
+}
+
+// emailVerified returns whether u's email is verified or nil if u has no
+// email.
+func emailVerified(u *user.User) *bool {
+	if u.Email == "" {
+		return nil
+	}
+	return &u.EmailVerified
+}
+
+// icePhoneVerified returns whether u's ICEPhone is verified or nil if u has
+// no ICEPhone.
+func icePhoneVerified(u *user.User) *bool {
+	if u.ICEPhone == "" {
+		return nil
+	}
+	return &u.ICEPhoneVerified
+}
+
+// formatTime formats t as an ISO8601 date or returns an empty string if t is
+// zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+/**
+ * @apiDefine UsersList200
+ *
+ * @apiSuccess (200 JSON Response) {Object[]} users List of users (values as per GetUser).
+ */
+
+/**
+ * @apiDefine BulkUsers200
+ *
+ * @apiSuccess (200 JSON Response) {Object[]} users List of users found (values as per GetUser).
+ * @apiSuccess (200 JSON Response) {String[]} missingIDs IDs for which no user was found.
+ */
+type BulkUsers struct {
+	Users      []User   `json:"users,omitempty"`
+	MissingIDs []string `json:"missingIDs,omitempty"`
+}
+
+func NewUsers(us []user.User) []User {
+	if len(us) == 0 {
+		return nil
+	}
+	var retUs []User
+	for _, u := range us {
+		retU := NewUser(&u)
+		retUs = append(retUs, *retU)
+	}
+	return retUs
+}
+
+func NewBulkUsers(us []user.User, missingIDs []string) BulkUsers {
+	return BulkUsers{Users: NewUsers(us), MissingIDs: missingIDs}
+}
+
+/**
+ * @apiDefine UserHistory200
+ *
+ * @apiSuccess (200 JSON Response) {Object[]} changes List of changes (values indented below).
+ * @apiSuccess (200 JSON Response) {String} changes.ID Unique identifier of this change.
+ * @apiSuccess (200 JSON Response) {String} changes.userID ID of the user whose profile changed.
+ * @apiSuccess (200 JSON Response) {String} changes.field Name of the field that changed e.g. ICEPhone.
+ * @apiSuccess (200 JSON Response) {String} changes.oldValue Value before the change.
+ * @apiSuccess (200 JSON Response) {String} changes.newValue Value after the change.
+ * @apiSuccess (200 JSON Response) {String} changes.actorUserID userID of the JWT subject who made the change.
+ * @apiSuccess (200 JSON Response) {Float} changes.actorAccessLevel Access level of the JWT subject who made the change.
+ * @apiSuccess (200 JSON Response) {String} changes.created ISO8601 date of the change.
+ */
+type Change struct {
+	ID               string  `json:"ID,omitempty"`
+	UserID           string  `json:"userID,omitempty"`
+	Field            string  `json:"field,omitempty"`
+	OldValue         string  `json:"oldValue"`
+	NewValue         string  `json:"newValue"`
+	ActorUserID      string  `json:"actorUserID,omitempty"`
+	ActorAccessLevel float32 `json:"actorAccessLevel"`
+	Created          string  `json:"created,omitempty"`
+}
+
+func NewChange(c *user.Change) *Change {
+	if c == nil {
+		return nil
+	}
+	return &Change{
+		ID:               c.ID,
+		UserID:           c.UserID,
+		Field:            c.Field,
+		OldValue:         c.OldValue,
+		NewValue:         c.NewValue,
+		ActorUserID:      c.ActorUserID,
+		ActorAccessLevel: c.ActorAccessLevel,
+		Created:          c.Created.Format(time.RFC3339),
+	}
+}
+
+func NewChanges(cs []user.Change) []Change {
+	if len(cs) == 0 {
+		return nil
+	}
+	var retCs []Change
+	for _, c := range cs {
+		retC := NewChange(&c)
+		retCs = append(retCs, *retC)
+	}
+	return retCs
+}
+
+/**
+ * @apiDefine ICEContact200
+ *
+ * @apiSuccess (200 JSON Response) {String} ID Unique identifier of the contact.
+ * @apiSuccess (200 JSON Response) {String} userID ID of the user the contact belongs to.
+ * @apiSuccess (200 JSON Response) {String} name Name of the contact.
+ * @apiSuccess (200 JSON Response) {String} [relationship] How the contact relates to the user e.g. "spouse".
+ * @apiSuccess (200 JSON Response) {String} phone The contact's phone number.
+ * @apiSuccess (200 JSON Response) {Integer} priority Order in which to reach
+ *		the contact, lowest first. The contact with the lowest priority is
+ *		the user's primary contact whose phone is the user's ICEPhone.
+ * @apiSuccess (200 JSON Response) {String} created ISO8601 date when the contact was added.
+ * @apiSuccess (200 JSON Response) {String} lastUpdated ISO8601 date when the contact was last updated.
+ */
+type ICEContact struct {
+	ID           string `json:"ID,omitempty"`
+	UserID       string `json:"userID,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Relationship string `json:"relationship,omitempty"`
+	Phone        string `json:"phone,omitempty"`
+	Priority     int32  `json:"priority,omitempty"`
+	Created      string `json:"created,omitempty"`
+	LastUpdated  string `json:"lastUpdated,omitempty"`
+}
+
+/**
+ * @apiDefine ICEContacts200
+ *
+ * @apiSuccess (200 JSON Response) {Object[]} contacts List of contacts in order of priority (values as per AddICEContact).
+ */
+
+func NewICEContact(c *user.ICEContact) *ICEContact {
+	if c == nil {
+		return nil
+	}
+	return &ICEContact{
+		ID:           c.ID,
+		UserID:       c.UserID,
+		Name:         c.Name,
+		Relationship: c.Relationship,
+		Phone:        c.Phone,
+		Priority:     c.Priority,
+		Created:      formatTime(c.Created),
+		LastUpdated:  formatTime(c.LastUpdated),
+	}
+}
+
+func NewICEContacts(cs []user.ICEContact) []ICEContact {
+	if len(cs) == 0 {
+		return nil
+	}
+	var retCs []ICEContact
+	for _, c := range cs {
+		retC := NewICEContact(&c)
+		retCs = append(retCs, *retC)
+	}
+	return retCs
+}
+
+type Gender struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+func NewGenders(gs []user.Gender) []Gender {
+	if len(gs) == 0 {
+		return nil
+	}
+	retGs := make([]Gender, len(gs))
+	for i, g := range gs {
+		retGs[i] = Gender{Value: g.Value, Label: g.Label}
+	}
+	return retGs
+}
+
+/**
+ * @apiDefine Block200
+ *
+ * @apiSuccess (200 JSON Response) {String} userID ID of the user who blocked.
+ * @apiSuccess (200 JSON Response) {String} blockedUserID ID of the blocked user.
+ * @apiSuccess (200 JSON Response) {String} created ISO8601 date when the user was blocked.
+ */
+type Block struct {
+	UserID        string `json:"userID,omitempty"`
+	BlockedUserID string `json:"blockedUserID,omitempty"`
+	Created       string `json:"created,omitempty"`
+}
+
+/**
+ * @apiDefine Blocks200
+ *
+ * @apiSuccess (200 JSON Response) {Object[]} blocks List of blocks, most recent first (values as per BlockUser).
+ */
+
+func NewBlock(b *user.Block) *Block {
+	if b == nil {
+		return nil
+	}
+	return &Block{
+		UserID:        b.UserID,
+		BlockedUserID: b.BlockedUserID,
+		Created:       formatTime(b.Created),
+	}
+}
+
+func NewBlocks(bs []user.Block) []Block {
+	if len(bs) == 0 {
+		return nil
+	}
+	var retBs []Block
+	for _, b := range bs {
+		retBs = append(retBs, *NewBlock(&b))
+	}
+	return retBs
+}
+
+/**
+ * @apiDefine Follow200
+ *
+ * @apiSuccess (200 JSON Response) {String} userID ID of the following user.
+ * @apiSuccess (200 JSON Response) {String} followedUserID ID of the followed user.
+ * @apiSuccess (200 JSON Response) {String} created ISO8601 date when the user was followed.
+ */
+type Follow struct {
+	UserID         string `json:"userID,omitempty"`
+	FollowedUserID string `json:"followedUserID,omitempty"`
+	Created        string `json:"created,omitempty"`
+}
+
+/**
+ * @apiDefine Follows200
+ *
+ * @apiSuccess (200 JSON Response) {Object[]} follows List of follows, most recent first (values as per FollowUser).
+ */
+
+func NewFollow(f *user.Follow) *Follow {
+	if f == nil {
+		return nil
+	}
+	return &Follow{
+		UserID:         f.UserID,
+		FollowedUserID: f.FollowedUserID,
+		Created:        formatTime(f.Created),
+	}
+}
+
+func NewFollows(fs []user.Follow) []Follow {
+	if len(fs) == 0 {
+		return nil
+	}
+	var retFs []Follow
+	for _, f := range fs {
+		retFs = append(retFs, *NewFollow(&f))
+	}
+	return retFs
+}
+
+/**
+ * @apiDefine Connection200
+ *
+ * @apiSuccess (200 JSON Response) {String} userID ID of the user who requested the connection.
+ * @apiSuccess (200 JSON Response) {String} connectedUserID ID of the user the connection was requested with.
+ * @apiSuccess (200 JSON Response) {String="pending","accepted"} status
+ * @apiSuccess (200 JSON Response) {String} created ISO8601 date when the connection was requested.
+ * @apiSuccess (200 JSON Response) {String} [accepted] ISO8601 date when the connection was accepted.
+ */
+type Connection struct {
+	UserID          string `json:"userID,omitempty"`
+	ConnectedUserID string `json:"connectedUserID,omitempty"`
+	Status          string `json:"status,omitempty"`
+	Created         string `json:"created,omitempty"`
+	Accepted        string `json:"accepted,omitempty"`
+}
+
+/**
+ * @apiDefine Connections200
+ *
+ * @apiSuccess (200 JSON Response) {Object[]} connections List of connections, most recent first (values as per RequestConnection).
+ */
+
+func NewConnection(c *user.Connection) *Connection {
+	if c == nil {
+		return nil
+	}
+	return &Connection{
+		UserID:          c.UserID,
+		ConnectedUserID: c.ConnectedUserID,
+		Status:          c.Status(),
+		Created:         formatTime(c.Created),
+		Accepted:        formatTime(c.Accepted),
+	}
+}
+
+func NewConnections(cs []user.Connection) []Connection {
+	if len(cs) == 0 {
+		return nil
+	}
+	var retCs []Connection
+	for _, c := range cs {
+		retCs = append(retCs, *NewConnection(&c))
+	}
+	return retCs
+}
+
+/**
+ * @apiDefine Moderation200
+ *
+ * @apiSuccess (200 JSON Response) {String} ID ID of the moderation.
+ * @apiSuccess (200 JSON Response) {String} userID ID of the user whose update was flagged.
+ * @apiSuccess (200 JSON Response) {String="name","bio","avatarURL"} field The field whose update was flagged.
+ * @apiSuccess (200 JSON Response) {String} value The flagged value.
+ * @apiSuccess (200 JSON Response) {String} [previousValue] The value the flagged value replaced.
+ * @apiSuccess (200 JSON Response) {String} reason Why the value was flagged.
+ * @apiSuccess (200 JSON Response) {Boolean} held true if the value was kept
+ *		off the profile pending review, false if it was published but
+ *		hidden from other users pending review.
+ * @apiSuccess (200 JSON Response) {String="pending","approved","rejected"} status
+ * @apiSuccess (200 JSON Response) {String} [resolvedBy] ID of the staff member who approved or rejected the value.
+ * @apiSuccess (200 JSON Response) {String} [resolved] ISO8601 date when the value was approved or rejected.
+ * @apiSuccess (200 JSON Response) {String} created ISO8601 date when the value was flagged.
+ */
+type Moderation struct {
+	ID            string `json:"ID,omitempty"`
+	UserID        string `json:"userID,omitempty"`
+	Field         string `json:"field,omitempty"`
+	Value         string `json:"value,omitempty"`
+	PreviousValue string `json:"previousValue,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+	Held          bool   `json:"held"`
+	Status        string `json:"status,omitempty"`
+	ResolvedBy    string `json:"resolvedBy,omitempty"`
+	Resolved      string `json:"resolved,omitempty"`
+	Created       string `json:"created,omitempty"`
+}
+
+/**
+ * @apiDefine Moderations200
+ *
+ * @apiSuccess (200 JSON Response) {Object[]} moderations List of moderations (values as per ApproveModeration).
+ */
+
+func NewModeration(m *user.Moderation) *Moderation {
+	if m == nil {
+		return nil
+	}
+	return &Moderation{
+		ID:            m.ID,
+		UserID:        m.UserID,
+		Field:         m.Field,
+		Value:         m.Value,
+		PreviousValue: m.PreviousValue,
+		Reason:        m.Reason,
+		Held:          m.Held,
+		Status:        m.Status,
+		ResolvedBy:    m.ResolvedBy,
+		Resolved:      formatTime(m.Resolved),
+		Created:       formatTime(m.Created),
+	}
+}
+
+func NewModerations(ms []user.Moderation) []Moderation {
+	if len(ms) == 0 {
+		return nil
+	}
+	var retMs []Moderation
+	for _, m := range ms {
+		retMs = append(retMs, *NewModeration(&m))
+	}
+	return retMs
+}
+
+/**
+ * @apiDefine UserExport200
+ *
+ * @apiSuccess (200 JSON Response) {Object} user The user's profile (values as per GetUser).
+ * @apiSuccess (200 JSON Response) {Object[]} ratingsGiven Ratings the user gave (values as per GetRatingsOnUser).
+ * @apiSuccess (200 JSON Response) {Object[]} ratingsReceived Ratings the user received (values as per GetRatingsOnUser).
+ * @apiSuccess (200 JSON Response) {Object[]} history The user's profile history (values as per GetUserHistory).
+ * @apiSuccess (200 JSON Response) {Object[]} iceContacts The user's emergency contacts (values as per AddICEContact).
+ * @apiSuccess (200 JSON Response) {String} generated ISO8601 date when this export was generated.
+ */
+type Export struct {
+	User            *User        `json:"user"`
+	RatingsGiven    []Rating     `json:"ratingsGiven"`
+	RatingsReceived []Rating     `json:"ratingsReceived"`
+	History         []Change     `json:"history"`
+	ICEContacts     []ICEContact `json:"iceContacts"`
+	Generated       string       `json:"generated"`
+}
+
+func NewExport(e *user.Export) *Export {
+	if e == nil {
+		return nil
+	}
+	return &Export{
+		User:            NewUser(&e.User),
+		RatingsGiven:    NewRatings(e.RatingsGiven),
+		RatingsReceived: NewRatings(e.RatingsReceived),
+		History:         NewChanges(e.History),
+		ICEContacts:     NewICEContacts(e.ICEContacts),
+		Generated:       e.Generated.Format(time.RFC3339),
 	}
 }
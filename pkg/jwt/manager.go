@@ -71,6 +71,11 @@ func (v Manager) JWTValid(JWT string) (*AuthMSClaim, error) {
 	if err := v.JWTValidOnClaim(JWT, clm); err != nil {
 		return nil, err
 	}
+	// Tokens signed for other purposes (e.g. email verification) have no
+	// UsrID and would otherwise be granted the zero (full) access level.
+	if clm.UsrID == "" {
+		return nil, errors.NewUnauthorized("token does not identify a user")
+	}
 	return clm, nil
 }
 
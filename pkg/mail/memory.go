@@ -0,0 +1,34 @@
+package mail
+
+import (
+	"sync"
+)
+
+// Message is an email sent through Memory.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Memory keeps sent emails in memory instead of delivering them. It is
+// meant for tests and local development. The zero value is ready for use.
+type Memory struct {
+	mutex sync.Mutex
+	sent  []Message
+}
+
+// Send records an email with subject and body to the to address.
+func (m *Memory) Send(to, subject, body string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sent = append(m.sent, Message{To: to, Subject: subject, Body: body})
+	return nil
+}
+
+// Sent returns the emails sent so far in the order they were sent.
+func (m *Memory) Sent() []Message {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]Message(nil), m.sent...)
+}
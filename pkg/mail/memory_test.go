@@ -0,0 +1,20 @@
+package mail
+
+import (
+	"testing"
+)
+
+func TestMemory_Send(t *testing.T) {
+	m := &Memory{}
+	if err := m.Send("jane@example.com", "Verify your email", "token"); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	sent := m.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 sent email, got %d", len(sent))
+	}
+	exp := Message{To: "jane@example.com", Subject: "Verify your email", Body: "token"}
+	if sent[0] != exp {
+		t.Errorf("Expected %+v, got %+v", exp, sent[0])
+	}
+}
@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"github.com/tomogoma/go-typed-errors"
+)
+
+// SMTP sends emails through an SMTP server. Use NewSMTP to instantiate.
+type SMTP struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTP creates an SMTP mailer that sends emails from the from address
+// through the server at host:port. PLAIN authentication is used if
+// username is not empty.
+func NewSMTP(host string, port int, username, password, from string) (*SMTP, error) {
+	if host == "" {
+		return nil, errors.New("empty SMTP host")
+	}
+	if port <= 0 {
+		return nil, errors.Newf("invalid SMTP port %d", port)
+	}
+	if from == "" {
+		return nil, errors.New("empty from address")
+	}
+	s := &SMTP{addr: net.JoinHostPort(host, strconv.Itoa(port)), from: from}
+	if username != "" {
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s, nil
+}
+
+// Send sends a plain text email with subject and body to the to address.
+func (s *SMTP) Send(to, subject, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return errors.NewClient("email address and subject must not contain line breaks")
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n"+
+		"MIME-Version: 1.0\r\nContent-Type: text/plain; charset=\"utf-8\"\r\n\r\n%s",
+		s.from, to, subject, body)
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{to}, []byte(msg)); err != nil {
+		return errors.Newf("send mail: %v", err)
+	}
+	return nil
+}
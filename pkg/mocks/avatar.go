@@ -0,0 +1,39 @@
+package mocks
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/user"
+)
+
+type Avatar struct {
+	errors.ErrToHTTP
+
+	UpldRecTkn   string
+	UpldRecUsrID string
+	UpldRecImg   []byte
+	UpldUsr      *user.User
+	UpldErr      error
+
+	AvtrRecTkn   string
+	AvtrRecUsrID string
+	AvtrRecSize  int
+	AvtrImg      []byte
+	AvtrErr      error
+}
+
+func (a *Avatar) Upload(token, userID string, img io.Reader) (*user.User, error) {
+	a.UpldRecTkn = token
+	a.UpldRecUsrID = userID
+	a.UpldRecImg, _ = ioutil.ReadAll(img)
+	return a.UpldUsr, a.UpldErr
+}
+
+func (a *Avatar) Avatar(token, userID string, size int) ([]byte, error) {
+	a.AvtrRecTkn = token
+	a.AvtrRecUsrID = userID
+	a.AvtrRecSize = size
+	return a.AvtrImg, a.AvtrErr
+}
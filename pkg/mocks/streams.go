@@ -0,0 +1,48 @@
+package mocks
+
+import (
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/feed"
+)
+
+// Streams returns the configured changes on the first call to each method
+// and a not found error on later calls, which ends a stream.
+type Streams struct {
+	errors.ErrToHTTP
+
+	UsrChsRecTkn     string
+	UsrChsRecUsrID   string
+	UsrChsRecAfterID string
+	UsrChs           []feed.Change
+	UsrChsLastID     string
+	UsrChsErr        error
+	usrChsCalls      int
+
+	ChsRecTkn     string
+	ChsRecAfterID string
+	Chs           []feed.Change
+	ChsLastID     string
+	ChsErr        error
+	chsCalls      int
+}
+
+func (s *Streams) UserChanges(token, userID, afterID string) ([]feed.Change, string, error) {
+	s.usrChsCalls++
+	if s.usrChsCalls > 1 {
+		return nil, "", errors.NewNotFound("stream ended")
+	}
+	s.UsrChsRecTkn = token
+	s.UsrChsRecUsrID = userID
+	s.UsrChsRecAfterID = afterID
+	return s.UsrChs, s.UsrChsLastID, s.UsrChsErr
+}
+
+func (s *Streams) Changes(token, afterID string) ([]feed.Change, string, error) {
+	s.chsCalls++
+	if s.chsCalls > 1 {
+		return nil, "", errors.NewNotFound("stream ended")
+	}
+	s.ChsRecTkn = token
+	s.ChsRecAfterID = afterID
+	return s.Chs, s.ChsLastID, s.ChsErr
+}
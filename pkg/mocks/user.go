@@ -19,6 +19,176 @@ type User struct {
 	UsrRecOffstUpdDt time.Time
 	UsrUsr           *user.User
 	UsrErr           error
+
+	UsrByHndlRecTkn    string
+	UsrByHndlRecHandle string
+	UsrByHndlUsr       *user.User
+	UsrByHndlErr       error
+
+	UsrsRecTkn  string
+	UsrsRecIDs  []string
+	UsrsUsrs    []user.User
+	UsrsMissing []string
+	UsrsErr     error
+
+	SrchRecTkn  string
+	SrchRecFltr user.Filter
+	SrchUsrs    []user.User
+	SrchErr     error
+
+	HstryRecTkn    string
+	HstryRecUsrID  string
+	HstryRecOffset int64
+	HstryRecCount  int32
+	HstryChngs     []user.Change
+	HstryErr       error
+
+	DeactvtRecTkn   string
+	DeactvtRecUsrID string
+	DeactvtErr      error
+
+	ReactvtRecTkn   string
+	ReactvtRecUsrID string
+	ReactvtErr      error
+
+	ErsRecTkn   string
+	ErsRecUsrID string
+	ErsErr      error
+
+	ExprtRecTkn   string
+	ExprtRecUsrID string
+	ExprtExprt    *user.Export
+	ExprtErr      error
+
+	ICECntctsRecTkn   string
+	ICECntctsRecUsrID string
+	ICECntctsCntcts   []user.ICEContact
+	ICECntctsErr      error
+
+	AddICECntctRecTkn   string
+	AddICECntctRecCntct user.ICEContact
+	AddICECntctCntct    *user.ICEContact
+	AddICECntctErr      error
+
+	UpdICECntctRecTkn   string
+	UpdICECntctRecCntct user.ICEContact
+	UpdICECntctCntct    *user.ICEContact
+	UpdICECntctErr      error
+
+	DelICECntctRecTkn     string
+	DelICECntctRecUsrID   string
+	DelICECntctRecCntctID string
+	DelICECntctErr        error
+
+	VrfyEmlRecUsrID string
+	VrfyEmlRecTkn   string
+	VrfyEmlUsr      *user.User
+	VrfyEmlErr      error
+
+	VrfyICEPhnRecTkn   string
+	VrfyICEPhnRecUsrID string
+	VrfyICEPhnRecCode  string
+	VrfyICEPhnUsr      *user.User
+	VrfyICEPhnErr      error
+
+	BlksRecTkn   string
+	BlksRecUsrID string
+	BlksBlks     []user.Block
+	BlksErr      error
+
+	BlkRecTkn       string
+	BlkRecUsrID     string
+	BlkRecBlkdUsrID string
+	BlkBlk          *user.Block
+	BlkErr          error
+
+	UnblkRecTkn       string
+	UnblkRecUsrID     string
+	UnblkRecBlkdUsrID string
+	UnblkErr          error
+
+	FlwRecTkn       string
+	FlwRecUsrID     string
+	FlwRecFlwdUsrID string
+	FlwFlw          *user.Follow
+	FlwErr          error
+
+	UnflwRecTkn       string
+	UnflwRecUsrID     string
+	UnflwRecFlwdUsrID string
+	UnflwErr          error
+
+	FlwrsRecTkn    string
+	FlwrsRecUsrID  string
+	FlwrsRecOffset int64
+	FlwrsRecCount  int32
+	FlwrsFlws      []user.Follow
+	FlwrsErr       error
+
+	FlwngRecTkn    string
+	FlwngRecUsrID  string
+	FlwngRecOffset int64
+	FlwngRecCount  int32
+	FlwngFlws      []user.Follow
+	FlwngErr       error
+
+	ReqConnRecTkn      string
+	ReqConnRecUsrID    string
+	ReqConnRecOthUsrID string
+	ReqConnConn        *user.Connection
+	ReqConnErr         error
+
+	AccConnRecTkn    string
+	AccConnRecUsrID  string
+	AccConnRecReqrID string
+	AccConnConn      *user.Connection
+	AccConnErr       error
+
+	RmConnRecTkn      string
+	RmConnRecUsrID    string
+	RmConnRecOthUsrID string
+	RmConnErr         error
+
+	ConnsRecTkn    string
+	ConnsRecUsrID  string
+	ConnsRecStatus string
+	ConnsRecOffset int64
+	ConnsRecCount  int32
+	ConnsConns     []user.Connection
+	ConnsErr       error
+
+	ModsRecTkn    string
+	ModsRecUsrID  string
+	ModsRecOffset int64
+	ModsRecCount  int32
+	ModsMods      []user.Moderation
+	ModsErr       error
+
+	ModQRecTkn    string
+	ModQRecStatus string
+	ModQRecOffset int64
+	ModQRecCount  int32
+	ModQMods      []user.Moderation
+	ModQErr       error
+
+	AprvModRecTkn   string
+	AprvModRecModID string
+	AprvModMod      *user.Moderation
+	AprvModErr      error
+
+	RejModRecTkn   string
+	RejModRecModID string
+	RejModMod      *user.Moderation
+	RejModErr      error
+
+	MrgRecTkn      string
+	MrgRecSurvID   string
+	MrgRecDupID    string
+	MrgRecStrategy string
+	MrgUsr         *user.User
+	MrgErr         error
+
+	GndrsGndrs []user.Gender
 }
 
 func (u *User) Update(token string, update user.UserUpdate) (*user.User, error) {
@@ -33,3 +203,211 @@ func (u *User) User(token, ID string, offsetUpdateDate time.Time) (*user.User, e
 	u.UsrRecOffstUpdDt = offsetUpdateDate
 	return u.UsrUsr, u.UsrErr
 }
+
+func (u *User) UserByHandle(token, handle string) (*user.User, error) {
+	u.UsrByHndlRecTkn = token
+	u.UsrByHndlRecHandle = handle
+	return u.UsrByHndlUsr, u.UsrByHndlErr
+}
+
+func (u *User) Users(token string, IDs []string) ([]user.User, []string, error) {
+	u.UsrsRecTkn = token
+	u.UsrsRecIDs = IDs
+	return u.UsrsUsrs, u.UsrsMissing, u.UsrsErr
+}
+
+func (u *User) Search(token string, f user.Filter) ([]user.User, error) {
+	u.SrchRecTkn = token
+	u.SrchRecFltr = f
+	return u.SrchUsrs, u.SrchErr
+}
+
+func (u *User) History(token, userID string, offset int64, count int32) ([]user.Change, error) {
+	u.HstryRecTkn = token
+	u.HstryRecUsrID = userID
+	u.HstryRecOffset = offset
+	u.HstryRecCount = count
+	return u.HstryChngs, u.HstryErr
+}
+
+func (u *User) Deactivate(token, userID string) error {
+	u.DeactvtRecTkn = token
+	u.DeactvtRecUsrID = userID
+	return u.DeactvtErr
+}
+
+func (u *User) Reactivate(token, userID string) error {
+	u.ReactvtRecTkn = token
+	u.ReactvtRecUsrID = userID
+	return u.ReactvtErr
+}
+
+func (u *User) Erase(token, userID string) error {
+	u.ErsRecTkn = token
+	u.ErsRecUsrID = userID
+	return u.ErsErr
+}
+
+func (u *User) Export(token, userID string) (*user.Export, error) {
+	u.ExprtRecTkn = token
+	u.ExprtRecUsrID = userID
+	return u.ExprtExprt, u.ExprtErr
+}
+
+func (u *User) ICEContacts(token, userID string) ([]user.ICEContact, error) {
+	u.ICECntctsRecTkn = token
+	u.ICECntctsRecUsrID = userID
+	return u.ICECntctsCntcts, u.ICECntctsErr
+}
+
+func (u *User) AddICEContact(token string, c user.ICEContact) (*user.ICEContact, error) {
+	u.AddICECntctRecTkn = token
+	u.AddICECntctRecCntct = c
+	return u.AddICECntctCntct, u.AddICECntctErr
+}
+
+func (u *User) UpdateICEContact(token string, c user.ICEContact) (*user.ICEContact, error) {
+	u.UpdICECntctRecTkn = token
+	u.UpdICECntctRecCntct = c
+	return u.UpdICECntctCntct, u.UpdICECntctErr
+}
+
+func (u *User) DeleteICEContact(token, userID, contactID string) error {
+	u.DelICECntctRecTkn = token
+	u.DelICECntctRecUsrID = userID
+	u.DelICECntctRecCntctID = contactID
+	return u.DelICECntctErr
+}
+
+func (u *User) VerifyEmail(userID, verificationToken string) (*user.User, error) {
+	u.VrfyEmlRecUsrID = userID
+	u.VrfyEmlRecTkn = verificationToken
+	return u.VrfyEmlUsr, u.VrfyEmlErr
+}
+
+func (u *User) VerifyICEPhone(token, userID, code string) (*user.User, error) {
+	u.VrfyICEPhnRecTkn = token
+	u.VrfyICEPhnRecUsrID = userID
+	u.VrfyICEPhnRecCode = code
+	return u.VrfyICEPhnUsr, u.VrfyICEPhnErr
+}
+
+func (u *User) Blocks(token, userID string) ([]user.Block, error) {
+	u.BlksRecTkn = token
+	u.BlksRecUsrID = userID
+	return u.BlksBlks, u.BlksErr
+}
+
+func (u *User) Block(token, userID, blockedUserID string) (*user.Block, error) {
+	u.BlkRecTkn = token
+	u.BlkRecUsrID = userID
+	u.BlkRecBlkdUsrID = blockedUserID
+	return u.BlkBlk, u.BlkErr
+}
+
+func (u *User) Unblock(token, userID, blockedUserID string) error {
+	u.UnblkRecTkn = token
+	u.UnblkRecUsrID = userID
+	u.UnblkRecBlkdUsrID = blockedUserID
+	return u.UnblkErr
+}
+
+func (u *User) Follow(token, userID, followedUserID string) (*user.Follow, error) {
+	u.FlwRecTkn = token
+	u.FlwRecUsrID = userID
+	u.FlwRecFlwdUsrID = followedUserID
+	return u.FlwFlw, u.FlwErr
+}
+
+func (u *User) Unfollow(token, userID, followedUserID string) error {
+	u.UnflwRecTkn = token
+	u.UnflwRecUsrID = userID
+	u.UnflwRecFlwdUsrID = followedUserID
+	return u.UnflwErr
+}
+
+func (u *User) Followers(token, userID string, offset int64, count int32) ([]user.Follow, error) {
+	u.FlwrsRecTkn = token
+	u.FlwrsRecUsrID = userID
+	u.FlwrsRecOffset = offset
+	u.FlwrsRecCount = count
+	return u.FlwrsFlws, u.FlwrsErr
+}
+
+func (u *User) Following(token, userID string, offset int64, count int32) ([]user.Follow, error) {
+	u.FlwngRecTkn = token
+	u.FlwngRecUsrID = userID
+	u.FlwngRecOffset = offset
+	u.FlwngRecCount = count
+	return u.FlwngFlws, u.FlwngErr
+}
+
+func (u *User) RequestConnection(token, userID, otherUserID string) (*user.Connection, error) {
+	u.ReqConnRecTkn = token
+	u.ReqConnRecUsrID = userID
+	u.ReqConnRecOthUsrID = otherUserID
+	return u.ReqConnConn, u.ReqConnErr
+}
+
+func (u *User) AcceptConnection(token, userID, requesterID string) (*user.Connection, error) {
+	u.AccConnRecTkn = token
+	u.AccConnRecUsrID = userID
+	u.AccConnRecReqrID = requesterID
+	return u.AccConnConn, u.AccConnErr
+}
+
+func (u *User) RemoveConnection(token, userID, otherUserID string) error {
+	u.RmConnRecTkn = token
+	u.RmConnRecUsrID = userID
+	u.RmConnRecOthUsrID = otherUserID
+	return u.RmConnErr
+}
+
+func (u *User) Connections(token, userID, status string, offset int64, count int32) ([]user.Connection, error) {
+	u.ConnsRecTkn = token
+	u.ConnsRecUsrID = userID
+	u.ConnsRecStatus = status
+	u.ConnsRecOffset = offset
+	u.ConnsRecCount = count
+	return u.ConnsConns, u.ConnsErr
+}
+
+func (u *User) Moderations(token, userID string, offset int64, count int32) ([]user.Moderation, error) {
+	u.ModsRecTkn = token
+	u.ModsRecUsrID = userID
+	u.ModsRecOffset = offset
+	u.ModsRecCount = count
+	return u.ModsMods, u.ModsErr
+}
+
+func (u *User) ModerationQueue(token, status string, offset int64, count int32) ([]user.Moderation, error) {
+	u.ModQRecTkn = token
+	u.ModQRecStatus = status
+	u.ModQRecOffset = offset
+	u.ModQRecCount = count
+	return u.ModQMods, u.ModQErr
+}
+
+func (u *User) ApproveModeration(token, moderationID string) (*user.Moderation, error) {
+	u.AprvModRecTkn = token
+	u.AprvModRecModID = moderationID
+	return u.AprvModMod, u.AprvModErr
+}
+
+func (u *User) RejectModeration(token, moderationID string) (*user.Moderation, error) {
+	u.RejModRecTkn = token
+	u.RejModRecModID = moderationID
+	return u.RejModMod, u.RejModErr
+}
+
+func (u *User) Merge(token, survivorID, duplicateID, strategy string) (*user.User, error) {
+	u.MrgRecTkn = token
+	u.MrgRecSurvID = survivorID
+	u.MrgRecDupID = duplicateID
+	u.MrgRecStrategy = strategy
+	return u.MrgUsr, u.MrgErr
+}
+
+func (u *User) Genders() []user.Gender {
+	return u.GndrsGndrs
+}
@@ -0,0 +1,74 @@
+package moderation
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/tomogoma/go-typed-errors"
+)
+
+// WordList is a user.ContentChecker that flags values containing any of a
+// list of blocked words or phrases. Matching is case insensitive and on whole
+// words so that e.g. blocking "ass" does not flag "class". Punctuation is
+// ignored so that "bad-word" matches the phrase "bad word".
+// Use NewWordList to instantiate.
+type WordList struct {
+	phrases [][]string
+}
+
+// NewWordList creates a WordList that blocks words. Each of words may be a
+// single word or a phrase of several words.
+func NewWordList(words ...string) (*WordList, error) {
+	if len(words) == 0 {
+		return nil, errors.New("at least one word must be provided")
+	}
+	wl := &WordList{phrases: make([][]string, 0, len(words))}
+	for _, w := range words {
+		phrase := tokenize(w)
+		if len(phrase) == 0 {
+			return nil, errors.Newf("word '%s' contains no letters or digits", w)
+		}
+		wl.phrases = append(wl.phrases, phrase)
+	}
+	return wl, nil
+}
+
+// Check returns a non-empty reason if value contains a blocked word or
+// phrase. field is not used; all fields are checked against the same list.
+func (wl *WordList) Check(field, value string) (string, error) {
+	tokens := tokenize(value)
+	for _, phrase := range wl.phrases {
+		if containsPhrase(tokens, phrase) {
+			return fmt.Sprintf("contains blocked word '%s'",
+				strings.Join(phrase, " ")), nil
+		}
+	}
+	return "", nil
+}
+
+// tokenize splits s into lower case words at any character that is not a
+// letter or digit.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// containsPhrase returns true if phrase appears as a consecutive sequence in
+// tokens.
+func containsPhrase(tokens, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(tokens); i++ {
+		match := true
+		for j, word := range phrase {
+			if tokens[i+j] != word {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package moderation
+
+import (
+	"testing"
+)
+
+func TestNewWordList(t *testing.T) {
+	tt := []struct {
+		name   string
+		words  []string
+		expErr bool
+	}{
+		{name: "valid", words: []string{"spam", "buy now"}},
+		{name: "no words", words: nil, expErr: true},
+		{name: "punctuation only", words: []string{"spam", "?!"}, expErr: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewWordList(tc.words...)
+			if tc.expErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+		})
+	}
+}
+
+func TestWordList_Check(t *testing.T) {
+	wl, err := NewWordList("Spam", "buy now")
+	if err != nil {
+		t.Fatalf("NewWordList(): %v", err)
+	}
+	tt := []struct {
+		name      string
+		value     string
+		expReason string
+	}{
+		{name: "clean", value: "Hello, I ride boda bodas"},
+		{name: "blocked word", value: "I love SPAM!", expReason: "contains blocked word 'spam'"},
+		{name: "blocked phrase", value: "Buy-now at my shop", expReason: "contains blocked word 'buy now'"},
+		{name: "partial word", value: "spammer"},
+		{name: "phrase words apart", value: "buy it now"},
+		{name: "url", value: "https://example.com/spam.png", expReason: "contains blocked word 'spam'"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			reason, err := wl.Check("bio", tc.value)
+			if err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if reason != tc.expReason {
+				t.Errorf("Expected reason '%s', got '%s'", tc.expReason, reason)
+			}
+		})
+	}
+}
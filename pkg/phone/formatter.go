@@ -1,26 +1,92 @@
 package phone
 
 import (
-	"github.com/ttacon/libphonenumber"
 	"fmt"
+	"strings"
+
+	"github.com/ttacon/libphonenumber"
 )
 
 // Kenya's region code for parsing phone numbers
 const RegionCodeKE = "KE"
 
+// Number types that Formatter.NumberTypes can be restricted to.
+const (
+	TypeFixedLine         = "fixedLine"
+	TypeMobile            = "mobile"
+	TypeFixedLineOrMobile = "fixedLineOrMobile"
+	TypeTollFree          = "tollFree"
+	TypePremiumRate       = "premiumRate"
+	TypeSharedCost        = "sharedCost"
+	TypeVoIP              = "voip"
+	TypePersonalNumber    = "personalNumber"
+	TypePager             = "pager"
+	TypeUAN               = "uan"
+	TypeVoicemail         = "voicemail"
+)
+
+var numberTypes = map[string]libphonenumber.PhoneNumberType{
+	TypeFixedLine:         libphonenumber.FIXED_LINE,
+	TypeMobile:            libphonenumber.MOBILE,
+	TypeFixedLineOrMobile: libphonenumber.FIXED_LINE_OR_MOBILE,
+	TypeTollFree:          libphonenumber.TOLL_FREE,
+	TypePremiumRate:       libphonenumber.PREMIUM_RATE,
+	TypeSharedCost:        libphonenumber.SHARED_COST,
+	TypeVoIP:              libphonenumber.VOIP,
+	TypePersonalNumber:    libphonenumber.PERSONAL_NUMBER,
+	TypePager:             libphonenumber.PAGER,
+	TypeUAN:               libphonenumber.UAN,
+	TypeVoicemail:         libphonenumber.VOICEMAIL,
+}
+
 type Formatter struct {
+	// RegionCode is the region assumed for numbers not written in
+	// international format when no region is provided to
+	// FormatValidPhone. Defaults to RegionCodeKE.
 	RegionCode string
+	// NumberTypes restricts valid numbers to the listed Type... values
+	// (e.g. TypeMobile). Numbers of every type are valid if empty. In
+	// regions where fixed line and mobile numbers cannot be told apart,
+	// such numbers are valid if either TypeFixedLine or TypeMobile is
+	// listed.
+	NumberTypes []string
+	// E164 formats numbers in E.164 format with a leading "+" e.g.
+	// +254712345678 rather than 254712345678.
+	E164 bool
 }
 
-func (f Formatter) FormatValidPhone(number string) (string, error) {
-	regionCode := f.RegionCode
+// Validate returns an error if f's RegionCode or NumberTypes are not
+// supported.
+func (f Formatter) Validate() error {
+	if f.RegionCode != "" && !IsValidRegion(f.RegionCode) {
+		return fmt.Errorf("unsupported region code '%s'", f.RegionCode)
+	}
+	for _, t := range f.NumberTypes {
+		if _, ok := numberTypes[t]; !ok {
+			return fmt.Errorf("unknown number type '%s'", t)
+		}
+	}
+	return nil
+}
+
+// IsValidRegion returns true if regionCode is a supported (upper case) ISO
+// 3166-1 alpha-2 region code.
+func (f Formatter) IsValidRegion(regionCode string) bool {
+	return IsValidRegion(regionCode)
+}
+
+// FormatValidPhone validates number and formats it as an international
+// number. regionCode, if not empty, is the region assumed for numbers not
+// written in international format, otherwise f.RegionCode is assumed.
+func (f Formatter) FormatValidPhone(number, regionCode string) (string, error) {
+
+	if regionCode == "" {
+		regionCode = f.RegionCode
+	}
 	if regionCode == "" {
 		regionCode = RegionCodeKE
 	}
-	return FormatValidPhone(number, regionCode)
-}
 
-func FormatValidPhone(number, regionCode string) (string, error) {
 	num, err := libphonenumber.Parse(number, regionCode)
 	if err != nil {
 		return "", fmt.Errorf("parse phone number: %v", err)
@@ -28,5 +94,41 @@ func FormatValidPhone(number, regionCode string) (string, error) {
 	if !libphonenumber.IsValidNumber(num) {
 		return "", fmt.Errorf("invalid phone number %s", number)
 	}
+	if !f.allowsType(libphonenumber.GetNumberType(num)) {
+		return "", fmt.Errorf("phone number %s must be one of %s", number,
+			strings.Join(f.NumberTypes, ", "))
+	}
+
+	if f.E164 {
+		return libphonenumber.Format(num, libphonenumber.E164), nil
+	}
 	return fmt.Sprintf("%d%d", num.GetCountryCode(), num.GetNationalNumber()), nil
 }
+
+func (f Formatter) allowsType(numType libphonenumber.PhoneNumberType) bool {
+	if len(f.NumberTypes) == 0 {
+		return true
+	}
+	for _, t := range f.NumberTypes {
+		allowed := numberTypes[t]
+		if allowed == numType {
+			return true
+		}
+		if numType == libphonenumber.FIXED_LINE_OR_MOBILE &&
+			(allowed == libphonenumber.FIXED_LINE || allowed == libphonenumber.MOBILE) {
+			return true
+		}
+	}
+	return false
+}
+
+func FormatValidPhone(number, regionCode string) (string, error) {
+	return Formatter{RegionCode: regionCode}.FormatValidPhone(number, "")
+}
+
+// IsValidRegion returns true if regionCode is a supported (upper case) ISO
+// 3166-1 alpha-2 region code.
+func IsValidRegion(regionCode string) bool {
+	_, ok := libphonenumber.GetSupportedRegions()[regionCode]
+	return ok
+}
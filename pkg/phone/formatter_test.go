@@ -0,0 +1,64 @@
+package phone
+
+import (
+	"testing"
+)
+
+func TestFormatter_FormatValidPhone(t *testing.T) {
+	tt := []struct {
+		name       string
+		formatter  Formatter
+		number     string
+		regionCode string
+		expNumber  string
+		expErr     bool
+	}{
+		{name: "default region", number: "0712345678", expNumber: "254712345678"},
+		{name: "configured region", formatter: Formatter{RegionCode: "UG"}, number: "0772123456", expNumber: "256772123456"},
+		{name: "region hint", formatter: Formatter{RegionCode: "KE"}, number: "0772123456", regionCode: "UG", expNumber: "256772123456"},
+		{name: "international ignores region", number: "+256772123456", regionCode: "TZ", expNumber: "256772123456"},
+		{name: "E164", formatter: Formatter{E164: true}, number: "0712345678", expNumber: "+254712345678"},
+		{name: "mobile only", formatter: Formatter{NumberTypes: []string{TypeMobile}}, number: "0712345678", expNumber: "254712345678"},
+		{name: "mobile only fixed line", formatter: Formatter{NumberTypes: []string{TypeMobile}}, number: "0202123456", expErr: true},
+		{name: "invalid", number: "0712", expErr: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			number, err := tc.formatter.FormatValidPhone(tc.number, tc.regionCode)
+			if tc.expErr {
+				if err == nil {
+					t.Errorf("Expected an error, got nil (%s)", number)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if number != tc.expNumber {
+				t.Errorf("Expected %s, got %s", tc.expNumber, number)
+			}
+		})
+	}
+}
+
+func TestFormatter_Validate(t *testing.T) {
+	tt := []struct {
+		name      string
+		formatter Formatter
+		expErr    bool
+	}{
+		{name: "zero"},
+		{name: "valid", formatter: Formatter{RegionCode: "UG", NumberTypes: []string{TypeMobile, TypeFixedLine}}},
+		{name: "unknown region", formatter: Formatter{RegionCode: "XX"}, expErr: true},
+		{name: "lower case region", formatter: Formatter{RegionCode: "ke"}, expErr: true},
+		{name: "unknown type", formatter: Formatter{NumberTypes: []string{"cell"}}, expErr: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.formatter.Validate()
+			if tc.expErr != (err != nil) {
+				t.Errorf("Expected error %t, got %v", tc.expErr, err)
+			}
+		})
+	}
+}
@@ -26,6 +26,8 @@ type DB interface {
 	Ratings(Filter) ([]Rating, error)
 	AverageUserRatings(offset int64, count int32) ([]AverageUser, error)
 	UpdateUserRating(userID string, newRating float32, numRaters int64) error
+	UserDeactivated(userID string) (bool, error)
+	EitherBlocked(userID, otherUserID string) (bool, error)
 }
 
 type Manager struct {
@@ -75,6 +77,26 @@ func (m *Manager) RateUser(JWT, forUserID, comment string, rating int32) error {
 		return errors.NewClient(err)
 	}
 
+	deactivated, err := m.db.UserDeactivated(forUserID)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return errors.NewNotFound("user to rate not found")
+		}
+		return errors.Newf("check user to rate deactivated: %v", err)
+	}
+	if deactivated {
+		return errors.NewNotFound("user to rate not found")
+	}
+
+	blocked, err := m.db.EitherBlocked(clm.ByUsrID, forUserID)
+	if err != nil {
+		return errors.Newf("check users blocked: %v", err)
+	}
+	if blocked {
+		return errors.NewForbidden("cannot rate a user that has blocked or" +
+			" been blocked by the rater")
+	}
+
 	_, err = m.db.Rating(clm.ByUsrID, clm.ForSection, forUserID)
 	if err == nil {
 		return errors.NewClientf("user already rated by JWT owner in JWT provided section")
@@ -101,13 +123,15 @@ func (m *Manager) RateUser(JWT, forUserID, comment string, rating int32) error {
 
 func (m *Manager) Ratings(JWT string, filter Filter) ([]Rating, error) {
 
-	if _, err := m.jwter.JWTValid(JWT); err != nil {
+	clm, err := m.jwter.JWTValid(JWT)
+	if err != nil {
 		return nil, m.parseJWTErError(err, "check JWT valid")
 	}
 
 	if err := filter.Validate(); err != nil {
 		return nil, err
 	}
+	filter.HideBlockedBy = clm.UsrID
 
 	rtngs, err := m.db.Ratings(filter)
 	if err != nil {
@@ -21,8 +21,11 @@ type Filter struct {
 	ForSection *crdb.Comparison
 	ForUserID  *crdb.Comparison
 	ByUserID   *crdb.Comparison
-	Offset     int64
-	Count      int32
+	// HideBlockedBy, if not empty, excludes ratings given by users that
+	// the user with this ID has blocked. It is set by Manager.Ratings.
+	HideBlockedBy string
+	Offset        int64
+	Count         int32
 }
 
 type AverageUser struct {
@@ -43,3 +46,21 @@ func (f Filter) Validate() error {
 	}
 	return nil
 }
+
+// Validate returns a client error if r is missing the IDs of the users or
+// section involved or if its Rating is out of range.
+func (r Rating) Validate() error {
+	if r.ForSection == "" {
+		return errors.NewClient("ForSection was empty")
+	}
+	if r.ForUserID == "" {
+		return errors.NewClient("ForUserID was empty")
+	}
+	if r.ByUserID == "" {
+		return errors.NewClient("ByUserID was empty")
+	}
+	if err := ratingValid(r.Rating); err != nil {
+		return errors.NewClient(err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package sms
+
+import (
+	"sync"
+
+	"github.com/tomogoma/usersms/pkg/logging"
+)
+
+// Message is an SMS sent through Stub.
+type Message struct {
+	To   string
+	Text string
+}
+
+// Stub keeps sent SMSs in memory and logs them instead of delivering them.
+// It is meant for local development and tests. Use NewStub to instantiate.
+type Stub struct {
+	lg    logging.Logger
+	mutex sync.Mutex
+	sent  []Message
+}
+
+// NewStub creates a Stub that logs each SMS to lg. lg may be nil.
+func NewStub(lg logging.Logger) *Stub {
+	return &Stub{lg: lg}
+}
+
+// Send records an SMS with text to the to phone number.
+func (s *Stub) Send(to, text string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sent = append(s.sent, Message{To: to, Text: text})
+	if s.lg != nil {
+		s.lg.Infof("SMS stub: to %s: %s", to, text)
+	}
+	return nil
+}
+
+// Sent returns the SMSs sent so far in the order they were sent.
+func (s *Stub) Sent() []Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Message(nil), s.sent...)
+}
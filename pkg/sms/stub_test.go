@@ -0,0 +1,22 @@
+package sms
+
+import (
+	"testing"
+
+	"github.com/tomogoma/usersms/pkg/mocks"
+)
+
+func TestStub_Send(t *testing.T) {
+	s := NewStub(&mocks.Logger{})
+	if err := s.Send("+254712345678", "Your code is 123456"); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	sent := s.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 sent SMS, got %d", len(sent))
+	}
+	exp := Message{To: "+254712345678", Text: "Your code is 123456"}
+	if sent[0] != exp {
+		t.Errorf("Expected %+v, got %+v", exp, sent[0])
+	}
+}
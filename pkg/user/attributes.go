@@ -0,0 +1,171 @@
+package user
+
+import (
+	"encoding/json"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/tomogoma/go-typed-errors"
+)
+
+// Types of values an attribute can hold.
+const (
+	AttrTypeString = "string"
+	AttrTypeNumber = "number"
+	AttrTypeBool   = "bool"
+)
+
+// Visibility of an attribute's value.
+const (
+	// AttrVisibilityPublic values are accessible to everyone, including
+	// anonymous callers.
+	AttrVisibilityPublic = "public"
+	// AttrVisibilityPrivate values are accessible to authenticated callers
+	// only, same as the non-public fields of User.
+	AttrVisibilityPrivate = "private"
+)
+
+// attrFieldPrefix prefixes the attribute name in Change.Field.
+const attrFieldPrefix = "attributes."
+
+// AttributeSpec declares a custom profile attribute and the rules its values
+// must satisfy.
+type AttributeSpec struct {
+	Name string `json:"name" yaml:"name"`
+	// Type is one of the AttrType... values.
+	Type string `json:"type" yaml:"type"`
+	// Visibility is one of the AttrVisibility... values. Defaults to
+	// AttrVisibilityPrivate.
+	Visibility string `json:"visibility" yaml:"visibility"`
+
+	// MinLength, MaxLength, Pattern and Values apply to AttrTypeString
+	// attributes only. Zero values are ignored.
+	MinLength int      `json:"minLength" yaml:"minLength"`
+	MaxLength int      `json:"maxLength" yaml:"maxLength"`
+	Pattern   string   `json:"pattern" yaml:"pattern"`
+	Values    []string `json:"values" yaml:"values"`
+
+	// Min and Max apply to AttrTypeNumber attributes only. nil values are
+	// ignored.
+	Min *float64 `json:"min" yaml:"min"`
+	Max *float64 `json:"max" yaml:"max"`
+
+	pattern *regexp.Regexp
+}
+
+// WithAttributes declares the custom attributes that users can set on their
+// profiles.
+func WithAttributes(specs ...AttributeSpec) Option {
+	return func(m *Manager) error {
+		for _, spec := range specs {
+			if err := spec.compile(); err != nil {
+				return errors.Newf("attribute '%s': %v", spec.Name, err)
+			}
+			if _, exists := m.attrSpecs[spec.Name]; exists {
+				return errors.Newf("attribute '%s' declared more than once", spec.Name)
+			}
+			m.attrSpecs[spec.Name] = spec
+		}
+		return nil
+	}
+}
+
+// IsPublic returns true if the attribute is accessible to everyone.
+func (as AttributeSpec) IsPublic() bool {
+	return as.Visibility == AttrVisibilityPublic
+}
+
+func (as *AttributeSpec) compile() error {
+	if as.Name == "" {
+		return errors.New("name was empty")
+	}
+	if !in(as.Type, []string{AttrTypeString, AttrTypeNumber, AttrTypeBool}) {
+		return errors.Newf("invalid type '%s'", as.Type)
+	}
+	if as.Visibility == "" {
+		as.Visibility = AttrVisibilityPrivate
+	}
+	if !in(as.Visibility, []string{AttrVisibilityPublic, AttrVisibilityPrivate}) {
+		return errors.Newf("invalid visibility '%s'", as.Visibility)
+	}
+	if as.Pattern != "" {
+		var err error
+		if as.pattern, err = regexp.Compile(as.Pattern); err != nil {
+			return errors.Newf("invalid pattern: %v", err)
+		}
+	}
+	return nil
+}
+
+// validate returns a client error if val does not satisfy as.
+func (as AttributeSpec) validate(val interface{}) error {
+	switch as.Type {
+	case AttrTypeString:
+		str, ok := val.(string)
+		if !ok {
+			return errors.NewClientf("attribute '%s' must be a string", as.Name)
+		}
+		if as.MinLength > 0 && utf8.RuneCountInString(str) < as.MinLength {
+			return errors.NewClientf("attribute '%s' must have at least %d"+
+				" characters", as.Name, as.MinLength)
+		}
+		if as.MaxLength > 0 && utf8.RuneCountInString(str) > as.MaxLength {
+			return errors.NewClientf("attribute '%s' must have at most %d"+
+				" characters", as.Name, as.MaxLength)
+		}
+		if as.pattern != nil && !as.pattern.MatchString(str) {
+			return errors.NewClientf("attribute '%s' must match the pattern %s",
+				as.Name, as.Pattern)
+		}
+		if len(as.Values) > 0 && !in(str, as.Values) {
+			return errors.NewClientf("attribute '%s' must be one of %v",
+				as.Name, as.Values)
+		}
+	case AttrTypeNumber:
+		num, ok := val.(float64)
+		if !ok {
+			return errors.NewClientf("attribute '%s' must be a number", as.Name)
+		}
+		if as.Min != nil && num < *as.Min {
+			return errors.NewClientf("attribute '%s' must be >= %v", as.Name, *as.Min)
+		}
+		if as.Max != nil && num > *as.Max {
+			return errors.NewClientf("attribute '%s' must be <= %v", as.Name, *as.Max)
+		}
+	case AttrTypeBool:
+		if _, ok := val.(bool); !ok {
+			return errors.NewClientf("attribute '%s' must be a boolean", as.Name)
+		}
+	}
+	return nil
+}
+
+// MergeAttributes returns a copy of current with updates applied. A nil value
+// in updates removes the attribute.
+func MergeAttributes(current, updates map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(current)+len(updates))
+	for name, val := range current {
+		merged[name] = val
+	}
+	for name, val := range updates {
+		if val == nil {
+			delete(merged, name)
+			continue
+		}
+		merged[name] = val
+	}
+	return merged
+}
+
+// attrString returns the JSON representation of an attribute value as used in
+// Change values or an empty string if val is nil.
+func attrString(val interface{}) string {
+	if val == nil {
+		return ""
+	}
+	valB, err := json.Marshal(val)
+	if err != nil {
+		return ""
+	}
+	return string(valB)
+}
@@ -0,0 +1,79 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/tomogoma/go-typed-errors"
+)
+
+func TestAttributeSpec_validate(t *testing.T) {
+	min, max := float64(1), float64(10)
+	tt := []struct {
+		name   string
+		spec   AttributeSpec
+		val    interface{}
+		expErr bool
+	}{
+		{name: "valid string", spec: AttributeSpec{Name: "a", Type: AttrTypeString, MaxLength: 3}, val: "abc"},
+		{name: "string too long", spec: AttributeSpec{Name: "a", Type: AttrTypeString, MaxLength: 3}, val: "abcd", expErr: true},
+		{name: "string too short", spec: AttributeSpec{Name: "a", Type: AttrTypeString, MinLength: 2}, val: "a", expErr: true},
+		{name: "string pattern mismatch", spec: AttributeSpec{Name: "a", Type: AttrTypeString, Pattern: "^[A-Z]+$"}, val: "abc", expErr: true},
+		{name: "string not in values", spec: AttributeSpec{Name: "a", Type: AttrTypeString, Values: []string{"en", "sw"}}, val: "fr", expErr: true},
+		{name: "string wrong type", spec: AttributeSpec{Name: "a", Type: AttrTypeString}, val: float64(1), expErr: true},
+		{name: "valid number", spec: AttributeSpec{Name: "a", Type: AttrTypeNumber, Min: &min, Max: &max}, val: float64(5)},
+		{name: "number below min", spec: AttributeSpec{Name: "a", Type: AttrTypeNumber, Min: &min}, val: float64(0), expErr: true},
+		{name: "number above max", spec: AttributeSpec{Name: "a", Type: AttrTypeNumber, Max: &max}, val: float64(11), expErr: true},
+		{name: "valid bool", spec: AttributeSpec{Name: "a", Type: AttrTypeBool}, val: true},
+		{name: "bool wrong type", spec: AttributeSpec{Name: "a", Type: AttrTypeBool}, val: "true", expErr: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.spec.compile(); err != nil {
+				t.Fatalf("Error setting up: compile spec: %v", err)
+			}
+			err := tc.spec.validate(tc.val)
+			if tc.expErr {
+				if err == nil {
+					t.Fatal("Expected an error but got nil")
+				}
+				if !new(errors.ClErrCheck).IsClientError(err) {
+					t.Errorf("Expected a client error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got an error: %v", err)
+			}
+		})
+	}
+}
+
+func TestWithAttributes(t *testing.T) {
+	tt := []struct {
+		name   string
+		specs  []AttributeSpec
+		expErr bool
+	}{
+		{name: "valid", specs: []AttributeSpec{{Name: "a", Type: AttrTypeString}, {Name: "b", Type: AttrTypeBool}}},
+		{name: "no name", specs: []AttributeSpec{{Type: AttrTypeString}}, expErr: true},
+		{name: "bad type", specs: []AttributeSpec{{Name: "a", Type: "date"}}, expErr: true},
+		{name: "bad visibility", specs: []AttributeSpec{{Name: "a", Type: AttrTypeString, Visibility: "friends"}}, expErr: true},
+		{name: "bad pattern", specs: []AttributeSpec{{Name: "a", Type: AttrTypeString, Pattern: "["}}, expErr: true},
+		{name: "duplicate", specs: []AttributeSpec{{Name: "a", Type: AttrTypeString}, {Name: "a", Type: AttrTypeBool}}, expErr: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &Manager{attrSpecs: make(map[string]AttributeSpec)}
+			err := WithAttributes(tc.specs...)(m)
+			if tc.expErr {
+				if err == nil {
+					t.Fatal("Expected an error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got an error: %v", err)
+			}
+		})
+	}
+}
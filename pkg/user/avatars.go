@@ -0,0 +1,70 @@
+package user
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/tomogoma/go-typed-errors"
+)
+
+// AvatarStore stores the avatars uploaded to this service and identifies
+// them by their URLs e.g. avatar.Files.
+type AvatarStore interface {
+	// IsAvatarURL returns true if avatarURL is the URL of an avatar
+	// uploaded for the user with userID.
+	IsAvatarURL(userID, avatarURL string) bool
+	// CopyAvatar copies the uploaded avatar at avatarURL to the user with
+	// toUserID and returns the copy's URL.
+	CopyAvatar(avatarURL, toUserID string) (string, error)
+	// DeleteAvatar deletes the uploaded avatar at avatarURL.
+	DeleteAvatar(avatarURL string) error
+	// DeleteAvatars deletes all avatars uploaded for the user with userID.
+	DeleteAvatars(userID string) error
+}
+
+// WithAvatarStore sets the store of the avatars uploaded to this service.
+// A user's AvatarURL can be set to the URL of an avatar uploaded for them,
+// and their avatars are deleted when they are erased or merged into another
+// user.
+func WithAvatarStore(s AvatarStore) Option {
+	return func(m *Manager) error {
+		if s == nil {
+			return errors.New("nil AvatarStore")
+		}
+		m.avatars = s
+		return nil
+	}
+}
+
+// WithAvatarHosts allows setting a user's AvatarURL to an http(s) URL on
+// one of hosts e.g. "images.example.com". By default AvatarURL can only be
+// set to the URL of an avatar uploaded to this service (see WithAvatarStore).
+func WithAvatarHosts(hosts ...string) Option {
+	return func(m *Manager) error {
+		if m.avatarHosts == nil {
+			m.avatarHosts = make(map[string]bool)
+		}
+		for _, host := range hosts {
+			if host == "" {
+				return errors.New("empty avatar host")
+			}
+			m.avatarHosts[strings.ToLower(host)] = true
+		}
+		return nil
+	}
+}
+
+// validateAvatarURL returns a client error unless avatarURL is the URL of
+// an avatar uploaded for the user with userID or is on an allowed host.
+func (m *Manager) validateAvatarURL(userID, avatarURL string) error {
+	if m.avatars != nil && m.avatars.IsAvatarURL(userID, avatarURL) {
+		return nil
+	}
+	u, err := url.Parse(avatarURL)
+	if err == nil && (u.Scheme == "https" || u.Scheme == "http") &&
+		m.avatarHosts[strings.ToLower(u.Hostname())] {
+		return nil
+	}
+	return errors.NewClient("AvatarURL must be the URL of an avatar uploaded" +
+		" to this service or of an image on an allowed host")
+}
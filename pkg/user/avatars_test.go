@@ -0,0 +1,77 @@
+package user
+
+import "testing"
+
+// avatarStore treats "/users/{userID}/avatar?v=1" as the only avatar
+// uploaded for userID.
+type avatarStore struct{}
+
+func (avatarStore) IsAvatarURL(userID, avatarURL string) bool {
+	return avatarURL == "/users/"+userID+"/avatar?v=1"
+}
+func (avatarStore) CopyAvatar(avatarURL, toUserID string) (string, error) { return "", nil }
+func (avatarStore) DeleteAvatar(avatarURL string) error                   { return nil }
+func (avatarStore) DeleteAvatars(userID string) error                     { return nil }
+
+func TestManager_validateAvatarURL(t *testing.T) {
+	tt := []struct {
+		name      string
+		opts      []Option
+		avatarURL string
+		expErr    bool
+	}{
+		{
+			name:      "uploaded avatar",
+			opts:      []Option{WithAvatarStore(avatarStore{})},
+			avatarURL: "/users/123/avatar?v=1",
+		},
+		{
+			name:      "another user's uploaded avatar",
+			opts:      []Option{WithAvatarStore(avatarStore{})},
+			avatarURL: "/users/456/avatar?v=1",
+			expErr:    true,
+		},
+		{
+			name:      "allowed host",
+			opts:      []Option{WithAvatarHosts("Images.example.com")},
+			avatarURL: "https://images.example.com/jane.png",
+		},
+		{
+			name:      "host not allowed",
+			opts:      []Option{WithAvatarHosts("images.example.com")},
+			avatarURL: "https://evil.example.com/jane.png",
+			expErr:    true,
+		},
+		{
+			name:      "allowed host non http scheme",
+			opts:      []Option{WithAvatarHosts("images.example.com")},
+			avatarURL: "javascript://images.example.com/%0Aalert(1)",
+			expErr:    true,
+		},
+		{
+			name:      "nothing allowed",
+			avatarURL: "https://images.example.com/jane.png",
+			expErr:    true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &Manager{}
+			for _, opt := range tc.opts {
+				if err := opt(m); err != nil {
+					t.Fatalf("Error setting up: apply option: %v", err)
+				}
+			}
+			err := m.validateAvatarURL("123", tc.avatarURL)
+			if tc.expErr {
+				if !m.IsClientError(err) {
+					t.Errorf("Expected a client error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Got error: %v", err)
+			}
+		})
+	}
+}
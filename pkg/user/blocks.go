@@ -0,0 +1,133 @@
+package user
+
+import (
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/jwt"
+)
+
+// Block records that the user with UserID has blocked the user with
+// BlockedUserID. A blocked user cannot view the blocker's profile, the two
+// cannot rate each other and the blocked user's ratings are hidden from the
+// blocker.
+type Block struct {
+	UserID        string
+	BlockedUserID string
+	Created       time.Time
+}
+
+// Blocks lists the users blocked by the user with userID, most recent first.
+// Only the user or staff can list a user's blocks.
+func (m *Manager) Blocks(JWT, userID string) ([]Block, error) {
+
+	_, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return nil, m.parseJWTErError(err, "validate JWT belongs to"+
+			" subject or has access")
+	}
+
+	bs, err := m.db.Blocks(userID)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("user has not blocked anyone")
+		}
+		return nil, errors.Newf("fetch blocks: %v", err)
+	}
+	return bs, nil
+}
+
+// Block blocks the user with blockedUserID on behalf of the user with
+// userID, removing any follows and connection (or connection request)
+// between the two users. Blocking an already blocked user has no effect.
+// Only the user or staff can block on a user's behalf.
+func (m *Manager) Block(JWT, userID, blockedUserID string) (*Block, error) {
+
+	_, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return nil, m.parseJWTErError(err, "validate JWT belongs to"+
+			" subject or has access")
+	}
+
+	if blockedUserID == "" {
+		return nil, errors.NewClient("ID of the user to block was empty")
+	}
+	if blockedUserID == userID {
+		return nil, errors.NewClient("a user cannot block themselves")
+	}
+
+	if _, err := m.db.User(blockedUserID, time.Time{}); err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("user to block not found")
+		}
+		return nil, errors.Newf("fetch user to block: %v", err)
+	}
+
+	b, err := m.db.InsertBlock(Block{UserID: userID,
+		BlockedUserID: blockedUserID, Created: time.Now()})
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("user not found")
+		}
+		return nil, errors.Newf("insert block: %v", err)
+	}
+	return b, nil
+}
+
+// Unblock reverses Block. Only the user or staff can unblock on a user's
+// behalf.
+func (m *Manager) Unblock(JWT, userID, blockedUserID string) error {
+
+	_, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return m.parseJWTErError(err, "validate JWT belongs to subject or"+
+			" has access")
+	}
+
+	if err := m.db.DeleteBlock(userID, blockedUserID); err != nil {
+		if m.db.IsNotFoundError(err) {
+			return errors.NewNotFound("user is not blocked")
+		}
+		return errors.Newf("delete block: %v", err)
+	}
+	return nil
+}
+
+// blockers returns the IDs of those of usrs that have blocked the JWT
+// subject in clm. Anonymous callers and staff are never blocked.
+func (m *Manager) blockers(clm *jwt.AuthMSClaim, usrs []User) (map[string]bool, error) {
+
+	if clm == nil || isStaff(clm) {
+		return nil, nil
+	}
+
+	var IDs []string
+	for _, usr := range usrs {
+		if usr.ID != clm.UsrID {
+			IDs = append(IDs, usr.ID)
+		}
+	}
+	if len(IDs) == 0 {
+		return nil, nil
+	}
+
+	blockerIDs, err := m.db.BlockersOf(clm.UsrID, IDs)
+	if err != nil && !m.db.IsNotFoundError(err) {
+		return nil, errors.Newf("fetch blockers: %v", err)
+	}
+
+	blockers := make(map[string]bool, len(blockerIDs))
+	for _, ID := range blockerIDs {
+		blockers[ID] = true
+	}
+	return blockers, nil
+}
+
+// blockedBy returns true if usr has blocked the JWT subject in clm.
+func (m *Manager) blockedBy(clm *jwt.AuthMSClaim, usr User) (bool, error) {
+	blockers, err := m.blockers(clm, []User{usr})
+	if err != nil {
+		return false, err
+	}
+	return blockers[usr.ID], nil
+}
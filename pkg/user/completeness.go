@@ -0,0 +1,116 @@
+package user
+
+import (
+	"sort"
+
+	"github.com/tomogoma/go-typed-errors"
+)
+
+// defaultCompletenessWeights is the contribution of each profile field to
+// the completeness score unless overridden with WithCompletenessWeights.
+var defaultCompletenessWeights = map[string]int{
+	FieldName:      20,
+	FieldAvatarURL: 20,
+	FieldBio:       15,
+	FieldICEPhone:  15,
+	FieldHandle:    10,
+	FieldEmail:     10,
+	FieldGender:    5,
+	FieldCountry:   5,
+}
+
+// Completeness describes how much of a profile has been filled in.
+type Completeness struct {
+	// Score is the percentage (0-100) of the total field weight that
+	// has been filled in, rounded down.
+	Score int32
+	// Missing lists the names of the weighted fields (the Field...
+	// values) that are empty, heaviest first.
+	Missing []string
+}
+
+// WithCompletenessWeights sets the contribution of each profile field (keyed
+// by the Field... values e.g. FieldBio) to the completeness score, replacing
+// the defaults. Fields not included do not count towards completeness.
+func WithCompletenessWeights(weights map[string]int) Option {
+	return func(m *Manager) error {
+		total := 0
+		for field, weight := range weights {
+			if _, ok := defaultPrivacy[field]; !ok && field != FieldHandle {
+				return errors.Newf("unknown completeness field '%s'", field)
+			}
+			if weight < 0 {
+				return errors.Newf("completeness weight for '%s' must be"+
+					" >= 0", field)
+			}
+			total += weight
+		}
+		if total <= 0 {
+			return errors.New("at least one completeness weight must be" +
+				" greater than 0")
+		}
+		m.completenessWeights = make(map[string]int, len(weights))
+		for field, weight := range weights {
+			m.completenessWeights[field] = weight
+		}
+		return nil
+	}
+}
+
+// completeness calculates how much of usr's profile has been filled in
+// according to the configured weights.
+func (m *Manager) completeness(usr *User) *Completeness {
+	total, filled := 0, 0
+	c := &Completeness{Missing: []string{}}
+	for field, weight := range m.completenessWeights {
+		if weight == 0 {
+			continue
+		}
+		total += weight
+		if usr.fieldValue(field) != "" {
+			filled += weight
+			continue
+		}
+		c.Missing = append(c.Missing, field)
+	}
+	if total > 0 {
+		c.Score = int32(filled * 100 / total)
+	}
+	sort.Slice(c.Missing, func(i, j int) bool {
+		wi, wj := m.completenessWeights[c.Missing[i]], m.completenessWeights[c.Missing[j]]
+		if wi != wj {
+			return wi > wj
+		}
+		return c.Missing[i] < c.Missing[j]
+	})
+	return c
+}
+
+// fieldValue returns the value of the profile field named field (one of the
+// Field... values) or an empty string for unknown fields.
+func (u User) fieldValue(field string) string {
+	switch field {
+	case FieldName:
+		return u.Name
+	case FieldICEPhone:
+		return u.ICEPhone
+	case FieldGender:
+		return u.Gender
+	case FieldAvatarURL:
+		return u.AvatarURL
+	case FieldBio:
+		return u.Bio
+	case FieldHandle:
+		return u.Handle
+	case FieldCountry:
+		return u.Country
+	case FieldLocale:
+		return u.Locale
+	case FieldTimezone:
+		return u.Timezone
+	case FieldEmail:
+		return u.Email
+	default:
+		return ""
+	}
+}
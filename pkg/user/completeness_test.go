@@ -0,0 +1,81 @@
+package user
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestManager_completeness(t *testing.T) {
+	tt := []struct {
+		name       string
+		weights    map[string]int
+		usr        User
+		expScore   int32
+		expMissing []string
+	}{
+		{
+			name:       "empty profile",
+			weights:    map[string]int{FieldName: 50, FieldBio: 30, FieldAvatarURL: 20},
+			expScore:   0,
+			expMissing: []string{FieldName, FieldBio, FieldAvatarURL},
+		},
+		{
+			name:       "partial profile",
+			weights:    map[string]int{FieldName: 50, FieldBio: 30, FieldAvatarURL: 20},
+			usr:        User{Name: "Jane", AvatarURL: "https://example.com/jane.png"},
+			expScore:   70,
+			expMissing: []string{FieldBio},
+		},
+		{
+			name:       "rounds down",
+			weights:    map[string]int{FieldName: 1, FieldBio: 1, FieldGender: 1},
+			usr:        User{Name: "Jane"},
+			expScore:   33,
+			expMissing: []string{FieldBio, FieldGender},
+		},
+		{
+			name:       "zero weight ignored",
+			weights:    map[string]int{FieldName: 1, FieldBio: 0},
+			usr:        User{Name: "Jane"},
+			expScore:   100,
+			expMissing: []string{},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &Manager{}
+			if err := WithCompletenessWeights(tc.weights)(m); err != nil {
+				t.Fatalf("Error setting up: with completeness weights: %v", err)
+			}
+			c := m.completeness(&tc.usr)
+			if c.Score != tc.expScore {
+				t.Errorf("Expected score %d, got %d", tc.expScore, c.Score)
+			}
+			if !reflect.DeepEqual(c.Missing, tc.expMissing) {
+				t.Errorf("Expected missing %v, got %v", tc.expMissing, c.Missing)
+			}
+		})
+	}
+}
+
+func TestWithCompletenessWeights(t *testing.T) {
+	tt := []struct {
+		name    string
+		weights map[string]int
+		expErr  bool
+	}{
+		{name: "valid", weights: map[string]int{FieldHandle: 10, FieldBio: 0}},
+		{name: "unknown field", weights: map[string]int{"rating": 10}, expErr: true},
+		{name: "negative weight", weights: map[string]int{FieldName: 10, FieldBio: -1}, expErr: true},
+		{name: "all zero", weights: map[string]int{FieldName: 0}, expErr: true},
+		{name: "empty", weights: map[string]int{}, expErr: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := WithCompletenessWeights(tc.weights)(&Manager{})
+			if tc.expErr != (err != nil) {
+				t.Errorf("Expected error %t, got %v", tc.expErr, err)
+			}
+		})
+	}
+}
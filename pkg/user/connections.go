@@ -0,0 +1,165 @@
+package user
+
+import (
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/jwt"
+)
+
+// Statuses of a Connection.
+const (
+	// ConnectionPending connections have been requested by Connection.UserID
+	// and await acceptance by Connection.ConnectedUserID.
+	ConnectionPending = "pending"
+	// ConnectionAccepted connections are mutual.
+	ConnectionAccepted = "accepted"
+)
+
+// Connection is a mutual relationship between the user with UserID, who
+// requested it, and the user with ConnectedUserID, who accepted it. Accepted
+// is zero while the request is pending.
+type Connection struct {
+	UserID          string
+	ConnectedUserID string
+	Created         time.Time
+	Accepted        time.Time
+}
+
+// Status returns ConnectionAccepted if c has been accepted, otherwise
+// ConnectionPending.
+func (c Connection) Status() string {
+	if c.Accepted.IsZero() {
+		return ConnectionPending
+	}
+	return ConnectionAccepted
+}
+
+// RequestConnection requests a connection between the user with userID and
+// the user with otherUserID. If otherUserID had already requested a
+// connection with userID, the request is accepted instead. Requesting an
+// existing connection returns it as is. Only the user or staff can request
+// a connection on a user's behalf.
+func (m *Manager) RequestConnection(JWT, userID, otherUserID string) (*Connection, error) {
+
+	_, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return nil, m.parseJWTErError(err, "validate JWT belongs to"+
+			" subject or has access")
+	}
+
+	if err := m.validateRelationTarget(userID, otherUserID, "connect with"); err != nil {
+		return nil, err
+	}
+
+	existing, err := m.db.Connection(userID, otherUserID)
+	if err == nil {
+		if existing.Status() == ConnectionPending && existing.UserID == otherUserID {
+			return m.acceptConnection(otherUserID, userID)
+		}
+		return existing, nil
+	}
+	if !m.db.IsNotFoundError(err) {
+		return nil, errors.Newf("fetch connection: %v", err)
+	}
+
+	c, err := m.db.InsertConnection(Connection{UserID: userID,
+		ConnectedUserID: otherUserID, Created: time.Now()})
+	if err != nil {
+		if m.db.IsConflictError(err) {
+			return nil, errors.NewConflict("a connection between the users was" +
+				" requested concurrently, please retry")
+		}
+		return nil, errors.Newf("insert connection: %v", err)
+	}
+	return c, nil
+}
+
+// AcceptConnection accepts the connection requested by the user with
+// requesterID from the user with userID. Only the user or staff can accept
+// a connection on a user's behalf.
+func (m *Manager) AcceptConnection(JWT, userID, requesterID string) (*Connection, error) {
+
+	_, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return nil, m.parseJWTErError(err, "validate JWT belongs to"+
+			" subject or has access")
+	}
+
+	blocked, err := m.db.EitherBlocked(userID, requesterID)
+	if err != nil {
+		return nil, errors.Newf("check users blocked: %v", err)
+	}
+	if blocked {
+		return nil, errors.NewForbidden("cannot connect with a user that has" +
+			" blocked or been blocked by the user")
+	}
+
+	return m.acceptConnection(requesterID, userID)
+}
+
+// RemoveConnection removes the connection (pending or accepted) between the
+// user with userID and the user with otherUserID regardless of who requested
+// it i.e. it cancels, declines or ends the connection. Only the user or staff
+// can remove a connection on a user's behalf.
+func (m *Manager) RemoveConnection(JWT, userID, otherUserID string) error {
+
+	_, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return m.parseJWTErError(err, "validate JWT belongs to subject or"+
+			" has access")
+	}
+
+	if err := m.db.DeleteConnection(userID, otherUserID); err != nil {
+		if m.db.IsNotFoundError(err) {
+			return errors.NewNotFound("connection not found")
+		}
+		return errors.Newf("delete connection: %v", err)
+	}
+	return nil
+}
+
+// Connections lists the connections of the user with userID that have
+// status (one of the Connection... values, defaults to ConnectionAccepted),
+// most recent first. Pending connections include requests made by and to
+// the user. Only the user or staff can list a user's connections.
+func (m *Manager) Connections(JWT, userID, status string, offset int64, count int32) ([]Connection, error) {
+
+	_, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return nil, m.parseJWTErError(err, "validate JWT belongs to"+
+			" subject or has access")
+	}
+
+	if status == "" {
+		status = ConnectionAccepted
+	}
+	if status != ConnectionAccepted && status != ConnectionPending {
+		return nil, errors.NewClientf("invalid connection status '%s'", status)
+	}
+	if err := validatePage(offset, count); err != nil {
+		return nil, err
+	}
+
+	cs, err := m.db.Connections(userID, status == ConnectionAccepted, offset, count)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFoundf("no %s connections found for user", status)
+		}
+		return nil, errors.Newf("fetch connections: %v", err)
+	}
+	return cs, nil
+}
+
+// acceptConnection accepts the pending connection requested by the user
+// with requesterID from the user with userID.
+func (m *Manager) acceptConnection(requesterID, userID string) (*Connection, error) {
+	c, err := m.db.AcceptConnection(requesterID, userID, time.Now())
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("no pending connection request found")
+		}
+		return nil, errors.Newf("accept connection: %v", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,28 @@
+package user
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnection_Status(t *testing.T) {
+	tt := []struct {
+		name string
+		c    Connection
+		exp  string
+	}{
+		{name: "pending", c: Connection{Created: time.Now()}, exp: ConnectionPending},
+		{
+			name: "accepted",
+			c:    Connection{Created: time.Now(), Accepted: time.Now()},
+			exp:  ConnectionAccepted,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if act := tc.c.Status(); act != tc.exp {
+				t.Errorf("expected status '%s', got '%s'", tc.exp, act)
+			}
+		})
+	}
+}
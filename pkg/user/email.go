@@ -0,0 +1,167 @@
+package user
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/jwt"
+)
+
+// DefaultEmailTokenValidity is the default duration for which an email
+// verification token is valid.
+const DefaultEmailTokenValidity = 24 * time.Hour
+
+// emailClaimAudience distinguishes email verification tokens from other JWTs
+// signed with the same key.
+const emailClaimAudience = "email-verification"
+
+// emailClaimIssuer is the issuer of email verification tokens.
+const emailClaimIssuer = "usersms"
+
+// Mailer sends emails e.g. mail.SMTP.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// EmailClaim is the claim of a token that verifies that the user with
+// Subject (the user ID) owns Email.
+type EmailClaim struct {
+	Email string
+	jwtgo.StandardClaims
+}
+
+func NewEmailClaim(userID, email string, validity time.Duration) *EmailClaim {
+	issue := time.Now()
+	expiry := issue.Add(validity)
+	return &EmailClaim{
+		Email: email,
+		StandardClaims: jwtgo.StandardClaims{
+			Audience:  emailClaimAudience,
+			Subject:   userID,
+			IssuedAt:  issue.Unix(),
+			ExpiresAt: expiry.Unix(),
+			Issuer:    emailClaimIssuer,
+		},
+	}
+}
+
+// WithMailer sets the Mailer through which email verification tokens are
+// sent. Users cannot set their email if no Mailer is provided.
+func WithMailer(mailer Mailer) Option {
+	return func(m *Manager) error {
+		if mailer == nil {
+			return errors.New("nil Mailer")
+		}
+		m.mailer = mailer
+		return nil
+	}
+}
+
+// WithEmailVerification sets how long email verification tokens are valid
+// (defaults to DefaultEmailTokenValidity) and the URL sent to users to
+// verify their email. verifyURL may contain the placeholders {userID} and
+// {token} e.g. "https://example.com/verify-email?user={userID}&token={token}".
+// Only the token is sent if verifyURL is empty.
+func WithEmailVerification(validity time.Duration, verifyURL string) Option {
+	return func(m *Manager) error {
+		if validity <= 0 {
+			return errors.New("email token validity must be greater than 0")
+		}
+		if verifyURL != "" {
+			if _, err := url.Parse(verifyURL); err != nil {
+				return errors.Newf("invalid email verification URL: %v", err)
+			}
+		}
+		m.emailTokenValidity = validity
+		m.emailVerifyURL = verifyURL
+		return nil
+	}
+}
+
+// VerifyEmail marks the email of the user with userID as verified if
+// verificationToken was issued for the user's current email.
+func (m *Manager) VerifyEmail(userID, verificationToken string) (*User, error) {
+
+	if verificationToken == "" {
+		return nil, errors.NewUnauthorized("verification token was empty")
+	}
+	clm := &EmailClaim{}
+	if err := m.jwter.JWTValidOnClaim(verificationToken, clm); err != nil {
+		return nil, m.parseJWTErError(err, "validate verification token")
+	}
+	if clm.Audience != emailClaimAudience || clm.Subject != userID || clm.Email == "" {
+		return nil, errors.NewForbidden("verification token is not valid for this user")
+	}
+
+	usr, err := m.db.User(userID, time.Time{})
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("user not found")
+		}
+		return nil, errors.Newf("fetch user: %v", err)
+	}
+	if usr.Email != clm.Email {
+		return nil, errors.NewForbidden("verification token was issued for" +
+			" an email that is no longer on the profile")
+	}
+	if usr.EmailVerified {
+		return usr, nil
+	}
+
+	// Whoever holds the token acts on behalf of the user.
+	actor := Actor{UserID: userID, AccessLevel: jwt.AccessLevelUser}
+	usr, err = m.db.SetEmailVerified(userID, clm.Email, actor, time.Now())
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewForbidden("verification token was issued" +
+				" for an email that is no longer on the profile")
+		}
+		return nil, errors.Newf("set email verified: %v", err)
+	}
+	return usr, nil
+}
+
+// validateEmail returns a client error if email is not a plain email
+// address e.g. jane@example.com.
+func validateEmail(email string) error {
+	if utf8.RuneCountInString(email) > 256 {
+		return errors.NewClient("email must be at most 256 characters")
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return errors.NewClientf("invalid email '%s'", email)
+	}
+	return nil
+}
+
+// sendEmailVerification sends a token to usr's email with which to verify
+// it (see VerifyEmail).
+func (m *Manager) sendEmailVerification(usr *User) error {
+
+	token, err := m.jwter.Generate(NewEmailClaim(usr.ID, usr.Email, m.emailTokenValidity))
+	if err != nil {
+		return errors.Newf("generate verification token: %v", err)
+	}
+
+	body := fmt.Sprintf("Use this token to verify your email: %s", token)
+	if m.emailVerifyURL != "" {
+		link := strings.NewReplacer(
+			"{userID}", url.QueryEscape(usr.ID),
+			"{token}", url.QueryEscape(token),
+		).Replace(m.emailVerifyURL)
+		body = fmt.Sprintf("Open this link to verify your email: %s", link)
+	}
+	body = fmt.Sprintf("%s\n\nIt expires in %s. Ignore this email if you did"+
+		" not add it to your profile.", body, m.emailTokenValidity)
+
+	if err := m.mailer.Send(usr.Email, "Verify your email", body); err != nil {
+		return errors.Newf("send verification email: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package user
+
+import (
+	"testing"
+)
+
+func TestValidateEmail(t *testing.T) {
+	tt := []struct {
+		name   string
+		email  string
+		expErr bool
+	}{
+		{name: "valid", email: "jane@example.com"},
+		{name: "no domain", email: "jane", expErr: true},
+		{name: "display name", email: "Jane <jane@example.com>", expErr: true},
+		{name: "header injection", email: "jane@example.com\r\nBcc: x@example.com", expErr: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateEmail(tc.email)
+			if tc.expErr != (err != nil) {
+				t.Errorf("Expected error %t, got %v", tc.expErr, err)
+			}
+		})
+	}
+}
+
+func TestManager_project_email(t *testing.T) {
+	m := &Manager{}
+	public := Privacy{FieldEmail: VisibilityPublic}
+
+	unverified := &User{ID: "123", Email: "jane@example.com", Privacy: public}
+	if got := m.project(unverified, relationAuthenticated); got.Email != "" || got.EmailVerified {
+		t.Errorf("Unverified email exposed to other users: %+v", got)
+	}
+	if got := m.project(unverified, relationSelf); got.Email != unverified.Email {
+		t.Errorf("Expected user to view their unverified email, got %+v", got)
+	}
+
+	verified := &User{ID: "123", Email: "jane@example.com", EmailVerified: true, Privacy: public}
+	if got := m.project(verified, relationAnonymous); got.Email != verified.Email || !got.EmailVerified {
+		t.Errorf("Expected public verified email, got %+v", got)
+	}
+}
@@ -0,0 +1,53 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// PreconditionFailedError is returned when a conditional update e.g. one with
+// UserUpdate.IfLastUpdated set does not apply because the user has changed.
+type PreconditionFailedError struct {
+	Data interface{}
+}
+
+func (e PreconditionFailedError) Error() string {
+	return fmt.Sprint(e.Data)
+}
+
+// ToHTTPResponse writes e to w with the 412 Precondition Failed status code.
+func (e PreconditionFailedError) ToHTTPResponse(w http.ResponseWriter) (int, bool) {
+	http.Error(w, e.Error(), http.StatusPreconditionFailed)
+	return http.StatusPreconditionFailed, true
+}
+
+// IsPreconditionFailedError returns true if err is a PreconditionFailedError.
+func IsPreconditionFailedError(err error) bool {
+	_, ok := err.(PreconditionFailedError)
+	return ok
+}
+
+// MergedError is returned when accessing a user that has been merged into
+// another user (see Manager.Merge).
+type MergedError struct {
+	UserID     string
+	MergedInto string
+}
+
+func (e MergedError) Error() string {
+	return fmt.Sprintf("user %s has been merged into user %s", e.UserID, e.MergedInto)
+}
+
+// ToHTTPResponse writes e to w with the 308 Permanent Redirect status code.
+// The caller should set the Location header to the URL of the user e was
+// merged into.
+func (e MergedError) ToHTTPResponse(w http.ResponseWriter) (int, bool) {
+	http.Error(w, e.Error(), http.StatusPermanentRedirect)
+	return http.StatusPermanentRedirect, true
+}
+
+// IsMergedError returns true if err is a MergedError.
+func IsMergedError(err error) bool {
+	_, ok := err.(MergedError)
+	return ok
+}
@@ -0,0 +1,53 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tomogoma/go-typed-errors"
+)
+
+func TestManager_ToHTTPResponse(t *testing.T) {
+	tt := []struct {
+		name    string
+		err     error
+		expCode int
+		expOK   bool
+	}{
+		{
+			name:    "precondition failed",
+			err:     PreconditionFailedError{Data: "user changed"},
+			expCode: http.StatusPreconditionFailed,
+			expOK:   true,
+		},
+		{
+			name:    "merged",
+			err:     MergedError{UserID: "123", MergedInto: "456"},
+			expCode: http.StatusPermanentRedirect,
+			expOK:   true,
+		},
+		{
+			name:    "typed error",
+			err:     errors.NewNotFound("user not found"),
+			expCode: http.StatusNotFound,
+			expOK:   true,
+		},
+		{
+			name:    "untyped error",
+			err:     errors.Newf("db error"),
+			expCode: -1,
+			expOK:   false,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &Manager{}
+			code, ok := m.ToHTTPResponse(tc.err, httptest.NewRecorder())
+			if ok != tc.expOK || code != tc.expCode {
+				t.Errorf("Expected (%d, %t), got (%d, %t)",
+					tc.expCode, tc.expOK, code, ok)
+			}
+		})
+	}
+}
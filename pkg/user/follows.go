@@ -0,0 +1,167 @@
+package user
+
+import (
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/jwt"
+)
+
+// Follow is a directed edge recording that the user with UserID follows the
+// user with FollowedUserID.
+type Follow struct {
+	UserID         string
+	FollowedUserID string
+	Created        time.Time
+}
+
+// Follow makes the user with userID follow the user with followedUserID.
+// Following an already followed user has no effect. Users that have blocked
+// each other cannot follow each other. Only the user or staff can follow on
+// a user's behalf.
+func (m *Manager) Follow(JWT, userID, followedUserID string) (*Follow, error) {
+
+	_, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return nil, m.parseJWTErError(err, "validate JWT belongs to"+
+			" subject or has access")
+	}
+
+	if err := m.validateRelationTarget(userID, followedUserID, "follow"); err != nil {
+		return nil, err
+	}
+
+	f, err := m.db.InsertFollow(Follow{UserID: userID,
+		FollowedUserID: followedUserID, Created: time.Now()})
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("user not found")
+		}
+		return nil, errors.Newf("insert follow: %v", err)
+	}
+	return f, nil
+}
+
+// Unfollow reverses Follow. Only the user or staff can unfollow on a user's
+// behalf.
+func (m *Manager) Unfollow(JWT, userID, followedUserID string) error {
+
+	_, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return m.parseJWTErError(err, "validate JWT belongs to subject or"+
+			" has access")
+	}
+
+	if err := m.db.DeleteFollow(userID, followedUserID); err != nil {
+		if m.db.IsNotFoundError(err) {
+			return errors.NewNotFound("user is not followed")
+		}
+		return errors.Newf("delete follow: %v", err)
+	}
+	return nil
+}
+
+// Followers lists the users following the user with userID, most recent
+// first. The same access rules as User apply to the user with userID.
+func (m *Manager) Followers(JWT, userID string, offset int64, count int32) ([]Follow, error) {
+
+	if err := m.validateGraphPage(JWT, userID, offset, count); err != nil {
+		return nil, err
+	}
+
+	fs, err := m.db.Followers(userID, offset, count)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("no followers found for user")
+		}
+		return nil, errors.Newf("fetch followers: %v", err)
+	}
+	return fs, nil
+}
+
+// Following lists the users followed by the user with userID, most recent
+// first. The same access rules as User apply to the user with userID.
+func (m *Manager) Following(JWT, userID string, offset int64, count int32) ([]Follow, error) {
+
+	if err := m.validateGraphPage(JWT, userID, offset, count); err != nil {
+		return nil, err
+	}
+
+	fs, err := m.db.Following(userID, offset, count)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("user does not follow anyone")
+		}
+		return nil, errors.Newf("fetch following: %v", err)
+	}
+	return fs, nil
+}
+
+// validateGraphPage validates that the JWT subject can view the user with
+// userID and that offset and count describe a valid page.
+func (m *Manager) validateGraphPage(JWT, userID string, offset int64, count int32) error {
+
+	clm, err := m.claim(JWT)
+	if err != nil {
+		return err
+	}
+
+	if err := validatePage(offset, count); err != nil {
+		return err
+	}
+
+	usr, err := m.db.User(userID, time.Time{})
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return errors.NewNotFound("user not found")
+		}
+		return errors.Newf("fetch user: %v", err)
+	}
+	if !usr.Deactivated.IsZero() && !isOwnerOrStaff(clm, usr.ID) {
+		return errors.NewNotFound("user not found")
+	}
+	blocked, err := m.blockedBy(clm, *usr)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return errors.NewNotFound("user not found")
+	}
+
+	return nil
+}
+
+// validateRelationTarget validates that the user with userID can form a
+// relationship (follow or connection, named by relationship in error
+// messages) with the user with otherUserID.
+func (m *Manager) validateRelationTarget(userID, otherUserID, relationship string) error {
+
+	if otherUserID == "" {
+		return errors.NewClientf("ID of the user to %s was empty", relationship)
+	}
+	if otherUserID == userID {
+		return errors.NewClientf("a user cannot %s themselves", relationship)
+	}
+
+	other, err := m.db.User(otherUserID, time.Time{})
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return errors.NewNotFoundf("user to %s not found", relationship)
+		}
+		return errors.Newf("fetch user to %s: %v", relationship, err)
+	}
+	if !other.Deactivated.IsZero() {
+		return errors.NewNotFoundf("user to %s not found", relationship)
+	}
+
+	blocked, err := m.db.EitherBlocked(userID, otherUserID)
+	if err != nil {
+		return errors.Newf("check users blocked: %v", err)
+	}
+	if blocked {
+		return errors.NewForbiddenf("cannot %s a user that has blocked or"+
+			" been blocked by the user", relationship)
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package user
+
+import (
+	"github.com/tomogoma/go-typed-errors"
+)
+
+// maxGenderLength is the maximum length of a Gender value that can be stored.
+const maxGenderLength = 16
+
+// defaultGenders are the genders users can choose from unless overridden
+// with WithGenders.
+var defaultGenders = []Gender{
+	{Value: "MALE", Label: "Male"},
+	{Value: "FEMALE", Label: "Female"},
+	{Value: "OTHER", Label: "Other"},
+	{Value: "UNDISCLOSED", Label: "Prefer not to say"},
+}
+
+// Gender is a value users can set as their gender.
+type Gender struct {
+	// Value is stored on the user's profile e.g. "FEMALE".
+	Value string `json:"value" yaml:"value"`
+	// Label is the display name of Value for clients e.g. "Female".
+	// Defaults to Value.
+	Label string `json:"label" yaml:"label"`
+}
+
+// WithGenders sets the genders users can choose from, in the order they
+// should be displayed, replacing the defaults. Users whose gender is no
+// longer among genders keep it until they update it.
+func WithGenders(genders ...Gender) Option {
+	return func(m *Manager) error {
+		if len(genders) == 0 {
+			return errors.New("at least one gender must be provided")
+		}
+		seen := make(map[string]bool, len(genders))
+		m.genders = make([]Gender, 0, len(genders))
+		for _, g := range genders {
+			if g.Value == "" {
+				return errors.New("gender value must not be empty")
+			}
+			if len(g.Value) > maxGenderLength {
+				return errors.Newf("gender value '%s' must be at most %d"+
+					" characters", g.Value, maxGenderLength)
+			}
+			if seen[g.Value] {
+				return errors.Newf("gender '%s' declared more than once", g.Value)
+			}
+			seen[g.Value] = true
+			if g.Label == "" {
+				g.Label = g.Value
+			}
+			m.genders = append(m.genders, g)
+		}
+		return nil
+	}
+}
+
+// Genders returns the genders users can choose from in display order.
+func (m *Manager) Genders() []Gender {
+	return append([]Gender(nil), m.genders...)
+}
+
+// genderValues returns the values of the genders users can choose from.
+func (m *Manager) genderValues() []string {
+	values := make([]string, len(m.genders))
+	for i, g := range m.genders {
+		values[i] = g.Value
+	}
+	return values
+}
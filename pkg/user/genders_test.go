@@ -0,0 +1,46 @@
+package user
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWithGenders(t *testing.T) {
+	tt := []struct {
+		name    string
+		genders []Gender
+		exp     []Gender
+		expErr  bool
+	}{
+		{
+			name:    "valid",
+			genders: []Gender{{Value: "FEMALE", Label: "Female"}, {Value: "NON_BINARY"}},
+			exp:     []Gender{{Value: "FEMALE", Label: "Female"}, {Value: "NON_BINARY", Label: "NON_BINARY"}},
+		},
+		{name: "none", genders: []Gender{}, expErr: true},
+		{name: "empty value", genders: []Gender{{Label: "Female"}}, expErr: true},
+		{name: "value too long", genders: []Gender{{Value: "PREFER_NOT_TO_SAY"}}, expErr: true},
+		{name: "duplicate", genders: []Gender{{Value: "MALE"}, {Value: "MALE"}}, expErr: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &Manager{genders: defaultGenders}
+			err := WithGenders(tc.genders...)(m)
+			if tc.expErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if !reflect.DeepEqual(m.Genders(), tc.exp) {
+				t.Errorf("Expected %+v, got %+v", tc.exp, m.Genders())
+			}
+			if !in("NON_BINARY", m.genderValues()) || in("MALE", m.genderValues()) {
+				t.Errorf("Expected gender values to be replaced, got %v", m.genderValues())
+			}
+		})
+	}
+}
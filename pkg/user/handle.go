@@ -0,0 +1,139 @@
+package user
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/jwt"
+)
+
+// DefaultHandleCooldown is the default minimum duration between changes to
+// a user's handle.
+const DefaultHandleCooldown = 30 * 24 * time.Hour
+
+// handleRegexp matches valid handles: 3 to 30 letters, digits or underscores
+// starting with a letter.
+var handleRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{2,29}$`)
+
+// defaultReservedHandles are handles that cannot be claimed by users because
+// they would be confusing or collide with paths/system accounts.
+var defaultReservedHandles = []string{
+	"admin", "administrator", "anonymous", "api", "help", "me", "moderator",
+	"null", "root", "settings", "staff", "support", "system", "undefined",
+	"user", "users", "usersms",
+}
+
+// WithReservedHandles adds handles to the list of handles that users cannot
+// claim. Comparison is case insensitive.
+func WithReservedHandles(handles ...string) Option {
+	return func(m *Manager) error {
+		for _, handle := range handles {
+			m.reservedHandles[strings.ToLower(handle)] = true
+		}
+		return nil
+	}
+}
+
+// WithHandleCooldown sets the minimum duration between changes to a user's
+// handle. Defaults to DefaultHandleCooldown. Staff are not subject to the
+// cooldown.
+func WithHandleCooldown(d time.Duration) Option {
+	return func(m *Manager) error {
+		if d < 0 {
+			return errors.Newf("handle cooldown must not be negative")
+		}
+		m.handleCooldown = d
+		return nil
+	}
+}
+
+// UserByHandle fetches the user with handle (case insensitive). The same
+// access rules as User apply.
+func (m *Manager) UserByHandle(JWT, handle string) (*User, error) {
+
+	clm, err := m.claim(JWT)
+	if err != nil {
+		return nil, err
+	}
+
+	usr, err := m.db.UserByHandle(handle)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("user not found")
+		}
+		return nil, errors.Newf("fetch user by handle: %v", err)
+	}
+
+	if !usr.Deactivated.IsZero() && !isOwnerOrStaff(clm, usr.ID) {
+		return nil, errors.NewNotFound("user not found")
+	}
+
+	blocked, err := m.blockedBy(clm, *usr)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, errors.NewNotFound("user not found")
+	}
+
+	rels, err := m.relations(clm, []User{*usr})
+	if err != nil {
+		return nil, err
+	}
+
+	return m.project(usr, rels[usr.ID]), nil
+}
+
+// validateHandleUpdate validates the handle in uu against the handle rules,
+// the reserved handles, the cooldown since current's handle last changed and
+// the handles already taken by other users.
+func (m *Manager) validateHandleUpdate(uu UserUpdate, current *User) error {
+
+	if !uu.Handle.IsUpdating {
+		return nil
+	}
+
+	newHandle := uu.Handle.NewValue
+	if current != nil && newHandle == current.Handle {
+		return nil
+	}
+
+	if newHandle != "" {
+		if !handleRegexp.MatchString(newHandle) {
+			return errors.NewClient("handle must be 3 to 30 letters, digits" +
+				" or underscores starting with a letter")
+		}
+		if m.reservedHandles[strings.ToLower(newHandle)] {
+			return errors.NewClientf("handle '%s' is reserved", newHandle)
+		}
+	}
+
+	if current != nil && !current.HandleUpdated.IsZero() &&
+		uu.ActorAccessLevel > jwt.AccessLevelStaff {
+
+		nextChange := current.HandleUpdated.Add(m.handleCooldown)
+		if time.Now().Before(nextChange) {
+			return errors.NewClientf("handle was changed recently and can be"+
+				" changed again after %s", nextChange.Format(time.RFC3339))
+		}
+	}
+
+	if newHandle == "" {
+		return nil
+	}
+
+	owner, err := m.db.UserByHandle(newHandle)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil
+		}
+		return errors.Newf("check handle availability: %v", err)
+	}
+	if owner.ID != uu.UserID {
+		return errors.NewConflictf("handle '%s' is already taken", newHandle)
+	}
+
+	return nil
+}
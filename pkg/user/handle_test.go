@@ -0,0 +1,41 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tomogoma/usersms/pkg/jwt"
+)
+
+func TestManager_validateHandleUpdate(t *testing.T) {
+	recent := &User{ID: "123", Handle: "jane_doe", HandleUpdated: time.Now().Add(-time.Hour)}
+	tt := []struct {
+		name    string
+		update  UserUpdate
+		current *User
+		expErr  bool
+	}{
+		{name: "not updating", update: UserUpdate{UserID: "123"}},
+		{name: "unchanged", update: UserUpdate{UserID: "123", Handle: StringUpdate{IsUpdating: true, NewValue: "jane_doe"}}, current: recent},
+		{name: "too short", update: UserUpdate{UserID: "123", Handle: StringUpdate{IsUpdating: true, NewValue: "jd"}}, expErr: true},
+		{name: "starts with digit", update: UserUpdate{UserID: "123", Handle: StringUpdate{IsUpdating: true, NewValue: "1jane"}}, expErr: true},
+		{name: "invalid char", update: UserUpdate{UserID: "123", Handle: StringUpdate{IsUpdating: true, NewValue: "jane.doe"}}, expErr: true},
+		{name: "reserved", update: UserUpdate{UserID: "123", Handle: StringUpdate{IsUpdating: true, NewValue: "Admin"}}, expErr: true},
+		{name: "custom reserved", update: UserUpdate{UserID: "123", Handle: StringUpdate{IsUpdating: true, NewValue: "Acme"}}, expErr: true},
+		{name: "cooldown", update: UserUpdate{UserID: "123", Handle: StringUpdate{IsUpdating: true, NewValue: "jane"}, ActorAccessLevel: jwt.AccessLevelStaff + 1}, current: recent, expErr: true},
+		{name: "cooldown removing", update: UserUpdate{UserID: "123", Handle: StringUpdate{IsUpdating: true, NewValue: ""}, ActorAccessLevel: jwt.AccessLevelStaff + 1}, current: recent, expErr: true},
+		{name: "cooldown staff", update: UserUpdate{UserID: "123", Handle: StringUpdate{IsUpdating: true, NewValue: ""}, ActorAccessLevel: jwt.AccessLevelStaff}, current: recent},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &Manager{reservedHandles: make(map[string]bool), handleCooldown: DefaultHandleCooldown}
+			if err := WithReservedHandles(append(defaultReservedHandles, "acme")...)(m); err != nil {
+				t.Fatalf("Error setting up: with reserved handles: %v", err)
+			}
+			err := m.validateHandleUpdate(tc.update, tc.current)
+			if tc.expErr != (err != nil) {
+				t.Errorf("Expected error %t, got %v", tc.expErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package user
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/jwt"
+)
+
+// maxICEContacts is the maximum number of emergency contacts a user can have.
+const maxICEContacts = 3
+
+// ICEContact is an (In Case of Emergency) contact of a user. The contact with
+// the lowest Priority value is the user's primary contact, whose phone is
+// mirrored in User.ICEPhone.
+type ICEContact struct {
+	ID           string
+	UserID       string
+	Name         string
+	Relationship string
+	Phone        string
+	Priority     int32
+	// PhoneRegion, if not empty, is the ISO 3166-1 alpha-2 region code
+	// assumed for Phone if it is not in international format. It takes
+	// precedence over the user's Country and is not stored.
+	PhoneRegion string
+	Created     time.Time
+	LastUpdated time.Time
+}
+
+// Actor identifies the JWT subject making a change.
+type Actor struct {
+	UserID      string
+	AccessLevel float32
+}
+
+// ICEContacts lists the emergency contacts of the user with userID in order of
+// priority. Callers can only list the contacts if they can view the user's
+// ICEPhone (see Privacy).
+func (m *Manager) ICEContacts(JWT, userID string) ([]ICEContact, error) {
+
+	clm, err := m.claim(JWT)
+	if err != nil {
+		return nil, err
+	}
+
+	usr, err := m.db.User(userID, time.Time{})
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("user not found")
+		}
+		return nil, errors.Newf("fetch user: %v", err)
+	}
+	if !usr.Deactivated.IsZero() && !isOwnerOrStaff(clm, usr.ID) {
+		return nil, errors.NewNotFound("user not found")
+	}
+
+	blocked, err := m.blockedBy(clm, *usr)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, errors.NewNotFound("user not found")
+	}
+
+	rels, err := m.relations(clm, []User{*usr})
+	if err != nil {
+		return nil, err
+	}
+	if !usr.Privacy.canView(FieldICEPhone, rels[userID]) {
+		if clm == nil {
+			return nil, errors.NewUnauthorized("a token is required to view" +
+				" this user's emergency contacts")
+		}
+		return nil, errors.NewForbidden("the user's emergency contacts are" +
+			" not visible to you")
+	}
+
+	cs, err := m.db.ICEContacts(userID)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("user has no emergency contacts")
+		}
+		return nil, errors.Newf("fetch emergency contacts: %v", err)
+	}
+	return cs, nil
+}
+
+// AddICEContact adds c to the emergency contacts of the user with c.UserID.
+// A zero c.Priority places the contact after all existing contacts. A
+// verification code is sent if the user's ICEPhone changes as a result (see
+// VerifyICEPhone). Only the user or staff can add a user's emergency
+// contacts.
+func (m *Manager) AddICEContact(JWT string, c ICEContact) (*ICEContact, error) {
+
+	actor, usr, err := m.iceContactActor(JWT, c.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := m.db.ICEContacts(c.UserID)
+	if err != nil && !m.db.IsNotFoundError(err) {
+		return nil, errors.Newf("fetch emergency contacts: %v", err)
+	}
+	if len(existing) >= maxICEContacts {
+		return nil, errors.NewClientf("a user can have at most %d emergency"+
+			" contacts", maxICEContacts)
+	}
+	if c.Priority == 0 {
+		c.Priority = 1
+		if len(existing) > 0 {
+			c.Priority = existing[len(existing)-1].Priority + 1
+		}
+	}
+
+	if err := m.validateICEContact(&c, usr.Country); err != nil {
+		return nil, err
+	}
+
+	c.Created = time.Now()
+	c.LastUpdated = c.Created
+	saved, err := m.db.InsertICEContact(c, maxICEContacts, *actor)
+	if err != nil {
+		if m.db.IsConflictError(err) {
+			return nil, errors.NewClientf("a user can have at most %d"+
+				" emergency contacts", maxICEContacts)
+		}
+		return nil, errors.Newf("insert emergency contact: %v", err)
+	}
+	m.verifyChangedICEPhone(c.UserID, usr.ICEPhone)
+	return saved, nil
+}
+
+// UpdateICEContact replaces the emergency contact with c.ID and c.UserID with
+// c. A verification code is sent if the user's ICEPhone changes as a result.
+// Only the user or staff can update a user's emergency contacts.
+func (m *Manager) UpdateICEContact(JWT string, c ICEContact) (*ICEContact, error) {
+
+	actor, usr, err := m.iceContactActor(JWT, c.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ID == "" {
+		return nil, errors.NewClient("contact ID was empty")
+	}
+	if err := m.validateICEContact(&c, usr.Country); err != nil {
+		return nil, err
+	}
+
+	c.LastUpdated = time.Now()
+	updated, err := m.db.UpdateICEContact(c, *actor)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("emergency contact not found")
+		}
+		return nil, errors.Newf("update emergency contact: %v", err)
+	}
+	m.verifyChangedICEPhone(c.UserID, usr.ICEPhone)
+	return updated, nil
+}
+
+// DeleteICEContact removes the emergency contact with contactID from the
+// user with userID. A verification code is sent if the user's ICEPhone
+// changes to the next contact's phone. Only the user or staff can delete a
+// user's emergency contacts.
+func (m *Manager) DeleteICEContact(JWT, userID, contactID string) error {
+
+	actor, usr, err := m.iceContactActor(JWT, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := m.db.DeleteICEContact(userID, contactID, *actor, time.Now()); err != nil {
+		if m.db.IsNotFoundError(err) {
+			return errors.NewNotFound("emergency contact not found")
+		}
+		return errors.Newf("delete emergency contact: %v", err)
+	}
+	m.verifyChangedICEPhone(userID, usr.ICEPhone)
+	return nil
+}
+
+// verifyChangedICEPhone sends a verification of the ICEPhone of the user with
+// userID, as Update does, if changing their emergency contacts changed it
+// from prevICEPhone. Failures are logged since the change has been saved.
+func (m *Manager) verifyChangedICEPhone(userID, prevICEPhone string) {
+	usr, err := m.db.User(userID, time.Time{})
+	if err != nil {
+		m.logOnError(errors.Newf("fetch user: %v", err), "send ICE phone verification to user %s", userID)
+		return
+	}
+	if usr.ICEPhone == "" || usr.ICEPhone == prevICEPhone || usr.ICEPhoneVerified {
+		return
+	}
+	m.logOnError(m.sendPhoneVerification(usr), "send ICE phone verification to user %s", userID)
+}
+
+// iceContactActor validates that JWT belongs to the user with userID or to
+// staff and that the user's profile can still be updated. It returns the
+// JWT subject and the user.
+func (m *Manager) iceContactActor(JWT, userID string) (*Actor, *User, error) {
+
+	clm, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return nil, nil, m.parseJWTErError(err, "validate JWT belongs to"+
+			" subject or has access")
+	}
+
+	usr, err := m.db.User(userID, time.Time{})
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, nil, errors.NewNotFound("user not found")
+		}
+		return nil, nil, errors.Newf("fetch user: %v", err)
+	}
+	if !usr.Erased.IsZero() {
+		return nil, nil, errors.NewClient("profile has been erased and cannot be updated")
+	}
+
+	return &Actor{UserID: clm.UsrID, AccessLevel: clm.Group.AccessLevel}, usr, nil
+}
+
+// validateICEContact validates c with side-effects on the Phone and
+// PhoneRegion values which are also formatted if valid. Phone numbers not in
+// international format are assumed to be from c.PhoneRegion or country.
+func (m *Manager) validateICEContact(c *ICEContact, country string) error {
+	if c.Name == "" {
+		return errors.NewClient("contact name was empty")
+	}
+	if utf8.RuneCountInString(c.Name) > 256 {
+		return errors.NewClient("contact name must be at most 256 characters")
+	}
+	if utf8.RuneCountInString(c.Relationship) > 56 {
+		return errors.NewClient("contact relationship must be at most 56 characters")
+	}
+	if c.Phone == "" {
+		return errors.NewClient("contact phone was empty")
+	}
+	var err error
+	if c.PhoneRegion != "" {
+		if c.PhoneRegion, err = m.normalizeRegion("phone region", c.PhoneRegion); err != nil {
+			return err
+		}
+	}
+	if c.Phone, err = m.pf.FormatValidPhone(c.Phone, phoneRegion(c.PhoneRegion, country)); err != nil {
+		return errors.NewClient(err)
+	}
+	if c.Priority < 1 {
+		return errors.NewClient("contact priority must be >= 1")
+	}
+	return nil
+}
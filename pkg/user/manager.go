@@ -1,41 +1,138 @@
 package user
 
 import (
+	"fmt"
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/tomogoma/crdb"
 	"github.com/tomogoma/go-typed-errors"
 	"github.com/tomogoma/usersms/pkg/jwt"
-	"net/url"
+	"github.com/tomogoma/usersms/pkg/logging"
+	"github.com/tomogoma/usersms/pkg/rating"
+	"net/http"
 	"time"
 )
 
-var validGenders = []string{"MALE", "FEMALE", "OTHER"}
+// maxBulkIDs is the maximum number of user IDs that can be fetched in a single
+// call to Manager.Users.
+const maxBulkIDs = 100
+
+// perQDBFetch is the number of records to fetch per DB query when
+// collecting all records of a kind.
+const perQDBFetch = 100
 
 type DB interface {
 	errors.IsNotFoundErrChecker
+	errors.IsConflictErrChecker
 
 	UpsertUser(UserUpdate) (*User, error)
 	User(userID string, offsetUpdateDate time.Time) (*User, error)
+	UserByHandle(handle string) (*User, error)
+	Users(IDs []string) ([]User, error)
+	SearchUsers(Filter) ([]User, error)
+	SetUserDeactivated(userID string, deactivated, now time.Time) error
+	EraseUser(userID string, at time.Time) error
+	UserHistory(userID string, offset int64, count int32) ([]Change, error)
+	Ratings(rating.Filter) ([]rating.Rating, error)
+	RatedConnections(userID string, otherUserIDs []string) ([]string, error)
+	ICEContacts(userID string) ([]ICEContact, error)
+	InsertICEContact(c ICEContact, maxContacts int, by Actor) (*ICEContact, error)
+	UpdateICEContact(c ICEContact, by Actor) (*ICEContact, error)
+	DeleteICEContact(userID, contactID string, by Actor, at time.Time) error
+	SetEmailVerified(userID, email string, by Actor, at time.Time) (*User, error)
+	PhoneVerification(userID string) (*PhoneVerification, error)
+	SetPhoneVerification(PhoneVerification) error
+	ClaimPhoneVerificationAttempt(userID string, maxAttempts int32, at time.Time) (*PhoneVerification, error)
+	SetICEPhoneVerified(userID, phone string, by Actor, at time.Time) (*User, error)
+	Blocks(userID string) ([]Block, error)
+	InsertBlock(Block) (*Block, error)
+	DeleteBlock(userID, blockedUserID string) error
+	BlockersOf(userID string, otherUserIDs []string) ([]string, error)
+	EitherBlocked(userID, otherUserID string) (bool, error)
+	InsertFollow(Follow) (*Follow, error)
+	DeleteFollow(userID, followedUserID string) error
+	Followers(userID string, offset int64, count int32) ([]Follow, error)
+	Following(userID string, offset int64, count int32) ([]Follow, error)
+	Follows(userID, followedUserID string) (bool, error)
+	Connection(userID, otherUserID string) (*Connection, error)
+	InsertConnection(Connection) (*Connection, error)
+	AcceptConnection(requesterID, userID string, at time.Time) (*Connection, error)
+	DeleteConnection(userID, otherUserID string) error
+	Connections(userID string, accepted bool, offset int64, count int32) ([]Connection, error)
+	AcceptedConnections(userID string, otherUserIDs []string) ([]string, error)
+	UserModerations(userID string, offset int64, count int32) ([]Moderation, error)
+	ModerationQueue(status string, offset int64, count int32) ([]Moderation, error)
+	ResolveModeration(ID, status string, by Actor, at time.Time) (*Moderation, error)
+	MergeUsers(Merge) (*User, error)
 }
 
 type JWTEr interface {
 	errors.IsAuthErrChecker
 	IsOwnerOrJWTHasAccess(JWT string, owner string, acl float32) (*jwt.AuthMSClaim, error)
+	JWTHasAccess(JWT string, acl float32) (*jwt.AuthMSClaim, error)
 	JWTValid(JWT string) (*jwt.AuthMSClaim, error)
+	JWTValidOnClaim(JWT string, clm jwtgo.Claims) error
+	Generate(claims jwtgo.Claims) (string, error)
 }
 
 type FormatValidPhoner interface {
-	FormatValidPhone(number string) (string, error)
+	// FormatValidPhone validates and formats number assuming regionCode
+	// (or the implementation's default if empty) for numbers that are
+	// not in international format.
+	FormatValidPhone(number, regionCode string) (string, error)
+	IsValidRegion(regionCode string) bool
 }
 
 type Manager struct {
 	errors.ClErrCheck
+	errors.ConflictErrCheck
 	errors.ErrToHTTP
 
-	db    DB
-	jwter JWTEr
-	pf    FormatValidPhoner
+	db              DB
+	jwter           JWTEr
+	pf              FormatValidPhoner
+	attrSpecs       map[string]AttributeSpec
+	reservedHandles map[string]bool
+	handleCooldown  time.Duration
+
+	completenessWeights map[string]int
+
+	genders []Gender
+
+	mailer             Mailer
+	emailTokenValidity time.Duration
+	emailVerifyURL     string
+
+	sms                  SMSSender
+	phoneCodeValidity    time.Duration
+	phoneCodeMaxAttempts int32
+
+	checker        ContentChecker
+	moderationMode string
+
+	avatars     AvatarStore
+	avatarHosts map[string]bool
+
+	lg logging.Logger
 }
 
-func NewManager(db DB, jwter JWTEr, pf FormatValidPhoner) (*Manager, error) {
+// Option allows extra configuration for instantiating Manager. Use the With...
+// functions (e.g. WithAttributes) to set options.
+type Option func(*Manager) error
+
+// WithLogger sets the logger for failures that do not fail the operation in
+// which they occur e.g. sending a verification for a saved email. Such
+// failures are not reported by default.
+func WithLogger(lg logging.Logger) Option {
+	return func(m *Manager) error {
+		if lg == nil {
+			return errors.New("nil Logger")
+		}
+		m.lg = lg
+		return nil
+	}
+}
+
+func NewManager(db DB, jwter JWTEr, pf FormatValidPhoner, opts ...Option) (*Manager, error) {
 	if db == nil {
 		return nil, errors.Newf("nil DB")
 	}
@@ -45,38 +142,124 @@ func NewManager(db DB, jwter JWTEr, pf FormatValidPhoner) (*Manager, error) {
 	if pf == nil {
 		return nil, errors.Newf("nil FormatValidPhoner")
 	}
-	return &Manager{db: db, jwter: jwter, pf: pf}, nil
+	m := &Manager{
+		db:              db,
+		jwter:           jwter,
+		pf:              pf,
+		attrSpecs:       make(map[string]AttributeSpec),
+		reservedHandles: make(map[string]bool),
+		handleCooldown:  DefaultHandleCooldown,
+
+		completenessWeights: defaultCompletenessWeights,
+
+		genders: defaultGenders,
+
+		emailTokenValidity: DefaultEmailTokenValidity,
+
+		phoneCodeValidity:    DefaultPhoneCodeValidity,
+		phoneCodeMaxAttempts: DefaultPhoneCodeMaxAttempts,
+	}
+	for _, handle := range defaultReservedHandles {
+		m.reservedHandles[handle] = true
+	}
+	for i, opt := range opts {
+		if opt == nil {
+			return nil, errors.Newf("received nil Option at index %d", i)
+		}
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
 }
 
 func (m *Manager) Update(JWT string, update UserUpdate) (*User, error) {
 
-	_, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, update.UserID, jwt.AccessLevelStaff)
+	clm, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, update.UserID, jwt.AccessLevelStaff)
 	if err != nil {
 		return nil, m.parseJWTErError(err, "validate JWT belongs to"+
 			" subject or has access")
 	}
+	update.ActorUserID = clm.UsrID
+	update.ActorAccessLevel = clm.Group.AccessLevel
 
-	if err := m.validateUserUpdate(&update); err != nil {
-		if m.IsClientError(err) {
-			return nil, err
-		}
-		return nil, errors.Newf("validate user update: %v", err)
+	if err := m.ValidateUpdate(&update); err != nil {
+		return nil, err
 	}
 
 	update.Time = time.Now()
+	if err := m.moderate(&update); err != nil {
+		return nil, err
+	}
+
 	usr, err := m.db.UpsertUser(update)
 	if err != nil {
+		if IsPreconditionFailedError(err) || IsMergedError(err) {
+			return nil, err
+		}
+		if m.db.IsConflictError(err) {
+			return nil, err
+		}
 		return nil, errors.Newf("upsert user: %v", err)
 	}
+
+	// Re-submitting an unverified email or ICEPhone re-sends the
+	// verification.
+	if update.Email.IsUpdating && usr.Email != "" && !usr.EmailVerified {
+		m.logOnError(m.sendEmailVerification(usr), "send email verification to user %s", usr.ID)
+	}
+	if update.ICEPhone.IsUpdating && usr.ICEPhone != "" && !usr.ICEPhoneVerified {
+		m.logOnError(m.sendPhoneVerification(usr), "send ICE phone verification to user %s", usr.ID)
+	}
+
 	return usr, nil
 }
 
-func (m *Manager) User(JWT, ID string, offsetUpdateDate time.Time) (*User, error) {
+// logOnError logs err, if not nil, in the context described by ctxFmt and
+// args. It is used for failures after an update has been saved, which are
+// not returned since the caller would otherwise retry a saved update.
+func (m *Manager) logOnError(err error, ctxFmt string, args ...interface{}) {
+	if err == nil || m.lg == nil {
+		return
+	}
+	m.lg.Warnf("%s: %v", fmt.Sprintf(ctxFmt, args...), err)
+}
 
-	if JWT != "" {
-		if _, err := m.jwter.JWTValid(JWT); err != nil {
-			return nil, m.parseJWTErError(err, "check JWT valid")
+// ValidateUpdate validates update as Update does without checking a JWT or
+// saving the update. Valid values are normalized e.g. the ICEPhone is
+// formatted. A client or conflict error is returned if update is invalid.
+// It is used when importing users in bulk (see package bulk).
+func (m *Manager) ValidateUpdate(update *UserUpdate) error {
+	if err := m.validateUserUpdate(update); err != nil {
+		if m.IsClientError(err) || m.IsConflictError(err) {
+			return err
 		}
+		return errors.Newf("validate user update: %v", err)
+	}
+	return nil
+}
+
+// ToHTTPResponse writes err to w with a status code matching err's type.
+// PreconditionFailedError is handled in addition to the types handled by
+// errors.ErrToHTTP.
+func (m *Manager) ToHTTPResponse(err error, w http.ResponseWriter) (int, bool) {
+	if pfErr, ok := err.(PreconditionFailedError); ok {
+		return pfErr.ToHTTPResponse(w)
+	}
+	if mErr, ok := err.(MergedError); ok {
+		return mErr.ToHTTPResponse(w)
+	}
+	return m.ErrToHTTP.ToHTTPResponse(err, w)
+}
+
+// User fetches the user with ID. Deactivated users are only visible to the
+// user and staff. Users are not visible to the users they have blocked.
+// A MergedError is returned if the user has been merged into another user.
+func (m *Manager) User(JWT, ID string, offsetUpdateDate time.Time) (*User, error) {
+
+	clm, err := m.claim(JWT)
+	if err != nil {
+		return nil, err
 	}
 
 	usr, err := m.db.User(ID, offsetUpdateDate)
@@ -87,15 +270,329 @@ func (m *Manager) User(JWT, ID string, offsetUpdateDate time.Time) (*User, error
 		return nil, errors.Newf("fetch user: %v", err)
 	}
 
-	if JWT == "" {
-		usr = &User{
-			ID:        usr.ID,
-			Name:      usr.Name,
-			AvatarURL: usr.AvatarURL,
+	if usr.MergedInto != "" {
+		return nil, MergedError{UserID: usr.ID, MergedInto: usr.MergedInto}
+	}
+
+	if !usr.Deactivated.IsZero() && !isOwnerOrStaff(clm, usr.ID) {
+		return nil, errors.NewNotFound("user not found")
+	}
+
+	blocked, err := m.blockedBy(clm, *usr)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, errors.NewNotFound("user not found")
+	}
+
+	rels, err := m.relations(clm, []User{*usr})
+	if err != nil {
+		return nil, err
+	}
+
+	projected := m.project(usr, rels[usr.ID])
+	if clm != nil && clm.UsrID == usr.ID {
+		projected.Completeness = m.completeness(usr)
+	}
+	if clm != nil && clm.UsrID != usr.ID {
+		followed, err := m.db.Follows(clm.UsrID, usr.ID)
+		if err != nil {
+			return nil, errors.Newf("check JWT subject follows user: %v", err)
 		}
+		projected.Followed = &followed
 	}
+	return projected, nil
+}
 
-	return usr, nil
+// Users fetches the users with the provided IDs in a single lookup. The same
+// access rules as User apply. IDs that were not found are returned in
+// missingIDs rather than failing the whole lookup.
+func (m *Manager) Users(JWT string, IDs []string) (usrs []User, missingIDs []string, err error) {
+
+	clm, err := m.claim(JWT)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	IDs = uniqueNonEmpty(IDs)
+	if len(IDs) == 0 {
+		return nil, nil, errors.NewClient("at least one user ID must be provided")
+	}
+	if len(IDs) > maxBulkIDs {
+		return nil, nil, errors.NewClientf("a maximum of %d user IDs can be"+
+			" fetched at once", maxBulkIDs)
+	}
+
+	found, err := m.db.Users(IDs)
+	if err != nil && !m.db.IsNotFoundError(err) {
+		return nil, nil, errors.Newf("fetch users: %v", err)
+	}
+
+	rels, err := m.relations(clm, found)
+	if err != nil {
+		return nil, nil, err
+	}
+	blockers, err := m.blockers(clm, found)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	foundIDs := make(map[string]bool, len(found))
+	for _, usr := range found {
+		if usr.MergedInto != "" {
+			continue
+		}
+		if !usr.Deactivated.IsZero() && !isOwnerOrStaff(clm, usr.ID) {
+			continue
+		}
+		if blockers[usr.ID] {
+			continue
+		}
+		foundIDs[usr.ID] = true
+		usrs = append(usrs, *m.project(&usr, rels[usr.ID]))
+	}
+
+	for _, ID := range IDs {
+		if !foundIDs[ID] {
+			missingIDs = append(missingIDs, ID)
+		}
+	}
+
+	return usrs, missingIDs, nil
+}
+
+// Deactivate hides the profile of the user with userID from everyone but
+// the user and staff. Deactivated users cannot be rated.
+// Only the user or staff can deactivate a profile.
+func (m *Manager) Deactivate(JWT, userID string) error {
+	return m.setDeactivated(JWT, userID, time.Now())
+}
+
+// Reactivate reverses Deactivate. Erased profiles cannot be re-activated.
+// Only the user or staff can re-activate a profile.
+func (m *Manager) Reactivate(JWT, userID string) error {
+	return m.setDeactivated(JWT, userID, time.Time{})
+}
+
+// Erase permanently removes the personally identifiable values and uploaded
+// avatars of the user with userID and anonymizes the ratings they gave and
+// received. The profile
+// remains deactivated thereafter. Only the user or staff can erase a profile.
+func (m *Manager) Erase(JWT, userID string) error {
+
+	_, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return m.parseJWTErError(err, "validate JWT belongs to subject or"+
+			" has access")
+	}
+
+	// Avatars are deleted first so that a retry deletes them if erasing
+	// the profile fails.
+	if m.avatars != nil {
+		if err := m.avatars.DeleteAvatars(userID); err != nil {
+			return errors.Newf("delete avatars: %v", err)
+		}
+	}
+
+	if err := m.db.EraseUser(userID, time.Now()); err != nil {
+		if m.db.IsNotFoundError(err) {
+			return errors.NewNotFound("user not found or already erased")
+		}
+		return errors.Newf("erase user: %v", err)
+	}
+
+	return nil
+}
+
+func (m *Manager) setDeactivated(JWT, userID string, deactivated time.Time) error {
+
+	_, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return m.parseJWTErError(err, "validate JWT belongs to subject or"+
+			" has access")
+	}
+
+	if err := m.db.SetUserDeactivated(userID, deactivated, time.Now()); err != nil {
+		if m.db.IsNotFoundError(err) {
+			return errors.NewNotFound("user not found or erased")
+		}
+		return errors.Newf("set user deactivated: %v", err)
+	}
+
+	return nil
+}
+
+// Search lists users matching f. Staff can filter and sort by any value,
+// including profile completeness, and include deactivated users. Everyone
+// else can only filter and sort by values they can view in the users
+// returned i.e. authenticated callers by rating and dates, anonymous callers
+// by name only, and both by gender where each user's Privacy allows it.
+// Values are returned according to each user's Privacy settings.
+func (m *Manager) Search(JWT string, f Filter) ([]User, error) {
+
+	clm, err := m.claim(JWT)
+	if err != nil {
+		return nil, err
+	}
+	staff := isStaff(clm)
+
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	if !staff {
+		rel := relationAuthenticated
+		if clm == nil {
+			rel = relationAnonymous
+		}
+		if err := f.validateVisible(rel); err != nil {
+			if JWT == "" {
+				return nil, errors.NewUnauthorized(err)
+			}
+			return nil, errors.NewForbidden(err)
+		}
+		f.PublicOnly = true
+	}
+	if len(f.Completeness) > 0 {
+		f.CompletenessWeights = m.completenessWeights
+	}
+	if clm != nil && !staff {
+		f.ExcludeBlockersOf = clm.UsrID
+	}
+
+	usrs, err := m.db.SearchUsers(f)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("no users found for filter")
+		}
+		return nil, errors.Newf("search users: %v", err)
+	}
+
+	rels, err := m.relations(clm, usrs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range usrs {
+		usrs[i] = *m.project(&usrs[i], rels[usrs[i].ID])
+	}
+
+	return usrs, nil
+}
+
+// History fetches the profile change history of the user with userID, most
+// recent first. Only staff can view the history.
+func (m *Manager) History(JWT, userID string, offset int64, count int32) ([]Change, error) {
+
+	if _, err := m.jwter.JWTHasAccess(JWT, jwt.AccessLevelStaff); err != nil {
+		return nil, m.parseJWTErError(err, "validate JWT has access")
+	}
+
+	if offset < 0 {
+		return nil, errors.NewClientf("offset must be >= 0")
+	}
+	if count < 1 {
+		return nil, errors.NewClientf("count must be > 0")
+	}
+
+	chs, err := m.db.UserHistory(userID, offset, count)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("no history found for user")
+		}
+		return nil, errors.Newf("fetch user history: %v", err)
+	}
+
+	return chs, nil
+}
+
+// Export collects all the data held about the user with userID i.e. their
+// profile, the ratings they gave and received, and their profile history.
+// Only the user or staff can export a user's data.
+func (m *Manager) Export(JWT, userID string) (*Export, error) {
+
+	_, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return nil, m.parseJWTErError(err, "validate JWT belongs to"+
+			" subject or has access")
+	}
+
+	usr, err := m.db.User(userID, time.Time{})
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("user not found")
+		}
+		return nil, errors.Newf("fetch user: %v", err)
+	}
+
+	exp := &Export{User: *usr, Generated: time.Now()}
+
+	exp.RatingsGiven, err = m.allRatings(rating.Filter{
+		ByUserID: crdb.NewComparisonString(crdb.OpET, userID),
+	})
+	if err != nil {
+		return nil, errors.Newf("fetch ratings given: %v", err)
+	}
+
+	exp.RatingsReceived, err = m.allRatings(rating.Filter{
+		ForUserID: crdb.NewComparisonString(crdb.OpET, userID),
+	})
+	if err != nil {
+		return nil, errors.Newf("fetch ratings received: %v", err)
+	}
+
+	for offset := int64(0); ; offset += perQDBFetch {
+		chs, err := m.db.UserHistory(userID, offset, perQDBFetch)
+		if err != nil {
+			if m.db.IsNotFoundError(err) {
+				break
+			}
+			return nil, errors.Newf("fetch history: %v", err)
+		}
+		exp.History = append(exp.History, chs...)
+		if len(chs) < perQDBFetch {
+			break
+		}
+	}
+
+	exp.ICEContacts, err = m.db.ICEContacts(userID)
+	if err != nil && !m.db.IsNotFoundError(err) {
+		return nil, errors.Newf("fetch emergency contacts: %v", err)
+	}
+
+	return exp, nil
+}
+
+// allRatings fetches every rating matching f regardless of f.Offset and
+// f.Count.
+func (m *Manager) allRatings(f rating.Filter) ([]rating.Rating, error) {
+	var all []rating.Rating
+	f.Count = perQDBFetch
+	for f.Offset = 0; ; f.Offset += perQDBFetch {
+		rts, err := m.db.Ratings(f)
+		if err != nil {
+			if m.db.IsNotFoundError(err) {
+				return all, nil
+			}
+			return nil, err
+		}
+		all = append(all, rts...)
+		if len(rts) < perQDBFetch {
+			return all, nil
+		}
+	}
+}
+
+// claim validates JWT and returns its claim or nil if JWT is empty.
+func (m *Manager) claim(JWT string) (*jwt.AuthMSClaim, error) {
+	if JWT == "" {
+		return nil, nil
+	}
+	clm, err := m.jwter.JWTValid(JWT)
+	if err != nil {
+		return nil, m.parseJWTErError(err, "check JWT valid")
+	}
+	return clm, nil
 }
 
 func (m *Manager) parseJWTErError(err error, errCtx string) error {
@@ -120,11 +617,13 @@ func (m *Manager) validateUserUpdate(uu *UserUpdate) error {
 		return errors.NewClient("UserID was empty")
 	}
 
-	if _, err := m.db.User(uu.UserID, time.Time{}); err != nil {
+	current, err := m.db.User(uu.UserID, time.Time{})
+	if err != nil {
 
 		if !m.db.IsNotFoundError(err) {
 			return errors.Newf("fetch user: %v", err)
 		}
+		current = nil
 
 		// user not found, so mandatory values should be provided.
 
@@ -135,6 +634,8 @@ func (m *Manager) validateUserUpdate(uu *UserUpdate) error {
 		if !uu.Gender.IsUpdating {
 			return errors.NewClient("Gender must be provided during first time profile update")
 		}
+	} else if !current.Erased.IsZero() {
+		return errors.NewClient("profile has been erased and cannot be updated")
 	}
 
 	// Name must not be empty when updating.
@@ -142,32 +643,231 @@ func (m *Manager) validateUserUpdate(uu *UserUpdate) error {
 		return errors.NewClient("name was empty")
 	}
 
+	// Country and PhoneRegion must be valid region codes if provided.
+	// This block also upper-cases the values if valid.
+	if uu.Country.IsUpdating && uu.Country.NewValue != "" {
+		if uu.Country.NewValue, err = m.normalizeRegion("country", uu.Country.NewValue); err != nil {
+			return err
+		}
+	}
+	if uu.PhoneRegion != "" {
+		if uu.PhoneRegion, err = m.normalizeRegion("phone region", uu.PhoneRegion); err != nil {
+			return err
+		}
+	}
+
+	// Locale and Timezone must be valid if updating and not empty.
+	if uu.Locale.IsUpdating && uu.Locale.NewValue != "" {
+		if uu.Locale.NewValue, err = normalizeLocale(uu.Locale.NewValue); err != nil {
+			return err
+		}
+	}
+	if uu.Timezone.IsUpdating && uu.Timezone.NewValue != "" {
+		if err := validateTimezone(uu.Timezone.NewValue); err != nil {
+			return err
+		}
+	}
+
 	// Phone must be valid if updating and new value not empty.
-	// This block also formats the newValue if valid.
+	// This block also formats the newValue if valid. Numbers not in
+	// international format are assumed to be from the PhoneRegion or the
+	// user's (new) country.
 	if uu.ICEPhone.IsUpdating && uu.ICEPhone.NewValue != "" {
-		var err error
-		uu.ICEPhone.NewValue, err = m.pf.FormatValidPhone(uu.ICEPhone.NewValue)
+		country := uu.Country.NewValue
+		if !uu.Country.IsUpdating && current != nil {
+			country = current.Country
+		}
+		uu.ICEPhone.NewValue, err = m.pf.FormatValidPhone(uu.ICEPhone.NewValue,
+			phoneRegion(uu.PhoneRegion, country))
 		if err != nil {
 			return errors.NewClient(err)
 		}
 	}
 
+	// Email must be valid if updating and not empty. It can only be set
+	// if there is a way to verify it.
+	if uu.Email.IsUpdating && uu.Email.NewValue != "" {
+		if err := validateEmail(uu.Email.NewValue); err != nil {
+			return err
+		}
+		if m.mailer == nil {
+			return errors.NewClient("email cannot be set because email" +
+				" verification is not configured on this service")
+		}
+	}
+
 	// Gender must be within valid values if updating.
-	if uu.Gender.IsUpdating && !in(uu.Gender.NewValue, validGenders) {
+	if uu.Gender.IsUpdating && !in(uu.Gender.NewValue, m.genderValues()) {
 		return errors.NewClientf("invalid gender value, must be one of %v",
-			validGenders)
+			m.genderValues())
 	}
 
-	// AvatarURL must be valid if updating and not empty.
+	// AvatarURL must be an uploaded avatar or on an allowed host if
+	// updating and not empty.
 	if uu.AvatarURL.IsUpdating && uu.AvatarURL.NewValue != "" {
-		if _, err := url.Parse(uu.AvatarURL.NewValue); err != nil {
-			return errors.NewClientf("invalid AvatarURL: %v", err)
+		if err := m.validateAvatarURL(uu.UserID, uu.AvatarURL.NewValue); err != nil {
+			return err
+		}
+	}
+
+	// Handle must be valid, available and not changed too often if
+	// updating.
+	if err := m.validateHandleUpdate(*uu, current); err != nil {
+		return err
+	}
+
+	if err := validatePrivacy(uu.Privacy); err != nil {
+		return err
+	}
+
+	// Attributes must be declared and their values (if not removing)
+	// must satisfy the declaration.
+	for name, val := range uu.Attributes {
+		spec, ok := m.attrSpecs[name]
+		if !ok {
+			return errors.NewClientf("unknown attribute '%s'", name)
+		}
+		if val == nil {
+			continue
+		}
+		if err := spec.validate(val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// relations determines how the caller with clm relates to each of usrs,
+// keyed by user ID. Rated connections are only looked up for users whose
+// Privacy requires it.
+func (m *Manager) relations(clm *jwt.AuthMSClaim, usrs []User) (map[string]relation, error) {
+
+	rels := make(map[string]relation, len(usrs))
+	var connIDs []string
+	for _, usr := range usrs {
+		switch {
+		case clm == nil:
+			rels[usr.ID] = relationAnonymous
+		case isOwnerOrStaff(clm, usr.ID):
+			rels[usr.ID] = relationSelf
+		default:
+			rels[usr.ID] = relationAuthenticated
+			if usr.Privacy.hasConnectionsOnly() {
+				connIDs = append(connIDs, usr.ID)
+			}
 		}
 	}
 
+	if len(connIDs) == 0 {
+		return rels, nil
+	}
+
+	connected, err := m.db.RatedConnections(clm.UsrID, connIDs)
+	if err != nil && !m.db.IsNotFoundError(err) {
+		return nil, errors.Newf("fetch rated connections: %v", err)
+	}
+	accepted, err := m.db.AcceptedConnections(clm.UsrID, connIDs)
+	if err != nil && !m.db.IsNotFoundError(err) {
+		return nil, errors.Newf("fetch accepted connections: %v", err)
+	}
+	for _, ID := range append(connected, accepted...) {
+		rels[ID] = relationConnection
+	}
+
+	return rels, nil
+}
+
+// project returns a copy of usr containing only the values accessible to a
+// caller with relation rel according to usr's Privacy settings.
+func (m *Manager) project(usr *User, rel relation) *User {
+
+	if rel == relationSelf {
+		return usr
+	}
+
+	visible := func(field, val string) string {
+		if usr.Privacy.canView(field, rel) && !in(field, usr.HiddenFields) {
+			return val
+		}
+		return ""
+	}
+
+	var attrs map[string]interface{}
+	for name, val := range usr.Attributes {
+		spec, ok := m.attrSpecs[name]
+		if !ok || (!spec.IsPublic() && rel == relationAnonymous) {
+			continue
+		}
+		if attrs == nil {
+			attrs = make(map[string]interface{})
+		}
+		attrs[name] = val
+	}
+
+	projected := &User{
+		ID:         usr.ID,
+		Handle:     usr.Handle,
+		Name:       visible(FieldName, usr.Name),
+		ICEPhone:   visible(FieldICEPhone, usr.ICEPhone),
+		Gender:     visible(FieldGender, usr.Gender),
+		AvatarURL:  visible(FieldAvatarURL, usr.AvatarURL),
+		Bio:        visible(FieldBio, usr.Bio),
+		Country:    visible(FieldCountry, usr.Country),
+		Locale:     visible(FieldLocale, usr.Locale),
+		Timezone:   visible(FieldTimezone, usr.Timezone),
+		Email:      visible(FieldEmail, usr.verifiedEmail()),
+		Attributes: attrs,
+
+		NumFollowers: usr.NumFollowers,
+		NumFollowing: usr.NumFollowing,
+	}
+	projected.EmailVerified = projected.Email != ""
+	projected.ICEPhoneVerified = projected.ICEPhone != "" && usr.ICEPhoneVerified
+	if rel != relationAnonymous {
+		projected.Rating = usr.Rating
+		projected.NumRaters = usr.NumRaters
+		projected.Created = usr.Created
+		projected.LastUpdated = usr.LastUpdated
+	}
+	return projected
+}
+
+// validatePage validates that offset and count describe a valid page of
+// results.
+func validatePage(offset int64, count int32) error {
+	if offset < 0 {
+		return errors.NewClientf("offset must be >= 0")
+	}
+	if count < 1 || count > maxFilterCount {
+		return errors.NewClientf("count must be in 1 <= count <= %d", maxFilterCount)
+	}
 	return nil
 }
 
+func isStaff(clm *jwt.AuthMSClaim) bool {
+	return clm != nil && clm.Group.AccessLevel <= jwt.AccessLevelStaff
+}
+
+func isOwnerOrStaff(clm *jwt.AuthMSClaim, userID string) bool {
+	return clm != nil && (clm.UsrID == userID || isStaff(clm))
+}
+
+// uniqueNonEmpty returns vals without empty and duplicate values while
+// retaining the original order.
+func uniqueNonEmpty(vals []string) []string {
+	seen := make(map[string]bool, len(vals))
+	var unique []string
+	for _, val := range vals {
+		if val == "" || seen[val] {
+			continue
+		}
+		seen[val] = true
+		unique = append(unique, val)
+	}
+	return unique
+}
+
 func in(needle string, haystack []string) bool {
 	for _, straw := range haystack {
 		if needle == straw {
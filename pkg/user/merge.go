@@ -0,0 +1,212 @@
+package user
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/jwt"
+)
+
+// Strategies for reconciling the profile fields of merged users (see
+// Manager.Merge). Whichever strategy is chosen, empty values are filled in
+// from the other profile.
+const (
+	// MergeKeepSurvivor keeps the surviving user's values.
+	MergeKeepSurvivor = "survivor"
+	// MergePreferDuplicate takes the duplicate user's values.
+	MergePreferDuplicate = "duplicate"
+	// MergePreferLatest takes the values of whichever profile was updated
+	// most recently.
+	MergePreferLatest = "latest"
+)
+
+// FieldMergedInto records the merge of a duplicate user into another user in
+// the duplicate user's history. It cannot be updated directly.
+const FieldMergedInto = "mergedInto"
+
+// mergedFields are the string fields reconciled by Manager.Merge.
+var mergedFields = []string{FieldHandle, FieldName, FieldICEPhone,
+	FieldGender, FieldAvatarURL, FieldBio, FieldCountry, FieldLocale,
+	FieldTimezone, FieldEmail}
+
+// Merge is the merge of a duplicate user into a surviving user.
+type Merge struct {
+	SurvivorID  string
+	DuplicateID string
+	// Update contains the surviving user's reconciled profile values. Its
+	// IfLastUpdated is the surviving user's LastUpdated value when the
+	// values were reconciled.
+	Update UserUpdate
+	// EmailVerified and ICEPhoneVerified are the verification states of
+	// the reconciled Email and ICEPhone.
+	EmailVerified    bool
+	ICEPhoneVerified bool
+	// DuplicateLastUpdated is the duplicate user's LastUpdated value when
+	// the values were reconciled. The merge fails with a
+	// PreconditionFailedError if either user has been updated since.
+	DuplicateLastUpdated time.Time
+}
+
+// Merge merges the user with duplicateID into the user with survivorID,
+// reconciling their profile fields according to strategy (one of the
+// Merge... strategies, defaults to MergeKeepSurvivor). All ratings given and
+// received by the duplicate user are moved to the surviving user. Where both
+// users rated, or were rated by, the same user in the same section only the
+// most recently updated rating is kept and ratings the users gave each other
+// are removed. The duplicate user's ICE contacts, follows, connections and
+// blocks are likewise moved, dropping the ones the surviving user already has
+// or that would be with themselves. The duplicate user's uploaded avatars are
+// deleted, after copying the one the surviving user takes, if any. The
+// duplicate user is left as a deactivated tombstone that refers to the
+// surviving user (see MergedError). Only staff can merge users.
+func (m *Manager) Merge(JWT, survivorID, duplicateID, strategy string) (*User, error) {
+
+	clm, err := m.jwter.JWTHasAccess(JWT, jwt.AccessLevelStaff)
+	if err != nil {
+		return nil, m.parseJWTErError(err, "validate JWT has access")
+	}
+
+	if survivorID == "" || duplicateID == "" {
+		return nil, errors.NewClient("both the surviving and duplicate user IDs must be provided")
+	}
+	if survivorID == duplicateID {
+		return nil, errors.NewClient("cannot merge a user into themselves")
+	}
+	if strategy == "" {
+		strategy = MergeKeepSurvivor
+	}
+	if strategy != MergeKeepSurvivor && strategy != MergePreferDuplicate && strategy != MergePreferLatest {
+		return nil, errors.NewClientf("strategy must be one of %s, %s or %s",
+			MergeKeepSurvivor, MergePreferDuplicate, MergePreferLatest)
+	}
+
+	survivor, err := m.mergeableUser(survivorID, "surviving")
+	if err != nil {
+		return nil, err
+	}
+	duplicate, err := m.mergeableUser(duplicateID, "duplicate")
+	if err != nil {
+		return nil, err
+	}
+
+	mrg := mergeProfiles(*survivor, *duplicate, strategy)
+	mrg.Update.ActorUserID = clm.UsrID
+	mrg.Update.ActorAccessLevel = clm.Group.AccessLevel
+	mrg.Update.Time = time.Now()
+
+	// An uploaded avatar taken from the duplicate user is copied to the
+	// surviving user since the duplicate user's avatars are deleted.
+	var copiedAvatarURL string
+	if au := &mrg.Update.AvatarURL; m.avatars != nil && au.IsUpdating &&
+		m.avatars.IsAvatarURL(duplicateID, au.NewValue) {
+		if au.NewValue, err = m.avatars.CopyAvatar(au.NewValue, survivorID); err != nil {
+			return nil, errors.Newf("copy duplicate user's avatar: %v", err)
+		}
+		copiedAvatarURL = au.NewValue
+	}
+
+	usr, err := m.db.MergeUsers(mrg)
+	if err != nil {
+		if copiedAvatarURL != "" {
+			m.avatars.DeleteAvatar(copiedAvatarURL)
+		}
+		if IsPreconditionFailedError(err) || m.db.IsConflictError(err) {
+			return nil, err
+		}
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("user not found")
+		}
+		return nil, errors.Newf("merge users: %v", err)
+	}
+
+	// A failure to delete the duplicate user's avatars is not reported
+	// since the merge succeeded. Avatars of merged users are not served.
+	if m.avatars != nil {
+		m.avatars.DeleteAvatars(duplicateID)
+	}
+
+	return usr, nil
+}
+
+// mergeableUser fetches the user with ID for Manager.Merge. role describes
+// the user in errors.
+func (m *Manager) mergeableUser(ID, role string) (*User, error) {
+	usr, err := m.db.User(ID, time.Time{})
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFoundf("%s user not found", role)
+		}
+		return nil, errors.Newf("fetch %s user: %v", role, err)
+	}
+	if !usr.Erased.IsZero() {
+		return nil, errors.NewNotFoundf("%s user not found", role)
+	}
+	if usr.MergedInto != "" {
+		return nil, errors.NewConflictf("%s user has already been merged into"+
+			" user %s", role, usr.MergedInto)
+	}
+	return usr, nil
+}
+
+// mergeProfiles reconciles the profile fields of survivor and duplicate
+// according to strategy.
+func mergeProfiles(survivor, duplicate User, strategy string) Merge {
+
+	preferred, other := survivor, duplicate
+	if strategy == MergePreferDuplicate ||
+		(strategy == MergePreferLatest && duplicate.LastUpdated.After(survivor.LastUpdated)) {
+		preferred, other = duplicate, survivor
+	}
+
+	mrg := Merge{
+		SurvivorID:  survivor.ID,
+		DuplicateID: duplicate.ID,
+		Update: UserUpdate{
+			UserID:        survivor.ID,
+			IfLastUpdated: survivor.LastUpdated,
+		},
+		DuplicateLastUpdated: duplicate.LastUpdated,
+	}
+
+	for _, field := range mergedFields {
+		src := preferred
+		if src.fieldValue(field) == "" {
+			src = other
+		}
+		val := src.fieldValue(field)
+		if val != survivor.fieldValue(field) {
+			*mrg.Update.stringUpdate(field) = StringUpdate{IsUpdating: true, NewValue: val}
+		}
+		switch field {
+		case FieldEmail:
+			mrg.EmailVerified = val != "" && (survivor.Email == val && survivor.EmailVerified ||
+				duplicate.Email == val && duplicate.EmailVerified)
+		case FieldICEPhone:
+			mrg.ICEPhoneVerified = val != "" && (survivor.ICEPhone == val && survivor.ICEPhoneVerified ||
+				duplicate.ICEPhone == val && duplicate.ICEPhoneVerified)
+		}
+	}
+
+	for name, val := range MergeAttributes(other.Attributes, preferred.Attributes) {
+		if cur, ok := survivor.Attributes[name]; ok && reflect.DeepEqual(cur, val) {
+			continue
+		}
+		if mrg.Update.Attributes == nil {
+			mrg.Update.Attributes = make(map[string]interface{})
+		}
+		mrg.Update.Attributes[name] = val
+	}
+
+	for field, v := range MergePrivacy(other.Privacy, preferred.Privacy) {
+		if survivor.Privacy[field] == v {
+			continue
+		}
+		if mrg.Update.Privacy == nil {
+			mrg.Update.Privacy = make(Privacy)
+		}
+		mrg.Update.Privacy[field] = v
+	}
+
+	return mrg
+}
@@ -0,0 +1,128 @@
+package user
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeProfiles(t *testing.T) {
+	older := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	survivor := User{
+		ID:            "123",
+		Name:          "Jane",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		Attributes:    map[string]interface{}{"bike": "boda"},
+		Privacy:       Privacy{FieldName: VisibilityPrivate},
+		LastUpdated:   older,
+	}
+	duplicate := User{
+		ID:               "456",
+		Name:             "Janet",
+		Email:            "janet@example.com",
+		ICEPhone:         "+254712345678",
+		ICEPhoneVerified: true,
+		Attributes:       map[string]interface{}{"bike": "tuk tuk", "seats": 3.0},
+		Privacy:          Privacy{FieldBio: VisibilityPublic},
+		LastUpdated:      newer,
+	}
+	tt := []struct {
+		name     string
+		survivor User
+		strategy string
+		expMerge Merge
+	}{
+		{
+			name:     "keep survivor",
+			survivor: survivor,
+			strategy: MergeKeepSurvivor,
+			expMerge: Merge{
+				SurvivorID:  "123",
+				DuplicateID: "456",
+				Update: UserUpdate{
+					UserID:        "123",
+					IfLastUpdated: older,
+					ICEPhone:      StringUpdate{IsUpdating: true, NewValue: "+254712345678"},
+					Attributes:    map[string]interface{}{"seats": 3.0},
+					Privacy:       Privacy{FieldBio: VisibilityPublic},
+				},
+				EmailVerified:        true,
+				ICEPhoneVerified:     true,
+				DuplicateLastUpdated: newer,
+			},
+		},
+		{
+			name:     "prefer duplicate",
+			survivor: survivor,
+			strategy: MergePreferDuplicate,
+			expMerge: Merge{
+				SurvivorID:  "123",
+				DuplicateID: "456",
+				Update: UserUpdate{
+					UserID:        "123",
+					IfLastUpdated: older,
+					Name:          StringUpdate{IsUpdating: true, NewValue: "Janet"},
+					Email:         StringUpdate{IsUpdating: true, NewValue: "janet@example.com"},
+					ICEPhone:      StringUpdate{IsUpdating: true, NewValue: "+254712345678"},
+					Attributes:    map[string]interface{}{"bike": "tuk tuk", "seats": 3.0},
+					Privacy:       Privacy{FieldBio: VisibilityPublic},
+				},
+				ICEPhoneVerified:     true,
+				DuplicateLastUpdated: newer,
+			},
+		},
+		{
+			name: "prefer latest survivor",
+			survivor: func() User {
+				s := survivor
+				s.LastUpdated = newer.Add(time.Hour)
+				return s
+			}(),
+			strategy: MergePreferLatest,
+			expMerge: Merge{
+				SurvivorID:  "123",
+				DuplicateID: "456",
+				Update: UserUpdate{
+					UserID:        "123",
+					IfLastUpdated: newer.Add(time.Hour),
+					ICEPhone:      StringUpdate{IsUpdating: true, NewValue: "+254712345678"},
+					Attributes:    map[string]interface{}{"seats": 3.0},
+					Privacy:       Privacy{FieldBio: VisibilityPublic},
+				},
+				EmailVerified:        true,
+				ICEPhoneVerified:     true,
+				DuplicateLastUpdated: newer,
+			},
+		},
+		{
+			name:     "prefer latest duplicate",
+			survivor: survivor,
+			strategy: MergePreferLatest,
+			expMerge: Merge{
+				SurvivorID:  "123",
+				DuplicateID: "456",
+				Update: UserUpdate{
+					UserID:        "123",
+					IfLastUpdated: older,
+					Name:          StringUpdate{IsUpdating: true, NewValue: "Janet"},
+					Email:         StringUpdate{IsUpdating: true, NewValue: "janet@example.com"},
+					ICEPhone:      StringUpdate{IsUpdating: true, NewValue: "+254712345678"},
+					Attributes:    map[string]interface{}{"bike": "tuk tuk", "seats": 3.0},
+					Privacy:       Privacy{FieldBio: VisibilityPublic},
+				},
+				ICEPhoneVerified:     true,
+				DuplicateLastUpdated: newer,
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			mrg := mergeProfiles(tc.survivor, duplicate, tc.strategy)
+			if !reflect.DeepEqual(mrg, tc.expMerge) {
+				t.Errorf("Expected %+v, got %+v", tc.expMerge, mrg)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package user
+
+import (
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/jwt"
+)
+
+// Ways in which flagged values are handled (see WithContentChecker).
+const (
+	// ModerationModeHold keeps flagged values off the profile until staff
+	// approve them.
+	ModerationModeHold = "hold"
+	// ModerationModeHide publishes flagged values but hides them from
+	// everyone except the user and staff until staff approve them.
+	ModerationModeHide = "hide"
+)
+
+// Statuses of a Moderation.
+const (
+	ModerationPending  = "pending"
+	ModerationApproved = "approved"
+	ModerationRejected = "rejected"
+)
+
+// moderatedFields are the fields whose new values are checked with the
+// ContentChecker.
+var moderatedFields = []string{FieldName, FieldBio, FieldAvatarURL}
+
+// ContentChecker checks user submitted content e.g. moderation.WordList.
+type ContentChecker interface {
+	// Check returns a non-empty reason if value is not acceptable as the
+	// value of field (one of the Field... values).
+	Check(field, value string) (reason string, err error)
+}
+
+// Moderation is a flagged update of a user's Field awaiting or having
+// undergone review by staff.
+type Moderation struct {
+	ID     string
+	UserID string
+	Field  string
+	// Value is the flagged value and PreviousValue the value it replaced.
+	Value         string
+	PreviousValue string
+	// Reason is why the ContentChecker flagged Value.
+	Reason string
+	// Held is true if Value was kept off the profile pending review,
+	// otherwise Value was published but hidden (see ModerationModeHold and
+	// ModerationModeHide).
+	Held bool
+	// Status is one of the Moderation... statuses.
+	Status     string
+	ResolvedBy string
+	Resolved   time.Time
+	Created    time.Time
+}
+
+// WithContentChecker enables moderation of updates to names, bios and avatar
+// URLs using c. Flagged values are held or hidden pending review by staff
+// according to mode (one of ModerationModeHold or ModerationModeHide).
+// Updates made by staff are not checked.
+func WithContentChecker(c ContentChecker, mode string) Option {
+	return func(m *Manager) error {
+		if c == nil {
+			return errors.New("nil ContentChecker")
+		}
+		if mode != ModerationModeHold && mode != ModerationModeHide {
+			return errors.Newf("moderation mode must be one of %s or %s",
+				ModerationModeHold, ModerationModeHide)
+		}
+		m.checker = c
+		m.moderationMode = mode
+		return nil
+	}
+}
+
+// Moderations lists the moderations of updates made by the user with userID,
+// most recent first. Only the user or staff can list a user's moderations.
+func (m *Manager) Moderations(JWT, userID string, offset int64, count int32) ([]Moderation, error) {
+
+	_, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return nil, m.parseJWTErError(err, "validate JWT belongs to"+
+			" subject or has access")
+	}
+
+	if err := validatePage(offset, count); err != nil {
+		return nil, err
+	}
+
+	ms, err := m.db.UserModerations(userID, offset, count)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("no moderations found for user")
+		}
+		return nil, errors.Newf("fetch moderations: %v", err)
+	}
+	return ms, nil
+}
+
+// ModerationQueue lists the moderations with status (defaults to
+// ModerationPending), oldest first. Only staff can view the queue.
+func (m *Manager) ModerationQueue(JWT, status string, offset int64, count int32) ([]Moderation, error) {
+
+	if _, err := m.jwter.JWTHasAccess(JWT, jwt.AccessLevelStaff); err != nil {
+		return nil, m.parseJWTErError(err, "validate JWT has access")
+	}
+
+	if status == "" {
+		status = ModerationPending
+	}
+	if status != ModerationPending && status != ModerationApproved && status != ModerationRejected {
+		return nil, errors.NewClientf("status must be one of %s, %s or %s",
+			ModerationPending, ModerationApproved, ModerationRejected)
+	}
+	if err := validatePage(offset, count); err != nil {
+		return nil, err
+	}
+
+	ms, err := m.db.ModerationQueue(status, offset, count)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFoundf("no %s moderations found", status)
+		}
+		return nil, errors.Newf("fetch moderation queue: %v", err)
+	}
+	return ms, nil
+}
+
+// ApproveModeration approves the pending moderation with ID. A held value is
+// applied to the user's profile and a hidden value is made visible. Only
+// staff can approve moderations.
+func (m *Manager) ApproveModeration(JWT, ID string) (*Moderation, error) {
+	return m.resolveModeration(JWT, ID, ModerationApproved)
+}
+
+// RejectModeration rejects the pending moderation with ID. A held value is
+// discarded and a hidden value is reverted to the value it replaced. Only
+// staff can reject moderations.
+func (m *Manager) RejectModeration(JWT, ID string) (*Moderation, error) {
+	return m.resolveModeration(JWT, ID, ModerationRejected)
+}
+
+func (m *Manager) resolveModeration(JWT, ID, status string) (*Moderation, error) {
+
+	clm, err := m.jwter.JWTHasAccess(JWT, jwt.AccessLevelStaff)
+	if err != nil {
+		return nil, m.parseJWTErError(err, "validate JWT has access")
+	}
+
+	if ID == "" {
+		return nil, errors.NewClient("moderation ID was empty")
+	}
+
+	actor := Actor{UserID: clm.UsrID, AccessLevel: clm.Group.AccessLevel}
+	mod, err := m.db.ResolveModeration(ID, status, actor, time.Now())
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewNotFound("pending moderation not found")
+		}
+		return nil, errors.Newf("resolve moderation: %v", err)
+	}
+	return mod, nil
+}
+
+// moderate checks the moderated fields being updated in uu with the
+// ContentChecker and adds a Moderation to uu for each flagged value. Flagged
+// values are removed from uu in ModerationModeHold except the name of a new
+// user which is required and is therefore hidden instead.
+func (m *Manager) moderate(uu *UserUpdate) error {
+
+	if m.checker == nil || uu.ActorAccessLevel <= jwt.AccessLevelStaff {
+		return nil
+	}
+
+	var current *User
+	for _, field := range moderatedFields {
+
+		su := uu.stringUpdate(field)
+		if !su.IsUpdating || su.NewValue == "" {
+			continue
+		}
+
+		reason, err := m.checker.Check(field, su.NewValue)
+		if err != nil {
+			return errors.Newf("check %s: %v", field, err)
+		}
+		if reason == "" {
+			continue
+		}
+
+		if current == nil {
+			if current, err = m.db.User(uu.UserID, time.Time{}); err != nil {
+				if !m.db.IsNotFoundError(err) {
+					return errors.Newf("fetch user: %v", err)
+				}
+				current = &User{}
+			}
+		}
+
+		held := m.moderationMode == ModerationModeHold &&
+			(field != FieldName || current.ID != "")
+		uu.Moderations = append(uu.Moderations, Moderation{
+			UserID:        uu.UserID,
+			Field:         field,
+			Value:         su.NewValue,
+			PreviousValue: current.fieldValue(field),
+			Reason:        reason,
+			Held:          held,
+			Status:        ModerationPending,
+			Created:       uu.Time,
+		})
+		if held {
+			*su = StringUpdate{}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package user
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/jwt"
+)
+
+type stubChecker struct{}
+
+func (stubChecker) Check(field, value string) (string, error) {
+	if strings.Contains(value, "spam") {
+		return "contains blocked word 'spam'", nil
+	}
+	return "", nil
+}
+
+// moderationDB provides the current user for Manager.moderate. Calls to
+// other DB methods panic.
+type moderationDB struct {
+	DB
+	errors.NotFoundErrCheck
+	usr *User
+}
+
+func (db *moderationDB) IsNotFoundError(err error) bool {
+	return db.NotFoundErrCheck.IsNotFoundError(err)
+}
+
+func (db *moderationDB) User(userID string, offsetUpdateDate time.Time) (*User, error) {
+	if db.usr == nil {
+		return nil, errors.NewNotFound("user not found")
+	}
+	return db.usr, nil
+}
+
+func TestManager_moderate(t *testing.T) {
+	now := time.Now()
+	current := &User{ID: "123", Name: "Jane", Bio: "Rider"}
+	tt := []struct {
+		name      string
+		mode      string
+		current   *User
+		update    UserUpdate
+		expUpdate UserUpdate
+	}{
+		{
+			name:    "clean values",
+			mode:    ModerationModeHold,
+			current: current,
+			update: UserUpdate{
+				UserID:           "123",
+				ActorAccessLevel: jwt.AccessLevelUser,
+				Name:             StringUpdate{IsUpdating: true, NewValue: "Janet"},
+				Time:             now,
+			},
+			expUpdate: UserUpdate{
+				UserID:           "123",
+				ActorAccessLevel: jwt.AccessLevelUser,
+				Name:             StringUpdate{IsUpdating: true, NewValue: "Janet"},
+				Time:             now,
+			},
+		},
+		{
+			name:    "hold flagged value",
+			mode:    ModerationModeHold,
+			current: current,
+			update: UserUpdate{
+				UserID:           "123",
+				ActorAccessLevel: jwt.AccessLevelUser,
+				Name:             StringUpdate{IsUpdating: true, NewValue: "Janet"},
+				Bio:              StringUpdate{IsUpdating: true, NewValue: "I sell spam"},
+				Time:             now,
+			},
+			expUpdate: UserUpdate{
+				UserID:           "123",
+				ActorAccessLevel: jwt.AccessLevelUser,
+				Name:             StringUpdate{IsUpdating: true, NewValue: "Janet"},
+				Time:             now,
+				Moderations: []Moderation{{
+					UserID:        "123",
+					Field:         FieldBio,
+					Value:         "I sell spam",
+					PreviousValue: "Rider",
+					Reason:        "contains blocked word 'spam'",
+					Held:          true,
+					Status:        ModerationPending,
+					Created:       now,
+				}},
+			},
+		},
+		{
+			name:    "hide flagged value",
+			mode:    ModerationModeHide,
+			current: current,
+			update: UserUpdate{
+				UserID:           "123",
+				ActorAccessLevel: jwt.AccessLevelUser,
+				Bio:              StringUpdate{IsUpdating: true, NewValue: "I sell spam"},
+				Time:             now,
+			},
+			expUpdate: UserUpdate{
+				UserID:           "123",
+				ActorAccessLevel: jwt.AccessLevelUser,
+				Bio:              StringUpdate{IsUpdating: true, NewValue: "I sell spam"},
+				Time:             now,
+				Moderations: []Moderation{{
+					UserID:        "123",
+					Field:         FieldBio,
+					Value:         "I sell spam",
+					PreviousValue: "Rider",
+					Reason:        "contains blocked word 'spam'",
+					Status:        ModerationPending,
+					Created:       now,
+				}},
+			},
+		},
+		{
+			name: "hide new user's flagged name in hold mode",
+			mode: ModerationModeHold,
+			update: UserUpdate{
+				UserID:           "456",
+				ActorAccessLevel: jwt.AccessLevelUser,
+				Name:             StringUpdate{IsUpdating: true, NewValue: "spam king"},
+				Time:             now,
+			},
+			expUpdate: UserUpdate{
+				UserID:           "456",
+				ActorAccessLevel: jwt.AccessLevelUser,
+				Name:             StringUpdate{IsUpdating: true, NewValue: "spam king"},
+				Time:             now,
+				Moderations: []Moderation{{
+					UserID:  "456",
+					Field:   FieldName,
+					Value:   "spam king",
+					Reason:  "contains blocked word 'spam'",
+					Status:  ModerationPending,
+					Created: now,
+				}},
+			},
+		},
+		{
+			name:    "staff not moderated",
+			mode:    ModerationModeHold,
+			current: current,
+			update: UserUpdate{
+				UserID:           "123",
+				ActorAccessLevel: jwt.AccessLevelStaff,
+				Bio:              StringUpdate{IsUpdating: true, NewValue: "I sell spam"},
+				Time:             now,
+			},
+			expUpdate: UserUpdate{
+				UserID:           "123",
+				ActorAccessLevel: jwt.AccessLevelStaff,
+				Bio:              StringUpdate{IsUpdating: true, NewValue: "I sell spam"},
+				Time:             now,
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &Manager{db: &moderationDB{usr: tc.current}}
+			if err := WithContentChecker(stubChecker{}, tc.mode)(m); err != nil {
+				t.Fatalf("WithContentChecker(): %v", err)
+			}
+			update := tc.update
+			if err := m.moderate(&update); err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if !reflect.DeepEqual(update, tc.expUpdate) {
+				t.Errorf("Expected %+v, got %+v", tc.expUpdate, update)
+			}
+		})
+	}
+}
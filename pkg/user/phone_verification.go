@@ -0,0 +1,179 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/jwt"
+)
+
+// Defaults for ICEPhone verification codes (see WithPhoneVerification).
+const (
+	DefaultPhoneCodeValidity    = 10 * time.Minute
+	DefaultPhoneCodeMaxAttempts = 5
+)
+
+// phoneCodeDigits is the number of digits in an ICEPhone verification code.
+const phoneCodeDigits = 6
+
+// SMSSender sends text messages e.g. sms.Stub.
+type SMSSender interface {
+	Send(to, text string) error
+}
+
+// PhoneVerification is a pending verification of a user's ICEPhone. Only a
+// hash of the code sent to the phone is kept.
+type PhoneVerification struct {
+	UserID   string
+	Phone    string
+	CodeHash string
+	Attempts int32
+	Expires  time.Time
+	Created  time.Time
+}
+
+// WithSMSSender sets the SMSSender through which ICEPhone verification codes
+// are sent. ICEPhones remain unverified if no SMSSender is provided.
+func WithSMSSender(s SMSSender) Option {
+	return func(m *Manager) error {
+		if s == nil {
+			return errors.New("nil SMSSender")
+		}
+		m.sms = s
+		return nil
+	}
+}
+
+// WithPhoneVerification sets how long ICEPhone verification codes are valid
+// and how many incorrect codes can be submitted before a new code has to be
+// requested. Defaults to DefaultPhoneCodeValidity and
+// DefaultPhoneCodeMaxAttempts.
+func WithPhoneVerification(validity time.Duration, maxAttempts int32) Option {
+	return func(m *Manager) error {
+		if validity <= 0 {
+			return errors.New("phone code validity must be greater than 0")
+		}
+		if maxAttempts < 1 {
+			return errors.New("phone code max attempts must be at least 1")
+		}
+		m.phoneCodeValidity = validity
+		m.phoneCodeMaxAttempts = maxAttempts
+		return nil
+	}
+}
+
+// VerifyICEPhone marks the ICEPhone of the user with userID as verified if
+// code matches the code last sent to it. Only the user or staff can verify a
+// user's ICEPhone.
+func (m *Manager) VerifyICEPhone(JWT, userID, code string) (*User, error) {
+
+	clm, err := m.jwter.IsOwnerOrJWTHasAccess(JWT, userID, jwt.AccessLevelStaff)
+	if err != nil {
+		return nil, m.parseJWTErError(err, "validate JWT belongs to"+
+			" subject or has access")
+	}
+
+	if code == "" {
+		return nil, errors.NewClient("code was empty")
+	}
+
+	pv, err := m.db.PhoneVerification(userID)
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewClient("no ICEPhone verification is pending," +
+				" update the ICEPhone to get a code")
+		}
+		return nil, errors.Newf("fetch phone verification: %v", err)
+	}
+	if time.Now().After(pv.Expires) {
+		return nil, errors.NewClient("the code has expired, update the" +
+			" ICEPhone to get a new code")
+	}
+
+	// The attempt is counted before comparing the code so that concurrent
+	// attempts cannot exceed the maximum.
+	pv, err = m.db.ClaimPhoneVerificationAttempt(userID, m.phoneCodeMaxAttempts, time.Now())
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewClient("too many incorrect codes, update the" +
+				" ICEPhone to get a new code")
+		}
+		return nil, errors.Newf("record attempt: %v", err)
+	}
+
+	hash := hashPhoneCode(userID, pv.Phone, code)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(pv.CodeHash)) != 1 {
+		return nil, errors.NewForbiddenf("incorrect code, %d attempt(s) left",
+			m.phoneCodeMaxAttempts-pv.Attempts)
+	}
+
+	actor := Actor{UserID: clm.UsrID, AccessLevel: clm.Group.AccessLevel}
+	usr, err := m.db.SetICEPhoneVerified(userID, pv.Phone, actor, time.Now())
+	if err != nil {
+		if m.db.IsNotFoundError(err) {
+			return nil, errors.NewClient("the code was sent to a phone that" +
+				" is no longer the ICEPhone")
+		}
+		return nil, errors.Newf("set ICEPhone verified: %v", err)
+	}
+	return usr, nil
+}
+
+// sendPhoneVerification sends a new code to usr's ICEPhone with which to
+// verify it (see VerifyICEPhone), replacing any pending verification.
+func (m *Manager) sendPhoneVerification(usr *User) error {
+
+	if m.sms == nil {
+		return nil
+	}
+
+	code, err := genPhoneCode()
+	if err != nil {
+		return errors.Newf("generate code: %v", err)
+	}
+
+	now := time.Now()
+	err = m.db.SetPhoneVerification(PhoneVerification{
+		UserID:   usr.ID,
+		Phone:    usr.ICEPhone,
+		CodeHash: hashPhoneCode(usr.ID, usr.ICEPhone, code),
+		Expires:  now.Add(m.phoneCodeValidity),
+		Created:  now,
+	})
+	if err != nil {
+		return errors.Newf("save phone verification: %v", err)
+	}
+
+	text := fmt.Sprintf("%s is your code to confirm this number as an"+
+		" emergency contact. It expires in %s.", code, m.phoneCodeValidity)
+	if err := m.sms.Send(usr.ICEPhone, text); err != nil {
+		return errors.Newf("send verification SMS: %v", err)
+	}
+	return nil
+}
+
+// genPhoneCode generates a random numeric code of phoneCodeDigits digits.
+func genPhoneCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < phoneCodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", phoneCodeDigits, n), nil
+}
+
+// hashPhoneCode hashes code together with the user and phone it was sent for
+// so that a hash cannot be reused for another user or phone.
+func hashPhoneCode(userID, phone, code string) string {
+	h := sha256.Sum256([]byte(userID + "\x00" + phone + "\x00" + code))
+	return hex.EncodeToString(h[:])
+}
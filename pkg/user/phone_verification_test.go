@@ -0,0 +1,178 @@
+package user
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/jwt"
+)
+
+// verifDB holds a single pending phone verification. Only the methods used by
+// VerifyICEPhone are implemented.
+type verifDB struct {
+	DB
+	mu       sync.Mutex
+	pv       PhoneVerification
+	verified bool
+}
+
+func (db *verifDB) IsNotFoundError(err error) bool {
+	return (&errors.NotFoundErrCheck{}).IsNotFoundError(err)
+}
+
+func (db *verifDB) PhoneVerification(userID string) (*PhoneVerification, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	pv := db.pv
+	return &pv, nil
+}
+
+func (db *verifDB) ClaimPhoneVerificationAttempt(userID string, maxAttempts int32, at time.Time) (*PhoneVerification, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.pv.Attempts >= maxAttempts || !db.pv.Expires.After(at) {
+		return nil, errors.NewNotFound("no claimable phone verification")
+	}
+	db.pv.Attempts++
+	pv := db.pv
+	return &pv, nil
+}
+
+func (db *verifDB) SetICEPhoneVerified(userID, phone string, by Actor, at time.Time) (*User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.verified = true
+	return &User{ID: userID, ICEPhone: phone, ICEPhoneVerified: true}, nil
+}
+
+type ownerJWTEr struct {
+	JWTEr
+}
+
+type phoneFormatter struct {
+	FormatValidPhoner
+}
+
+func (ownerJWTEr) IsOwnerOrJWTHasAccess(JWT, owner string, acl float32) (*jwt.AuthMSClaim, error) {
+	return &jwt.AuthMSClaim{UsrID: owner}, nil
+}
+
+func TestGenPhoneCode(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code, err := genPhoneCode()
+		if err != nil {
+			t.Fatalf("genPhoneCode() error: %v", err)
+		}
+		if len(code) != phoneCodeDigits {
+			t.Fatalf("Expected a %d digit code, got '%s'", phoneCodeDigits, code)
+		}
+		if _, err := strconv.Atoi(code); err != nil {
+			t.Fatalf("Expected a numeric code, got '%s'", code)
+		}
+	}
+}
+
+func TestHashPhoneCode(t *testing.T) {
+	hash := hashPhoneCode("123", "254712345678", "012345")
+	if hash != hashPhoneCode("123", "254712345678", "012345") {
+		t.Errorf("Expected the same inputs to give the same hash")
+	}
+	tt := []struct {
+		name                string
+		userID, phone, code string
+	}{
+		{name: "other user", userID: "124", phone: "254712345678", code: "012345"},
+		{name: "other phone", userID: "123", phone: "254712345679", code: "012345"},
+		{name: "other code", userID: "123", phone: "254712345678", code: "012346"},
+		{name: "shifted separator", userID: "1232", phone: "54712345678", code: "012345"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if hashPhoneCode(tc.userID, tc.phone, tc.code) == hash {
+				t.Errorf("Expected a different hash")
+			}
+		})
+	}
+}
+
+func TestManager_VerifyICEPhone_concurrentAttempts(t *testing.T) {
+	const maxAttempts = 3
+	const userID, phone, code = "123", "254712345678", "012345"
+	db := &verifDB{pv: PhoneVerification{
+		UserID:   userID,
+		Phone:    phone,
+		CodeHash: hashPhoneCode(userID, phone, code),
+		Expires:  time.Now().Add(time.Hour),
+	}}
+	m, err := NewManager(db, ownerJWTEr{}, &phoneFormatter{},
+		WithPhoneVerification(time.Hour, maxAttempts))
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.VerifyICEPhone("jwt", userID, "999999")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var numIncorrect int
+	for err := range errs {
+		switch {
+		case (&errors.AuthErrCheck{}).IsForbiddenError(err):
+			numIncorrect++
+		case m.IsClientError(err):
+		default:
+			t.Errorf("Expected a forbidden or client error, got %v", err)
+		}
+	}
+	if numIncorrect != maxAttempts {
+		t.Errorf("Expected %d codes to be checked, got %d", maxAttempts, numIncorrect)
+	}
+
+	if _, err := m.VerifyICEPhone("jwt", userID, code); !m.IsClientError(err) {
+		t.Errorf("Expected a client error for the correct code after too"+
+			" many attempts, got %v", err)
+	}
+	if db.verified {
+		t.Errorf("Expected the ICEPhone to remain unverified")
+	}
+}
+
+func TestManager_VerifyICEPhone_attemptsLeft(t *testing.T) {
+	const userID, phone, code = "123", "254712345678", "012345"
+	db := &verifDB{pv: PhoneVerification{
+		UserID:   userID,
+		Phone:    phone,
+		CodeHash: hashPhoneCode(userID, phone, code),
+		Attempts: 1,
+		Expires:  time.Now().Add(time.Hour),
+	}}
+	m, err := NewManager(db, ownerJWTEr{}, &phoneFormatter{},
+		WithPhoneVerification(time.Hour, 3))
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+
+	_, err = m.VerifyICEPhone("jwt", userID, "999999")
+	if !(&errors.AuthErrCheck{}).IsForbiddenError(err) || err.Error() != "incorrect code, 1 attempt(s) left" {
+		t.Errorf("Expected 1 attempt left, got %v", err)
+	}
+	usr, err := m.VerifyICEPhone("jwt", userID, code)
+	if err != nil {
+		t.Fatalf("VerifyICEPhone: %v", err)
+	}
+	if !usr.ICEPhoneVerified || !db.verified {
+		t.Errorf("Expected the ICEPhone to be verified")
+	}
+}
@@ -0,0 +1,123 @@
+package user
+
+import (
+	"github.com/tomogoma/go-typed-errors"
+)
+
+// Visibility levels a user can choose for each of their profile fields
+// (see Privacy). Each level includes the viewers of the levels after it.
+const (
+	// VisibilityPublic values are accessible to everyone, including
+	// anonymous callers.
+	VisibilityPublic = "public"
+	// VisibilityAuthenticated values are accessible to callers with a
+	// valid JWT.
+	VisibilityAuthenticated = "authenticated"
+	// VisibilityConnections values are accessible to users that the user
+	// has rated, been rated by or has an accepted Connection with.
+	VisibilityConnections = "connections"
+	// VisibilityPrivate values are accessible to the user and staff only.
+	VisibilityPrivate = "private"
+)
+
+// privacyFieldPrefix prefixes the field name in Change.Field.
+const privacyFieldPrefix = "privacy."
+
+// visibilityLevels orders visibility values from least to most restrictive.
+var visibilityLevels = []string{VisibilityPublic, VisibilityAuthenticated,
+	VisibilityConnections, VisibilityPrivate}
+
+// defaultPrivacy is the visibility of fields whose visibility the user has not
+// set.
+var defaultPrivacy = map[string]string{
+	FieldName:      VisibilityPublic,
+	FieldAvatarURL: VisibilityPublic,
+	FieldICEPhone:  VisibilityAuthenticated,
+	FieldGender:    VisibilityAuthenticated,
+	FieldBio:       VisibilityAuthenticated,
+	FieldCountry:   VisibilityAuthenticated,
+	FieldLocale:    VisibilityAuthenticated,
+	FieldTimezone:  VisibilityPrivate,
+	FieldEmail:     VisibilityPrivate,
+}
+
+// Privacy maps the name of a profile field (the Field... values e.g.
+// FieldICEPhone) to its visibility (the Visibility... values).
+type Privacy map[string]string
+
+// Visibility returns the visibility of field, falling back to the default
+// if not set.
+func (p Privacy) Visibility(field string) string {
+	if v, ok := p[field]; ok {
+		return v
+	}
+	return defaultPrivacy[field]
+}
+
+// MergePrivacy applies updates onto current returning the result. An empty
+// visibility in updates reverts the field to its default visibility.
+func MergePrivacy(current, updates Privacy) Privacy {
+	merged := make(Privacy, len(current)+len(updates))
+	for field, v := range current {
+		merged[field] = v
+	}
+	for field, v := range updates {
+		if v == "" {
+			delete(merged, field)
+			continue
+		}
+		merged[field] = v
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// validatePrivacy returns a client error if p contains unknown fields or
+// visibility values.
+func validatePrivacy(p Privacy) error {
+	for field, v := range p {
+		if _, ok := defaultPrivacy[field]; !ok {
+			return errors.NewClientf("visibility cannot be set for '%s'", field)
+		}
+		if v != "" && !in(v, visibilityLevels) {
+			return errors.NewClientf("invalid visibility '%s' for '%s', expected"+
+				" one of %v", v, field, visibilityLevels)
+		}
+	}
+	return nil
+}
+
+// relation describes how a caller relates to the owner of a profile, from
+// least to most privileged.
+type relation int
+
+const (
+	relationAnonymous relation = iota
+	relationAuthenticated
+	relationConnection
+	relationSelf
+)
+
+// canView returns true if a caller with relation rel can view field.
+func (p Privacy) canView(field string, rel relation) bool {
+	v := p.Visibility(field)
+	for level, levelV := range visibilityLevels {
+		if v == levelV {
+			return int(rel) >= level
+		}
+	}
+	return rel == relationSelf
+}
+
+// hasConnectionsOnly returns true if any field is visible to connections
+// but not to every authenticated caller.
+func (p Privacy) hasConnectionsOnly() bool {
+	for field := range defaultPrivacy {
+		if p.Visibility(field) == VisibilityConnections {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package user
+
+import (
+	"testing"
+)
+
+func TestPrivacy_canView(t *testing.T) {
+	tt := []struct {
+		name    string
+		privacy Privacy
+		field   string
+		rel     relation
+		expView bool
+	}{
+		{name: "default public anonymous", field: FieldName, rel: relationAnonymous, expView: true},
+		{name: "default authenticated anonymous", field: FieldICEPhone, rel: relationAnonymous, expView: false},
+		{name: "default authenticated authenticated", field: FieldICEPhone, rel: relationAuthenticated, expView: true},
+		{name: "connections authenticated", privacy: Privacy{FieldICEPhone: VisibilityConnections}, field: FieldICEPhone, rel: relationAuthenticated, expView: false},
+		{name: "connections connection", privacy: Privacy{FieldICEPhone: VisibilityConnections}, field: FieldICEPhone, rel: relationConnection, expView: true},
+		{name: "private connection", privacy: Privacy{FieldName: VisibilityPrivate}, field: FieldName, rel: relationConnection, expView: false},
+		{name: "private self", privacy: Privacy{FieldName: VisibilityPrivate}, field: FieldName, rel: relationSelf, expView: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.privacy.canView(tc.field, tc.rel); got != tc.expView {
+				t.Errorf("Expected %t, got %t", tc.expView, got)
+			}
+		})
+	}
+}
+
+func TestValidatePrivacy(t *testing.T) {
+	tt := []struct {
+		name    string
+		privacy Privacy
+		expErr  bool
+	}{
+		{name: "valid", privacy: Privacy{FieldICEPhone: VisibilityPrivate, FieldBio: ""}},
+		{name: "unknown field", privacy: Privacy{"rating": VisibilityPrivate}, expErr: true},
+		{name: "unknown visibility", privacy: Privacy{FieldBio: "friends"}, expErr: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validatePrivacy(tc.privacy)
+			if tc.expErr != (err != nil) {
+				t.Errorf("Expected error %t, got %v", tc.expErr, err)
+			}
+		})
+	}
+}
+
+func TestManager_project(t *testing.T) {
+	usr := &User{
+		ID:       "123",
+		Name:     "Jane",
+		ICEPhone: "+254712345678",
+		Gender:   "FEMALE",
+		Bio:      "About Jane",
+		Rating:   4.5,
+		Privacy:  Privacy{FieldName: VisibilityAuthenticated, FieldBio: VisibilityConnections},
+	}
+	m := &Manager{}
+
+	anon := m.project(usr, relationAnonymous)
+	if anon.ID != usr.ID || anon.Name != "" || anon.ICEPhone != "" || anon.Rating != 0 {
+		t.Errorf("Anonymous projection exposed private values: %+v", anon)
+	}
+
+	auth := m.project(usr, relationAuthenticated)
+	if auth.Name != usr.Name || auth.ICEPhone != usr.ICEPhone || auth.Bio != "" || auth.Privacy != nil {
+		t.Errorf("Unexpected authenticated projection: %+v", auth)
+	}
+
+	conn := m.project(usr, relationConnection)
+	if conn.Bio != usr.Bio {
+		t.Errorf("Expected connection to view bio, got %+v", conn)
+	}
+
+	if self := m.project(usr, relationSelf); self.Privacy == nil {
+		t.Errorf("Expected self to view privacy settings, got %+v", self)
+	}
+}
@@ -0,0 +1,63 @@
+package user
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tomogoma/go-typed-errors"
+)
+
+// localeRegexp matches BCP 47 language tags of the form
+// language[-Script][-REGION] e.g. sw, en-KE, zh-Hant-TW or es-419.
+var localeRegexp = regexp.MustCompile(`^([a-zA-Z]{2,3})(-[a-zA-Z]{4})?(-[a-zA-Z]{2}|-[0-9]{3})?$`)
+
+// normalizeRegion upper-cases regionCode and validates that it is a
+// supported ISO 3166-1 alpha-2 region code. field names the value in error
+// messages.
+func (m *Manager) normalizeRegion(field, regionCode string) (string, error) {
+	regionCode = strings.ToUpper(regionCode)
+	if !m.pf.IsValidRegion(regionCode) {
+		return "", errors.NewClientf("invalid %s '%s', expected an ISO 3166-1"+
+			" alpha-2 code e.g. KE", field, regionCode)
+	}
+	return regionCode, nil
+}
+
+// normalizeLocale validates locale and returns it in its conventional case
+// e.g. en-ke becomes en-KE.
+func normalizeLocale(locale string) (string, error) {
+	parts := localeRegexp.FindStringSubmatch(locale)
+	if parts == nil {
+		return "", errors.NewClientf("invalid locale '%s', expected a BCP 47"+
+			" language tag e.g. en-KE", locale)
+	}
+	normalized := strings.ToLower(parts[1])
+	if parts[2] != "" {
+		normalized += "-" + strings.ToUpper(parts[2][1:2]) + strings.ToLower(parts[2][2:])
+	}
+	return normalized + strings.ToUpper(parts[3]), nil
+}
+
+// validateTimezone returns a client error if tz is not an IANA time zone
+// name.
+func validateTimezone(tz string) error {
+	if tz == "Local" {
+		return errors.NewClientf("invalid timezone '%s'", tz)
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return errors.NewClientf("invalid timezone '%s', expected an IANA"+
+			" time zone name e.g. Africa/Nairobi", tz)
+	}
+	return nil
+}
+
+// phoneRegion returns the region to assume for phone numbers not in
+// international format: the per-request hint if provided, otherwise the
+// user's country. An empty value leaves the choice to FormatValidPhoner.
+func phoneRegion(hint, country string) string {
+	if hint != "" {
+		return hint
+	}
+	return country
+}
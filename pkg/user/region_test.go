@@ -0,0 +1,32 @@
+package user
+
+import (
+	"testing"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	tt := []struct {
+		name      string
+		locale    string
+		expLocale string
+		expErr    bool
+	}{
+		{name: "language", locale: "sw", expLocale: "sw"},
+		{name: "language region", locale: "en-ke", expLocale: "en-KE"},
+		{name: "language script region", locale: "ZH-hant-tw", expLocale: "zh-Hant-TW"},
+		{name: "numeric region", locale: "es-419", expLocale: "es-419"},
+		{name: "underscore", locale: "en_KE", expErr: true},
+		{name: "too long", locale: "english", expErr: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			locale, err := normalizeLocale(tc.locale)
+			if tc.expErr != (err != nil) {
+				t.Fatalf("Expected error %t, got %v", tc.expErr, err)
+			}
+			if locale != tc.expLocale {
+				t.Errorf("Expected %s, got %s", tc.expLocale, locale)
+			}
+		})
+	}
+}
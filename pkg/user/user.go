@@ -1,16 +1,102 @@
 package user
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/tomogoma/crdb"
+	"github.com/tomogoma/go-typed-errors"
+	"github.com/tomogoma/usersms/pkg/rating"
+)
+
+// Fields by which a list of users can be sorted (see Filter.Sort).
+const (
+	SortName        = "name"
+	SortRating      = "rating"
+	SortCreated     = "created"
+	SortLastUpdated = "lastUpdated"
+)
+
+// AnonymousUserID is the ID of the placeholder user that ratings given by an
+// erased user are re-assigned to.
+const AnonymousUserID = "anonymous"
+
+// Names of user fields as recorded in Change.Field.
+const (
+	FieldName      = "name"
+	FieldICEPhone  = "ICEPhone"
+	FieldGender    = "gender"
+	FieldAvatarURL = "avatarURL"
+	FieldBio       = "bio"
+	FieldHandle    = "handle"
+	FieldCountry   = "country"
+	FieldLocale    = "locale"
+	FieldTimezone  = "timezone"
+	FieldEmail     = "email"
+	// FieldEmailVerified and FieldICEPhoneVerified record the verification
+	// of Email and ICEPhone respectively. They cannot be updated directly.
+	FieldEmailVerified    = "emailVerified"
+	FieldICEPhoneVerified = "ICEPhoneVerified"
+)
+
+// maxFilterCount is the maximum number of users that can be fetched per
+// Filter.
+const maxFilterCount = 100
 
 type User struct {
-	ID          string
-	Name        string
-	Gender      string
-	ICEPhone    string
-	AvatarURL   string
-	Bio         string
-	Rating      float32
-	NumRaters   int64
+	ID       string
+	Handle   string
+	Name     string
+	Gender   string
+	ICEPhone string
+	// ICEPhoneVerified is true once the ICEPhone has been confirmed with
+	// a code sent to it (see Manager.VerifyICEPhone).
+	ICEPhoneVerified bool
+	AvatarURL        string
+	Bio              string
+	// Country is the user's ISO 3166-1 alpha-2 country code e.g. KE. It
+	// is the region assumed for the user's phone numbers.
+	Country string
+	// Locale is the user's preferred BCP 47 language tag e.g. en-KE.
+	Locale string
+	// Timezone is the user's IANA time zone name e.g. Africa/Nairobi.
+	Timezone string
+	// Email is the user's contact email. Only shown to other users once
+	// EmailVerified.
+	Email         string
+	EmailVerified bool
+	Rating        float32
+	NumRaters     int64
+	// NumFollowers and NumFollowing count the users following and followed
+	// by the user respectively.
+	NumFollowers int64
+	NumFollowing int64
+	// Followed is true if the caller follows the user. It is only set by
+	// Manager.User for authenticated callers other than the user.
+	Followed *bool
+	// Attributes contains the custom attribute values keyed by attribute
+	// name (see AttributeSpec).
+	Attributes map[string]interface{}
+	// Privacy contains the visibility settings the user has chosen for
+	// their profile fields.
+	Privacy Privacy
+	// Completeness is only provided to the user when fetching their own
+	// profile.
+	Completeness *Completeness
+	// HiddenFields lists the fields whose values are pending moderation
+	// and are therefore hidden from everyone except the user and staff
+	// (see ModerationModeHide).
+	HiddenFields []string
+	// HandleUpdated is the last time the user's unique (case insensitive)
+	// Handle was changed.
+	HandleUpdated time.Time
+	// MergedInto is the ID of the user this user was merged into (see
+	// Manager.Merge). Merged users are deactivated tombstones.
+	MergedInto string
+	// Deactivated and Erased are zero unless the user was deactivated or
+	// erased respectively.
+	Deactivated time.Time
+	Erased      time.Time
 	Created     time.Time
 	LastUpdated time.Time
 }
@@ -22,10 +108,257 @@ type StringUpdate struct {
 
 type UserUpdate struct {
 	UserID    string
+	Handle    StringUpdate
 	Name      StringUpdate
 	ICEPhone  StringUpdate
 	Gender    StringUpdate
 	AvatarURL StringUpdate
 	Bio       StringUpdate
-	Time      time.Time
+	Country   StringUpdate
+	Locale    StringUpdate
+	Timezone  StringUpdate
+	// Email, if changed, is stored as unverified and a verification token
+	// is sent to it.
+	Email StringUpdate
+	// PhoneRegion, if not empty, is the ISO 3166-1 alpha-2 region code
+	// assumed for the ICEPhone if it is not in international format. It
+	// takes precedence over the user's Country and is not stored.
+	PhoneRegion string
+	// Attributes contains the new custom attribute values keyed by
+	// attribute name. A nil value removes the attribute.
+	Attributes map[string]interface{}
+	// Privacy contains the new visibility values keyed by field name. An
+	// empty value reverts the field to its default visibility.
+	Privacy Privacy
+	Time    time.Time
+
+	// IfLastUpdated, if not zero, restricts the update to an existing user
+	// whose LastUpdated value is still IfLastUpdated. Otherwise the update
+	// fails with a PreconditionFailedError.
+	IfLastUpdated time.Time
+
+	// ActorUserID and ActorAccessLevel identify the JWT subject making
+	// the update.
+	ActorUserID      string
+	ActorAccessLevel float32
+
+	// Moderations contains the flagged values in the update (see
+	// WithContentChecker). They replace any pending moderations of the
+	// same fields, as do changes to those fields. It is set by
+	// Manager.Update.
+	Moderations []Moderation
+}
+
+// Change is a record of a single field update on a user's profile.
+type Change struct {
+	ID               string
+	UserID           string
+	Field            string
+	OldValue         string
+	NewValue         string
+	ActorUserID      string
+	ActorAccessLevel float32
+	Created          time.Time
+}
+
+// Export contains all the data held about a user.
+type Export struct {
+	User            User
+	RatingsGiven    []rating.Rating
+	RatingsReceived []rating.Rating
+	History         []Change
+	ICEContacts     []ICEContact
+	Generated       time.Time
+}
+
+// stringUpdate returns the update of the field named field (one of the
+// Field... values) in uu or nil if field is not a string field.
+func (uu *UserUpdate) stringUpdate(field string) *StringUpdate {
+	switch field {
+	case FieldHandle:
+		return &uu.Handle
+	case FieldName:
+		return &uu.Name
+	case FieldICEPhone:
+		return &uu.ICEPhone
+	case FieldGender:
+		return &uu.Gender
+	case FieldAvatarURL:
+		return &uu.AvatarURL
+	case FieldBio:
+		return &uu.Bio
+	case FieldCountry:
+		return &uu.Country
+	case FieldLocale:
+		return &uu.Locale
+	case FieldTimezone:
+		return &uu.Timezone
+	case FieldEmail:
+		return &uu.Email
+	default:
+		return nil
+	}
+}
+
+// Changes lists the fields in uu whose new values differ from their values in
+// current.
+func (uu UserUpdate) Changes(current User) []Change {
+	fields := []struct {
+		name     string
+		update   StringUpdate
+		oldValue string
+	}{
+		{name: FieldHandle, update: uu.Handle, oldValue: current.Handle},
+		{name: FieldName, update: uu.Name, oldValue: current.Name},
+		{name: FieldICEPhone, update: uu.ICEPhone, oldValue: current.ICEPhone},
+		{name: FieldGender, update: uu.Gender, oldValue: current.Gender},
+		{name: FieldAvatarURL, update: uu.AvatarURL, oldValue: current.AvatarURL},
+		{name: FieldBio, update: uu.Bio, oldValue: current.Bio},
+		{name: FieldCountry, update: uu.Country, oldValue: current.Country},
+		{name: FieldLocale, update: uu.Locale, oldValue: current.Locale},
+		{name: FieldTimezone, update: uu.Timezone, oldValue: current.Timezone},
+		{name: FieldEmail, update: uu.Email, oldValue: current.Email},
+	}
+	for name, newVal := range uu.Attributes {
+		fields = append(fields, struct {
+			name     string
+			update   StringUpdate
+			oldValue string
+		}{
+			name:     attrFieldPrefix + name,
+			update:   StringUpdate{IsUpdating: true, NewValue: attrString(newVal)},
+			oldValue: attrString(current.Attributes[name]),
+		})
+	}
+	for field, newVal := range uu.Privacy {
+		fields = append(fields, struct {
+			name     string
+			update   StringUpdate
+			oldValue string
+		}{
+			name:     privacyFieldPrefix + field,
+			update:   StringUpdate{IsUpdating: true, NewValue: newVal},
+			oldValue: current.Privacy[field],
+		})
+	}
+	var changes []Change
+	for _, f := range fields {
+		if !f.update.IsUpdating || f.update.NewValue == f.oldValue {
+			continue
+		}
+		changes = append(changes, Change{
+			UserID:           uu.UserID,
+			Field:            f.name,
+			OldValue:         f.oldValue,
+			NewValue:         f.update.NewValue,
+			ActorUserID:      uu.ActorUserID,
+			ActorAccessLevel: uu.ActorAccessLevel,
+			Created:          uu.Time,
+		})
+	}
+	return changes
+}
+
+// verifiedEmail returns the user's Email if it has been verified.
+func (u User) verifiedEmail() string {
+	if !u.EmailVerified {
+		return ""
+	}
+	return u.Email
+}
+
+// Filter describes a search/listing of users. Zero values are ignored.
+type Filter struct {
+	// NamePrefix matches users whose name starts with the value
+	// (case insensitive).
+	NamePrefix string
+	// Query matches users where every word in the value appears in the
+	// name or bio (case insensitive).
+	Query  string
+	Gender *crdb.Comparison
+	// Rating, Created and LastUpdated are combined with the AND operator
+	// e.g. a rating range is expressed as a >= and <= pair of comparisons.
+	Rating      []crdb.Comparison
+	Created     []crdb.Comparison
+	LastUpdated []crdb.Comparison
+	// Completeness compares the profile completeness score (0-100, see
+	// Completeness.Score) combined with the AND operator.
+	Completeness []crdb.Comparison
+	// CompletenessWeights is the contribution of each field to the
+	// completeness score. It is set by Manager.Search.
+	CompletenessWeights map[string]int
+	// Sort lists the Sort... values (e.g. SortName) to order by.
+	Sort *crdb.ColOrders
+	// GenderVisibleTo, if not empty, limits Gender matches to users whose
+	// gender has one of these visibilities (see Privacy). It is set by
+	// Manager.Search.
+	GenderVisibleTo []string
+	// ExcludeBlockersOf, if not empty, excludes users that have blocked
+	// the user with this ID. It is set by Manager.Search.
+	ExcludeBlockersOf string
+	// PublicOnly restricts text matches (NamePrefix and Query) to publicly
+	// accessible values.
+	PublicOnly bool
+	// IncludeDeactivated includes deactivated and erased users in the
+	// results.
+	IncludeDeactivated bool
+	Offset             int64
+	Count              int32
+}
+
+func (f Filter) Validate() error {
+	if f.Offset < 0 {
+		return errors.NewClientf("Offset must be >= 0")
+	}
+	if f.Count < 1 || f.Count > maxFilterCount {
+		return errors.NewClientf("Count must be in 1 <= count <= %d", maxFilterCount)
+	}
+	if f.Sort != nil {
+		if len(f.Sort.Cols) != len(f.Sort.Orders) {
+			return errors.NewClient("number of sort fields and sort orders not equal")
+		}
+		for i, col := range f.Sort.Cols {
+			if !in(fmt.Sprint(col), []string{SortName, SortRating, SortCreated, SortLastUpdated}) {
+				return errors.NewClientf("cannot sort by '%v'", col)
+			}
+			if !in(f.Sort.Orders[i], []string{crdb.OrderAsc, crdb.OrderDesc}) {
+				return errors.NewClientf("invalid sort order '%s'", f.Sort.Orders[i])
+			}
+		}
+	}
+	return nil
+}
+
+// validateVisible returns an error if f filters or sorts by values that a
+// non-staff caller with relation rel cannot view in the users returned (see
+// Manager.project). Gender is viewable depending on each user's Privacy so
+// gender matches are limited by setting GenderVisibleTo.
+func (f *Filter) validateVisible(rel relation) error {
+	if len(f.Completeness) > 0 {
+		return errors.New("only staff can filter by completeness")
+	}
+	if f.IncludeDeactivated {
+		return errors.New("only staff can include deactivated users")
+	}
+	if rel == relationAnonymous {
+		if len(f.Rating) > 0 || len(f.Created) > 0 || len(f.LastUpdated) > 0 {
+			return errors.New("a token is required to filter by rating or dates")
+		}
+		if f.Sort != nil {
+			for _, col := range f.Sort.Cols {
+				if fmt.Sprint(col) != SortName {
+					return errors.Newf("a token is required to sort by '%v'", col)
+				}
+			}
+		}
+	}
+	if f.Gender != nil {
+		f.GenderVisibleTo = nil
+		for level, v := range visibilityLevels {
+			if level <= int(rel) {
+				f.GenderVisibleTo = append(f.GenderVisibleTo, v)
+			}
+		}
+	}
+	return nil
 }
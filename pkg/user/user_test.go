@@ -0,0 +1,88 @@
+package user
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tomogoma/crdb"
+)
+
+func TestFilter_validateVisible(t *testing.T) {
+	tt := []struct {
+		name               string
+		f                  Filter
+		rel                relation
+		expErr             bool
+		expGenderVisibleTo []string
+	}{
+		{
+			name: "anonymous name",
+			f:    Filter{NamePrefix: "jo", Sort: &crdb.ColOrders{Cols: []interface{}{SortName}}},
+			rel:  relationAnonymous,
+		},
+		{
+			name:               "anonymous gender",
+			f:                  Filter{Gender: &crdb.Comparison{Op: crdb.OpET, Val: "female"}},
+			rel:                relationAnonymous,
+			expGenderVisibleTo: []string{VisibilityPublic},
+		},
+		{
+			name:   "anonymous rating",
+			f:      Filter{Rating: []crdb.Comparison{{Op: crdb.OpGT, Val: 3}}},
+			rel:    relationAnonymous,
+			expErr: true,
+		},
+		{
+			name:   "anonymous sort by created",
+			f:      Filter{Sort: &crdb.ColOrders{Cols: []interface{}{SortCreated}}},
+			rel:    relationAnonymous,
+			expErr: true,
+		},
+		{
+			name: "authenticated rating and dates",
+			f: Filter{
+				Rating:      []crdb.Comparison{{Op: crdb.OpGT, Val: 3}},
+				Created:     []crdb.Comparison{{Op: crdb.OpGT, Val: "2018-01-01"}},
+				LastUpdated: []crdb.Comparison{{Op: crdb.OpLT, Val: "2019-01-01"}},
+				Sort:        &crdb.ColOrders{Cols: []interface{}{SortRating}},
+			},
+			rel: relationAuthenticated,
+		},
+		{
+			name:               "authenticated gender",
+			f:                  Filter{Gender: &crdb.Comparison{Op: crdb.OpET, Val: "female"}},
+			rel:                relationAuthenticated,
+			expGenderVisibleTo: []string{VisibilityPublic, VisibilityAuthenticated},
+		},
+		{
+			name:   "authenticated completeness",
+			f:      Filter{Completeness: []crdb.Comparison{{Op: crdb.OpGT, Val: 50}}},
+			rel:    relationAuthenticated,
+			expErr: true,
+		},
+		{
+			name:   "authenticated deactivated",
+			f:      Filter{IncludeDeactivated: true},
+			rel:    relationAuthenticated,
+			expErr: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.f.validateVisible(tc.rel)
+			if tc.expErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateVisible: %v", err)
+			}
+			if !reflect.DeepEqual(tc.f.GenderVisibleTo, tc.expGenderVisibleTo) {
+				t.Errorf("Expected gender visible to %v, got %v",
+					tc.expGenderVisibleTo, tc.f.GenderVisibleTo)
+			}
+		})
+	}
+}